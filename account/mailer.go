@@ -0,0 +1,114 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/types"
+)
+
+const (
+	// JobVerifyEmail emails the payload's user a link to verify their
+	// address.
+	JobVerifyEmail = "account.verify_email"
+	// JobPasswordReset emails the payload's user a link to reset their
+	// password.
+	JobPasswordReset = "account.password_reset"
+)
+
+type translation struct {
+	verifySubject string
+	verifyIntro   string
+	verifyAction  string
+	resetSubject  string
+	resetIntro    string
+	resetAction   string
+}
+
+var translations = map[string]translation{
+	"en": {
+		verifySubject: "Verify your email address",
+		verifyIntro:   "Confirm that this is your email address to finish setting up your account.",
+		verifyAction:  "Verify email",
+		resetSubject:  "Reset your password",
+		resetIntro:    "Someone asked to reset your password. If it wasn't you, ignore this email; the link expires in an hour.",
+		resetAction:   "Reset password",
+	},
+	"fa": {
+		verifySubject: "نشانی ایمیل خود را تأیید کنید",
+		verifyIntro:   "برای تکمیل ساخت حساب، تأیید کنید که این نشانی ایمیل متعلق به شماست.",
+		verifyAction:  "تأیید ایمیل",
+		resetSubject:  "بازنشانی گذرواژه",
+		resetIntro:    "درخواست بازنشانی گذرواژه شما ثبت شد. اگر این درخواست از طرف شما نبوده، این ایمیل را نادیده بگیرید؛ این پیوند پس از یک ساعت منقضی می‌شود.",
+		resetAction:   "بازنشانی گذرواژه",
+	},
+}
+
+// Mailer sends the account emails queued by the auth handlers. Tokens are
+// signed when the email is sent, so they never sit in the job queue.
+type Mailer struct {
+	userStore db.UserStore
+	sender    mail.Sender
+	links     *mail.Links
+}
+
+func NewMailer(userStore db.UserStore, sender mail.Sender, links *mail.Links) *Mailer {
+	return &Mailer{
+		userStore: userStore,
+		sender:    sender,
+		links:     links,
+	}
+}
+
+func (m *Mailer) HandleVerifyEmail(ctx context.Context, job *types.Job) error {
+	user, err := m.userStore.GetUser(ctx, job.Payload["user"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified || len(user.Email) == 0 {
+		return nil
+	}
+	lang, tr := translate(user.Language)
+	msg, err := mail.Compose(user.Email, tr.verifySubject, mail.Content{
+		Lang:   lang,
+		Title:  tr.verifySubject,
+		Intro:  tr.verifyIntro,
+		Action: &mail.Item{Title: tr.verifyAction, Link: m.links.VerifyEmail(user.ID.Hex(), user.Email)},
+	})
+	if err != nil {
+		return err
+	}
+	return m.sender.Send(ctx, msg)
+}
+
+func (m *Mailer) HandlePasswordReset(ctx context.Context, job *types.Job) error {
+	user, err := m.userStore.GetUser(ctx, job.Payload["user"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lang, tr := translate(user.Language)
+	msg, err := mail.Compose(user.Email, tr.resetSubject, mail.Content{
+		Lang:   lang,
+		Title:  tr.resetSubject,
+		Intro:  tr.resetIntro,
+		Action: &mail.Item{Title: tr.resetAction, Link: m.links.ResetPassword(user.ID.Hex())},
+	})
+	if err != nil {
+		return err
+	}
+	return m.sender.Send(ctx, msg)
+}
+
+func translate(lang string) (string, translation) {
+	if tr, ok := translations[lang]; ok {
+		return lang, tr
+	}
+	return types.DefaultLanguage, translations[types.DefaultLanguage]
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"github.com/MiladJlz/blog_app/account"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+type AuthHandler struct {
+	userStore  db.UserStore
+	tokenStore db.TokenStore
+	signer     *token.Signer
+	jobs       queue.Enqueuer
+}
+
+func NewAuthHandler(userStore db.UserStore, tokenStore db.TokenStore, signer *token.Signer, jobs queue.Enqueuer) *AuthHandler {
+	return &AuthHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		signer:     signer,
+		jobs:       jobs,
+	}
+}
+
+// HandleVerifyEmail VerifyEmail verify email
+//
+//	@Summary	Verifying email address with the token from a verification email
+//	@Tags		Auth
+//	@Param		token	query	string	true	"Verification token"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/auth/verify-email [get]
+func (h *AuthHandler) HandleVerifyEmail(c *fiber.Ctx) error {
+	claims, err := h.redeem(c, mail.PurposeVerifyEmail, c.Query("token"))
+	if err != nil {
+		return err
+	}
+	userID, email, _ := strings.Cut(claims.Subject, " ")
+	err = h.userStore.MarkEmailVerified(c.Context(), userID, email)
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrBadRequest(errors.New("email address has changed since the token was sent"))
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"verified": email})
+}
+
+// HandleResendVerification ResendVerification resend verification email
+//
+//	@Summary	Sending a new verification email
+//	@Tags		Auth
+//	@Param		user	body	types.UserParam	true	"User to verify"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/auth/verify-email/resend [post]
+func (h *AuthHandler) HandleResendVerification(c *fiber.Ctx) error {
+	var param types.UserParam
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	if _, err := primitive.ObjectIDFromHex(param.UserID); err != nil {
+		return ErrBadRequest(err)
+	}
+	user, err := h.userStore.GetUser(c.Context(), param.UserID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return c.JSON(map[string]string{"verified": user.Email})
+	}
+	if _, err := h.jobs.Enqueue(c.Context(), account.JobVerifyEmail, map[string]string{"user": param.UserID}); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"sent": user.Email})
+}
+
+// HandleRequestPasswordReset RequestPasswordReset request password reset
+//
+//	@Summary	Emailing a password reset link. The response does not reveal whether the address is registered.
+//	@Tags		Auth
+//	@Param		email	body	types.PasswordResetRequestParams	true	"Account email"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/auth/password-reset [post]
+func (h *AuthHandler) HandleRequestPasswordReset(c *fiber.Ctx) error {
+	var params types.PasswordResetRequestParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	user, err := h.userStore.GetUserByEmail(c.Context(), params.Email)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if user != nil {
+		if _, err := h.jobs.Enqueue(c.Context(), account.JobPasswordReset, map[string]string{"user": user.ID.Hex()}); err != nil {
+			return err
+		}
+	}
+	return c.JSON(map[string]string{"requested": params.Email})
+}
+
+// HandleConfirmPasswordReset ConfirmPasswordReset confirm password reset
+//
+//	@Summary	Setting a new password with the token from a password reset email
+//	@Tags		Auth
+//	@Param		reset	body	types.PasswordResetParams	true	"Token and new password"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/auth/password-reset/confirm [post]
+func (h *AuthHandler) HandleConfirmPasswordReset(c *fiber.Ctx) error {
+	var params types.PasswordResetParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	claims, err := h.redeem(c, mail.PurposeResetPassword, params.Token)
+	if err != nil {
+		return err
+	}
+	oid, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.userStore.UpdateUser(c.Context(), db.UserFilter{ID: oid}, types.UpdateUserParams{Password: params.Password}); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"reset": claims.Subject})
+}
+
+// redeem verifies a single-use token and marks it used.
+func (h *AuthHandler) redeem(c *fiber.Ctx, purpose string, tok string) (*token.Claims, error) {
+	claims, err := h.signer.Parse(purpose, tok)
+	if err != nil {
+		return nil, ErrBadRequest(err)
+	}
+	err = h.tokenStore.UseToken(c.Context(), claims.ID, claims.Expires)
+	if errors.Is(err, db.ErrTokenUsed) {
+		return nil, ErrBadRequest(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,151 @@
+package api_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/account"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authFixture struct {
+	app    *fiber.App
+	users  *db.MemoryUserStore
+	jobs   *recordingJobs
+	signer *token.Signer
+	user   *types.User
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	sqlDB, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	f := &authFixture{
+		users:  db.NewMemoryUserStore(),
+		jobs:   &recordingJobs{},
+		signer: token.NewSigner([]byte("secret")),
+	}
+	f.user, err = f.users.InsertUser(context.Background(), types.NewUserFromImport(types.ImportUserParams{FirstName: "foo", Email: "foo@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	handler := api.NewAuthHandler(f.users, db.NewSQLiteTokenStore(sqlDB), f.signer, f.jobs)
+	f.app = fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	f.app.Get("/auth/verify-email", handler.HandleVerifyEmail)
+	f.app.Post("/auth/verify-email/resend", handler.HandleResendVerification)
+	f.app.Post("/auth/password-reset/confirm", handler.HandleConfirmPasswordReset)
+	return f
+}
+
+func (f *authFixture) getUser(t *testing.T) *types.User {
+	t.Helper()
+	user, err := f.users.GetUser(context.Background(), f.user.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	return user
+}
+
+func (f *authFixture) verifyToken(email string, ttl time.Duration) string {
+	return f.signer.Sign(mail.PurposeVerifyEmail, mail.VerifyEmailSubject(f.user.ID.Hex(), email), ttl)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	f := newAuthFixture(t)
+	verify := func(tok string) int {
+		return do(t, f.app, http.MethodGet, "/auth/verify-email?token="+tok, "", nil).StatusCode
+	}
+	tok := f.verifyToken(f.user.Email, time.Hour)
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"an expired token", f.verifyToken(f.user.Email, -time.Minute), http.StatusBadRequest},
+		{"a password reset token", f.signer.Sign(mail.PurposeResetPassword, f.user.ID.Hex(), time.Hour), http.StatusBadRequest},
+		{"a tampered token", tok + "x", http.StatusBadRequest},
+		{"a valid token", tok, http.StatusOK},
+		{"the same token again", tok, http.StatusBadRequest},
+	} {
+		if got := verify(tc.token); got != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	if !f.getUser(t).EmailVerified {
+		t.Fatal("the address is not verified")
+	}
+	resend := `{"userID":"` + f.user.ID.Hex() + `"}`
+	if resp := do(t, f.app, http.MethodPost, "/auth/verify-email/resend", resend, nil); resp.StatusCode != http.StatusOK || len(f.jobs.jobs) != 0 {
+		t.Errorf("resending to a verified address: got status %d and %d jobs, want 200 and none", resp.StatusCode, len(f.jobs.jobs))
+	}
+
+	// A new address has to be verified again, and not by a token sent to
+	// the old one.
+	unused := f.verifyToken(f.user.Email, time.Hour)
+	err := f.users.UpdateUser(context.Background(), db.UserFilter{ID: f.user.ID}, types.UpdateUserParams{Email: "new@blog.test"})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if f.getUser(t).EmailVerified {
+		t.Fatal("a changed address is still verified")
+	}
+	if resp := do(t, f.app, http.MethodPost, "/auth/verify-email/resend", resend, nil); resp.StatusCode != http.StatusOK ||
+		len(f.jobs.jobs) != 1 || f.jobs.jobs[0].Type != account.JobVerifyEmail {
+		t.Errorf("resending to a changed address: got status %d and jobs %+v, want a verification email queued", resp.StatusCode, f.jobs.jobs)
+	}
+	if got := verify(unused); got != http.StatusBadRequest {
+		t.Errorf("a token for the old address: got status %d, want 400", got)
+	}
+	if f.getUser(t).EmailVerified {
+		t.Error("a token for the old address verified the new one")
+	}
+	if got := verify(f.verifyToken("new@blog.test", time.Hour)); got != http.StatusOK {
+		t.Errorf("a token for the new address: got status %d, want 200", got)
+	}
+	if !f.getUser(t).EmailVerified {
+		t.Error("the new address is not verified")
+	}
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	f := newAuthFixture(t)
+	reset := func(tok string, password string) int {
+		body := `{"token":"` + tok + `","password":"` + password + `"}`
+		return do(t, f.app, http.MethodPost, "/auth/password-reset/confirm", body, nil).StatusCode
+	}
+	tok := f.signer.Sign(mail.PurposeResetPassword, f.user.ID.Hex(), time.Hour)
+	for _, tc := range []struct {
+		name     string
+		token    string
+		password string
+		want     int
+	}{
+		{"an expired token", f.signer.Sign(mail.PurposeResetPassword, f.user.ID.Hex(), -time.Minute), "expiredpassword", http.StatusBadRequest},
+		{"a verification token", f.verifyToken(f.user.Email, time.Hour), "wrongpurpose", http.StatusBadRequest},
+		{"a valid token", tok, "verysecurepassword", http.StatusOK},
+		{"the same token again", tok, "anotherpassword", http.StatusBadRequest},
+	} {
+		if got := reset(tc.token, tc.password); got != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	user := f.getUser(t)
+	if !user.IsValidPassword("verysecurepassword") {
+		t.Error("the password was not reset")
+	}
+	for _, password := range []string{"expiredpassword", "wrongpurpose", "anotherpassword"} {
+		if user.IsValidPassword(password) {
+			t.Errorf("the password was set to %q by a rejected token", password)
+		}
+	}
+}
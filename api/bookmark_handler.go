@@ -0,0 +1,396 @@
+package api
+
+import (
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookmarkHandler struct {
+	bookmarkStore db.BookmarkStore
+	postStore     db.PostStore
+	userStore     db.UserStore
+}
+
+func NewBookmarkHandler(bookmarkStore db.BookmarkStore, postStore db.PostStore, userStore db.UserStore) *BookmarkHandler {
+	return &BookmarkHandler{
+		bookmarkStore: bookmarkStore,
+		postStore:     postStore,
+		userStore:     userStore,
+	}
+}
+
+// HandlePutBookmark AddBookmark bookmark post
+//
+//	@Summary	Bookmarking Post
+//	@Tags		Bookmarks
+//	@Param		post	postID	path			types.PathParameter	true	"ID of post"
+//	@Param		user	body	types.UserParam	true				"User bookmarking the post"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/post/{id}/bookmark [put]
+func (h *BookmarkHandler) HandlePutBookmark(c *fiber.Ctx) error {
+	var (
+		param  types.UserParam
+		postID = c.Params("id")
+	)
+	_, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	if _, err := h.postStore.GetPostByID(c.Context(), postID); err != nil {
+		return err
+	}
+	if err := h.bookmarkStore.AddBookmark(c.Context(), param.UserID, postID); err != nil {
+		return ErrBadRequest(err)
+	}
+	return c.JSON(map[string]string{"bookmarked": postID})
+}
+
+// HandleDeleteBookmark RemoveBookmark remove bookmark
+//
+//	@Summary	Removing Bookmark
+//	@Tags		Bookmarks
+//	@Param		post	postID	path			types.PathParameter	true	"ID of post"
+//	@Param		user	body	types.UserParam	true				"User removing the bookmark"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/post/{id}/bookmark [delete]
+func (h *BookmarkHandler) HandleDeleteBookmark(c *fiber.Ctx) error {
+	var (
+		param  types.UserParam
+		postID = c.Params("id")
+	)
+	_, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.bookmarkStore.RemoveBookmark(c.Context(), param.UserID, postID); err != nil {
+		return ErrBadRequest(err)
+	}
+	return c.JSON(map[string]string{"unbookmarked": postID})
+}
+
+// HandleGetBookmarks GetBookmarks get bookmarked posts
+//
+//	@Summary	Getting bookmarked posts of given user id, newest bookmark first
+//	@Tags		Bookmarks
+//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Posts per page"
+//	@Produce	json
+//	@Success	200	{array}		types.PostView
+//	@Failure	400	{string}	string
+//	@Router		/user/{id}/bookmarks [get]
+func (h *BookmarkHandler) HandleGetBookmarks(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	bookmarks, err := h.bookmarkStore.GetBookmarks(c.Context(), userID, page, limit)
+	if err != nil {
+		return err
+	}
+	viewer, err := h.userStore.GetViewer(c.Context(), oid)
+	if err != nil {
+		return err
+	}
+	ids := make([]primitive.ObjectID, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		ids = append(ids, bookmark.Post)
+	}
+	views, err := h.renderPostsInOrder(c, ids, viewer)
+	if err != nil {
+		return err
+	}
+	return c.JSON(views)
+}
+
+// HandleInsertReadingList InsertReadingList insert reading list
+//
+//	@Summary	Creating reading list for given user id
+//	@Tags		Bookmarks
+//	@Param		user	userID	path							types.PathParameter	true	"ID of owner"
+//	@Param		list	body	types.CreateReadingListParams	true				"New reading list"
+//	@Produce	json
+//	@Success	201	{object}	types.ReadingList
+//	@Failure	400	{string}	string
+//	@Failure	500	{string}	string
+//	@Router		/user/{id}/lists [post]
+func (h *BookmarkHandler) HandleInsertReadingList(c *fiber.Ctx) error {
+	var (
+		params types.CreateReadingListParams
+		userID = c.Params("id")
+	)
+	owner, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	list, err := h.bookmarkStore.InsertReadingList(c.Context(), types.NewReadingListFromParams(params, owner))
+	if err != nil {
+		return err
+	}
+	return c.JSON(list)
+}
+
+// HandleGetReadingLists GetReadingLists get reading lists
+//
+//	@Summary	Getting reading lists of given user id; private lists only for their owner
+//	@Tags		Bookmarks
+//	@Param		user	userID	path	types.PathParameter	true	"ID of owner"
+//	@Param		viewer	query	string	false				"ID of user viewing the lists"
+//	@Produce	json
+//	@Success	200	{array}		types.ReadingList
+//	@Failure	400	{string}	string
+//	@Router		/user/{id}/lists [get]
+func (h *BookmarkHandler) HandleGetReadingLists(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	lists, err := h.bookmarkStore.GetReadingListsByOwner(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	visible := []*types.ReadingList{}
+	for _, list := range lists {
+		if list.VisibleTo(c.Query("viewer")) {
+			visible = append(visible, list)
+		}
+	}
+	return c.JSON(visible)
+}
+
+// HandleGetReadingList GetReadingList get reading list
+//
+//	@Summary	Getting reading list with its posts
+//	@Tags		Bookmarks
+//	@Param		list	listID	path	types.PathParameter	true	"ID of reading list"
+//	@Param		viewer	query	string	false				"ID of user viewing the list"
+//	@Produce	json
+//	@Success	200	{object}	types.ReadingListView
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/list/{id} [get]
+func (h *BookmarkHandler) HandleGetReadingList(c *fiber.Ctx) error {
+	listID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	list, err := h.bookmarkStore.GetReadingList(c.Context(), listID)
+	if err != nil {
+		return err
+	}
+	// private lists are hidden rather than forbidden so their existence is not leaked
+	if !list.VisibleTo(c.Query("viewer")) {
+		return ErrNotResourceNotFound(fmt.Errorf("reading list %s", listID))
+	}
+	viewer, err := parseViewer(c, h.userStore)
+	if err != nil {
+		return err
+	}
+	items, err := h.renderPostsInOrder(c, list.Posts, viewer)
+	if err != nil {
+		return err
+	}
+	return c.JSON(types.ReadingListView{ReadingList: list, Items: items})
+}
+
+// HandlePutReadingList UpdateReadingList update reading list
+//
+//	@Summary	Updating reading list
+//	@Tags		Bookmarks
+//	@Param		list	listID	path							types.PathParameter	true	"ID of reading list"
+//	@Param		list	body	types.UpdateReadingListParams	true				"Changes, made by the owner"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	403	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/list/{id} [put]
+func (h *BookmarkHandler) HandlePutReadingList(c *fiber.Ctx) error {
+	var (
+		params types.UpdateReadingListParams
+		listID = c.Params("id")
+	)
+	oid, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	if _, err := h.ownedReadingList(c, listID, params.UserID); err != nil {
+		return err
+	}
+	if err := h.bookmarkStore.UpdateReadingList(c.Context(), oid, params); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"updated": listID})
+}
+
+// HandleDeleteReadingList DeleteReadingList delete reading list
+//
+//	@Summary	Deleting reading list
+//	@Tags		Bookmarks
+//	@Param		list	listID	path			types.PathParameter	true	"ID of reading list"
+//	@Param		user	body	types.UserParam	true				"Owner of the list"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	403	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/list/{id} [delete]
+func (h *BookmarkHandler) HandleDeleteReadingList(c *fiber.Ctx) error {
+	var (
+		param  types.UserParam
+		listID = c.Params("id")
+	)
+	_, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	if _, err := h.ownedReadingList(c, listID, param.UserID); err != nil {
+		return err
+	}
+	if err := h.bookmarkStore.DeleteReadingList(c.Context(), listID); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"deleted": listID})
+}
+
+// HandleAddToReadingList AddToReadingList add post to reading list
+//
+//	@Summary	Adding post to reading list
+//	@Tags		Bookmarks
+//	@Param		list	listID	path						types.PathParameter	true	"ID of reading list"
+//	@Param		post	body	types.ReadingListPostParams	true				"Post to add, by the owner"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	403	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/list/{id}/post [put]
+func (h *BookmarkHandler) HandleAddToReadingList(c *fiber.Ctx) error {
+	var (
+		params types.ReadingListPostParams
+		listID = c.Params("id")
+	)
+	_, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if _, err := h.ownedReadingList(c, listID, params.UserID); err != nil {
+		return err
+	}
+	if _, err := h.postStore.GetPostByID(c.Context(), params.PostID); err != nil {
+		return err
+	}
+	if err := h.bookmarkStore.AddToReadingList(c.Context(), listID, params.PostID); err != nil {
+		return ErrBadRequest(err)
+	}
+	return c.JSON(map[string]string{"added": params.PostID})
+}
+
+// HandleRemoveFromReadingList RemoveFromReadingList remove post from reading list
+//
+//	@Summary	Removing post from reading list
+//	@Tags		Bookmarks
+//	@Param		list	listID	path			types.PathParameter	true	"ID of reading list"
+//	@Param		post	postID	path			types.PathParameter	true	"ID of post"
+//	@Param		user	body	types.UserParam	true				"Owner of the list"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	403	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/list/{id}/post/{postID} [delete]
+func (h *BookmarkHandler) HandleRemoveFromReadingList(c *fiber.Ctx) error {
+	var (
+		param  types.UserParam
+		listID = c.Params("id")
+		postID = c.Params("postID")
+	)
+	_, err := primitive.ObjectIDFromHex(listID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	if _, err := h.ownedReadingList(c, listID, param.UserID); err != nil {
+		return err
+	}
+	if err := h.bookmarkStore.RemoveFromReadingList(c.Context(), listID, postID); err != nil {
+		return ErrBadRequest(err)
+	}
+	return c.JSON(map[string]string{"removed": postID})
+}
+
+func (h *BookmarkHandler) ownedReadingList(c *fiber.Ctx, listID string, userID string) (*types.ReadingList, error) {
+	list, err := h.bookmarkStore.GetReadingList(c.Context(), listID)
+	if err != nil {
+		return nil, err
+	}
+	if list.Owner.Hex() != userID {
+		return nil, ErrForbidden()
+	}
+	return list, nil
+}
+
+// renderPostsInOrder loads the posts with the given ids and renders them in
+// the same order, skipping posts that no longer exist or that viewer may not
+// read.
+func (h *BookmarkHandler) renderPostsInOrder(c *fiber.Ctx, ids []primitive.ObjectID, viewer *types.Viewer) ([]*types.PostView, error) {
+	if len(ids) == 0 {
+		return []*types.PostView{}, nil
+	}
+	found, err := h.postStore.GetPostsByIDs(c.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[primitive.ObjectID]*types.Post{}
+	for _, post := range found {
+		byID[post.ID] = post
+	}
+	posts := make([]*types.Post, 0, len(ids))
+	for _, id := range ids {
+		if post, ok := byID[id]; ok && viewer.CanSee(post) {
+			posts = append(posts, post)
+		}
+	}
+	return renderPosts(c.Context(), h.postStore, *viewer, posts)
+}
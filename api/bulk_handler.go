@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/MiladJlz/blog_app/bulk"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/gofiber/fiber/v2"
+	"slices"
+)
+
+type BulkHandler struct {
+	userStore db.UserStore
+	postStore db.PostStore
+}
+
+func NewBulkHandler(userStore db.UserStore, postStore db.PostStore) *BulkHandler {
+	return &BulkHandler{
+		userStore: userStore,
+		postStore: postStore,
+	}
+}
+
+// HandleImport Import import users and posts
+//
+//	@Summary		Importing users and posts
+//	@Description	The body is the file to import, or for markdown a zip archive of the directory. Imports larger than the body limit go through the import command.
+//	@Tags			Admin
+//	@Param			format	query	string	true	"jsonl, csv, wxr or markdown"
+//	@Accept			octet-stream
+//	@Produce		json
+//	@Success		200	{object}	bulk.Report
+//	@Failure		400	{string}	string
+//	@Router			/admin/import [post]
+func (h *BulkHandler) HandleImport(c *fiber.Ctx) error {
+	format, err := parseFormat(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	records, err := bulk.Decode(format, bytes.NewReader(c.Body()))
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	report := bulk.NewImporter(h.userStore, h.postStore).Import(c.Context(), records)
+	return c.JSON(report)
+}
+
+// HandleExport Export export users and posts
+//
+//	@Summary		Exporting users and posts
+//	@Description	Reposts and quotes are left out. Markdown comes as a zip archive of the directory.
+//	@Tags			Admin
+//	@Param			format	query	string	true	"jsonl, csv, wxr or markdown"
+//	@Produce		octet-stream
+//	@Success		200	{file}		file
+//	@Failure		400	{string}	string
+//	@Router			/admin/export [get]
+func (h *BulkHandler) HandleExport(c *fiber.Ctx) error {
+	format, err := parseFormat(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	records, err := bulk.Export(c.Context(), h.userStore, h.postStore)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := bulk.Encode(format, &buf, records); err != nil {
+		return err
+	}
+	// Attachment guesses the content type from the extension, and gets
+	// .jsonl wrong, so the format's own is set after it
+	c.Attachment(bulk.FileName(format))
+	c.Set(fiber.HeaderContentType, bulk.ContentType(format))
+	return c.Send(buf.Bytes())
+}
+
+func parseFormat(c *fiber.Ctx) (string, error) {
+	format := c.Query("format")
+	if !slices.Contains(bulk.Formats, format) {
+		return "", fmt.Errorf("format %q is invalid", format)
+	}
+	return format, nil
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/MiladJlz/blog_app/cache"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CacheHandler reports on the caching user and post stores, either of which
+// is nil when caching is off.
+type CacheHandler struct {
+	userStore *cache.UserStore
+	postStore *cache.PostStore
+}
+
+func NewCacheHandler(userStore *cache.UserStore, postStore *cache.PostStore) *CacheHandler {
+	return &CacheHandler{
+		userStore: userStore,
+		postStore: postStore,
+	}
+}
+
+// HandleGetCacheStats GetCacheStats get cache statistics
+//
+//	@Summary	Getting cache hits, misses and errors since startup, for users and posts
+//	@Tags		Admin
+//	@Produce	json
+//	@Success	200	{object}	map[string]cache.Report
+//	@Router		/admin/cache [get]
+func (h *CacheHandler) HandleGetCacheStats(c *fiber.Ctx) error {
+	stats := map[string]cache.Report{}
+	if h.userStore != nil {
+		stats["users"] = h.userStore.Stats()
+	}
+	if h.postStore != nil {
+		stats["posts"] = h.postStore.Stats()
+	}
+	return c.JSON(stats)
+}
@@ -1,15 +1,29 @@
 package api
 
 import (
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
 	"github.com/gofiber/fiber/v2"
 	"net/http"
 )
 
+// ErrorHandler responds with the status an Error carries. Handlers return
+// store errors as they are, and the store's sentinel errors are mapped here.
 func ErrorHandler(c *fiber.Ctx, err error) error {
-	if apiError, ok := err.(Error); ok {
-		return c.Status(apiError.Code).JSON(apiError)
+	var apiError Error
+	switch {
+	case errors.As(err, &apiError):
+	case errors.Is(err, db.ErrNotFound):
+		apiError = ErrNotResourceNotFound(err)
+	case errors.Is(err, db.ErrConflict):
+		apiError = ErrConflict(err)
+	case errors.Is(err, db.ErrInvalidID):
+		apiError = ErrBadRequest(err)
+	case errors.Is(err, db.ErrVersionMismatch):
+		apiError = ErrPreconditionFailed(err)
+	default:
+		apiError = NewError(http.StatusInternalServerError, err.Error())
 	}
-	apiError := NewError(http.StatusInternalServerError, err.Error())
 	return c.Status(apiError.Code).JSON(apiError)
 }
 
@@ -42,3 +56,38 @@ func ErrBadRequest(err error) Error {
 		Err:  "invalid JSON request -> " + err.Error(),
 	}
 }
+
+func ErrConflict(err error) Error {
+	return Error{
+		Code: http.StatusConflict,
+		Err:  "conflict -> " + err.Error(),
+	}
+}
+
+func ErrPreconditionFailed(err error) Error {
+	return Error{
+		Code: http.StatusPreconditionFailed,
+		Err:  "precondition failed -> " + err.Error(),
+	}
+}
+
+func ErrForbidden() Error {
+	return Error{
+		Code: http.StatusForbidden,
+		Err:  "forbidden",
+	}
+}
+
+func ErrUnverified() Error {
+	return Error{
+		Code: http.StatusForbidden,
+		Err:  "email address not verified",
+	}
+}
+
+func ErrUnauthorized(err error) Error {
+	return Error{
+		Code: http.StatusUnauthorized,
+		Err:  "unauthorized -> " + err.Error(),
+	}
+}
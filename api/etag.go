@@ -0,0 +1,71 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+)
+
+// Posts and users are served with their version as ETag. Clients revalidate
+// their copy with If-None-Match, and send If-Match with a write so that it
+// fails rather than overwrite an edit they have not seen.
+//
+// The tags are weak: the version only counts edits, so counters such as a
+// post's views and the parts rendered for each viewer change under the same
+// tag. If-Match compares strongly, so a write names the version it edits as
+// a strong tag, "3" for a document served as W/"3".
+
+func etag(version int64) string {
+	return `W/"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// notModified sets the ETag of a response carrying a document at version and
+// reports whether If-None-Match names it, in which case the handler answers
+// 304 Not Modified instead. Tags compare weakly, as RFC 9110 has it.
+func notModified(c *fiber.Ctx, version int64) bool {
+	tag := etag(version)
+	c.Set(fiber.HeaderETag, tag)
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if len(header) == 0 {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || weakTag(candidate) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// weakTag returns tag in its weak form.
+func weakTag(tag string) string {
+	if strings.HasPrefix(tag, "W/") {
+		return tag
+	}
+	return "W/" + tag
+}
+
+// ifMatch returns the version If-Match requires the document to be at, or 0
+// if there is no If-Match or it is "*". As RFC 9110 has it, a weak tag never
+// matches.
+func ifMatch(c *fiber.Ctx) (int64, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if len(header) == 0 || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, ErrBadRequest(errors.New("If-Match takes a single entity tag"))
+	}
+	if strings.HasPrefix(header, "W/") {
+		return 0, ErrPreconditionFailed(errors.New("If-Match " + header + " is weak; send the version as a strong tag"))
+	}
+	unquoted, opened := strings.CutPrefix(header, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if !opened || !closed || err != nil || version < 1 {
+		return 0, ErrPreconditionFailed(errors.New("If-Match " + header + " is not a version"))
+	}
+	return version, nil
+}
@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// discardJobs accepts every job and runs none.
+type discardJobs struct{}
+
+func (discardJobs) Enqueue(ctx context.Context, jobType string, payload map[string]string) (*types.Job, error) {
+	return &types.Job{Type: jobType, Payload: payload}, nil
+}
+
+func newPostApp(t *testing.T) (*fiber.App, *db.MemoryPostStore, *types.Post) {
+	t.Helper()
+	posts := db.NewMemoryPostStore()
+	users := db.NewMemoryUserStore()
+	author, err := users.InsertUser(context.Background(), types.NewUserFromImport(types.ImportUserParams{FirstName: "foo", Email: "foo@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	post, err := posts.InsertPost(context.Background(), types.NewPostFromParams(types.CreatePostParams{Content: "First", Author: author.ID.Hex()}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	handler := api.NewPostHandler(posts, users, discardJobs{}, api.Restrictions{})
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Get("/post/:id", handler.HandleGetPost)
+	app.Put("/post/:id", handler.HandlePutPost)
+	return app, posts, post
+}
+
+func do(t *testing.T, app *fiber.App, method string, path string, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(body) > 0 {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestGetPostETag(t *testing.T) {
+	app, posts, post := newPostApp(t)
+	path := "/post/" + post.ID.Hex()
+
+	resp := do(t, app, http.MethodGet, path, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET: got status %d", resp.StatusCode)
+	}
+	tag := resp.Header.Get(fiber.HeaderETag)
+	if tag != `W/"1"` {
+		t.Fatalf("ETag: got %q, want W/\"1\"", tag)
+	}
+	for _, candidate := range []string{tag, `"1"`, `"7", W/"1"`, "*"} {
+		resp := do(t, app, http.MethodGet, path, "", map[string]string{fiber.HeaderIfNoneMatch: candidate})
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: got status %d, want 304", candidate, resp.StatusCode)
+		}
+	}
+	if resp := do(t, app, http.MethodGet, path, "", map[string]string{fiber.HeaderIfNoneMatch: `W/"2"`}); resp.StatusCode != http.StatusOK {
+		t.Errorf("If-None-Match of another version: got status %d, want 200", resp.StatusCode)
+	}
+
+	got, err := posts.GetPostByID(context.Background(), post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	if got.Stats.Views != 2 {
+		t.Errorf("views: got %d, want 2, as 304s are not views", got.Stats.Views)
+	}
+}
+
+func TestPutPostIfMatch(t *testing.T) {
+	app, _, post := newPostApp(t)
+	path := "/post/" + post.ID.Hex()
+	for _, tc := range []struct {
+		ifMatch string
+		want    int
+		etag    string
+	}{
+		{`W/"1"`, http.StatusPreconditionFailed, ""},
+		{`"1"`, http.StatusOK, `W/"2"`},
+		{`"2"`, http.StatusOK, `W/"3"`},
+		{`"1"`, http.StatusPreconditionFailed, ""},
+		{`W/"3"`, http.StatusPreconditionFailed, ""},
+		{`"abc"`, http.StatusPreconditionFailed, ""},
+		{`"3", "4"`, http.StatusBadRequest, ""},
+		{"*", http.StatusOK, `W/"4"`},
+		{"", http.StatusOK, `W/"5"`},
+	} {
+		resp := do(t, app, http.MethodPut, path, `{"content":"Edited"}`, map[string]string{fiber.HeaderIfMatch: tc.ifMatch})
+		if resp.StatusCode != tc.want {
+			t.Errorf("If-Match %s: got status %d, want %d", tc.ifMatch, resp.StatusCode, tc.want)
+			continue
+		}
+		if got := resp.Header.Get(fiber.HeaderETag); got != tc.etag {
+			t.Errorf("If-Match %s: got ETag %q, want %q", tc.ifMatch, got, tc.etag)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type JobHandler struct {
+	jobStore db.JobStore
+}
+
+func NewJobHandler(jobStore db.JobStore) *JobHandler {
+	return &JobHandler{
+		jobStore: jobStore,
+	}
+}
+
+// HandleGetJobs GetJobs get background jobs
+//
+//	@Summary	Getting background jobs, newest first
+//	@Tags		Admin
+//	@Param		status	query	string	false	"pending, running, done or dead"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Jobs per page"
+//	@Produce	json
+//	@Success	200	{array}		types.Job
+//	@Failure	400	{string}	string
+//	@Router		/admin/jobs [get]
+func (h *JobHandler) HandleGetJobs(c *fiber.Ctx) error {
+	status := c.Query("status")
+	switch status {
+	case "", types.JobStatusPending, types.JobStatusRunning, types.JobStatusDone, types.JobStatusDead:
+	default:
+		return ErrBadRequest(fmt.Errorf("status %s is invalid", status))
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	jobs, err := h.jobStore.GetJobs(c.Context(), status, page, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(jobs)
+}
+
+// HandleGetJob GetJob get background job
+//
+//	@Summary	Getting background job
+//	@Tags		Admin
+//	@Param		job	jobID	path	types.PathParameter	true	"ID of job"
+//	@Produce	json
+//	@Success	200	{object}	types.Job
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/jobs/{id} [get]
+func (h *JobHandler) HandleGetJob(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	job, err := h.jobStore.GetJob(c.Context(), jobID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(job)
+}
+
+// HandleRetryJob RetryJob retry dead job
+//
+//	@Summary	Requeueing a dead job with fresh attempts
+//	@Tags		Admin
+//	@Param		job	jobID	path	types.PathParameter	true	"ID of job"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/jobs/{id}/retry [post]
+func (h *JobHandler) HandleRetryJob(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.jobStore.RequeueJob(c.Context(), jobID); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"requeued": jobID})
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+)
+
+type NotificationHandler struct {
+	notificationStore db.NotificationStore
+	userStore         db.UserStore
+}
+
+func NewNotificationHandler(notificationStore db.NotificationStore, userStore db.UserStore) *NotificationHandler {
+	return &NotificationHandler{
+		notificationStore: notificationStore,
+		userStore:         userStore,
+	}
+}
+
+// HandleGetNotifications GetNotifications get notifications
+//
+//	@Summary	Getting inbox of given user id, most recently active first
+//	@Tags		Notifications
+//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Param		unread	query	bool	false	"Only unread notifications"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Notifications per page"
+//	@Produce	json
+//	@Success	200	{object}	types.NotificationPage
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/notifications [get]
+func (h *NotificationHandler) HandleGetNotifications(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	unreadOnly := false
+	if value := c.Query("unread"); len(value) > 0 {
+		if unreadOnly, err = strconv.ParseBool(value); err != nil {
+			return ErrBadRequest(err)
+		}
+	}
+	user, err := h.userStore.GetUser(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	notifications, err := h.notificationStore.GetNotifications(c.Context(), userID, unreadOnly, page, limit)
+	if err != nil {
+		return err
+	}
+	unread, err := h.notificationStore.CountUnread(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	views := make([]*types.NotificationView, 0, len(notifications))
+	for _, n := range notifications {
+		view, err := notify.RenderNotification(n, user.Language)
+		if err != nil {
+			return err
+		}
+		views = append(views, view)
+	}
+	return c.JSON(types.NotificationPage{
+		Page:          page,
+		Limit:         limit,
+		Unread:        unread,
+		Notifications: views,
+	})
+}
+
+// HandleGetUnreadCount GetUnreadCount get unread count
+//
+//	@Summary	Getting number of unread notifications of given user id
+//	@Tags		Notifications
+//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Produce	json
+//	@Success	200	{object}	types.UnreadCount
+//	@Failure	400	{string}	string
+//	@Router		/user/{id}/notifications/unread [get]
+func (h *NotificationHandler) HandleGetUnreadCount(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	unread, err := h.notificationStore.CountUnread(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(types.UnreadCount{Unread: unread})
+}
+
+// HandleMarkRead MarkRead mark notification read
+//
+//	@Summary	Marking notification of given user id as read
+//	@Tags		Notifications
+//	@Param		user			userID			path	types.PathParameter	true	"ID of user"
+//	@Param		notification	notificationID	path	types.PathParameter	true	"ID of notification"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/notifications/{notificationID}/read [put]
+func (h *NotificationHandler) HandleMarkRead(c *fiber.Ctx) error {
+	var (
+		userID         = c.Params("id")
+		notificationID = c.Params("notificationID")
+	)
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	_, err = primitive.ObjectIDFromHex(notificationID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.notificationStore.MarkRead(c.Context(), userID, notificationID); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"read": notificationID})
+}
+
+// HandleMarkAllRead MarkAllRead mark all notifications read
+//
+//	@Summary	Marking all notifications of given user id as read
+//	@Tags		Notifications
+//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/user/{id}/notifications/read [put]
+func (h *NotificationHandler) HandleMarkAllRead(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.notificationStore.MarkAllRead(c.Context(), userID); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"read": userID})
+}
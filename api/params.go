@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// expandAuthor asks post endpoints to embed author summaries.
+const expandAuthor = "author"
+
+func parsePagination(c *fiber.Ctx) (int64, int64, error) {
+	page, err := parsePositiveInt(c.Query("page"), 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("page: %w", err)
+	}
+	limit, err := parsePositiveInt(c.Query("limit"), defaultPageLimit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("limit: %w", err)
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return page, limit, nil
+}
+
+func parsePositiveInt(value string, fallback int64) (int64, error) {
+	if len(value) == 0 {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("%d should be at least 1", n)
+	}
+	return n, nil
+}
+
+// parseTime accepts either an RFC 3339 timestamp or a plain 2006-01-02 date.
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// parseExpand reads ?expand, a comma separated list of the related documents
+// to embed in a response, each of which has to be one of allowed.
+func parseExpand(c *fiber.Ctx, allowed ...string) ([]string, error) {
+	value := c.Query("expand")
+	if len(value) == 0 {
+		return nil, nil
+	}
+	var expand []string
+	for _, name := range strings.Split(value, ",") {
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("expand %s is invalid", name)
+		}
+		expand = append(expand, name)
+	}
+	return expand, nil
+}
+
+// parseViewer loads the user named by ?viewer, who posts and search results
+// are shown to, or returns an anonymous viewer if there is none.
+func parseViewer(c *fiber.Ctx, userStore db.UserStore) (*types.Viewer, error) {
+	viewer := c.Query("viewer")
+	if len(viewer) == 0 {
+		return &types.Viewer{}, nil
+	}
+	oid, err := primitive.ObjectIDFromHex(viewer)
+	if err != nil {
+		return nil, ErrBadRequest(fmt.Errorf("viewer: %w", err))
+	}
+	return userStore.GetViewer(c.Context(), oid)
+}
+
+// parsePostQuery reads the query parameters post listings take: author, kind
+// (comma separated), from, to, sort (oldest or newest), page and limit.
+func parsePostQuery(c *fiber.Ctx) (db.PostFilter, db.FindOptions, error) {
+	var (
+		filter db.PostFilter
+		opts   = db.FindOptions{Sort: db.Sort(c.Query("sort", string(db.SortOldest)))}
+		err    error
+	)
+	if author := c.Query("author"); len(author) > 0 {
+		oid, err := primitive.ObjectIDFromHex(author)
+		if err != nil {
+			return filter, opts, fmt.Errorf("author: %w", err)
+		}
+		filter.Authors = []primitive.ObjectID{oid}
+	}
+	if kinds := c.Query("kind"); len(kinds) > 0 {
+		for _, kind := range strings.Split(kinds, ",") {
+			if !slices.Contains([]string{types.PostKindPost, types.PostKindRepost, types.PostKindQuote}, kind) {
+				return filter, opts, fmt.Errorf("kind %s is invalid", kind)
+			}
+			filter.Kinds = append(filter.Kinds, kind)
+		}
+	}
+	if filter.CreatedFrom, err = parseTime(c.Query("from")); err != nil {
+		return filter, opts, fmt.Errorf("from: %w", err)
+	}
+	if filter.CreatedTo, err = parseTime(c.Query("to")); err != nil {
+		return filter, opts, fmt.Errorf("to: %w", err)
+	}
+	if len(c.Query("to")) == len(time.DateOnly) {
+		filter.CreatedTo = filter.CreatedTo.Add(24*time.Hour - time.Nanosecond)
+	}
+	if opts.Sort != db.SortOldest && opts.Sort != db.SortNewest {
+		return filter, opts, fmt.Errorf("sort %s is invalid", opts.Sort)
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		return filter, opts, err
+	}
+	opts.Skip, opts.Limit = (page-1)*limit, limit
+	return filter, opts, nil
+}
@@ -1,25 +1,34 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/MiladJlz/blog_app/db"
-	"github.com/MiladJlz/blog_app/fcm"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/queue"
 	"github.com/MiladJlz/blog_app/types"
+	"github.com/MiladJlz/blog_app/webhook"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
 	_ "net/http/httputil"
+	"slices"
 )
 
 type PostHandler struct {
-	postStore db.PostStore
-	fcmClient *fcm.FirebaseMessagingClient
-	userStore db.UserStore
+	postStore    db.PostStore
+	jobs         queue.Enqueuer
+	userStore    db.UserStore
+	restrictions Restrictions
 }
 
-func NewPostHandler(postStore db.PostStore, userStore db.UserStore, fcmClient *fcm.FirebaseMessagingClient) *PostHandler {
+func NewPostHandler(postStore db.PostStore, userStore db.UserStore, jobs queue.Enqueuer, restrictions Restrictions) *PostHandler {
 	return &PostHandler{
-		postStore: postStore,
-		fcmClient: fcmClient,
-		userStore: userStore,
+		postStore:    postStore,
+		jobs:         jobs,
+		userStore:    userStore,
+		restrictions: restrictions,
 	}
 }
 
@@ -27,12 +36,15 @@ func NewPostHandler(postStore db.PostStore, userStore db.UserStore, fcmClient *f
 //
 //	@Summary	Updating Post
 //	@Tags		Posts
-//	@Param		post	postID	path					types.PathParameter	true	"ID of post"
-//	@Param		content	body	types.UpdatePostParams	true				"New content"
+//	@Param		post		postID	path					types.PathParameter	true	"ID of post"
+//	@Param		content		body	types.UpdatePostParams	true				"New content"
+//	@Param		If-Match	header	string					false				"Version of the post being edited, as a strong entity tag"
 //	@Produce	json
 //	@Success	200
+//	@Header		200	{string}	ETag	"Version of the edited post"
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
+//	@Failure	412	{string}	string
 //	@Router		/post/{id} [put]
 func (h *PostHandler) HandlePutPost(c *fiber.Ctx) error {
 
@@ -40,16 +52,28 @@ func (h *PostHandler) HandlePutPost(c *fiber.Ctx) error {
 		params types.UpdatePostParams
 		postID = c.Params("id")
 	)
-	_, err := primitive.ObjectIDFromHex(postID)
+	oid, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
 		return ErrBadRequest(err)
 	}
 	if err := c.BodyParser(&params); err != nil {
 		return ErrBadRequest(err)
 	}
-	filter := db.Map{"_id": postID}
-	if err := h.postStore.UpdatePost(c.Context(), filter, params); err != nil {
-		return ErrNotResourceNotFound(err)
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if err := h.postStore.UpdatePost(c.Context(), db.PostFilter{ID: oid, Version: version}, params); err != nil {
+		return err
+	}
+	if post, err := h.postStore.GetPostByID(c.Context(), postID); err == nil {
+		c.Set(fiber.HeaderETag, etag(post.Version))
+		if err := webhook.Publish(c.Context(), h.jobs, types.WebhookPostUpdated, post); err != nil {
+			return err
+		}
 	}
 	return c.JSON(map[string]string{"updated": postID})
 }
@@ -58,11 +82,13 @@ func (h *PostHandler) HandlePutPost(c *fiber.Ctx) error {
 //
 //	@Summary	Deleting Post
 //	@Tags		Posts
-//	@Param		post	postID	path	types.PathParameter	true	"ID of post"
+//	@Param		post		postID	path	types.PathParameter	true	"ID of post"
+//	@Param		If-Match	header	string	false				"Version of the post being deleted, as a strong entity tag"
 //	@Produce	json
 //	@Success	200	{map}		string
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
+//	@Failure	412	{string}	string
 //	@Router		/post/{id} [delete]
 func (h *PostHandler) HandleDeletePost(c *fiber.Ctx) error {
 	postID := c.Params("id")
@@ -70,8 +96,25 @@ func (h *PostHandler) HandleDeletePost(c *fiber.Ctx) error {
 	if err != nil {
 		return ErrBadRequest(err)
 	}
-	if err := h.postStore.DeletePost(c.Context(), postID); err != nil {
-		return ErrNotResourceNotFound(err)
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+	post, err := h.postStore.GetPostByID(c.Context(), postID)
+	if err != nil {
+		return err
+	}
+	if err := h.postStore.DeletePost(c.Context(), postID, version); err != nil {
+		return err
+	}
+	if post.RepostOf != nil {
+		err := h.postStore.IncrementPostStat(c.Context(), post.RepostOf.Hex(), types.StatReposts, -1)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+	}
+	if err := webhook.Publish(c.Context(), h.jobs, types.WebhookPostDeleted, post); err != nil {
+		return err
 	}
 	return c.JSON(map[string]string{"deleted": postID})
 }
@@ -95,24 +138,25 @@ func (h *PostHandler) HandleInsertPost(c *fiber.Ctx) error {
 	if errors := params.Validate(); len(errors) > 0 {
 		return c.JSON(errors)
 	}
+	if err := h.restrictions.check(c.Context(), h.userStore, ActionPost, params.Author); err != nil {
+		return err
+	}
 	post := types.NewPostFromParams(params)
 	insertedPost, err := h.postStore.InsertPost(c.Context(), post)
 	if err != nil {
 		return err
 	}
-	user, err := h.userStore.GetUser(c.Context(), params.Author)
-	var friendsToken []string
-	for _, friend := range user.Friends {
-		userFriend, err := h.userStore.GetUserByObjectID(c.Context(), friend)
-		if err != nil {
-			return nil
-		}
-		friendsToken = append(friendsToken, userFriend.FCMToken)
+	// The post is stored, so failing to queue what follows from it is only
+	// logged: reporting an error would invite the client to post it again.
+	payload := map[string]string{
+		"post":   insertedPost.ID.Hex(),
+		"author": insertedPost.Author.Hex(),
 	}
-
-	err = h.fcmClient.SendNotification(c.Context(), friendsToken, "sa")
-	if err != nil {
-		return err
+	if _, err := h.jobs.Enqueue(c.Context(), notify.JobNewPost, payload); err != nil {
+		log.Printf("post %s: queueing notifications: %v", insertedPost.ID.Hex(), err)
+	}
+	if err := webhook.Publish(c.Context(), h.jobs, types.WebhookPostCreated, insertedPost); err != nil {
+		log.Printf("post %s: publishing %s: %v", insertedPost.ID.Hex(), types.WebhookPostCreated, err)
 	}
 	return c.JSON(insertedPost)
 }
@@ -121,9 +165,14 @@ func (h *PostHandler) HandleInsertPost(c *fiber.Ctx) error {
 //
 //	@Summary	Getting Post
 //	@Tags		Posts
-//	@Param		post	postID	path	types.PathParameter	true	"ID of post"
+//	@Param		post			postID	path	types.PathParameter	true	"ID of post"
+//	@Param		If-None-Match	header	string	false				"ETag of the copy the client has"
+//	@Param		expand			query	string	false				"author to embed author summaries"
+//	@Param		viewer			query	string	false				"ID of user reading the post"
 //	@Produce	json
-//	@Success	200	{object}	types.Post
+//	@Success	200	{object}	types.PostView
+//	@Header		200	{string}	ETag	"Version of the post"
+//	@Success	304
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
 //	@Router		/post/{id} [get]
@@ -135,27 +184,82 @@ func (h *PostHandler) HandleGetPost(c *fiber.Ctx) error {
 	if err != nil {
 		return ErrBadRequest(err)
 	}
+	expand, err := parseExpand(c, expandAuthor)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	viewer, err := parseViewer(c, h.userStore)
+	if err != nil {
+		return err
+	}
 	post, err := h.postStore.GetPostByID(c.Context(), postID)
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return err
+	}
+	// Posts the viewer may not read are as good as missing.
+	if !viewer.CanSee(post) {
+		return db.ErrNotFound
+	}
+	// Revalidating a copy the client already has is not a view.
+	if notModified(c, post.Version) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	if err := h.postStore.IncrementPostStat(c.Context(), postID, types.StatViews, 1); err != nil {
+		return err
+	}
+	post.Stats.Views++
+	view, err := renderPost(c.Context(), h.postStore, *viewer, post)
+	if err != nil {
+		return err
 	}
-	return c.JSON(post)
+	if err := h.expand(c.Context(), []*types.PostView{view}, expand); err != nil {
+		return err
+	}
+	return c.JSON(view)
 }
 
 // HandleGetPosts GetPosts Get posts
 //
 //	@Summary	Getting Posts
 //	@Tags		Posts
+//	@Param		author	query	string	false	"Only posts from this user ID"
+//	@Param		kind	query	string	false	"Only posts of these kinds: post, repost or quote, comma separated"
+//	@Param		from	query	string	false	"Only posts created at or after this date"
+//	@Param		to		query	string	false	"Only posts created at or before this date"
+//	@Param		sort	query	string	false	"oldest (default) or newest first"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Posts per page"
+//	@Param		expand	query	string	false	"author to embed author summaries"
+//	@Param		viewer	query	string	false	"ID of user reading the posts"
 //	@Produce	json
-//	@Success	200	{array}		types.Post
+//	@Success	200	{array}		types.PostView
+//	@Failure	400	{string}	string
 //	@Failure	500	{string}	string
 //	@Router		/posts [get]
 func (h *PostHandler) HandleGetPosts(c *fiber.Ctx) error {
-	posts, err := h.postStore.GetPosts(c.Context())
+	filter, opts, err := parsePostQuery(c)
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return ErrBadRequest(err)
+	}
+	expand, err := parseExpand(c, expandAuthor)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if filter.Viewer, err = parseViewer(c, h.userStore); err != nil {
+		return err
+	}
+	posts, err := h.postStore.FindPosts(c.Context(), filter, opts)
+	if err != nil {
+		return err
 	}
-	return c.JSON(posts)
+	views, err := renderPosts(c.Context(), h.postStore, *filter.Viewer, posts)
+	if err != nil {
+		return err
+	}
+	if err := h.expand(c.Context(), views, expand); err != nil {
+		return err
+	}
+	return c.JSON(views)
 }
 
 // HandleGetPostsByUserID GetPosts get posts
@@ -163,8 +267,16 @@ func (h *PostHandler) HandleGetPosts(c *fiber.Ctx) error {
 //	@Summary	Getting posts from given user id
 //	@Tags		Posts
 //	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Param		kind	query	string	false	"Only posts of these kinds: post, repost or quote, comma separated"
+//	@Param		from	query	string	false	"Only posts created at or after this date"
+//	@Param		to		query	string	false	"Only posts created at or before this date"
+//	@Param		sort	query	string	false	"oldest (default) or newest first"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Posts per page"
+//	@Param		expand	query	string	false	"author to embed author summaries"
+//	@Param		viewer	query	string	false	"ID of user reading the posts"
 //	@Produce	json
-//	@Success	200	{array}		types.Post
+//	@Success	200	{array}		types.PostView
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
 //	@Router		/post/user/{id} [get]
@@ -172,13 +284,199 @@ func (h *PostHandler) HandleGetPostsByUserID(c *fiber.Ctx) error {
 	var (
 		userID = c.Params("id")
 	)
-	_, err := primitive.ObjectIDFromHex(userID)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	filter, opts, err := parsePostQuery(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	expand, err := parseExpand(c, expandAuthor)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if filter.Viewer, err = parseViewer(c, h.userStore); err != nil {
+		return err
+	}
+	filter.Authors = []primitive.ObjectID{oid}
+	posts, err := h.postStore.FindPosts(c.Context(), filter, opts)
+	if err != nil {
+		return err
+	}
+	views, err := renderPosts(c.Context(), h.postStore, *filter.Viewer, posts)
+	if err != nil {
+		return err
+	}
+	if err := h.expand(c.Context(), views, expand); err != nil {
+		return err
+	}
+	return c.JSON(views)
+}
+
+// HandleRepost Repost repost or quote post
+//
+//	@Summary	Reposting or quoting Post
+//	@Tags		Posts
+//	@Param		post	postID	path						types.PathParameter	true	"ID of post"
+//	@Param		repost	body	types.CreateRepostParams	true				"Repost, or quote post when content is set"
+//	@Produce	json
+//	@Success	201	{object}	types.PostView
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Failure	409	{string}	string
+//	@Router		/post/{id}/repost [post]
+func (h *PostHandler) HandleRepost(c *fiber.Ctx) error {
+	var (
+		params types.CreateRepostParams
+		postID = c.Params("id")
+	)
+	_, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
 		return ErrBadRequest(err)
 	}
-	posts, err := h.postStore.GetPostsByUserID(c.Context(), userID)
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	if err := h.restrictions.check(c.Context(), h.userStore, ActionRepost, params.Author); err != nil {
+		return err
+	}
+	original, err := h.postStore.GetPostByID(c.Context(), postID)
+	if err != nil {
+		return err
+	}
+	repost := types.NewRepostFromParams(params, original)
+	// Reposting a repost reposts its original, which the author must be able
+	// to read too.
+	if *repost.RepostOf != original.ID {
+		if original, err = h.postStore.GetPostByID(c.Context(), repost.RepostOf.Hex()); err != nil {
+			return err
+		}
+	}
+	viewer, err := h.userStore.GetViewer(c.Context(), repost.Author)
+	if err != nil {
+		return err
+	}
+	if !viewer.CanSee(original) {
+		return db.ErrNotFound
+	}
+	// The stores allow a user one repost of a post, and quotes without limit.
+	insertedPost, err := h.postStore.InsertPost(c.Context(), repost)
+	if errors.Is(err, db.ErrConflict) {
+		return ErrConflict(fmt.Errorf("post %s is already reposted", original.ID.Hex()))
+	}
+	if err != nil {
+		return err
+	}
+	// As in HandleInsertPost, what follows from the stored repost only logs
+	// its failures.
+	if err := h.postStore.IncrementPostStat(c.Context(), repost.RepostOf.Hex(), types.StatReposts, 1); err != nil {
+		log.Printf("post %s: counting repost %s: %v", repost.RepostOf.Hex(), insertedPost.ID.Hex(), err)
+	}
+	if err := webhook.Publish(c.Context(), h.jobs, types.WebhookPostCreated, insertedPost); err != nil {
+		log.Printf("post %s: publishing %s: %v", insertedPost.ID.Hex(), types.WebhookPostCreated, err)
+	}
+	view, err := renderPost(c.Context(), h.postStore, *viewer, insertedPost)
+	if err != nil {
+		return err
+	}
+	if view.Original != nil && view.Original.Author != insertedPost.Author {
+		payload := map[string]string{
+			"post":      insertedPost.ID.Hex(),
+			"recipient": view.Original.Author.Hex(),
+		}
+		if _, err := h.jobs.Enqueue(c.Context(), notify.JobRepost, payload); err != nil {
+			log.Printf("post %s: queueing notifications: %v", insertedPost.ID.Hex(), err)
+		}
+	}
+	return c.JSON(view)
+}
+
+// expand embeds the related documents named in expand into views.
+func (h *PostHandler) expand(ctx context.Context, views []*types.PostView, expand []string) error {
+	if slices.Contains(expand, expandAuthor) {
+		return expandAuthors(ctx, h.userStore, views)
+	}
+	return nil
+}
+
+// expandAuthors embeds a summary of the author of each post, and of the post
+// it reposts or quotes, loading all of them in a single query.
+func expandAuthors(ctx context.Context, userStore db.UserStore, views []*types.PostView) error {
+	var ids []primitive.ObjectID
+	add := func(id primitive.ObjectID) {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, view := range views {
+		add(view.Author)
+		if view.Original != nil {
+			add(view.Original.Author)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	authors, err := userStore.GetUsersByIDs(ctx, ids, "firstName", "lastName")
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return err
+	}
+	summaries := map[primitive.ObjectID]*types.UserSummary{}
+	for _, author := range authors {
+		summary := types.NewUserSummary(author)
+		summaries[author.ID] = &summary
+	}
+	for _, view := range views {
+		view.AuthorSummary = summaries[view.Author]
+		if view.Original != nil {
+			view.OriginalAuthorSummary = summaries[view.Original.Author]
+		}
+	}
+	return nil
+}
+
+func renderPost(ctx context.Context, postStore db.PostStore, viewer types.Viewer, post *types.Post) (*types.PostView, error) {
+	views, err := renderPosts(ctx, postStore, viewer, []*types.Post{post})
+	if err != nil {
+		return nil, err
+	}
+	return views[0], nil
+}
+
+// renderPosts embeds the reposted or quoted post into each post, loading all
+// of them in a single query. Originals the viewer may not read are left out
+// and marked unavailable, as if they had been deleted.
+func renderPosts(ctx context.Context, postStore db.PostStore, viewer types.Viewer, posts []*types.Post) ([]*types.PostView, error) {
+	var refs []primitive.ObjectID
+	for _, post := range posts {
+		if post.RepostOf != nil {
+			refs = append(refs, *post.RepostOf)
+		}
+	}
+	originals := map[primitive.ObjectID]*types.Post{}
+	if len(refs) > 0 {
+		found, err := postStore.GetPostsByIDs(ctx, refs)
+		if err != nil {
+			return nil, err
+		}
+		for _, original := range found {
+			if viewer.CanSee(original) {
+				originals[original.ID] = original
+			}
+		}
+	}
+	views := make([]*types.PostView, 0, len(posts))
+	for _, post := range posts {
+		view := &types.PostView{Post: post}
+		if post.RepostOf != nil {
+			view.Original = originals[*post.RepostOf]
+			view.OriginalUnavailable = view.Original == nil
+		}
+		views = append(views, view)
 	}
-	return c.JSON(posts)
+	return views, nil
 }
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"testing"
+)
+
+// failingJobs fails to enqueue anything.
+type failingJobs struct{}
+
+func (failingJobs) Enqueue(ctx context.Context, jobType string, payload map[string]string) (*types.Job, error) {
+	return nil, errors.New("queue down")
+}
+
+func TestInsertPostWithTheQueueDown(t *testing.T) {
+	posts := db.NewMemoryPostStore()
+	users := db.NewMemoryUserStore()
+	author, err := users.InsertUser(context.Background(), types.NewUserFromImport(types.ImportUserParams{FirstName: "foo", Email: "foo@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	handler := api.NewPostHandler(posts, users, failingJobs{}, api.Restrictions{})
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/post", handler.HandleInsertPost)
+
+	resp := do(t, app, http.MethodPost, "/post", `{"content":"Stored anyway","author":"`+author.ID.Hex()+`"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST: got status %d, want 200, as the post is stored", resp.StatusCode)
+	}
+	stored, err := posts.FindPosts(context.Background(), db.PostFilter{}, db.FindOptions{})
+	if err != nil {
+		t.Fatalf("FindPosts: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Errorf("stored %d posts, want 1", len(stored))
+	}
+}
+
+func TestRepostTwice(t *testing.T) {
+	ctx := context.Background()
+	posts := db.NewMemoryPostStore()
+	users := db.NewMemoryUserStore()
+	author, err := users.InsertUser(ctx, types.NewUserFromImport(types.ImportUserParams{FirstName: "foo", Email: "foo@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	original, err := posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Worth sharing", Author: author.ID.Hex()}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	handler := api.NewPostHandler(posts, users, failingJobs{}, api.Restrictions{})
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/post/:id/repost", handler.HandleRepost)
+	path := "/post/" + original.ID.Hex() + "/repost"
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"repost", `{"author":"` + author.ID.Hex() + `"}`, http.StatusOK},
+		{"repost again", `{"author":"` + author.ID.Hex() + `"}`, http.StatusConflict},
+		{"quote", `{"author":"` + author.ID.Hex() + `","content":"Still worth it"}`, http.StatusOK},
+		{"quote again", `{"author":"` + author.ID.Hex() + `","content":"Really worth it"}`, http.StatusOK},
+	} {
+		if resp := do(t, app, http.MethodPost, path, tc.body, nil); resp.StatusCode != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
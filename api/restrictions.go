@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"strings"
+)
+
+const UnverifiedRestrictionsEnvName = "UNVERIFIED_RESTRICTIONS"
+
+const (
+	ActionPost      = "post"
+	ActionRepost    = "repost"
+	ActionAddFriend = "add_friend"
+)
+
+// Restrictions is the set of actions accounts may not take until they verify
+// their email address.
+type Restrictions map[string]bool
+
+// ParseRestrictions reads a comma separated list of actions, as given in
+// UNVERIFIED_RESTRICTIONS.
+func ParseRestrictions(value string) (Restrictions, error) {
+	r := Restrictions{}
+	for _, action := range strings.Split(value, ",") {
+		action = strings.TrimSpace(action)
+		switch action {
+		case "":
+		case ActionPost, ActionRepost, ActionAddFriend:
+			r[action] = true
+		default:
+			return nil, fmt.Errorf("unknown restricted action %q", action)
+		}
+	}
+	return r, nil
+}
+
+// check returns an error if the user may not take action.
+func (r Restrictions) check(ctx context.Context, userStore db.UserStore, action string, userID string) error {
+	if !r[action] {
+		return nil
+	}
+	user, err := userStore.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return ErrUnverified()
+	}
+	return nil
+}
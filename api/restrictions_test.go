@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"testing"
+)
+
+func TestParseRestrictions(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    api.Restrictions
+		wantErr bool
+	}{
+		{"", api.Restrictions{}, false},
+		{"post", api.Restrictions{api.ActionPost: true}, false},
+		{" post , repost,add_friend,", api.Restrictions{api.ActionPost: true, api.ActionRepost: true, api.ActionAddFriend: true}, false},
+		{"post,comment", nil, true},
+	} {
+		got, err := api.ParseRestrictions(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseRestrictions(%q): got error %v, want one: %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("ParseRestrictions(%q): got %v, want %v", tc.value, got, tc.want)
+		}
+		for action := range tc.want {
+			if !got[action] {
+				t.Errorf("ParseRestrictions(%q): %s is not restricted", tc.value, action)
+			}
+		}
+	}
+}
+
+func TestUnverifiedRestrictions(t *testing.T) {
+	ctx := context.Background()
+	posts := db.NewMemoryPostStore()
+	users := db.NewMemoryUserStore()
+	unverified, err := users.InsertUser(ctx, types.NewUserFromImport(types.ImportUserParams{FirstName: "new", Email: "new@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	verified, err := users.InsertUser(ctx, types.NewUserFromImport(types.ImportUserParams{FirstName: "old", Email: "old@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if err := users.MarkEmailVerified(ctx, verified.ID.Hex(), verified.Email); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	original, err := posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Worth sharing", Author: verified.ID.Hex()}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	repost := "/post/" + original.ID.Hex() + "/repost"
+
+	for _, tc := range []struct {
+		name         string
+		restrictions api.Restrictions
+		author       *types.User
+		path         string
+		want         int
+	}{
+		{"unverified post", api.Restrictions{api.ActionPost: true}, unverified, "/post", http.StatusForbidden},
+		{"verified post", api.Restrictions{api.ActionPost: true}, verified, "/post", http.StatusOK},
+		{"unverified post, reposts restricted", api.Restrictions{api.ActionRepost: true}, unverified, "/post", http.StatusOK},
+		{"unverified repost", api.Restrictions{api.ActionRepost: true}, unverified, repost, http.StatusForbidden},
+		{"unverified repost, unrestricted", api.Restrictions{}, unverified, repost, http.StatusOK},
+	} {
+		handler := api.NewPostHandler(posts, users, failingJobs{}, tc.restrictions)
+		app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+		app.Post("/post", handler.HandleInsertPost)
+		app.Post("/post/:id/repost", handler.HandleRepost)
+		body := `{"content":"Hello from ` + tc.author.FirstName + `","author":"` + tc.author.ID.Hex() + `"}`
+		if tc.path == repost {
+			body = `{"author":"` + tc.author.ID.Hex() + `"}`
+		}
+		if resp := do(t, app, http.MethodPost, tc.path, body, nil); resp.StatusCode != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+type SearchHandler struct {
+	searchStore db.SearchStore
+	userStore   db.UserStore
+}
+
+func NewSearchHandler(searchStore db.SearchStore, userStore db.UserStore) *SearchHandler {
+	return &SearchHandler{
+		searchStore: searchStore,
+		userStore:   userStore,
+	}
+}
+
+// HandleSearch Search search posts and users
+//
+//	@Summary	Searching posts and users
+//	@Tags		Search
+//	@Param		q		query	string	true	"Search query"
+//	@Param		type	query	string	false	"all, posts or users"
+//	@Param		author	query	string	false	"Only posts from this user ID"
+//	@Param		from	query	string	false	"Only posts created at or after this date"
+//	@Param		to		query	string	false	"Only posts created at or before this date"
+//	@Param		page	query	int		false	"Page number"
+//	@Param		limit	query	int		false	"Results per page"
+//	@Param		viewer	query	string	false	"ID of user searching, who finds the posts they may read"
+//	@Produce	json
+//	@Success	200	{object}	types.SearchResult
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Failure	500	{string}	string
+//	@Router		/search [get]
+func (h *SearchHandler) HandleSearch(c *fiber.Ctx) error {
+	params, err := searchParamsFromQuery(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	viewer, err := parseViewer(c, h.userStore)
+	if err != nil {
+		return err
+	}
+	params.Viewer = *viewer
+	result, err := h.searchStore.Search(c.Context(), params)
+	if err != nil {
+		return err
+	}
+	return c.JSON(result)
+}
+
+func searchParamsFromQuery(c *fiber.Ctx) (types.SearchParams, error) {
+	var (
+		params = types.SearchParams{
+			Query: strings.TrimSpace(c.Query("q")),
+			Type:  c.Query("type", types.SearchTypeAll),
+		}
+		err error
+	)
+	if len(params.Query) == 0 {
+		return params, errors.New("q is required")
+	}
+	switch params.Type {
+	case types.SearchTypeAll, types.SearchTypePosts, types.SearchTypeUsers:
+	default:
+		return params, fmt.Errorf("type %s is invalid", params.Type)
+	}
+	if author := c.Query("author"); len(author) > 0 {
+		if params.Author, err = primitive.ObjectIDFromHex(author); err != nil {
+			return params, err
+		}
+	}
+	if params.From, err = parseTime(c.Query("from")); err != nil {
+		return params, err
+	}
+	if params.To, err = parseTime(c.Query("to")); err != nil {
+		return params, err
+	}
+	if len(c.Query("to")) == len(time.DateOnly) {
+		params.To = params.To.Add(24*time.Hour - time.Nanosecond)
+	}
+	if params.Page, params.Limit, err = parsePagination(c); err != nil {
+		return params, err
+	}
+	return params, nil
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/realtime"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	streamTokenTTL = 24 * time.Hour
+	// heartbeatInterval keeps idle streams from being cut by proxies.
+	heartbeatInterval = 25 * time.Second
+)
+
+type StreamHandler struct {
+	userStore db.UserStore
+	broker    realtime.Broker
+	signer    *token.Signer
+}
+
+func NewStreamHandler(userStore db.UserStore, broker realtime.Broker, signer *token.Signer) *StreamHandler {
+	return &StreamHandler{
+		userStore: userStore,
+		broker:    broker,
+		signer:    signer,
+	}
+}
+
+// HandleStreamToken StreamToken issue stream token
+//
+//	@Summary	Issuing a token that opens the real-time stream of given user id, given the user's password
+//	@Tags		Stream
+//	@Param		user		userID	path	types.PathParameter			true	"ID of user"
+//	@Param		password	body	types.StreamTokenParams	true	"Password of user"
+//	@Produce	json
+//	@Success	200	{object}	types.StreamToken
+//	@Failure	400	{string}	string
+//	@Failure	401	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/stream-token [post]
+func (h *StreamHandler) HandleStreamToken(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	var params types.StreamTokenParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	user, err := h.userStore.GetUser(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsValidPassword(params.Password) {
+		return ErrUnauthorized(errors.New("wrong password"))
+	}
+	return c.JSON(types.StreamToken{
+		Token:     h.signer.Sign(realtime.TokenPurpose, userID, streamTokenTTL),
+		ExpiresAt: time.Now().Add(streamTokenTTL),
+	})
+}
+
+// HandleSSE Stream server-sent events
+//
+//	@Summary	Streaming events for the token's user as server-sent events
+//	@Tags		Stream
+//	@Param		token	query	string	true	"Stream token"
+//	@Produce	text/event-stream
+//	@Success	200	{string}	string
+//	@Failure	401	{string}	string
+//	@Router		/stream [get]
+func (h *StreamHandler) HandleSSE(c *fiber.Ctx) error {
+	userID, err := h.authenticate(c)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub := h.broker.Subscribe(userID)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		fmt.Fprint(w, "retry: 3000\n\n")
+		for {
+			if err := w.Flush(); err != nil {
+				return
+			}
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+		}
+	})
+	return nil
+}
+
+// HandleWebSocket Stream websocket
+//
+//	@Summary	Streaming events for the token's user over a WebSocket
+//	@Tags		Stream
+//	@Param		token	query	string	true	"Stream token"
+//	@Success	101	{string}	string
+//	@Failure	400	{string}	string
+//	@Failure	401	{string}	string
+//	@Router		/ws [get]
+func (h *StreamHandler) HandleWebSocket(c *fiber.Ctx) error {
+	userID, err := h.authenticate(c)
+	if err != nil {
+		return err
+	}
+	key := c.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") || len(key) == 0 {
+		return ErrBadRequest(errors.New("expected a websocket upgrade"))
+	}
+	if c.Get("Sec-WebSocket-Version") != "13" {
+		c.Set("Sec-WebSocket-Version", "13")
+		return NewError(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.Set(fiber.HeaderUpgrade, "websocket")
+	c.Set(fiber.HeaderConnection, "Upgrade")
+	c.Set("Sec-WebSocket-Accept", realtime.AcceptKey(key))
+
+	sub := h.broker.Subscribe(userID)
+	c.Context().Hijack(func(conn net.Conn) {
+		ws := realtime.NewWebSocket(conn)
+		defer ws.Close()
+		defer sub.Close()
+		closed := make(chan struct{})
+		go func() {
+			ws.ReadLoop()
+			close(closed)
+		}()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				b, _ := json.Marshal(ev)
+				if err := ws.WriteText(b); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if err := ws.Ping(); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// authenticate returns the user named by the stream token in the token query
+// parameter or a bearer Authorization header. Browsers cannot set headers on
+// EventSource or WebSocket requests, hence the query parameter.
+func (h *StreamHandler) authenticate(c *fiber.Ctx) (string, error) {
+	tok := c.Query("token")
+	if len(tok) == 0 {
+		tok = strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	}
+	userID, err := h.signer.Verify(realtime.TokenPurpose, tok)
+	if err != nil {
+		return "", ErrUnauthorized(err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/realtime"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamToken(t *testing.T) {
+	users := db.NewMemoryUserStore()
+	user, err := types.NewUserFromParams(types.CreateUserParams{FirstName: "foo", LastName: "bar", Email: "foo@blog.test", Password: "verysecurepassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = users.InsertUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	imported, err := users.InsertUser(context.Background(), types.NewUserFromImport(types.ImportUserParams{FirstName: "baz", Email: "baz@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	signer := token.NewSigner([]byte("secret"))
+	handler := api.NewStreamHandler(users, realtime.NewMemoryBroker(), signer)
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/user/:id/stream-token", handler.HandleStreamToken)
+
+	for _, tc := range []struct {
+		name   string
+		userID string
+		body   string
+		want   int
+	}{
+		{"right password", user.ID.Hex(), `{"password":"verysecurepassword"}`, http.StatusOK},
+		{"wrong password", user.ID.Hex(), `{"password":"guess"}`, http.StatusUnauthorized},
+		{"no password", user.ID.Hex(), `{}`, http.StatusUnauthorized},
+		{"user without a password", imported.ID.Hex(), `{"password":""}`, http.StatusUnauthorized},
+		{"unknown user", "66db2c856699531daa9abc16", `{"password":"verysecurepassword"}`, http.StatusNotFound},
+		{"invalid id", "nope", `{"password":"verysecurepassword"}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/user/"+tc.userID+"/stream-token", strings.NewReader(tc.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Fatalf("status: got %d, want %d", resp.StatusCode, tc.want)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var streamToken types.StreamToken
+			if err := json.NewDecoder(resp.Body).Decode(&streamToken); err != nil {
+				t.Fatal(err)
+			}
+			if subject, err := signer.Verify(realtime.TokenPurpose, streamToken.Token); err != nil || subject != tc.userID {
+				t.Errorf("token verifies as %q, %v, want %q", subject, err, tc.userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/MiladJlz/blog_app/trending"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TrendingHandler struct {
+	ranker *trending.Ranker
+}
+
+func NewTrendingHandler(ranker *trending.Ranker) *TrendingHandler {
+	return &TrendingHandler{
+		ranker: ranker,
+	}
+}
+
+// HandleGetTrending GetTrending Get trending posts and tags
+//
+//	@Summary	Getting trending posts and tags
+//	@Tags		Trending
+//	@Param		limit	query	int	false	"Maximum posts and tags to return"
+//	@Produce	json
+//	@Success	200	{object}	types.Trending
+//	@Failure	400	{string}	string
+//	@Failure	500	{string}	string
+//	@Router		/trending [get]
+func (h *TrendingHandler) HandleGetTrending(c *fiber.Ctx) error {
+	limit, err := parsePositiveInt(c.Query("limit"), maxPageLimit)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	current, err := h.ranker.Trending(c.Context())
+	if err != nil {
+		return err
+	}
+	result := *current
+	result.Posts = result.Posts[:min(len(result.Posts), int(limit))]
+	result.Tags = result.Tags[:min(len(result.Tags), int(limit))]
+	return c.JSON(result)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/gofiber/fiber/v2"
+)
+
+type UnsubscribeHandler struct {
+	userStore db.UserStore
+	signer    *token.Signer
+}
+
+func NewUnsubscribeHandler(userStore db.UserStore, signer *token.Signer) *UnsubscribeHandler {
+	return &UnsubscribeHandler{
+		userStore: userStore,
+		signer:    signer,
+	}
+}
+
+// HandleUnsubscribe Unsubscribe unsubscribe from emails
+//
+//	@Summary	Turning off every email to the user named by a signed unsubscribe token
+//	@Tags		Notifications
+//	@Param		token	query	string	true	"Unsubscribe token from an email"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/unsubscribe [get]
+//	@Router		/unsubscribe [post]
+func (h *UnsubscribeHandler) HandleUnsubscribe(c *fiber.Ctx) error {
+	userID, err := h.signer.Verify(mail.PurposeUnsubscribe, c.Query("token"))
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	user, err := h.userStore.GetUser(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	settings := user.Notifications
+	settings.DisableEmail()
+	if err := h.userStore.UpdateNotificationSettings(c.Context(), userID, settings); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"unsubscribed": userID})
+}
@@ -1,19 +1,28 @@
 package api
 
 import (
+	"errors"
+	"github.com/MiladJlz/blog_app/account"
 	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/queue"
 	"github.com/MiladJlz/blog_app/types"
+	"github.com/MiladJlz/blog_app/webhook"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserHandler struct {
-	userStore db.UserStore
+	userStore    db.UserStore
+	jobs         queue.Enqueuer
+	restrictions Restrictions
 }
 
-func NewUserHandler(userStore db.UserStore) *UserHandler {
+func NewUserHandler(userStore db.UserStore, jobs queue.Enqueuer, restrictions Restrictions) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
+		userStore:    userStore,
+		jobs:         jobs,
+		restrictions: restrictions,
 	}
 }
 
@@ -21,28 +30,58 @@ func NewUserHandler(userStore db.UserStore) *UserHandler {
 //
 //	@Summary	Updating user
 //	@Tags		Users
-//	@Param		post	userID	path					types.PathParameter	true	"ID of user"
-//	@Param		content	body	types.UpdateUserParams	true				"User"
+//	@Param		post		userID	path					types.PathParameter	true	"ID of user"
+//	@Param		content		body	types.UpdateUserParams	true				"User"
+//	@Param		If-Match	header	string					false				"Version of the user being edited, as a strong entity tag"
 //	@Produce	json
 //	@Success	200	{map}		string
+//	@Header		200	{string}	ETag	"Version of the edited user"
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
+//	@Failure	409	{string}	string
+//	@Failure	412	{string}	string
 //	@Router		/user/{id} [put]
 func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
 	var (
 		params types.UpdateUserParams
 		userID = c.Params("id")
 	)
-	_, err := primitive.ObjectIDFromHex(userID)
+	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return ErrBadRequest(err)
 	}
 	if err := c.BodyParser(&params); err != nil {
 		return ErrBadRequest(err)
 	}
-	filter := db.Map{"_id": userID}
-	if err := h.userStore.UpdateUser(c.Context(), filter, params); err != nil {
-		return ErrNotResourceNotFound(err)
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if len(params.Email) > 0 {
+		user, err := h.userStore.GetUser(c.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if user.Email == params.Email {
+			params.Email = ""
+		}
+	}
+	if err := h.userStore.UpdateUser(c.Context(), db.UserFilter{ID: oid, Version: version}, params); err != nil {
+		return err
+	}
+	if len(params.Email) > 0 {
+		if _, err := h.jobs.Enqueue(c.Context(), account.JobVerifyEmail, map[string]string{"user": userID}); err != nil {
+			return err
+		}
+	}
+	if user, err := h.userStore.GetUser(c.Context(), userID); err == nil {
+		c.Set(fiber.HeaderETag, etag(user.Version))
+		if err := webhook.Publish(c.Context(), h.jobs, types.WebhookUserUpdated, types.NewUserSummary(user)); err != nil {
+			return err
+		}
 	}
 	return c.JSON(map[string]string{"updated": userID})
 }
@@ -51,11 +90,13 @@ func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
 //
 //	@Summary	Deleting User
 //	@Tags		Users
-//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Param		user		userID	path	types.PathParameter	true	"ID of user"
+//	@Param		If-Match	header	string	false				"Version of the user being deleted, as a strong entity tag"
 //	@Produce	json
 //	@Success	200	{map}		string
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
+//	@Failure	412	{string}	string
 //	@Router		/user/{id} [delete]
 func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
@@ -63,7 +104,14 @@ func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 	if err != nil {
 		return ErrBadRequest(err)
 	}
-	if err := h.userStore.DeleteUser(c.Context(), userID); err != nil {
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if err := h.userStore.DeleteUser(c.Context(), userID, version); err != nil {
+		return err
+	}
+	if err := webhook.Publish(c.Context(), h.jobs, types.WebhookUserDeleted, map[string]string{"id": userID}); err != nil {
 		return err
 	}
 	return c.JSON(map[string]string{"deleted": userID})
@@ -77,6 +125,7 @@ func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 //	@Produce	json
 //	@Success	201	{map}		string
 //	@Failure	400	{string}	string
+//	@Failure	409	{string}	string
 //	@Failure	500	{string}	string
 //	@Router		/user [post]
 func (h *UserHandler) HandleInsertUser(c *fiber.Ctx) error {
@@ -95,6 +144,12 @@ func (h *UserHandler) HandleInsertUser(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if _, err := h.jobs.Enqueue(c.Context(), account.JobVerifyEmail, map[string]string{"user": insertedUser.ID.Hex()}); err != nil {
+		return err
+	}
+	if err := webhook.Publish(c.Context(), h.jobs, types.WebhookUserCreated, types.NewUserSummary(insertedUser)); err != nil {
+		return err
+	}
 	return c.JSON(insertedUser)
 }
 
@@ -102,9 +157,12 @@ func (h *UserHandler) HandleInsertUser(c *fiber.Ctx) error {
 //
 //	@Summary	Getting user
 //	@Tags		Users
-//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Param		user			userID	path	types.PathParameter	true	"ID of user"
+//	@Param		If-None-Match	header	string	false				"ETag of the copy the client has"
 //	@Produce	json
 //	@Success	200	{map}		string
+//	@Header		200	{string}	ETag	"Version of the user"
+//	@Success	304
 //	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
 //	@Router		/user/{id} [get]
@@ -118,7 +176,10 @@ func (h *UserHandler) HandleGetUser(c *fiber.Ctx) error {
 	}
 	user, err := h.userStore.GetUser(c.Context(), userID)
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return err
+	}
+	if notModified(c, user.Version) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 	return c.JSON(user)
 }
@@ -134,7 +195,7 @@ func (h *UserHandler) HandleGetUser(c *fiber.Ctx) error {
 func (h *UserHandler) HandleGetUsers(c *fiber.Ctx) error {
 	users, err := h.userStore.GetUsers(c.Context())
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return err
 	}
 	return c.JSON(users)
 }
@@ -147,6 +208,7 @@ func (h *UserHandler) HandleGetUsers(c *fiber.Ctx) error {
 //	@Param		userID	body	types.PathParameter	true				"User"
 //	@Produce	json
 //	@Success	200	{map}		string
+//	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
 //	@Router		/user/{id}/add [put]
 func (h *UserHandler) HandleAddFriend(c *fiber.Ctx) error {
@@ -154,17 +216,32 @@ func (h *UserHandler) HandleAddFriend(c *fiber.Ctx) error {
 		userID = c.Params("id")
 		param  types.AddFriendParam
 	)
-	_, err := primitive.ObjectIDFromHex(userID)
+	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return ErrBadRequest(err)
 	}
 	if err := c.BodyParser(&param); err != nil {
 		return ErrBadRequest(err)
 	}
-	filter := db.Map{"_id": userID}
-	err = h.userStore.AddFriend(c.Context(), filter, userID, param.UserID)
+	friend, err := primitive.ObjectIDFromHex(param.UserID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.restrictions.check(c.Context(), h.userStore, ActionAddFriend, userID); err != nil {
+		return err
+	}
+	err = h.userStore.AddFriend(c.Context(), db.UserFilter{ID: oid}, friend)
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return err
+	}
+	if param.UserID != userID {
+		payload := map[string]string{
+			"actor":     userID,
+			"recipient": param.UserID,
+		}
+		if _, err := h.jobs.Enqueue(c.Context(), notify.JobFriendRequest, payload); err != nil {
+			return err
+		}
 	}
 	return c.JSON(map[string]string{"add friend": param.UserID})
 }
@@ -177,6 +254,7 @@ func (h *UserHandler) HandleAddFriend(c *fiber.Ctx) error {
 //	@Param		userID	body	types.PathParameter	true				"User"
 //	@Produce	json
 //	@Success	200	{map}		string
+//	@Failure	400	{string}	string
 //	@Failure	404	{string}	string
 //	@Router		/user/{id}/remove [put]
 func (h *UserHandler) HandleRemoveFriend(c *fiber.Ctx) error {
@@ -184,17 +262,205 @@ func (h *UserHandler) HandleRemoveFriend(c *fiber.Ctx) error {
 		userID = c.Params("id")
 		param  types.AddFriendParam
 	)
-	_, err := primitive.ObjectIDFromHex(userID)
+	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return ErrBadRequest(err)
 	}
 	if err := c.BodyParser(&param); err != nil {
 		return ErrBadRequest(err)
 	}
-	filter := db.Map{"_id": userID}
-	err = h.userStore.RemoveFriend(c.Context(), filter, userID, param.UserID)
+	friend, err := primitive.ObjectIDFromHex(param.UserID)
 	if err != nil {
-		return ErrNotResourceNotFound(err)
+		return ErrBadRequest(err)
+	}
+	err = h.userStore.RemoveFriend(c.Context(), db.UserFilter{ID: oid}, friend)
+	if err != nil {
+		return err
 	}
 	return c.JSON(map[string]string{"remove friend": param.UserID})
 }
+
+// HandleBlockUser BlockUser Block User
+//
+//	@Summary	Blocking user, so that neither sees the other's posts
+//	@Tags		Users
+//	@Param		user	userID	path				types.PathParameter	true	"ID of user"
+//	@Param		userID	body	types.PathParameter	true				"User to block"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/block [put]
+func (h *UserHandler) HandleBlockUser(c *fiber.Ctx) error {
+	var (
+		userID = c.Params("id")
+		param  types.AddFriendParam
+	)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	blocked, err := primitive.ObjectIDFromHex(param.UserID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if blocked == oid {
+		return ErrBadRequest(errors.New("users cannot block themselves"))
+	}
+	if err := h.userStore.BlockUser(c.Context(), db.UserFilter{ID: oid}, blocked); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"block": param.UserID})
+}
+
+// HandleUnblockUser UnblockUser Unblock User
+//
+//	@Summary	Unblocking user
+//	@Tags		Users
+//	@Param		user	userID	path				types.PathParameter	true	"ID of user"
+//	@Param		userID	body	types.PathParameter	true				"User to unblock"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/unblock [put]
+func (h *UserHandler) HandleUnblockUser(c *fiber.Ctx) error {
+	var (
+		userID = c.Params("id")
+		param  types.AddFriendParam
+	)
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&param); err != nil {
+		return ErrBadRequest(err)
+	}
+	blocked, err := primitive.ObjectIDFromHex(param.UserID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.userStore.UnblockUser(c.Context(), db.UserFilter{ID: oid}, blocked); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"unblock": param.UserID})
+}
+
+// HandleRegisterDevice RegisterDevice Register Device
+//
+//	@Summary	Registering device for push notifications
+//	@Tags		Users
+//	@Param		user	userID	path						types.PathParameter	true	"ID of user"
+//	@Param		device	body	types.RegisterDeviceParams	true				"Device"
+//	@Produce	json
+//	@Success	200	{object}	types.Device
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/devices [post]
+func (h *UserHandler) HandleRegisterDevice(c *fiber.Ctx) error {
+	var (
+		userID = c.Params("id")
+		params types.RegisterDeviceParams
+	)
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	device := types.NewDeviceFromParams(params)
+	if err := h.userStore.UpsertDevice(c.Context(), userID, device); err != nil {
+		return err
+	}
+	return c.JSON(device)
+}
+
+// HandleRemoveDevice RemoveDevice Remove Device
+//
+//	@Summary	Removing device
+//	@Tags		Users
+//	@Param		user	userID	path						types.PathParameter	true	"ID of user"
+//	@Param		device	body	types.RemoveDeviceParams	true				"Device"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Router		/user/{id}/devices [delete]
+func (h *UserHandler) HandleRemoveDevice(c *fiber.Ctx) error {
+	var (
+		userID = c.Params("id")
+		params types.RemoveDeviceParams
+	)
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.userStore.RemoveDevice(c.Context(), userID, params.Token); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"removed device": params.Token})
+}
+
+// HandleGetNotificationSettings GetNotificationSettings Get Notification Settings
+//
+//	@Summary	Getting notification settings
+//	@Tags		Users
+//	@Param		user	userID	path	types.PathParameter	true	"ID of user"
+//	@Produce	json
+//	@Success	200	{object}	types.NotificationSettings
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/notification-settings [get]
+func (h *UserHandler) HandleGetNotificationSettings(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	user, err := h.userStore.GetUser(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(user.Notifications)
+}
+
+// HandlePutNotificationSettings UpdateNotificationSettings Update Notification Settings
+//
+//	@Summary	Updating notification settings
+//	@Tags		Users
+//	@Param		user		userID	path						types.PathParameter	true	"ID of user"
+//	@Param		settings	body	types.NotificationSettings	true				"Notification settings"
+//	@Produce	json
+//	@Success	200	{object}	types.NotificationSettings
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/user/{id}/notification-settings [put]
+func (h *UserHandler) HandlePutNotificationSettings(c *fiber.Ctx) error {
+	var (
+		userID   = c.Params("id")
+		settings types.NotificationSettings
+	)
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&settings); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := settings.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	if err := h.userStore.UpdateNotificationSettings(c.Context(), userID, settings); err != nil {
+		return err
+	}
+	return c.JSON(settings)
+}
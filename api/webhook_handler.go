@@ -0,0 +1,213 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/MiladJlz/blog_app/webhook"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookHandler struct {
+	webhookStore db.WebhookStore
+	jobs         queue.Enqueuer
+}
+
+func NewWebhookHandler(webhookStore db.WebhookStore, jobs queue.Enqueuer) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+		jobs:         jobs,
+	}
+}
+
+// HandleInsertWebhook InsertWebhook insert webhook
+//
+//	@Summary	Subscribing a URL to blog events. The secret is only returned here.
+//	@Tags		Admin
+//	@Param		webhook	body	types.CreateWebhookParams	true	"New webhook"
+//	@Produce	json
+//	@Success	200	{object}	types.WebhookWithSecret
+//	@Failure	400	{string}	string
+//	@Router		/admin/webhooks [post]
+func (h *WebhookHandler) HandleInsertWebhook(c *fiber.Ctx) error {
+	var params types.CreateWebhookParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	secret := params.Secret
+	if len(secret) == 0 {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	inserted, err := h.webhookStore.InsertWebhook(c.Context(), types.NewWebhookFromParams(params, secret))
+	if err != nil {
+		return err
+	}
+	return c.JSON(types.WebhookWithSecret{Webhook: inserted, Secret: secret})
+}
+
+// HandleGetWebhooks GetWebhooks get webhooks
+//
+//	@Summary	Getting webhooks
+//	@Tags		Admin
+//	@Produce	json
+//	@Success	200	{array}	types.Webhook
+//	@Router		/admin/webhooks [get]
+func (h *WebhookHandler) HandleGetWebhooks(c *fiber.Ctx) error {
+	webhooks, err := h.webhookStore.GetWebhooks(c.Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(webhooks)
+}
+
+// HandleGetWebhook GetWebhook get webhook
+//
+//	@Summary	Getting webhook
+//	@Tags		Admin
+//	@Param		webhook	webhookID	path	types.PathParameter	true	"ID of webhook"
+//	@Produce	json
+//	@Success	200	{object}	types.Webhook
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/webhooks/{id} [get]
+func (h *WebhookHandler) HandleGetWebhook(c *fiber.Ctx) error {
+	id := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	hook, err := h.webhookStore.GetWebhook(c.Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(hook)
+}
+
+// HandlePutWebhook UpdateWebhook update webhook
+//
+//	@Summary	Updating webhook
+//	@Tags		Admin
+//	@Param		webhook	webhookID	path						types.PathParameter	true	"ID of webhook"
+//	@Param		params	body		types.UpdateWebhookParams	true				"Changes"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/webhooks/{id} [put]
+func (h *WebhookHandler) HandlePutWebhook(c *fiber.Ctx) error {
+	var (
+		params types.UpdateWebhookParams
+		id     = c.Params("id")
+	)
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest(err)
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.JSON(errors)
+	}
+	if err := h.webhookStore.UpdateWebhook(c.Context(), oid, params); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"updated": id})
+}
+
+// HandleDeleteWebhook DeleteWebhook delete webhook
+//
+//	@Summary	Deleting webhook and its delivery log
+//	@Tags		Admin
+//	@Param		webhook	webhookID	path	types.PathParameter	true	"ID of webhook"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/webhooks/{id} [delete]
+func (h *WebhookHandler) HandleDeleteWebhook(c *fiber.Ctx) error {
+	id := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	if err := h.webhookStore.DeleteWebhook(c.Context(), id); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"deleted": id})
+}
+
+// HandleGetDeliveries GetDeliveries get webhook deliveries
+//
+//	@Summary	Getting delivery log of webhook, newest first
+//	@Tags		Admin
+//	@Param		webhook	webhookID	path	types.PathParameter	true	"ID of webhook"
+//	@Param		page	query		int		false	"Page number"
+//	@Param		limit	query		int		false	"Deliveries per page"
+//	@Produce	json
+//	@Success	200	{array}		types.WebhookDelivery
+//	@Failure	400	{string}	string
+//	@Router		/admin/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) HandleGetDeliveries(c *fiber.Ctx) error {
+	id := c.Params("id")
+	_, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	deliveries, err := h.webhookStore.GetDeliveries(c.Context(), id, page, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(deliveries)
+}
+
+// HandleReplayDelivery ReplayDelivery replay webhook delivery
+//
+//	@Summary	Sending a delivery again, whatever its status
+//	@Tags		Admin
+//	@Param		webhook		webhookID	path	types.PathParameter	true	"ID of webhook"
+//	@Param		delivery	deliveryID	path	types.PathParameter	true	"ID of delivery"
+//	@Produce	json
+//	@Success	200	{map}		string
+//	@Failure	400	{string}	string
+//	@Failure	404	{string}	string
+//	@Router		/admin/webhooks/{id}/deliveries/{deliveryID}/replay [post]
+func (h *WebhookHandler) HandleReplayDelivery(c *fiber.Ctx) error {
+	var (
+		id         = c.Params("id")
+		deliveryID = c.Params("deliveryID")
+	)
+	webhookOID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrBadRequest(err)
+	}
+	delivery, err := h.webhookStore.GetDelivery(c.Context(), deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.Webhook != webhookOID {
+		return ErrForbidden()
+	}
+	if err := h.webhookStore.ResetDelivery(c.Context(), deliveryID); err != nil {
+		return err
+	}
+	// deliveryID is only valid during the request; the job outlives it.
+	if _, err := h.jobs.Enqueue(c.Context(), webhook.JobDeliver, map[string]string{"delivery": delivery.ID.Hex()}); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"replayed": delivery.ID.Hex()})
+}
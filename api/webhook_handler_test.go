@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/MiladJlz/blog_app/webhook"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordingJobs keeps the jobs it is given instead of running them.
+type recordingJobs struct {
+	jobs []*types.Job
+}
+
+func (r *recordingJobs) Enqueue(ctx context.Context, jobType string, payload map[string]string) (*types.Job, error) {
+	job := types.NewJob(jobType, payload, 1, time.Now())
+	r.jobs = append(r.jobs, job)
+	return job, nil
+}
+
+func TestReplayDelivery(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQLite(ctx, filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	webhooks := db.NewSQLiteWebhookStore(sqlDB)
+	hook, err := webhooks.InsertWebhook(ctx, types.NewWebhookFromParams(types.CreateWebhookParams{URL: "https://example.com/hooks", Events: []string{types.WebhookAllEvents}}, "secret"))
+	if err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	delivery, err := webhooks.InsertDelivery(ctx, &types.WebhookDelivery{
+		Webhook:   hook.ID,
+		Event:     types.WebhookPostCreated,
+		Payload:   `{"event":"post.created"}`,
+		Status:    types.DeliverySucceeded,
+		Attempts:  []types.DeliveryAttempt{{At: time.Now(), StatusCode: http.StatusOK}},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("InsertDelivery: %v", err)
+	}
+	jobs := &recordingJobs{}
+	handler := api.NewWebhookHandler(webhooks, jobs)
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/admin/webhooks/:id/deliveries/:deliveryID/replay", handler.HandleReplayDelivery)
+
+	for _, tc := range []struct {
+		name    string
+		webhook string
+		want    int
+	}{
+		{"another webhook's delivery", primitive.NewObjectID().Hex(), http.StatusForbidden},
+		{"a bad webhook ID", "nope", http.StatusBadRequest},
+		{"replay", hook.ID.Hex(), http.StatusOK},
+	} {
+		path := "/admin/webhooks/" + tc.webhook + "/deliveries/" + delivery.ID.Hex() + "/replay"
+		if resp := do(t, app, http.MethodPost, path, "", nil); resp.StatusCode != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+	if resp := do(t, app, http.MethodPost, "/admin/webhooks/"+hook.ID.Hex()+"/deliveries/"+hook.ID.Hex()+"/replay", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a missing delivery: got status %d, want 404", resp.StatusCode)
+	}
+
+	got, err := webhooks.GetDelivery(ctx, delivery.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	if got.Status != types.DeliveryPending || len(got.Attempts) != 1 {
+		t.Errorf("replayed delivery: got status %s with %d attempts, want pending with its log kept", got.Status, len(got.Attempts))
+	}
+	if len(jobs.jobs) != 1 || jobs.jobs[0].Type != webhook.JobDeliver || jobs.jobs[0].Payload["delivery"] != delivery.ID.Hex() {
+		t.Errorf("queued jobs: got %+v, want one delivery of %s", jobs.jobs, delivery.ID.Hex())
+	}
+}
@@ -0,0 +1,331 @@
+// Package bulk moves blog content in and out in bulk, for migrations from and
+// to other platforms. Every format is read into and written from Records, so
+// importing and exporting are the same whatever the format.
+package bulk
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSONL    = "jsonl"
+	FormatCSV      = "csv"
+	FormatWXR      = "wxr"
+	FormatMarkdown = "markdown"
+)
+
+// Formats lists the formats Decode and Encode take.
+var Formats = []string{FormatJSONL, FormatCSV, FormatWXR, FormatMarkdown}
+
+var formatFiles = map[string]struct {
+	extension   string
+	contentType string
+}{
+	FormatJSONL:    {".jsonl", "application/x-ndjson"},
+	FormatCSV:      {".csv", "text/csv"},
+	FormatWXR:      {".xml", "application/rss+xml"},
+	FormatMarkdown: {".zip", "application/zip"},
+}
+
+// Record is a post and its author, or an author alone when Content is empty.
+// Posts are always kind post: reposts and quotes point at other posts, which
+// other platforms do not have.
+type Record struct {
+	// ID, if set, is the post's ObjectID, kept so that importing an
+	// export again reports the posts already there.
+	ID              string
+	AuthorEmail     string
+	AuthorFirstName string
+	AuthorLastName  string
+	Content         string
+	CreatedAt       time.Time
+	// Visibility is the post's: public, friends or private. Posts without
+	// one are public.
+	Visibility string
+
+	// Source says where the record was read from, such as a line or a
+	// file, for the import report.
+	Source string
+	// Err is set for a record that could not be read, which the import
+	// reports in its place.
+	Err error
+}
+
+// RecordError is a record an import skipped, and why.
+type RecordError struct {
+	Record string `json:"record" example:"line 3"`
+	Error  string `json:"error" example:"email foo is invalid"`
+}
+
+// Report sums up an import.
+type Report struct {
+	Records      int           `json:"records" example:"120"`
+	UsersCreated int           `json:"users_created" example:"4"`
+	PostsCreated int           `json:"posts_created" example:"115"`
+	Errors       []RecordError `json:"errors"`
+}
+
+// Importer stores records, creating their authors on first sight. Authors
+// are matched to existing users by email.
+type Importer struct {
+	userStore db.UserStore
+	postStore db.PostStore
+	// authors maps the emails seen so far to their users.
+	authors map[string]primitive.ObjectID
+}
+
+func NewImporter(userStore db.UserStore, postStore db.PostStore) *Importer {
+	return &Importer{
+		userStore: userStore,
+		postStore: postStore,
+		authors:   map[string]primitive.ObjectID{},
+	}
+}
+
+// Import stores records, carrying on past those that fail, which the report
+// lists. It stops early only if ctx is done.
+func (im *Importer) Import(ctx context.Context, records []Record) Report {
+	report := Report{Errors: []RecordError{}}
+	for _, record := range records {
+		if ctx.Err() != nil {
+			report.Errors = append(report.Errors, RecordError{Record: record.Source, Error: ctx.Err().Error()})
+			break
+		}
+		report.Records++
+		if err := im.importRecord(ctx, record, &report); err != nil {
+			report.Errors = append(report.Errors, RecordError{Record: record.Source, Error: err.Error()})
+		}
+	}
+	return report
+}
+
+func (im *Importer) importRecord(ctx context.Context, record Record, report *Report) error {
+	if record.Err != nil {
+		return record.Err
+	}
+	if len(strings.TrimSpace(record.Content)) == 0 {
+		_, err := im.author(ctx, record, report)
+		return err
+	}
+	// the post is checked before its author is created, so that a post
+	// that fails leaves no user behind
+	params := types.CreatePostParams{Content: record.Content, Visibility: record.Visibility}
+	if errors := params.Validate(); len(errors) > 0 {
+		return validationError(errors)
+	}
+	post := types.NewPostFromParams(params)
+	if len(record.ID) > 0 {
+		id, err := primitive.ObjectIDFromHex(record.ID)
+		if err != nil {
+			return fmt.Errorf("id %s is invalid", record.ID)
+		}
+		post.ID = id
+	}
+	author, err := im.author(ctx, record, report)
+	if err != nil {
+		return err
+	}
+	post.Author = author
+	if !record.CreatedAt.IsZero() {
+		post.CreatedAt = record.CreatedAt
+	}
+	if _, err := im.postStore.InsertPost(ctx, post); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			return fmt.Errorf("post %s already exists", record.ID)
+		}
+		return err
+	}
+	report.PostsCreated++
+	return nil
+}
+
+// author returns the ID of the record's author, creating them if no user has
+// their email. A new author without a name is named after their email.
+func (im *Importer) author(ctx context.Context, record Record, report *Report) (primitive.ObjectID, error) {
+	email := strings.ToLower(strings.TrimSpace(record.AuthorEmail))
+	if id, ok := im.authors[email]; ok {
+		return id, nil
+	}
+	user, err := im.userStore.GetUserByEmail(ctx, email)
+	if err == nil {
+		im.authors[email] = user.ID
+		return user.ID, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return primitive.NilObjectID, err
+	}
+	params := types.ImportUserParams{
+		FirstName: strings.TrimSpace(record.AuthorFirstName),
+		LastName:  strings.TrimSpace(record.AuthorLastName),
+		Email:     email,
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return primitive.NilObjectID, validationError(errors)
+	}
+	if len(params.FirstName) == 0 && len(params.LastName) == 0 {
+		params.FirstName, _, _ = strings.Cut(email, "@")
+	}
+	user, err = im.userStore.InsertUser(ctx, types.NewUserFromImport(params))
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	report.UsersCreated++
+	im.authors[email] = user.ID
+	return user.ID, nil
+}
+
+func validationError(errors map[string]string) error {
+	messages := make([]string, 0, len(errors))
+	for _, message := range errors {
+		messages = append(messages, message)
+	}
+	slices.Sort(messages)
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// Export returns every user and their posts as records: first the users
+// without posts, then the posts, oldest first. Reposts and quotes are left
+// out.
+func Export(ctx context.Context, userStore db.UserStore, postStore db.PostStore) ([]Record, error) {
+	users, err := userStore.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := postStore.FindPosts(ctx, db.PostFilter{Kinds: []string{types.PostKindPost}}, db.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+	authors := map[primitive.ObjectID]*types.User{}
+	for _, user := range users {
+		authors[user.ID] = user
+	}
+	posted := map[primitive.ObjectID]bool{}
+	for _, post := range posts {
+		posted[post.Author] = true
+	}
+	var records []Record
+	for _, user := range users {
+		if !posted[user.ID] {
+			records = append(records, Record{
+				AuthorEmail:     user.Email,
+				AuthorFirstName: user.FirstName,
+				AuthorLastName:  user.LastName,
+			})
+		}
+	}
+	for _, post := range posts {
+		author, ok := authors[post.Author]
+		if !ok {
+			// the author was deleted and the post left behind
+			continue
+		}
+		records = append(records, Record{
+			ID:              post.ID.Hex(),
+			AuthorEmail:     author.Email,
+			AuthorFirstName: author.FirstName,
+			AuthorLastName:  author.LastName,
+			Content:         post.Content,
+			CreatedAt:       post.CreatedAt,
+			Visibility:      post.Visibility,
+		})
+	}
+	return records, nil
+}
+
+// Decode reads records in format from r. Markdown is read from a zip archive
+// of the directory. Records that cannot be read are returned with Err set;
+// the error is for input that cannot be read at all.
+func Decode(format string, r io.Reader) ([]Record, error) {
+	switch format {
+	case FormatJSONL:
+		return ReadJSONL(r)
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatWXR:
+		return ReadWXR(r)
+	case FormatMarkdown:
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		archive, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, err
+		}
+		return ReadMarkdown(archive)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// Encode writes records to w in format. Markdown is written as a zip archive
+// of the directory.
+func Encode(format string, w io.Writer, records []Record) error {
+	switch format {
+	case FormatJSONL:
+		return WriteJSONL(w, records)
+	case FormatCSV:
+		return WriteCSV(w, records)
+	case FormatWXR:
+		return WriteWXR(w, records)
+	case FormatMarkdown:
+		archive := zip.NewWriter(w)
+		err := WriteMarkdown(records, func(name string, content []byte) error {
+			f, err := archive.Create(name)
+			if err != nil {
+				return err
+			}
+			_, err = f.Write(content)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return archive.Close()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// FileName returns the name of an export in format.
+func FileName(format string) string {
+	return "export" + formatFiles[format].extension
+}
+
+// ContentType returns the media type of an export in format.
+func ContentType(format string) string {
+	return formatFiles[format].contentType
+}
+
+// parseTime accepts the timestamps the formats use: RFC 3339, WordPress's
+// UTC 2006-01-02 15:04:05, RSS's RFC 1123 or a plain date.
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, "2006-01-02T15:04:05", time.RFC1123Z, time.RFC1123, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("time %s is invalid", value)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
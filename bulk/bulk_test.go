@@ -0,0 +1,330 @@
+package bulk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/bulk"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// same reports whether two records say the same, leaving out where they were
+// read from.
+func same(a, b bulk.Record) bool {
+	return a.ID == b.ID && a.AuthorEmail == b.AuthorEmail && a.AuthorFirstName == b.AuthorFirstName &&
+		a.AuthorLastName == b.AuthorLastName && a.Content == b.Content && a.CreatedAt.Equal(b.CreatedAt) &&
+		a.Visibility == b.Visibility && a.Err == nil && b.Err == nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2024, 9, 7, 16, 23, 33, 0, time.UTC)
+	authorOnly := bulk.Record{AuthorEmail: "quiet@blog.test", AuthorFirstName: "Quiet"}
+	posts := []bulk.Record{
+		{ID: "66db2c856699531daa9abc16", AuthorEmail: "foo@blog.test", AuthorFirstName: "Foo", AuthorLastName: "Bar", Content: "A post, with \"quotes\"\nand lines", CreatedAt: created},
+		{ID: "66db2c856699531daa9abc17", AuthorEmail: "baz@blog.test", AuthorFirstName: "Baz", Content: "یک پست <b>فارسی</b> & more", CreatedAt: created.Add(time.Hour)},
+		{ID: "66db2c856699531daa9abc18", AuthorEmail: "foo@blog.test", AuthorFirstName: "Foo", AuthorLastName: "Bar", Content: "A private post", CreatedAt: created.Add(2 * time.Hour), Visibility: types.PostVisibilityPrivate},
+		{ID: "66db2c856699531daa9abc19", AuthorEmail: "baz@blog.test", AuthorFirstName: "Baz", Content: "A post for friends", CreatedAt: created.Add(3 * time.Hour), Visibility: types.PostVisibilityFriends},
+	}
+	for _, format := range bulk.Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := bulk.Encode(format, &buf, append([]bulk.Record{authorOnly}, posts...)); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			records, err := bulk.Decode(format, &buf)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			want := posts
+			// Only the line based formats can hold an author without posts.
+			if format == bulk.FormatJSONL || format == bulk.FormatCSV {
+				want = append([]bulk.Record{authorOnly}, posts...)
+			}
+			if len(records) != len(want) {
+				t.Fatalf("records: got %d, want %d: %+v", len(records), len(want), records)
+			}
+			for i := range want {
+				if !same(records[i], want[i]) {
+					t.Errorf("record %d: got %+v, want %+v", i, records[i], want[i])
+				}
+			}
+		})
+	}
+	if err := bulk.Encode("yaml", &bytes.Buffer{}, posts); err == nil {
+		t.Error("Encode in an unknown format: got no error")
+	}
+	if _, err := bulk.Decode("yaml", strings.NewReader("")); err == nil {
+		t.Error("Decode in an unknown format: got no error")
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	records, err := bulk.ReadJSONL(strings.NewReader(`{"author_email":"foo@blog.test","content":"First post here","created_at":"2024-09-07"}
+
+{"author_email":
+{"author_email":"foo@blog.test","created_at":"yesterday"}
+`))
+	if err != nil {
+		t.Fatalf("ReadJSONL: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("records: got %d, want 3 as blank lines are skipped", len(records))
+	}
+	if r := records[0]; r.Err != nil || r.Source != "line 1" || !r.CreatedAt.Equal(time.Date(2024, 9, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("first record: got %+v", r)
+	}
+	for _, r := range records[1:] {
+		if r.Err == nil {
+			t.Errorf("%s: got no error", r.Source)
+		}
+	}
+	if records[1].Source != "line 3" || records[2].Source != "line 4" {
+		t.Errorf("sources: got %s and %s, want lines 3 and 4", records[1].Source, records[2].Source)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	records, err := bulk.ReadCSV(strings.NewReader(`content,author_email
+"Quoted, with a comma",foo@blog.test
+too,many,fields
+`))
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records: got %d, want 2", len(records))
+	}
+	if r := records[0]; r.Err != nil || r.Content != "Quoted, with a comma" || r.AuthorEmail != "foo@blog.test" {
+		t.Errorf("columns in another order: got %+v", r)
+	}
+	if r := records[1]; r.Err == nil || r.Source != "line 3" {
+		t.Errorf("a row with too many fields: got %+v, want an error on line 3", r)
+	}
+	if _, err := bulk.ReadCSV(strings.NewReader("content\nA post without author\n")); err == nil {
+		t.Error("no author_email column: got no error")
+	}
+}
+
+func TestReadWXR(t *testing.T) {
+	records, err := bulk.ReadWXR(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<wp:author><wp:author_login>admin</wp:author_login><wp:author_email>admin@blog.test</wp:author_email><wp:author_display_name>Site Admin</wp:author_display_name></wp:author>
+	<item>
+		<title>Hello world</title>
+		<dc:creator>admin</dc:creator>
+		<guid isPermaLink="false">https://blog.test/?p=1</guid>
+		<content:encoded><![CDATA[Welcome to <em>WordPress</em>.]]></content:encoded>
+		<excerpt:encoded><![CDATA[Not the content]]></excerpt:encoded>
+		<wp:post_date_gmt>2024-09-07 16:23:33</wp:post_date_gmt>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+	</item>
+	<item>
+		<title>Draft</title>
+		<dc:creator>admin</dc:creator>
+		<content:encoded><![CDATA[Not ready yet]]></content:encoded>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>draft</wp:status>
+	</item>
+	<item>
+		<title>About</title>
+		<dc:creator>admin</dc:creator>
+		<wp:post_type>page</wp:post_type>
+		<wp:status>publish</wp:status>
+	</item>
+	<item>
+		<title>Unpublished date</title>
+		<dc:creator>admin</dc:creator>
+		<content:encoded><![CDATA[Falls back to pubDate]]></content:encoded>
+		<pubDate>Sat, 07 Sep 2024 18:00:00 +0000</pubDate>
+		<wp:post_date_gmt>0000-00-00 00:00:00</wp:post_date_gmt>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+	</item>
+	<item>
+		<dc:creator>ghost</dc:creator>
+		<content:encoded><![CDATA[By nobody in the export]]></content:encoded>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+	</item>
+	<item>
+		<title>Private</title>
+		<dc:creator>admin</dc:creator>
+		<content:encoded><![CDATA[Only for me]]></content:encoded>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>private</wp:status>
+	</item>
+</channel>
+</rss>
+`))
+	if err != nil {
+		t.Fatalf("ReadWXR: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("records: got %d, want 4 leaving out drafts and pages", len(records))
+	}
+	want := bulk.Record{
+		AuthorEmail:     "admin@blog.test",
+		AuthorFirstName: "Site Admin",
+		Content:         "Hello world\n\nWelcome to <em>WordPress</em>.",
+		CreatedAt:       time.Date(2024, 9, 7, 16, 23, 33, 0, time.UTC),
+	}
+	if !same(records[0], want) {
+		t.Errorf("first post: got %+v, want %+v", records[0], want)
+	}
+	if r := records[1]; r.Err != nil || !r.CreatedAt.Equal(time.Date(2024, 9, 7, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("post without a GMT date: got %+v", r)
+	}
+	if r := records[2]; r.Err == nil || r.Source != "item 5" {
+		t.Errorf("post by an unknown author: got %+v, want an error for item 5", r)
+	}
+	if r := records[3]; r.Err != nil || r.Visibility != types.PostVisibilityPrivate {
+		t.Errorf("private post: got %+v, want it kept private", r)
+	}
+	if _, err := bulk.ReadWXR(strings.NewReader("<rss><channel>")); err == nil {
+		t.Error("truncated XML: got no error")
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	records, err := bulk.ReadMarkdown(fstest.MapFS{
+		"posts/2024-09-07-hello.md": {Data: []byte("---\r\ntitle: Hello\r\nauthor: Foo Bar Baz\r\nemail: foo@blog.test\r\ndate: 2024-09-07T16:23:33Z\r\n---\r\n\r\nThe body.\r\n")},
+		"posts/empty-body.markdown": {Data: []byte("---\nauthor_email: foo@blog.test\n---")},
+		"posts/no-front-matter.md":  {Data: []byte("Just text\n")},
+		"posts/unclosed.md":         {Data: []byte("---\ntitle: Oops\n")},
+		"posts/image.png":           {Data: []byte{0x89}},
+	})
+	if err != nil {
+		t.Fatalf("ReadMarkdown: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("records: got %d, want the 4 Markdown files", len(records))
+	}
+	want := bulk.Record{
+		AuthorEmail:     "foo@blog.test",
+		AuthorFirstName: "Foo",
+		AuthorLastName:  "Bar Baz",
+		Content:         "Hello\n\nThe body.",
+		CreatedAt:       time.Date(2024, 9, 7, 16, 23, 33, 0, time.UTC),
+	}
+	if !same(records[0], want) || records[0].Source != "posts/2024-09-07-hello.md" {
+		t.Errorf("first file: got %+v, want %+v", records[0], want)
+	}
+	if r := records[1]; r.Err != nil || r.AuthorEmail != "foo@blog.test" || len(r.Content) != 0 {
+		t.Errorf("front matter closing the file: got %+v", r)
+	}
+	for _, r := range records[2:] {
+		if r.Err == nil {
+			t.Errorf("%s: got no error", r.Source)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	users := db.NewMemoryUserStore()
+	posts := db.NewMemoryPostStore()
+	existing, err := users.InsertUser(ctx, types.NewUserFromImport(types.ImportUserParams{FirstName: "Existing", Email: "existing@blog.test"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []bulk.Record{
+		{Source: "line 1", ID: "66db2c856699531daa9abc16", AuthorEmail: "New@Blog.test ", Content: "An imported post", CreatedAt: created},
+		{Source: "line 2", AuthorEmail: "new@blog.test", AuthorFirstName: "Ignored", Content: "Another imported post"},
+		{Source: "line 3", AuthorEmail: "existing@blog.test", Content: "A post by a user already here", Visibility: types.PostVisibilityPrivate},
+		{Source: "line 4", AuthorEmail: "nameless@blog.test"},
+		{Source: "line 5", AuthorEmail: "not an email", Content: "A post by nobody valid"},
+		{Source: "line 6", AuthorEmail: "short@blog.test", Content: "Too short"},
+		{Source: "line 7", ID: "nope", AuthorEmail: "badid@blog.test", Content: "A post with a bad ID"},
+		{Source: "line 8", Err: errors.New("unexpected end of JSON input")},
+		{Source: "line 9", AuthorEmail: "secret@blog.test", Content: "A post nobody can read", Visibility: "secret"},
+	}
+	report := bulk.NewImporter(users, posts).Import(ctx, records)
+
+	if report.Records != 9 || report.UsersCreated != 2 || report.PostsCreated != 3 {
+		t.Errorf("report: got %d records, %d users and %d posts, want 9, 2 and 3", report.Records, report.UsersCreated, report.PostsCreated)
+	}
+	failed := map[string]bool{}
+	for _, e := range report.Errors {
+		failed[e.Record] = true
+	}
+	for _, source := range []string{"line 5", "line 6", "line 7", "line 8", "line 9"} {
+		if !failed[source] {
+			t.Errorf("%s is not reported: %+v", source, report.Errors)
+		}
+	}
+	if len(report.Errors) != 5 {
+		t.Errorf("errors: got %+v, want 5", report.Errors)
+	}
+	for _, email := range []string{"short@blog.test", "badid@blog.test", "secret@blog.test"} {
+		if _, err := users.GetUserByEmail(ctx, email); err == nil {
+			t.Errorf("the author of a post that failed, %s, was created", email)
+		}
+	}
+	author, err := users.GetUserByEmail(ctx, "new@blog.test")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if author.FirstName != "new" {
+		t.Errorf("author without a name: got %q, want them named after their email", author.FirstName)
+	}
+	post, err := posts.GetPostByID(ctx, "66db2c856699531daa9abc16")
+	if err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	if post.Author != author.ID || !post.CreatedAt.Equal(created) {
+		t.Errorf("imported post: got author %s at %v, want %s at %v", post.Author.Hex(), post.CreatedAt, author.ID.Hex(), created)
+	}
+	mine, err := posts.FindPosts(ctx, db.PostFilter{Authors: []primitive.ObjectID{existing.ID}}, db.FindOptions{})
+	if err != nil {
+		t.Fatalf("FindPosts: %v", err)
+	}
+	if len(mine) != 1 || mine[0].Visibility != types.PostVisibilityPrivate {
+		t.Errorf("posts of the existing user: got %+v, want 1 private post", mine)
+	}
+
+	// Importing an export again reports the posts already there.
+	exported, err := bulk.Export(ctx, users, posts)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(exported) != 4 {
+		t.Fatalf("exported: got %d records, want the nameless author and 3 posts", len(exported))
+	}
+	if r := exported[0]; r.AuthorEmail != "nameless@blog.test" || len(r.Content) != 0 {
+		t.Errorf("first exported record: got %+v, want the author without posts", r)
+	}
+	for _, r := range exported[1:] {
+		want := types.PostVisibilityPublic
+		if r.AuthorEmail == "existing@blog.test" {
+			want = types.PostVisibilityPrivate
+		}
+		if r.Visibility != want {
+			t.Errorf("exported post by %s: got visibility %q, want %q", r.AuthorEmail, r.Visibility, want)
+		}
+	}
+	again := bulk.NewImporter(users, posts).Import(ctx, exported)
+	if again.UsersCreated != 0 || again.PostsCreated != 0 || len(again.Errors) != 3 {
+		t.Errorf("importing the export again: got %d users, %d posts and errors %+v, want only 3 errors", again.UsersCreated, again.PostsCreated, again.Errors)
+	}
+}
+
+func TestImportStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := bulk.NewImporter(db.NewMemoryUserStore(), db.NewMemoryPostStore()).Import(ctx, []bulk.Record{
+		{Source: "line 1", AuthorEmail: "foo@blog.test", Content: "Never imported"},
+		{Source: "line 2", AuthorEmail: "foo@blog.test", Content: "Never imported"},
+	})
+	if report.Records != 0 || len(report.Errors) != 1 || report.Errors[0].Record != "line 1" {
+		t.Errorf("report: got %+v, want one error for line 1", report)
+	}
+}
@@ -0,0 +1,89 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// csvColumns are the columns of a CSV export. An import finds them by the
+// header row, so they may come in any order and all but author_email may be
+// left out.
+var csvColumns = []string{"id", "author_email", "author_first_name", "author_last_name", "content", "created_at", "visibility"}
+
+// ReadCSV reads one record per row after the header row.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the header row: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["author_email"]; !ok {
+		return nil, errors.New("the header row has no author_email column")
+	}
+	var records []Record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			records = append(records, Record{Source: fmt.Sprintf("line %d", parseErr.StartLine), Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		record := Record{Source: fmt.Sprintf("line %d", line)}
+		if len(row) != len(header) {
+			record.Err = fmt.Errorf("%d fields, want %d", len(row), len(header))
+			records = append(records, record)
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return row[i]
+			}
+			return ""
+		}
+		record.ID = field("id")
+		record.AuthorEmail = field("author_email")
+		record.AuthorFirstName = field("author_first_name")
+		record.AuthorLastName = field("author_last_name")
+		record.Content = field("content")
+		record.Visibility = field("visibility")
+		record.CreatedAt, record.Err = parseTime(field("created_at"))
+		records = append(records, record)
+	}
+}
+
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		row := []string{
+			record.ID,
+			record.AuthorEmail,
+			record.AuthorFirstName,
+			record.AuthorLastName,
+			record.Content,
+			formatTime(record.CreatedAt),
+			record.Visibility,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
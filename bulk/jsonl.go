@@ -0,0 +1,67 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineSize bounds a JSON Lines record, a post with its author.
+const maxLineSize = 16 << 20
+
+// jsonRecord is a Record as a line of JSON Lines.
+type jsonRecord struct {
+	ID              string `json:"id,omitempty"`
+	AuthorEmail     string `json:"author_email"`
+	AuthorFirstName string `json:"author_first_name,omitempty"`
+	AuthorLastName  string `json:"author_last_name,omitempty"`
+	Content         string `json:"content,omitempty"`
+	CreatedAt       string `json:"created_at,omitempty"`
+	Visibility      string `json:"visibility,omitempty"`
+}
+
+// ReadJSONL reads one record per line. Blank lines are skipped.
+func ReadJSONL(r io.Reader) ([]Record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	var records []Record
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		record := Record{Source: fmt.Sprintf("line %d", line)}
+		var jr jsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &jr); err != nil {
+			record.Err = err
+			records = append(records, record)
+			continue
+		}
+		record.ID, record.AuthorEmail, record.AuthorFirstName, record.AuthorLastName, record.Content, record.Visibility =
+			jr.ID, jr.AuthorEmail, jr.AuthorFirstName, jr.AuthorLastName, jr.Content, jr.Visibility
+		record.CreatedAt, record.Err = parseTime(jr.CreatedAt)
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func WriteJSONL(w io.Writer, records []Record) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, record := range records {
+		err := enc.Encode(jsonRecord{
+			ID:              record.ID,
+			AuthorEmail:     record.AuthorEmail,
+			AuthorFirstName: record.AuthorFirstName,
+			AuthorLastName:  record.AuthorLastName,
+			Content:         record.Content,
+			CreatedAt:       formatTime(record.CreatedAt),
+			Visibility:      record.Visibility,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,128 @@
+package bulk
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// A Markdown post is a file with YAML front matter between --- lines, as
+// static site generators such as Jekyll and Hugo keep them. The body is
+// taken as it is.
+
+const frontMatterDelimiter = "---"
+
+// frontMatter holds the keys WriteMarkdown writes, and the author, email and
+// title other generators use. Visibility is this app's own.
+type frontMatter struct {
+	ID              string `yaml:"id,omitempty"`
+	Title           string `yaml:"title,omitempty"`
+	Date            string `yaml:"date,omitempty"`
+	Author          string `yaml:"author,omitempty"`
+	Email           string `yaml:"email,omitempty"`
+	AuthorEmail     string `yaml:"author_email,omitempty"`
+	AuthorFirstName string `yaml:"author_first_name,omitempty"`
+	AuthorLastName  string `yaml:"author_last_name,omitempty"`
+	Visibility      string `yaml:"visibility,omitempty"`
+}
+
+// ReadMarkdown reads every .md and .markdown file under fsys, in lexical
+// order. A title becomes the first line of the content, and an author given
+// as a single name is split at its first space.
+func ReadMarkdown(fsys fs.FS) ([]Record, error) {
+	var records []Record
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := path.Ext(name); entry.IsDir() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		record := Record{Source: name}
+		record.Err = parseMarkdown(b, &record)
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func parseMarkdown(b []byte, record *Record) error {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	rest, ok := bytes.CutPrefix(b, []byte(frontMatterDelimiter+"\n"))
+	if !ok {
+		return fmt.Errorf("no front matter")
+	}
+	header, body, ok := bytes.Cut(rest, []byte("\n"+frontMatterDelimiter+"\n"))
+	if !ok {
+		if header, ok = bytes.CutSuffix(rest, []byte("\n"+frontMatterDelimiter)); !ok {
+			return fmt.Errorf("front matter is not closed")
+		}
+	}
+	var fm frontMatter
+	if err := yaml.Unmarshal(header, &fm); err != nil {
+		return err
+	}
+	record.ID = fm.ID
+	record.AuthorEmail = fm.AuthorEmail
+	if len(record.AuthorEmail) == 0 {
+		record.AuthorEmail = fm.Email
+	}
+	record.AuthorFirstName, record.AuthorLastName = fm.AuthorFirstName, fm.AuthorLastName
+	if len(record.AuthorFirstName) == 0 && len(record.AuthorLastName) == 0 {
+		record.AuthorFirstName, record.AuthorLastName, _ = strings.Cut(strings.TrimSpace(fm.Author), " ")
+	}
+	record.Visibility = fm.Visibility
+	record.Content = strings.TrimSpace(string(body))
+	if title := strings.TrimSpace(fm.Title); len(title) > 0 {
+		record.Content = title + "\n\n" + record.Content
+	}
+	var err error
+	record.CreatedAt, err = parseTime(fm.Date)
+	return err
+}
+
+// WriteMarkdown calls write with the name and content of a file for each
+// post in records, named after its date and ID. Authors without posts are
+// left out.
+func WriteMarkdown(records []Record, write func(name string, content []byte) error) error {
+	for i, record := range records {
+		if len(record.Content) == 0 {
+			continue
+		}
+		header, err := yaml.Marshal(frontMatter{
+			ID:              record.ID,
+			Date:            formatTime(record.CreatedAt),
+			AuthorEmail:     record.AuthorEmail,
+			AuthorFirstName: record.AuthorFirstName,
+			AuthorLastName:  record.AuthorLastName,
+			Visibility:      record.Visibility,
+		})
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		buf.WriteString(frontMatterDelimiter + "\n")
+		buf.Write(header)
+		buf.WriteString(frontMatterDelimiter + "\n\n")
+		buf.WriteString(record.Content)
+		buf.WriteString("\n")
+		name := record.ID
+		if len(name) == 0 {
+			name = fmt.Sprintf("post-%d", i+1)
+		}
+		if !record.CreatedAt.IsZero() {
+			name = record.CreatedAt.UTC().Format("2006-01-02") + "-" + name
+		}
+		if err := write(name+".md", buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
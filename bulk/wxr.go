@@ -0,0 +1,227 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"strings"
+	"time"
+)
+
+// WordPress eXtended RSS, the format of WordPress's Tools > Export. Elements
+// are read by local name, so every WXR version reads the same, except
+// content:encoded, which has to be told from excerpt:encoded.
+
+const (
+	wxrContentNS = "http://purl.org/rss/1.0/modules/content/"
+	// wxrNoDate is how WordPress writes the GMT date of a post it never
+	// published.
+	wxrNoDate = "0000-00-00 00:00:00"
+	// wxrVisibilityKey is the post meta WriteWXR keeps a post's visibility
+	// in, since WordPress has no friends-only posts.
+	wxrVisibilityKey = "_blog_visibility"
+)
+
+type wxrFeed struct {
+	Channel struct {
+		Authors []wxrAuthor `xml:"author"`
+		Items   []wxrItem   `xml:"item"`
+	} `xml:"channel"`
+}
+
+type wxrAuthor struct {
+	Login       string `xml:"author_login"`
+	Email       string `xml:"author_email"`
+	DisplayName string `xml:"author_display_name"`
+	FirstName   string `xml:"author_first_name"`
+	LastName    string `xml:"author_last_name"`
+}
+
+type wxrItem struct {
+	Title       string `xml:"title"`
+	GUID        string `xml:"guid"`
+	Creator     string `xml:"creator"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	PostDateGMT string `xml:"post_date_gmt"`
+	PostType    string `xml:"post_type"`
+	Status      string `xml:"status"`
+	Postmeta    []struct {
+		Key   string `xml:"meta_key"`
+		Value string `xml:"meta_value"`
+	} `xml:"postmeta"`
+}
+
+// ReadWXR reads the published and private posts of a WordPress export,
+// leaving out pages, attachments and drafts, and the authors without any. A
+// post's title becomes the first line of its content. A GUID is kept as the
+// post's ID if it is one, and so is the visibility, as in exports from
+// WriteWXR. Other private posts stay private.
+func ReadWXR(r io.Reader) ([]Record, error) {
+	var feed wxrFeed
+	if err := xml.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, err
+	}
+	authors := map[string]wxrAuthor{}
+	for _, author := range feed.Channel.Authors {
+		authors[author.Login] = author
+	}
+	var records []Record
+	for i, item := range feed.Channel.Items {
+		if item.PostType != "post" || (item.Status != "publish" && item.Status != "private") {
+			continue
+		}
+		record := Record{Source: fmt.Sprintf("item %d", i+1)}
+		author, ok := authors[item.Creator]
+		if !ok {
+			record.Err = fmt.Errorf("author %s is not in the export", item.Creator)
+			records = append(records, record)
+			continue
+		}
+		record.AuthorEmail, record.AuthorFirstName, record.AuthorLastName = author.Email, author.FirstName, author.LastName
+		if len(record.AuthorFirstName) == 0 && len(record.AuthorLastName) == 0 {
+			record.AuthorFirstName = author.DisplayName
+		}
+		record.Content = strings.TrimSpace(item.Content)
+		if title := strings.TrimSpace(item.Title); len(title) > 0 {
+			record.Content = title + "\n\n" + record.Content
+		}
+		if _, err := primitive.ObjectIDFromHex(item.GUID); err == nil {
+			record.ID = item.GUID
+		}
+		if item.Status == "private" {
+			record.Visibility = types.PostVisibilityPrivate
+		}
+		for _, meta := range item.Postmeta {
+			if meta.Key == wxrVisibilityKey {
+				record.Visibility = meta.Value
+			}
+		}
+		date := item.PostDateGMT
+		if len(date) == 0 || date == wxrNoDate {
+			date = item.PubDate
+		}
+		record.CreatedAt, record.Err = parseTime(date)
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// The elements WriteWXR writes carry their prefix in their name, since
+// encoding/xml would declare a namespace on each of them instead.
+type wxrOutFeed struct {
+	XMLName   xml.Name      `xml:"rss"`
+	Version   string        `xml:"version,attr"`
+	ContentNS string        `xml:"xmlns:content,attr"`
+	DCNS      string        `xml:"xmlns:dc,attr"`
+	WPNS      string        `xml:"xmlns:wp,attr"`
+	Channel   wxrOutChannel `xml:"channel"`
+}
+
+type wxrOutChannel struct {
+	Title      string         `xml:"title"`
+	WXRVersion string         `xml:"wp:wxr_version"`
+	Authors    []wxrOutAuthor `xml:"wp:author"`
+	Items      []wxrOutItem   `xml:"item"`
+}
+
+type wxrOutAuthor struct {
+	Login     string `xml:"wp:author_login"`
+	Email     string `xml:"wp:author_email"`
+	FirstName string `xml:"wp:author_first_name"`
+	LastName  string `xml:"wp:author_last_name"`
+}
+
+type wxrOutItem struct {
+	Title       string `xml:"title"`
+	PubDate     string `xml:"pubDate"`
+	Creator     string `xml:"dc:creator"`
+	GUID        wxrOutGUID
+	Content     wxrOutCDATA      `xml:"content:encoded"`
+	PostDateGMT string           `xml:"wp:post_date_gmt"`
+	PostType    string           `xml:"wp:post_type"`
+	Status      string           `xml:"wp:status"`
+	Postmeta    []wxrOutPostmeta `xml:"wp:postmeta"`
+}
+
+type wxrOutPostmeta struct {
+	Key   string `xml:"wp:meta_key"`
+	Value string `xml:"wp:meta_value"`
+}
+
+type wxrOutGUID struct {
+	XMLName     xml.Name `xml:"guid"`
+	IsPermaLink bool     `xml:"isPermaLink,attr"`
+	Value       string   `xml:",chardata"`
+}
+
+type wxrOutCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// WriteWXR writes records as a WordPress export that WordPress's importer
+// takes. Authors log in with their email, and posts have no title. Posts that
+// are not public are private to WordPress, and keep their visibility in a
+// post meta.
+func WriteWXR(w io.Writer, records []Record) error {
+	feed := wxrOutFeed{
+		Version:   "2.0",
+		ContentNS: wxrContentNS,
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		WPNS:      "http://wordpress.org/export/1.2/",
+		Channel: wxrOutChannel{
+			Title:      "Blog export",
+			WXRVersion: "1.2",
+		},
+	}
+	seen := map[string]bool{}
+	for _, record := range records {
+		if !seen[record.AuthorEmail] {
+			seen[record.AuthorEmail] = true
+			feed.Channel.Authors = append(feed.Channel.Authors, wxrOutAuthor{
+				Login:     record.AuthorEmail,
+				Email:     record.AuthorEmail,
+				FirstName: record.AuthorFirstName,
+				LastName:  record.AuthorLastName,
+			})
+		}
+		if len(record.Content) == 0 {
+			continue
+		}
+		created := record.CreatedAt.UTC()
+		status := "publish"
+		var postmeta []wxrOutPostmeta
+		if len(record.Visibility) > 0 {
+			postmeta = append(postmeta, wxrOutPostmeta{Key: wxrVisibilityKey, Value: record.Visibility})
+			if record.Visibility != types.PostVisibilityPublic {
+				status = "private"
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, wxrOutItem{
+			PubDate:     created.Format(time.RFC1123Z),
+			Creator:     record.AuthorEmail,
+			GUID:        wxrOutGUID{Value: record.ID},
+			Content:     wxrOutCDATA{Value: record.Content},
+			PostDateGMT: created.Format(time.DateTime),
+			PostType:    "post",
+			Status:      status,
+			Postmeta:    postmeta,
+		})
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(bw)
+	enc.Indent("", "\t")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
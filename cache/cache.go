@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	BackendEnvName       = "CACHE_BACKEND"
+	SizeEnvName          = "CACHE_SIZE"
+	TTLEnvName           = "CACHE_TTL"
+	RedisAddrEnvName     = "REDIS_ADDR"
+	RedisPasswordEnvName = "REDIS_PASSWORD"
+
+	// DefaultSize is how many entries the in-process cache holds unless
+	// CACHE_SIZE says otherwise.
+	DefaultSize = 10000
+	// DefaultTTL is how long entries live unless CACHE_TTL says otherwise.
+	// It bounds how stale a cached document can be after a write the
+	// decorators could not see, such as a cascade in the database.
+	DefaultTTL = time.Minute
+	// MinTTL is the shortest CACHE_TTL. Redis keeps expiries in
+	// milliseconds and rejects a TTL of none.
+	MinTTL = time.Millisecond
+)
+
+// Cache holds encoded documents under string keys for a fixed time to live.
+// Implementations are safe for concurrent use.
+type Cache interface {
+	// GetMulti returns the values stored under keys. Keys that are missing
+	// or expired are left out.
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	// Replace stores value under key only if a live entry is there, keeping
+	// the entry's expiry.
+	Replace(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+}
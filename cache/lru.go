@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is a Cache in process memory. Once it holds size entries, setting
+// another evicts the least recently used one.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// recent orders entries from most to least recently used.
+	recent *list.List
+	now    func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	values := map[string][]byte{}
+	for _, key := range keys {
+		el, ok := c.entries[key]
+		if !ok {
+			continue
+		}
+		entry := el.Value.(*lruEntry)
+		if !now.Before(entry.expires) {
+			c.remove(el)
+			continue
+		}
+		c.recent.MoveToFront(el)
+		values[key] = entry.value
+	}
+	return values, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{key: key, value: value, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.recent.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.size {
+		c.remove(c.recent.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Replace(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		return nil
+	}
+	el.Value = &lruEntry{key: key, value: value, expires: entry.expires}
+	c.recent.MoveToFront(el)
+	return nil
+}
+
+func (c *LRU) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+	return nil
+}
+
+// remove drops el. Callers hold c.mu.
+func (c *LRU) remove(el *list.Element) {
+	c.recent.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
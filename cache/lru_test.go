@@ -0,0 +1,93 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/cache"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// keys returns the keys of c among candidates, sorted.
+func keys(t *testing.T, c cache.Cache, candidates ...string) []string {
+	t.Helper()
+	values, err := c.GetMulti(context.Background(), candidates)
+	if err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	return slices.Sorted(maps.Keys(values))
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(2, time.Hour)
+	lru.Set(ctx, "a", []byte("1"))
+	lru.Set(ctx, "b", []byte("2"))
+	// Reading a makes b the least recently used.
+	keys(t, lru, "a")
+	lru.Set(ctx, "c", []byte("3"))
+	if got := keys(t, lru, "a", "b", "c"); !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("after evicting: got %v, want [a c]", got)
+	}
+	// Overwriting a key neither grows the cache nor evicts another.
+	lru.Set(ctx, "c", []byte("4"))
+	values, _ := lru.GetMulti(ctx, []string{"a", "c"})
+	if len(values) != 2 || string(values["c"]) != "4" {
+		t.Errorf("after overwriting: got %q", values)
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(10, time.Hour)
+	lru.Set(ctx, "a", []byte("1"))
+	lru.Set(ctx, "b", []byte("2"))
+	if err := lru.Delete(ctx, "a", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := keys(t, lru, "a", "b"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("after deleting: got %v, want [b]", got)
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(10, 20*time.Millisecond)
+	lru.Set(ctx, "a", []byte("1"))
+	if got := keys(t, lru, "a"); len(got) != 1 {
+		t.Fatalf("before expiry: got %v, want [a]", got)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if got := keys(t, lru, "a"); len(got) != 0 {
+		t.Errorf("after expiry: got %v, want none", got)
+	}
+	// Setting an expired key again makes it live again.
+	lru.Set(ctx, "a", []byte("2"))
+	if got := keys(t, lru, "a"); len(got) != 1 {
+		t.Errorf("after setting again: got %v, want [a]", got)
+	}
+}
+
+func TestLRUReplaceKeepsExpiry(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(10, 40*time.Millisecond)
+	lru.Set(ctx, "a", []byte("1"))
+	if err := lru.Replace(ctx, "missing", []byte("1")); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if got := keys(t, lru, "a", "missing"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("after replacing a missing key: got %v, want [a]", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+	lru.Replace(ctx, "a", []byte("2"))
+	values, _ := lru.GetMulti(ctx, []string{"a"})
+	if string(values["a"]) != "2" {
+		t.Errorf("after replacing: got %q, want 2", values["a"])
+	}
+	// Replacing did not restart the TTL.
+	time.Sleep(30 * time.Millisecond)
+	if got := keys(t, lru, "a"); len(got) != 0 {
+		t.Errorf("after the first expiry: got %v, want none", got)
+	}
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// redisPoolSize is how many idle connections Redis keeps open.
+	redisPoolSize = 8
+	// redisTimeout bounds a command whose context has no deadline, so that
+	// a stalled server slows requests down rather than hanging them.
+	redisTimeout = 2 * time.Second
+)
+
+// Redis is a Cache on a Redis server, or anything speaking its protocol such
+// as Valkey or KeyDB, at addr. It only needs GET, MGET, SET with PX or with XX
+// and KEEPTTL, which came with Redis 6, DEL and, given a password, AUTH.
+type Redis struct {
+	addr     string
+	password string
+	ttl      time.Duration
+	idle     chan *redisConn
+	dialer   net.Dialer
+}
+
+// RedisError is an error reply from the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var errRedisProtocol = errors.New("redis: malformed reply")
+
+func NewRedis(addr string, password string, ttl time.Duration) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		ttl:      ttl,
+		idle:     make(chan *redisConn, redisPoolSize),
+	}
+}
+
+func (c *Redis) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	if len(keys) == 0 {
+		return values, nil
+	}
+	reply, err := c.do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != len(keys) {
+		return nil, fmt.Errorf("redis: unexpected MGET reply %v", reply)
+	}
+	for i, item := range items {
+		if value, ok := item.([]byte); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte) error {
+	_, err := c.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	return err
+}
+
+func (c *Redis) Replace(ctx context.Context, key string, value []byte) error {
+	_, err := c.do(ctx, "SET", key, string(value), "XX", "KEEPTTL")
+	return err
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Close closes the idle connections. Commands issued afterwards open new ones.
+func (c *Redis) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply: a string, an int64, a []byte, nil
+// or a []any of those. An error reply is returned as a RedisError.
+func (c *Redis) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, args...)
+	if err != nil {
+		// The connection may be half way through a reply.
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	if err, ok := reply.(RedisError); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// conn returns an idle connection, or dials a new one.
+func (c *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	netConn, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{
+		Conn: netConn,
+		r:    bufio.NewReader(netConn),
+		w:    bufio.NewWriter(netConn),
+	}
+	if len(c.password) > 0 {
+		reply, err := conn.do(ctx, "AUTH", c.password)
+		if replyErr, ok := reply.(RedisError); ok {
+			err = replyErr
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisProtocol
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return RedisError(line), nil
+	case ':':
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		if string(b[n:]) != "\r\n" {
+			return nil, errRedisProtocol
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, errRedisProtocol
+	}
+}
@@ -0,0 +1,256 @@
+package cache_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/cache"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisStandIn speaks enough of the Redis protocol for cache.Redis: AUTH, GET,
+// MGET, SET with PX or with XX and KEEPTTL, and DEL.
+type redisStandIn struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+}
+
+func newRedisStandIn(t *testing.T, password string) *redisStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &redisStandIn{
+		listener: listener,
+		password: password,
+		values:   map[string]string{},
+		expires:  map[string]time.Time{},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *redisStandIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := len(s.password) == 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch name := strings.ToUpper(args[0]); {
+		case name == "AUTH":
+			if len(args) == 2 && args[1] == s.password {
+				authed = true
+				fmt.Fprint(w, "+OK\r\n")
+			} else {
+				fmt.Fprint(w, "-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		default:
+			s.run(w, name, args[1:])
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *redisStandIn) run(w io.Writer, name string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch name {
+	case "GET", "MGET":
+		if name == "MGET" {
+			fmt.Fprintf(w, "*%d\r\n", len(args))
+		}
+		for _, key := range args {
+			if value, ok := s.get(key); ok {
+				fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(w, "$-1\r\n")
+			}
+		}
+	case "SET":
+		if len(args) == 4 && strings.ToUpper(args[2]) == "XX" && strings.ToUpper(args[3]) == "KEEPTTL" {
+			if _, ok := s.get(args[0]); !ok {
+				fmt.Fprint(w, "$-1\r\n")
+				return
+			}
+			s.values[args[0]] = args[1]
+			fmt.Fprint(w, "+OK\r\n")
+			return
+		}
+		if len(args) != 4 || strings.ToUpper(args[2]) != "PX" {
+			fmt.Fprint(w, "-ERR syntax error\r\n")
+			return
+		}
+		ms, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || ms <= 0 {
+			fmt.Fprint(w, "-ERR invalid expire time in 'set' command\r\n")
+			return
+		}
+		s.values[args[0]] = args[1]
+		s.expires[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		fmt.Fprint(w, "+OK\r\n")
+	case "DEL":
+		n := 0
+		for _, key := range args {
+			if _, ok := s.get(key); ok {
+				delete(s.values, key)
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", name)
+	}
+}
+
+// get returns the live value of key. Callers hold s.mu.
+func (s *redisStandIn) get(key string) (string, bool) {
+	value, ok := s.values[key]
+	if ok && !time.Now().Before(s.expires[key]) {
+		delete(s.values, key)
+		return "", false
+	}
+	return value, ok
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readHeader(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, errors.New("empty command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readHeader(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func readHeader(r *bufio.Reader, kind byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 || line[0] != kind {
+		return 0, fmt.Errorf("unexpected %q", line)
+	}
+	return strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server := newRedisStandIn(t, "secret")
+	redis := cache.NewRedis(server.addr(), "secret", time.Hour)
+	t.Cleanup(func() { redis.Close() })
+
+	// Values are binary, as cached documents are BSON.
+	value := []byte("a\r\n$5\x00b")
+	if err := redis.Set(ctx, "a", value); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := redis.Set(ctx, "b", []byte("2")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	values, err := redis.GetMulti(ctx, []string{"a", "missing", "b"})
+	if err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	if len(values) != 2 || string(values["a"]) != string(value) || string(values["b"]) != "2" {
+		t.Errorf("GetMulti: got %q", values)
+	}
+	// Replace leaves missing keys missing.
+	if err := redis.Replace(ctx, "b", []byte("3")); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if err := redis.Replace(ctx, "c", []byte("3")); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	values, err = redis.GetMulti(ctx, []string{"b", "c"})
+	if err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	if len(values) != 1 || string(values["b"]) != "3" {
+		t.Errorf("after replacing: got %q, want b only, as 3", values)
+	}
+	if err := redis.Delete(ctx, "a", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := keys(t, redis, "a", "b"); len(got) != 1 || got[0] != "b" {
+		t.Errorf("after deleting: got %v, want [b]", got)
+	}
+}
+
+func TestRedisErrors(t *testing.T) {
+	ctx := context.Background()
+	server := newRedisStandIn(t, "secret")
+	wrong := cache.NewRedis(server.addr(), "guess", time.Hour)
+	t.Cleanup(func() { wrong.Close() })
+	var replyErr cache.RedisError
+	if _, err := wrong.GetMulti(ctx, []string{"a"}); !errors.As(err, &replyErr) {
+		t.Errorf("GetMulti with a wrong password: got %v, want a RedisError", err)
+	}
+	// A TTL under a millisecond is rejected by the server.
+	short := cache.NewRedis(server.addr(), "secret", time.Microsecond)
+	t.Cleanup(func() { short.Close() })
+	if err := short.Set(ctx, "a", []byte("1")); !errors.As(err, &replyErr) {
+		t.Errorf("Set with a TTL under a millisecond: got %v, want a RedisError", err)
+	}
+	// Pooled connections outlive the listener they were accepted on.
+	redis := cache.NewRedis(server.addr(), "secret", time.Hour)
+	t.Cleanup(func() { redis.Close() })
+	if err := redis.Set(ctx, "a", []byte("1")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	server.listener.Close()
+	if got := keys(t, redis, "a"); len(got) != 1 {
+		t.Errorf("over a pooled connection: got %v, want [a]", got)
+	}
+	redis.Close()
+	if _, err := redis.GetMulti(ctx, []string{"a"}); err == nil {
+		t.Error("GetMulti with the server gone: got no error")
+	}
+}
@@ -0,0 +1,472 @@
+package cache
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// The decorators cache users and posts by ID only, which is how the hot paths
+// look them up. Every write through them invalidates the documents it goes
+// to, whether or not it succeeds: a failed write may be a conditional one that
+// found the cached copy stale. Post stats are the exception, being updated in
+// the cache as well, without extending the cached copy's life.
+//
+// A change the decorators do not see, such as a user's posts or friendships
+// removed by a database cascade, shows once the cached copies expire. So does
+// the rare read that loads a document just before a concurrent write and
+// caches it just after.
+
+// Stats counts the lookups a decorator made in its cache. Cache errors are
+// logged and counted; a lookup that fails is also a miss, since the store is
+// read instead.
+type Stats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+// Report is a snapshot of Stats.
+type Report struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Errors   int64   `json:"errors"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+func (s *Stats) Report() Report {
+	r := Report{
+		Hits:   s.hits.Load(),
+		Misses: s.misses.Load(),
+		Errors: s.errors.Load(),
+	}
+	if lookups := r.Hits + r.Misses; lookups > 0 {
+		r.HitRatio = float64(r.Hits) / float64(lookups)
+	}
+	return r
+}
+
+// UserStore serves users by ID from a Cache, reading through to the wrapped
+// UserStore on a miss.
+type UserStore struct {
+	db.UserStore
+	cache Cache
+	stats Stats
+}
+
+func NewUserStore(store db.UserStore, cache Cache) *UserStore {
+	return &UserStore{
+		UserStore: store,
+		cache:     cache,
+	}
+}
+
+func (s *UserStore) Stats() Report {
+	return s.stats.Report()
+}
+
+func (s *UserStore) GetUser(ctx context.Context, id string) (*types.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return s.UserStore.GetUser(ctx, id)
+	}
+	return s.GetUserByObjectID(ctx, oid)
+}
+
+func (s *UserStore) GetUserByObjectID(ctx context.Context, id primitive.ObjectID) (*types.User, error) {
+	key := userKey(id)
+	if user := get[types.User](ctx, s.cache, &s.stats, []string{key})[key]; user != nil {
+		return user, nil
+	}
+	user, err := s.UserStore.GetUserByObjectID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	set(ctx, s.cache, &s.stats, key, user)
+	return user, nil
+}
+
+// GetUsersByIDs reads the users missing from the cache in one call to the
+// wrapped store. Projected lookups are not cached and go to the wrapped store.
+func (s *UserStore) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID, fields ...string) ([]*types.User, error) {
+	if len(ids) == 0 || len(fields) > 0 {
+		return s.UserStore.GetUsersByIDs(ctx, ids, fields...)
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userKey(id)
+	}
+	found := get[types.User](ctx, s.cache, &s.stats, keys)
+	var missing []primitive.ObjectID
+	for i, id := range ids {
+		if found[keys[i]] == nil && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		loaded, err := s.UserStore.GetUsersByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range loaded {
+			key := userKey(user.ID)
+			set(ctx, s.cache, &s.stats, key, user)
+			found[key] = user
+		}
+	}
+	return inOrder(keys, found), nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, filter db.UserFilter, params types.UpdateUserParams) error {
+	return s.write(ctx, s.selected(ctx, filter), func() error {
+		return s.UserStore.UpdateUser(ctx, filter, params)
+	})
+}
+
+func (s *UserStore) DeleteUser(ctx context.Context, id string, version int64) error {
+	return s.write(ctx, hexIDs(id), func() error {
+		return s.UserStore.DeleteUser(ctx, id, version)
+	})
+}
+
+func (s *UserStore) AddFriend(ctx context.Context, filter db.UserFilter, friend primitive.ObjectID) error {
+	return s.write(ctx, s.selected(ctx, filter), func() error {
+		return s.UserStore.AddFriend(ctx, filter, friend)
+	})
+}
+
+func (s *UserStore) RemoveFriend(ctx context.Context, filter db.UserFilter, friend primitive.ObjectID) error {
+	return s.write(ctx, s.selected(ctx, filter), func() error {
+		return s.UserStore.RemoveFriend(ctx, filter, friend)
+	})
+}
+
+func (s *UserStore) BlockUser(ctx context.Context, filter db.UserFilter, blocked primitive.ObjectID) error {
+	return s.write(ctx, s.selected(ctx, filter), func() error {
+		return s.UserStore.BlockUser(ctx, filter, blocked)
+	})
+}
+
+func (s *UserStore) UnblockUser(ctx context.Context, filter db.UserFilter, blocked primitive.ObjectID) error {
+	return s.write(ctx, s.selected(ctx, filter), func() error {
+		return s.UserStore.UnblockUser(ctx, filter, blocked)
+	})
+}
+
+// UpsertDevice also invalidates the users the token moves away from.
+func (s *UserStore) UpsertDevice(ctx context.Context, userID string, device types.Device) error {
+	owners, err := s.owners(ctx, []string{device.Token})
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, append(owners, hexIDs(userID)...), func() error {
+		return s.UserStore.UpsertDevice(ctx, userID, device)
+	})
+}
+
+func (s *UserStore) RemoveDevice(ctx context.Context, userID string, token string) error {
+	return s.write(ctx, hexIDs(userID), func() error {
+		return s.UserStore.RemoveDevice(ctx, userID, token)
+	})
+}
+
+func (s *UserStore) RemoveDeviceTokens(ctx context.Context, tokens []string) error {
+	owners, err := s.owners(ctx, tokens)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, owners, func() error {
+		return s.UserStore.RemoveDeviceTokens(ctx, tokens)
+	})
+}
+
+func (s *UserStore) UpdateNotificationSettings(ctx context.Context, userID string, settings types.NotificationSettings) error {
+	return s.write(ctx, hexIDs(userID), func() error {
+		return s.UserStore.UpdateNotificationSettings(ctx, userID, settings)
+	})
+}
+
+func (s *UserStore) MarkEmailVerified(ctx context.Context, userID string, email string) error {
+	return s.write(ctx, hexIDs(userID), func() error {
+		return s.UserStore.MarkEmailVerified(ctx, userID, email)
+	})
+}
+
+func (s *UserStore) ClaimDigest(ctx context.Context, userID primitive.ObjectID, sentBefore time.Time, now time.Time) (bool, error) {
+	var claimed bool
+	err := s.write(ctx, []primitive.ObjectID{userID}, func() (err error) {
+		claimed, err = s.UserStore.ClaimDigest(ctx, userID, sentBefore, now)
+		return err
+	})
+	return claimed, err
+}
+
+func (s *UserStore) write(ctx context.Context, ids []primitive.ObjectID, write func() error) error {
+	err := write()
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userKey(id)
+	}
+	invalidate(ctx, s.cache, &s.stats, keys)
+	return err
+}
+
+// selected returns the ID of the user filter selects, if there is one.
+func (s *UserStore) selected(ctx context.Context, filter db.UserFilter) []primitive.ObjectID {
+	if !filter.ID.IsZero() {
+		return []primitive.ObjectID{filter.ID}
+	}
+	if len(filter.Email) == 0 {
+		return nil
+	}
+	user, err := s.UserStore.GetUserByEmail(ctx, filter.Email)
+	if err != nil {
+		return nil
+	}
+	return []primitive.ObjectID{user.ID}
+}
+
+// owners returns the IDs of the users tokens are registered to.
+func (s *UserStore) owners(ctx context.Context, tokens []string) ([]primitive.ObjectID, error) {
+	users, err := s.UserStore.GetUsersByDeviceTokens(ctx, tokens)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+// PostStore serves posts by ID from a Cache, reading through to the wrapped
+// PostStore on a miss.
+type PostStore struct {
+	db.PostStore
+	cache Cache
+	stats Stats
+}
+
+func NewPostStore(store db.PostStore, cache Cache) *PostStore {
+	return &PostStore{
+		PostStore: store,
+		cache:     cache,
+	}
+}
+
+func (s *PostStore) Stats() Report {
+	return s.stats.Report()
+}
+
+func (s *PostStore) GetPostByID(ctx context.Context, id string) (*types.Post, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return s.PostStore.GetPostByID(ctx, id)
+	}
+	key := postKey(oid)
+	if post := get[types.Post](ctx, s.cache, &s.stats, []string{key})[key]; post != nil {
+		return post, nil
+	}
+	post, err := s.PostStore.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	set(ctx, s.cache, &s.stats, key, post)
+	return post, nil
+}
+
+// GetPostsByIDs reads the posts missing from the cache in one call to the
+// wrapped store. The posts are returned in the order of ids.
+func (s *PostStore) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*types.Post, error) {
+	if len(ids) == 0 {
+		return s.PostStore.GetPostsByIDs(ctx, ids)
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = postKey(id)
+	}
+	found := get[types.Post](ctx, s.cache, &s.stats, keys)
+	var missing []primitive.ObjectID
+	for i, id := range ids {
+		if found[keys[i]] == nil && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		loaded, err := s.PostStore.GetPostsByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range loaded {
+			key := postKey(post.ID)
+			set(ctx, s.cache, &s.stats, key, post)
+			found[key] = post
+		}
+	}
+	return inOrder(keys, found), nil
+}
+
+// UpdatePost invalidates every post filter selects, looking them up first
+// unless it names the post by ID.
+func (s *PostStore) UpdatePost(ctx context.Context, filter db.PostFilter, params types.UpdatePostParams) error {
+	var ids []primitive.ObjectID
+	switch {
+	case !filter.ID.IsZero():
+		ids = []primitive.ObjectID{filter.ID}
+	case !filter.IsZero():
+		posts, err := s.PostStore.FindPosts(ctx, filter, db.FindOptions{})
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+	}
+	err := s.PostStore.UpdatePost(ctx, filter, params)
+	s.invalidate(ctx, ids)
+	return err
+}
+
+func (s *PostStore) DeletePost(ctx context.Context, id string, version int64) error {
+	err := s.PostStore.DeletePost(ctx, id, version)
+	s.invalidate(ctx, hexIDs(id))
+	return err
+}
+
+// IncrementPostStat applies the increment to the cached copy of the post
+// rather than dropping it, since every read of a post counts a view. The
+// copy keeps its expiry, so it is read again from the store within the TTL.
+//
+// The copy is read and replaced without a lock. A concurrent increment may be
+// lost, and an edit racing the replacement may be undone, until the copy
+// expires.
+func (s *PostStore) IncrementPostStat(ctx context.Context, id string, stat string, delta int64) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return s.PostStore.IncrementPostStat(ctx, id, stat, delta)
+	}
+	key := postKey(oid)
+	if err := s.PostStore.IncrementPostStat(ctx, id, stat, delta); err != nil {
+		invalidate(ctx, s.cache, &s.stats, []string{key})
+		return err
+	}
+	values, err := s.cache.GetMulti(ctx, []string{key})
+	if err != nil {
+		// There is no telling what a failing cache holds.
+		s.stats.errors.Add(1)
+		log.Printf("cache: getting %s: %v", key, err)
+		invalidate(ctx, s.cache, &s.stats, []string{key})
+		return nil
+	}
+	value, ok := values[key]
+	if !ok {
+		return nil
+	}
+	var post types.Post
+	if err := bson.Unmarshal(value, &post); err != nil {
+		s.stats.errors.Add(1)
+		log.Printf("cache: decoding %s: %v", key, err)
+		invalidate(ctx, s.cache, &s.stats, []string{key})
+		return nil
+	}
+	post.Stats.Add(stat, delta)
+	if value, err = bson.Marshal(&post); err == nil {
+		err = s.cache.Replace(ctx, key, value)
+	}
+	if err != nil {
+		s.stats.errors.Add(1)
+		log.Printf("cache: replacing %s: %v", key, err)
+		invalidate(ctx, s.cache, &s.stats, []string{key})
+	}
+	return nil
+}
+
+func (s *PostStore) invalidate(ctx context.Context, ids []primitive.ObjectID) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = postKey(id)
+	}
+	invalidate(ctx, s.cache, &s.stats, keys)
+}
+
+func userKey(id primitive.ObjectID) string {
+	return "user:" + id.Hex()
+}
+
+func postKey(id primitive.ObjectID) string {
+	return "post:" + id.Hex()
+}
+
+// hexIDs returns id parsed, or nothing if it is not an ID, in which case the
+// wrapped store rejects the write.
+func hexIDs(id string) []primitive.ObjectID {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	return []primitive.ObjectID{oid}
+}
+
+// inOrder returns the documents in found in the order of keys, once each.
+func inOrder[T any](keys []string, found map[string]*T) []*T {
+	docs := make([]*T, 0, len(found))
+	for _, key := range keys {
+		if doc := found[key]; doc != nil {
+			docs = append(docs, doc)
+			delete(found, key)
+		}
+	}
+	return docs
+}
+
+// get returns the documents cached under keys, counting a hit or a miss for
+// each key. Entries that do not decode count as misses.
+func get[T any](ctx context.Context, cache Cache, stats *Stats, keys []string) map[string]*T {
+	docs := map[string]*T{}
+	values, err := cache.GetMulti(ctx, keys)
+	if err != nil {
+		stats.errors.Add(1)
+		log.Printf("cache: getting %d keys: %v", len(keys), err)
+	}
+	for key, value := range values {
+		var doc T
+		if err := bson.Unmarshal(value, &doc); err != nil {
+			stats.errors.Add(1)
+			log.Printf("cache: decoding %s: %v", key, err)
+			continue
+		}
+		docs[key] = &doc
+	}
+	stats.hits.Add(int64(len(docs)))
+	stats.misses.Add(int64(len(keys) - len(docs)))
+	return docs
+}
+
+func set[T any](ctx context.Context, cache Cache, stats *Stats, key string, doc *T) {
+	value, err := bson.Marshal(doc)
+	if err == nil {
+		err = cache.Set(ctx, key, value)
+	}
+	if err != nil {
+		stats.errors.Add(1)
+		log.Printf("cache: setting %s: %v", key, err)
+	}
+}
+
+// invalidate deletes keys. A failure leaves the entries to expire, so it is
+// only logged, like any other cache error.
+func invalidate(ctx context.Context, cache Cache, stats *Stats, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := cache.Delete(ctx, keys...); err != nil {
+		stats.errors.Add(1)
+		log.Printf("cache: deleting %d keys: %v", len(keys), err)
+	}
+}
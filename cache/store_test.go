@@ -0,0 +1,125 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/cache"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/db/dbtest"
+	"github.com/MiladJlz/blog_app/types"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLRUCachedStores(t *testing.T) {
+	lru := cache.NewLRU(cache.DefaultSize, cache.DefaultTTL)
+	dbtest.Run(t, db.Store{User: cache.NewUserStore(db.NewMemoryUserStore(), lru), Post: cache.NewPostStore(db.NewMemoryPostStore(), lru)})
+}
+
+// TestRedisCachedStores runs against the server at REDIS_ADDR, or a stand-in
+// if it is not set.
+func TestRedisCachedStores(t *testing.T) {
+	redis := newRedis(t)
+	dbtest.Run(t, db.Store{User: cache.NewUserStore(db.NewMemoryUserStore(), redis), Post: cache.NewPostStore(db.NewMemoryPostStore(), redis)})
+}
+
+func newRedis(t *testing.T) *cache.Redis {
+	t.Helper()
+	addr, password := os.Getenv(cache.RedisAddrEnvName), os.Getenv(cache.RedisPasswordEnvName)
+	if len(addr) == 0 {
+		addr = newRedisStandIn(t, "").addr()
+	}
+	redis := cache.NewRedis(addr, password, cache.DefaultTTL)
+	t.Cleanup(func() { redis.Close() })
+	return redis
+}
+
+func TestCachedPostStats(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cache func(t *testing.T) cache.Cache
+	}{
+		{"lru", func(t *testing.T) cache.Cache { return cache.NewLRU(cache.DefaultSize, time.Hour) }},
+		{"redis", func(t *testing.T) cache.Cache { return newRedis(t) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			posts := cache.NewPostStore(db.NewMemoryPostStore(), tc.cache(t))
+			post, err := posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Popular", Author: "66db2c856699531daa9abc16"}))
+			if err != nil {
+				t.Fatalf("InsertPost: %v", err)
+			}
+			id := post.ID.Hex()
+			// Count a view on every read, as HandleGetPost does.
+			for range 3 {
+				if _, err := posts.GetPostByID(ctx, id); err != nil {
+					t.Fatalf("GetPostByID: %v", err)
+				}
+				if err := posts.IncrementPostStat(ctx, id, types.StatViews, 1); err != nil {
+					t.Fatalf("IncrementPostStat: %v", err)
+				}
+			}
+			got, err := posts.GetPostByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetPostByID: %v", err)
+			}
+			if got.Stats.Views != 3 {
+				t.Errorf("cached views: got %d, want 3", got.Stats.Views)
+			}
+			if report := posts.Stats(); report.Hits != 3 || report.Misses != 1 {
+				t.Errorf("lookups: got %d hits and %d misses, want 3 and 1", report.Hits, report.Misses)
+			}
+			// A failed increment drops the cached copy.
+			if err := posts.IncrementPostStat(ctx, "66db2c856699531daa9abc16", types.StatViews, 1); err == nil {
+				t.Error("IncrementPostStat of a missing post: got no error")
+			}
+			if err := posts.UpdatePost(ctx, db.PostFilter{ID: post.ID}, types.UpdatePostParams{Content: "Edited"}); err != nil {
+				t.Fatalf("UpdatePost: %v", err)
+			}
+			got, err = posts.GetPostByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetPostByID: %v", err)
+			}
+			if got.Content != "Edited" || got.Stats.Views != 3 {
+				t.Errorf("after an edit: got %q with %d views, want the edit with 3", got.Content, got.Stats.Views)
+			}
+		})
+	}
+}
+
+// TestCachedPostStatsExpire checks that counting views does not keep a hot
+// post cached past its TTL, so writes the decorator missed still show.
+func TestCachedPostStatsExpire(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryPostStore()
+	posts := cache.NewPostStore(store, cache.NewLRU(cache.DefaultSize, 50*time.Millisecond))
+	post, err := posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Popular", Author: "66db2c856699531daa9abc16"}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	id := post.ID.Hex()
+	if _, err := posts.GetPostByID(ctx, id); err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	// An edit made by another instance, say.
+	if err := store.UpdatePost(ctx, db.PostFilter{ID: post.ID}, types.UpdatePostParams{Content: "Edited"}); err != nil {
+		t.Fatalf("UpdatePost: %v", err)
+	}
+	deadline := time.Now().Add(100 * time.Millisecond)
+	var got *types.Post
+	for views := int64(1); time.Now().Before(deadline); views++ {
+		if err := posts.IncrementPostStat(ctx, id, types.StatViews, 1); err != nil {
+			t.Fatalf("IncrementPostStat: %v", err)
+		}
+		if got, err = posts.GetPostByID(ctx, id); err != nil {
+			t.Fatalf("GetPostByID: %v", err)
+		}
+		if got.Stats.Views != views {
+			t.Fatalf("views: got %d, want %d", got.Stats.Views, views)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got.Content != "Edited" {
+		t.Errorf("after the TTL: got %q, want the edit", got.Content)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/bulk"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/search"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs an admin command given on the command line instead of
+// starting the HTTP server.
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "reindex":
+		return reindex(ctx)
+	case "migrate":
+		return migrate(ctx, args[1:])
+	case "import":
+		return importContent(ctx, args[1:])
+	case "export":
+		return exportContent(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// reindex rebuilds the embedded search index from the posts collection. Run it
+// while no server is using the same SEARCH_INDEX_DIR.
+func reindex(ctx context.Context) error {
+	index, err := search.OpenInvertedIndex(os.Getenv(search.IndexDirEnvName))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	_, store, err := newStores(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := search.Reindex(ctx, store.Post, index)
+	if err != nil {
+		return err
+	}
+	log.Printf("reindexed %d posts", n)
+	return nil
+}
+
+// migrate runs the Mongo migrations: "up" applies the pending ones, up to a
+// version if one is given, "down" rolls back those newer than the given
+// version and "status", the default, lists them.
+func migrate(ctx context.Context, args []string) error {
+	client, err := connectMongo(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		migrator = db.NewMongoMigrator(client)
+		action   = "status"
+		version  int
+	)
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		version = v
+	}
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx, version)
+		for _, migration := range applied {
+			log.Printf("applied %d: %s", migration.Version, migration.Description)
+		}
+		return err
+	case "down":
+		if len(args) < 2 {
+			return errors.New("migrate down needs the version to roll back to")
+		}
+		rolledBack, err := migrator.Down(ctx, version)
+		for _, migration := range rolledBack {
+			log.Printf("rolled back %d: %s", migration.Version, migration.Description)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if !status.AppliedAt.IsZero() {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-30s  %s\n", status.Version, applied, status.Description)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+}
+
+// importContent imports users and posts in the given format from a file, "-"
+// for standard input or, for markdown, a directory. Records that fail are
+// logged and the rest imported, after which it fails. Posts are added to the
+// search index, so with SEARCH_BACKEND=index run it while no server is using
+// the same SEARCH_INDEX_DIR.
+func importContent(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("import takes a format, one of %s, and a path", strings.Join(bulk.Formats, ", "))
+	}
+	format, name := args[0], args[1]
+	if !slices.Contains(bulk.Formats, format) {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	backend, store, err := newStores(ctx)
+	if err != nil {
+		return err
+	}
+	postStore, _, err := newSearchBackend(backend, store)
+	if err != nil {
+		return err
+	}
+	var records []bulk.Record
+	if info, err := os.Stat(name); err == nil && info.IsDir() && format == bulk.FormatMarkdown {
+		records, err = bulk.ReadMarkdown(os.DirFS(name))
+		if err != nil {
+			return err
+		}
+	} else {
+		in := os.Stdin
+		if name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		if records, err = bulk.Decode(format, in); err != nil {
+			return err
+		}
+	}
+	report := bulk.NewImporter(store.User, postStore).Import(ctx, records)
+	for _, failed := range report.Errors {
+		log.Printf("%s: %s", failed.Record, failed.Error)
+	}
+	log.Printf("imported %d records: %d new users, %d posts", report.Records, report.UsersCreated, report.PostsCreated)
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d records failed", len(report.Errors))
+	}
+	return nil
+}
+
+// exportContent exports every user and post in the given format to a file,
+// "-" for standard output or, for markdown, a directory it creates unless the
+// name ends in .zip.
+func exportContent(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("export takes a format, one of %s, and a path", strings.Join(bulk.Formats, ", "))
+	}
+	format, name := args[0], args[1]
+	if !slices.Contains(bulk.Formats, format) {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	_, store, err := newStores(ctx)
+	if err != nil {
+		return err
+	}
+	records, err := bulk.Export(ctx, store.User, store.Post)
+	if err != nil {
+		return err
+	}
+	if format == bulk.FormatMarkdown && name != "-" && filepath.Ext(name) != ".zip" {
+		if err := os.MkdirAll(name, 0o755); err != nil {
+			return err
+		}
+		return bulk.WriteMarkdown(records, func(file string, content []byte) error {
+			return os.WriteFile(filepath.Join(name, file), content, 0o644)
+		})
+	}
+	if name == "-" {
+		return bulk.Encode(format, os.Stdout, records)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := bulk.Encode(format, f, records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
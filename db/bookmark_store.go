@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"time"
+)
+
+const (
+	bookmarkColl    = "bookmarks"
+	readingListColl = "reading_lists"
+)
+
+type BookmarkStore interface {
+	AddBookmark(ctx context.Context, userID string, postID string) error
+	RemoveBookmark(ctx context.Context, userID string, postID string) error
+	GetBookmarks(ctx context.Context, userID string, page int64, limit int64) ([]*types.Bookmark, error)
+
+	InsertReadingList(context.Context, *types.ReadingList) (*types.ReadingList, error)
+	GetReadingList(context.Context, string) (*types.ReadingList, error)
+	GetReadingListsByOwner(context.Context, string) ([]*types.ReadingList, error)
+	UpdateReadingList(ctx context.Context, id primitive.ObjectID, params types.UpdateReadingListParams) error
+	DeleteReadingList(context.Context, string) error
+	AddToReadingList(ctx context.Context, listID string, postID string) error
+	RemoveFromReadingList(ctx context.Context, listID string, postID string) error
+}
+
+type MongoBookmarkStore struct {
+	client    *mongo.Client
+	bookmarks *mongo.Collection
+	lists     *mongo.Collection
+}
+
+func NewMongoBookmarkStore(client *mongo.Client) *MongoBookmarkStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoBookmarkStore{
+		client:    client,
+		bookmarks: client.Database(dbname).Collection(bookmarkColl),
+		lists:     client.Database(dbname).Collection(readingListColl),
+	}
+}
+
+func (s *MongoBookmarkStore) AddBookmark(ctx context.Context, userID string, postID string) error {
+	uid, pid, err := parseIDPair(userID, postID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"user": uid, "post": pid}
+	update := bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}}
+	_, err = s.bookmarks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *MongoBookmarkStore) RemoveBookmark(ctx context.Context, userID string, postID string) error {
+	uid, pid, err := parseIDPair(userID, postID)
+	if err != nil {
+		return err
+	}
+	_, err = s.bookmarks.DeleteOne(ctx, bson.M{"user": uid, "post": pid})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *MongoBookmarkStore) GetBookmarks(ctx context.Context, userID string, page int64, limit int64) ([]*types.Bookmark, error) {
+	uid, err := parseID(userID)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cur, err := s.bookmarks.Find(ctx, bson.M{"user": uid}, opts)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks := []*types.Bookmark{}
+	if err := cur.All(ctx, &bookmarks); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+func (s *MongoBookmarkStore) InsertReadingList(ctx context.Context, list *types.ReadingList) (*types.ReadingList, error) {
+	res, err := s.lists.InsertOne(ctx, list)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	list.ID = res.InsertedID.(primitive.ObjectID)
+	return list, nil
+}
+
+func (s *MongoBookmarkStore) GetReadingList(ctx context.Context, id string) (*types.ReadingList, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var list types.ReadingList
+	if err := s.lists.FindOne(ctx, bson.M{"_id": oid}).Decode(&list); err != nil {
+		return nil, mongoError(err)
+	}
+	return &list, nil
+}
+
+func (s *MongoBookmarkStore) GetReadingListsByOwner(ctx context.Context, ownerID string) ([]*types.ReadingList, error) {
+	oid, err := parseID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.lists.Find(ctx, bson.M{"owner": oid}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	lists := []*types.ReadingList{}
+	if err := cur.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (s *MongoBookmarkStore) UpdateReadingList(ctx context.Context, id primitive.ObjectID, params types.UpdateReadingListParams) error {
+	update := bson.M{"$set": params.ToBSON()}
+	res, err := s.lists.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoBookmarkStore) DeleteReadingList(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := s.lists.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoBookmarkStore) AddToReadingList(ctx context.Context, listID string, postID string) error {
+	lid, pid, err := parseIDPair(listID, postID)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"posts": pid},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+	res, err := s.lists.UpdateOne(ctx, bson.M{"_id": lid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoBookmarkStore) RemoveFromReadingList(ctx context.Context, listID string, postID string) error {
+	lid, pid, err := parseIDPair(listID, postID)
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$pull": bson.M{"posts": pid},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	res, err := s.lists.UpdateOne(ctx, bson.M{"_id": lid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func parseIDPair(a string, b string) (primitive.ObjectID, primitive.ObjectID, error) {
+	aid, err := parseID(a)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+	bid, err := parseID(b)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+	return aid, bid, nil
+}
@@ -2,7 +2,13 @@ package db
 
 const MongoDBNameEnvName = "MONGO_DB_NAME"
 
+// Store holds the stores of one backend.
 type Store struct {
-	User UserStore
-	Post PostStore
+	User         UserStore
+	Post         PostStore
+	Bookmark     BookmarkStore
+	Job          JobStore
+	Notification NotificationStore
+	Token        TokenStore
+	Webhook      WebhookStore
 }
@@ -0,0 +1,119 @@
+// Package dbtest tests that a store implementation behaves the way the rest
+// of the app expects, so every backend can be held to the same contract. The
+// tests of each package with a backend run it against their stores. They
+// create their own documents, with fresh IDs and addresses, and delete them
+// again, so they can run against a store that already holds data.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"testing"
+)
+
+// Run tests the stores of one backend against the behaviour of the Mongo
+// stores. Stores the backend does not have are skipped.
+func Run(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	t.Run("UserStore", func(t *testing.T) { testUserStore(t, ctx, store.User) })
+	t.Run("PostStore", func(t *testing.T) { testPostStore(t, ctx, store.User, store.Post) })
+	if store.Bookmark != nil {
+		t.Run("BookmarkStore", func(t *testing.T) { testBookmarkStore(t, ctx, store.Bookmark) })
+	}
+	if store.Job != nil {
+		t.Run("JobStore", func(t *testing.T) { testJobStore(t, ctx, store.Job) })
+	}
+	if store.Notification != nil {
+		t.Run("NotificationStore", func(t *testing.T) { testNotificationStore(t, ctx, store.Notification) })
+	}
+	if store.Token != nil {
+		t.Run("TokenStore", func(t *testing.T) { testTokenStore(t, ctx, store.Token) })
+	}
+	if store.Webhook != nil {
+		t.Run("WebhookStore", func(t *testing.T) { testWebhookStore(t, ctx, store.Webhook) })
+	}
+}
+
+// check fails the test if err, the result of what, is not nil. It reports
+// whether err was nil.
+func check(t *testing.T, what string, err error) bool {
+	t.Helper()
+	if err != nil {
+		t.Errorf("%s: %v", what, err)
+		return false
+	}
+	return true
+}
+
+// notFound fails the test unless err says the document does not exist.
+func notFound(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("%s: got error %v, want %v", what, err, db.ErrNotFound)
+	}
+}
+
+// leaseLost fails the test unless err says a job is no longer the worker's.
+func leaseLost(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, db.ErrLeaseLost) {
+		t.Errorf("%s: got error %v, want %v", what, err, db.ErrLeaseLost)
+	}
+}
+
+// invalidID fails the test unless err says an ID is not an ObjectID.
+func invalidID(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, db.ErrInvalidID) {
+		t.Errorf("%s with an invalid ID: got error %v, want %v", what, err, db.ErrInvalidID)
+	}
+}
+
+// conflict fails the test unless err says a unique key is taken.
+func conflict(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, db.ErrConflict) {
+		t.Errorf("%s: got error %v, want %v", what, err, db.ErrConflict)
+	}
+}
+
+// versionMismatch fails the test unless err says the document has moved on
+// from the version a write was conditioned on.
+func versionMismatch(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, db.ErrVersionMismatch) {
+		t.Errorf("%s at a stale version: got error %v, want %v", what, err, db.ErrVersionMismatch)
+	}
+}
+
+// emptyFilter fails the test unless err is not nil, as it must be for an
+// update given a filter that sets no field.
+func emptyFilter(t *testing.T, what string, err error) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s with an empty filter: got no error", what)
+	}
+}
+
+func ids[T any](docs []T, id func(T) primitive.ObjectID) []primitive.ObjectID {
+	out := make([]primitive.ObjectID, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, id(doc))
+	}
+	return out
+}
+
+func sameIDs(got []primitive.ObjectID, want ...primitive.ObjectID) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for _, id := range want {
+		if !slices.Contains(got, id) {
+			return false
+		}
+	}
+	return true
+}
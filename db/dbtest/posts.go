@@ -0,0 +1,274 @@
+package dbtest
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"testing"
+	"time"
+)
+
+func insertPost(t *testing.T, ctx context.Context, store db.PostStore, post *types.Post) *types.Post {
+	t.Helper()
+	inserted, err := store.InsertPost(ctx, post)
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	if inserted.ID.IsZero() {
+		t.Fatalf("InsertPost: no ID assigned")
+	}
+	t.Cleanup(func() { store.DeletePost(ctx, inserted.ID.Hex(), 0) })
+	return inserted
+}
+
+func getPost(t *testing.T, ctx context.Context, store db.PostStore, post *types.Post) *types.Post {
+	t.Helper()
+	got, err := store.GetPostByID(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	return got
+}
+
+// testPostStore creates the posts' authors in users, which must be the user
+// store of the same backend.
+func testPostStore(t *testing.T, ctx context.Context, users db.UserStore, store db.PostStore) {
+	var (
+		alice = insertUser(t, ctx, users, "alice").ID
+		bob   = insertUser(t, ctx, users, "bob").ID
+		now   = time.Now().Truncate(time.Millisecond)
+	)
+	newPost := func(author primitive.ObjectID, content string, age time.Duration) *types.Post {
+		post := types.NewPostFromParams(types.CreatePostParams{Content: content, Author: author.Hex()})
+		post.CreatedAt = now.Add(-age)
+		return post
+	}
+	older := insertPost(t, ctx, store, newPost(alice, "An older post about #Go", 2*time.Hour))
+	newer := insertPost(t, ctx, store, newPost(alice, "A newer post about #Mongo", time.Hour))
+	other := insertPost(t, ctx, store, newPost(bob, "Bob's own post, a day old", 24*time.Hour))
+	repost := insertPost(t, ctx, store, types.NewRepostFromParams(types.CreateRepostParams{Author: alice.Hex()}, other))
+
+	t.Run("Lookups", func(t *testing.T) { checkPostLookups(t, ctx, store, older, repost) })
+	t.Run("Queries", func(t *testing.T) { checkPostQueries(t, ctx, store, alice, older, newer, other, repost) })
+	t.Run("FindPosts", func(t *testing.T) { checkFindPosts(t, ctx, store, alice, older, newer, other, repost) })
+	t.Run("Updates", func(t *testing.T) { checkPostUpdates(t, ctx, store, older) })
+	t.Run("Versions", func(t *testing.T) { checkPostVersions(t, ctx, store, older) })
+	t.Run("Authors", func(t *testing.T) { checkPostAuthors(t, ctx, users, store) })
+	t.Run("Visibility", func(t *testing.T) { checkPostVisibility(t, ctx, users, store) })
+
+	if !check(t, "DeletePost", store.DeletePost(ctx, older.ID.Hex(), 0)) {
+		return
+	}
+	_, err := store.GetPostByID(ctx, older.ID.Hex())
+	notFound(t, "GetPostByID after DeletePost", err)
+	notFound(t, "DeletePost of a missing post", store.DeletePost(ctx, older.ID.Hex(), 0))
+	invalidID(t, "DeletePost", store.DeletePost(ctx, "not-an-id", 0))
+	posts, err := store.GetPosts(ctx)
+	if check(t, "GetPosts", err) {
+		got := ids(posts, func(p *types.Post) primitive.ObjectID { return p.ID })
+		if slices.Contains(got, older.ID) || !slices.Contains(got, newer.ID) {
+			t.Errorf("GetPosts: deleted post listed or remaining post missing")
+		}
+	}
+}
+
+// checkPostAuthors checks that posts are independent of their author's
+// document, as Mongo's are: they outlive it and may name a missing one.
+func checkPostAuthors(t *testing.T, ctx context.Context, users db.UserStore, store db.PostStore) {
+	dave := insertUser(t, ctx, users, "dave")
+	post := insertPost(t, ctx, store, types.NewPostFromParams(types.CreatePostParams{Content: "Dave's post", Author: dave.ID.Hex()}))
+	if check(t, "DeleteUser", users.DeleteUser(ctx, dave.ID.Hex(), 0)) {
+		_, err := store.GetPostByID(ctx, post.ID.Hex())
+		check(t, "GetPostByID after its author's DeleteUser", err)
+	}
+	orphan := types.NewPostFromParams(types.CreatePostParams{Content: "Nobody's post", Author: primitive.NewObjectID().Hex()})
+	if inserted, err := store.InsertPost(ctx, orphan); check(t, "InsertPost by a missing author", err) {
+		store.DeletePost(ctx, inserted.ID.Hex(), 0)
+	}
+}
+
+func checkPostLookups(t *testing.T, ctx context.Context, store db.PostStore, post, repost *types.Post) {
+	got := getPost(t, ctx, store, post)
+	if got.Content != post.Content || got.Author != post.Author || got.Kind != types.PostKindPost || !slices.Equal(got.Tags, []string{"go"}) {
+		t.Errorf("GetPostByID: got %+v, want %+v", got, post)
+	}
+	if d := got.CreatedAt.Sub(post.CreatedAt); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("GetPostByID: created at %v, want %v", got.CreatedAt, post.CreatedAt)
+	}
+	got.Content = "changed"
+	if again := getPost(t, ctx, store, post); again.Content != post.Content {
+		t.Errorf("GetPostByID: changing a returned post changed the stored one")
+	}
+	if got := getPost(t, ctx, store, repost); got.Kind != types.PostKindRepost || got.RepostOf == nil || *got.RepostOf != *repost.RepostOf {
+		t.Errorf("GetPostByID: repost %+v lost what it reposts", got)
+	}
+
+	_, err := store.GetPostByID(ctx, primitive.NewObjectID().Hex())
+	notFound(t, "GetPostByID of a missing post", err)
+	_, err = store.GetPostByID(ctx, "not-an-id")
+	invalidID(t, "GetPostByID", err)
+	_, err = store.GetPostsByUserID(ctx, "not-an-id")
+	invalidID(t, "GetPostsByUserID", err)
+
+	dup := types.NewPostFromParams(types.CreatePostParams{Content: post.Content, Author: post.Author.Hex()})
+	dup.ID = post.ID
+	_, err = store.InsertPost(ctx, dup)
+	conflict(t, "InsertPost with a taken ID", err)
+
+	// A user reposts a post once, but may quote it again.
+	_, err = store.InsertPost(ctx, types.NewRepostFromParams(types.CreateRepostParams{Author: repost.Author.Hex()}, repost))
+	conflict(t, "InsertPost of a second repost", err)
+	quote := insertPost(t, ctx, store, types.NewRepostFromParams(types.CreateRepostParams{Author: repost.Author.Hex(), Content: "Worth reading twice"}, repost))
+	check(t, "DeletePost", store.DeletePost(ctx, quote.ID.Hex(), 0))
+}
+
+func checkPostQueries(t *testing.T, ctx context.Context, store db.PostStore, alice primitive.ObjectID, older, newer, other, repost *types.Post) {
+	postID := func(p *types.Post) primitive.ObjectID { return p.ID }
+
+	posts, err := store.GetPostsByUserID(ctx, alice.Hex())
+	if check(t, "GetPostsByUserID", err) && !sameIDs(ids(posts, postID), older.ID, newer.ID, repost.ID) {
+		t.Errorf("GetPostsByUserID: got %v, want alice's posts and repost", ids(posts, postID))
+	}
+	posts, err = store.GetPostsByIDs(ctx, []primitive.ObjectID{older.ID, other.ID, primitive.NewObjectID()})
+	if check(t, "GetPostsByIDs", err) && !sameIDs(ids(posts, postID), older.ID, other.ID) {
+		t.Errorf("GetPostsByIDs: got %v, want %v", ids(posts, postID), []primitive.ObjectID{older.ID, other.ID})
+	}
+
+	posts, err = store.GetPostsSince(ctx, newer.CreatedAt)
+	if check(t, "GetPostsSince", err) {
+		got := ids(posts, postID)
+		if !slices.Contains(got, newer.ID) || !slices.Contains(got, repost.ID) || slices.Contains(got, older.ID) {
+			t.Errorf("GetPostsSince: got %v, want posts from %v on", got, newer.CreatedAt)
+		}
+	}
+
+	authors := []primitive.ObjectID{alice, other.Author}
+	posts, err = store.GetRecentPostsByAuthors(ctx, authors, older.CreatedAt, 10)
+	if check(t, "GetRecentPostsByAuthors", err) {
+		if got := ids(posts, postID); !slices.Equal(got, []primitive.ObjectID{newer.ID, older.ID}) {
+			t.Errorf("GetRecentPostsByAuthors: got %v, want newer then older, without reposts or posts before since", got)
+		}
+	}
+	posts, err = store.GetRecentPostsByAuthors(ctx, authors, older.CreatedAt, 1)
+	if check(t, "GetRecentPostsByAuthors", err) && !slices.Equal(ids(posts, postID), []primitive.ObjectID{newer.ID}) {
+		t.Errorf("GetRecentPostsByAuthors with limit 1: got %v, want only the newer post", ids(posts, postID))
+	}
+	posts, err = store.GetRecentPostsByAuthors(ctx, nil, older.CreatedAt, 10)
+	if check(t, "GetRecentPostsByAuthors", err) && (posts == nil || len(posts) != 0) {
+		t.Errorf("GetRecentPostsByAuthors without authors: got %v, want an empty list", posts)
+	}
+}
+
+func checkFindPosts(t *testing.T, ctx context.Context, store db.PostStore, alice primitive.ObjectID, older, newer, other, repost *types.Post) {
+	postID := func(p *types.Post) primitive.ObjectID { return p.ID }
+	find := func(what string, filter db.PostFilter, opts db.FindOptions, want ...primitive.ObjectID) {
+		posts, err := store.FindPosts(ctx, filter, opts)
+		if !check(t, "FindPosts "+what, err) {
+			return
+		}
+		if posts == nil {
+			t.Errorf("FindPosts %s: got nil, want a list", what)
+		}
+		if got := ids(posts, postID); !slices.Equal(got, append([]primitive.ObjectID{}, want...)) {
+			t.Errorf("FindPosts %s: got %v, want %v", what, got, want)
+		}
+	}
+	find("by author", db.PostFilter{Authors: []primitive.ObjectID{alice}}, db.FindOptions{},
+		older.ID, newer.ID, repost.ID)
+	find("by kind, newest first", db.PostFilter{Authors: []primitive.ObjectID{alice}, Kinds: []string{types.PostKindPost, types.PostKindQuote}},
+		db.FindOptions{Sort: db.SortNewest}, newer.ID, older.ID)
+	find("by creation time, paged", db.PostFilter{Authors: []primitive.ObjectID{alice, other.Author}, CreatedFrom: other.CreatedAt, CreatedTo: newer.CreatedAt},
+		db.FindOptions{Skip: 1, Limit: 1}, older.ID)
+	find("skipping without a limit", db.PostFilter{Authors: []primitive.ObjectID{alice}}, db.FindOptions{Skip: 2}, repost.ID)
+	find("by ID", db.PostFilter{ID: other.ID}, db.FindOptions{}, other.ID)
+	find("by original", db.PostFilter{RepostOf: other.ID}, db.FindOptions{}, repost.ID)
+	find("by original and author", db.PostFilter{RepostOf: other.ID, Authors: []primitive.ObjectID{other.Author}}, db.FindOptions{})
+	find("matching nothing", db.PostFilter{Authors: []primitive.ObjectID{primitive.NewObjectID()}}, db.FindOptions{})
+}
+
+func checkPostUpdates(t *testing.T, ctx context.Context, store db.PostStore, post *types.Post) {
+	params := types.UpdatePostParams{Content: "Rewritten to be about #Fiber"}
+	check(t, "UpdatePost", store.UpdatePost(ctx, db.PostFilter{ID: post.ID}, params))
+	got := getPost(t, ctx, store, post)
+	if got.Content != params.Content || !slices.Equal(got.Tags, []string{"fiber"}) || got.UpdatedAt.IsZero() {
+		t.Errorf("UpdatePost: got %q tagged %v updated at %v", got.Content, got.Tags, got.UpdatedAt)
+	}
+	notFound(t, "UpdatePost of a missing post", store.UpdatePost(ctx, db.PostFilter{ID: primitive.NewObjectID()}, params))
+	emptyFilter(t, "UpdatePost", store.UpdatePost(ctx, db.PostFilter{}, params))
+
+	check(t, "IncrementPostStat", store.IncrementPostStat(ctx, post.ID.Hex(), types.StatReposts, 2))
+	check(t, "IncrementPostStat", store.IncrementPostStat(ctx, post.ID.Hex(), types.StatReposts, -1))
+	check(t, "IncrementPostStat", store.IncrementPostStat(ctx, post.ID.Hex(), types.StatViews, 5))
+	if stats := getPost(t, ctx, store, post).Stats; stats.Reposts != 1 || stats.Views != 5 || stats.Reactions != 0 {
+		t.Errorf("IncrementPostStat: stats %+v, want 1 repost and 5 views", stats)
+	}
+	notFound(t, "IncrementPostStat of a missing post", store.IncrementPostStat(ctx, primitive.NewObjectID().Hex(), types.StatViews, 1))
+	invalidID(t, "IncrementPostStat", store.IncrementPostStat(ctx, "not-an-id", types.StatViews, 1))
+}
+
+// checkPostVersions expects post to have been updated once since it was
+// inserted, by checkPostUpdates.
+func checkPostVersions(t *testing.T, ctx context.Context, store db.PostStore, post *types.Post) {
+	if post.Version != 1 {
+		t.Errorf("InsertPost: version %d, want 1", post.Version)
+	}
+	if got := getPost(t, ctx, store, post).Version; got != 2 {
+		t.Errorf("UpdatePost: version %d, want 2, unchanged by IncrementPostStat", got)
+	}
+	params := types.UpdatePostParams{Content: "Rewritten again"}
+	versionMismatch(t, "UpdatePost", store.UpdatePost(ctx, db.PostFilter{ID: post.ID, Version: 1}, params))
+	if got := getPost(t, ctx, store, post); got.Content == params.Content {
+		t.Errorf("UpdatePost at a stale version: post updated")
+	}
+	check(t, "UpdatePost at the current version", store.UpdatePost(ctx, db.PostFilter{ID: post.ID, Version: 2}, params))
+	if got := getPost(t, ctx, store, post); got.Content != params.Content || got.Version != 3 {
+		t.Errorf("UpdatePost at the current version: got %q at version %d, want %q at 3", got.Content, got.Version, params.Content)
+	}
+	notFound(t, "UpdatePost of a missing post at a version", store.UpdatePost(ctx, db.PostFilter{ID: primitive.NewObjectID(), Version: 1}, params))
+	versionMismatch(t, "DeletePost", store.DeletePost(ctx, post.ID.Hex(), 2))
+	notFound(t, "DeletePost of a missing post at a version", store.DeletePost(ctx, primitive.NewObjectID().Hex(), 1))
+}
+
+// checkPostVisibility checks that FindPosts only returns the posts a viewer
+// may see.
+func checkPostVisibility(t *testing.T, ctx context.Context, users db.UserStore, store db.PostStore) {
+	var (
+		frank   = insertUser(t, ctx, users, "frank").ID
+		grace   = insertUser(t, ctx, users, "grace").ID
+		heidi   = insertUser(t, ctx, users, "heidi").ID
+		authors = []primitive.ObjectID{frank, heidi}
+	)
+	newPost := func(author primitive.ObjectID, visibility string) *types.Post {
+		return insertPost(t, ctx, store, types.NewPostFromParams(types.CreatePostParams{Content: "A " + visibility + " post", Author: author.Hex(), Visibility: visibility}))
+	}
+	unset := insertPost(t, ctx, store, &types.Post{Content: "A post from before visibility", Author: frank, Kind: types.PostKindPost})
+	if got := getPost(t, ctx, store, unset).Visibility; got != types.PostVisibilityPublic {
+		t.Errorf("InsertPost without a visibility: got %q, want %q", got, types.PostVisibilityPublic)
+	}
+	public := newPost(frank, types.PostVisibilityPublic)
+	friends := newPost(frank, types.PostVisibilityFriends)
+	private := newPost(frank, types.PostVisibilityPrivate)
+	hidden := newPost(heidi, types.PostVisibilityPublic)
+
+	find := func(what string, viewer types.Viewer, want ...primitive.ObjectID) {
+		posts, err := store.FindPosts(ctx, db.PostFilter{Authors: authors, Viewer: &viewer}, db.FindOptions{})
+		if !check(t, "FindPosts "+what, err) {
+			return
+		}
+		if got := ids(posts, func(p *types.Post) primitive.ObjectID { return p.ID }); !slices.Equal(got, append([]primitive.ObjectID{}, want...)) {
+			t.Errorf("FindPosts %s: got %v, want %v", what, got, want)
+		}
+	}
+	find("for an anonymous viewer", types.Viewer{}, unset.ID, public.ID, hidden.ID)
+	find("for a stranger", types.Viewer{ID: grace}, unset.ID, public.ID, hidden.ID)
+	find("for a friend", types.Viewer{ID: grace, FriendOf: []primitive.ObjectID{frank}}, unset.ID, public.ID, friends.ID, hidden.ID)
+	find("for the author", types.Viewer{ID: frank}, unset.ID, public.ID, friends.ID, private.ID, hidden.ID)
+	find("hiding a blocked author", types.Viewer{ID: grace, Hidden: []primitive.ObjectID{heidi}}, unset.ID, public.ID)
+
+	check(t, "UpdatePost", store.UpdatePost(ctx, db.PostFilter{ID: public.ID}, types.UpdatePostParams{Visibility: types.PostVisibilityPrivate}))
+	if got := getPost(t, ctx, store, public).Visibility; got != types.PostVisibilityPrivate {
+		t.Errorf("UpdatePost visibility: got %q, want %q", got, types.PostVisibilityPrivate)
+	}
+}
@@ -0,0 +1,350 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testBookmarkStore(t *testing.T, ctx context.Context, store db.BookmarkStore) {
+	var (
+		user  = primitive.NewObjectID()
+		first = primitive.NewObjectID()
+		later = primitive.NewObjectID()
+	)
+	t.Run("Bookmarks", func(t *testing.T) {
+		check(t, "AddBookmark", store.AddBookmark(ctx, user.Hex(), first.Hex()))
+		time.Sleep(2 * time.Millisecond)
+		for range 2 {
+			check(t, "AddBookmark", store.AddBookmark(ctx, user.Hex(), later.Hex()))
+		}
+		t.Cleanup(func() {
+			store.RemoveBookmark(ctx, user.Hex(), first.Hex())
+			store.RemoveBookmark(ctx, user.Hex(), later.Hex())
+		})
+		if bookmarks, err := store.GetBookmarks(ctx, user.Hex(), 1, 10); check(t, "GetBookmarks", err) {
+			got := ids(bookmarks, func(b *types.Bookmark) primitive.ObjectID { return b.Post })
+			if !slices.Equal(got, []primitive.ObjectID{later, first}) {
+				t.Errorf("GetBookmarks: got posts %v, want %v newest first, each once", got, []primitive.ObjectID{later, first})
+			}
+		}
+		if bookmarks, err := store.GetBookmarks(ctx, user.Hex(), 2, 1); check(t, "GetBookmarks of page 2", err) {
+			if len(bookmarks) != 1 || bookmarks[0].Post != first {
+				t.Errorf("GetBookmarks of page 2: got %+v, want the older bookmark", bookmarks)
+			}
+		}
+		check(t, "RemoveBookmark", store.RemoveBookmark(ctx, user.Hex(), later.Hex()))
+		check(t, "RemoveBookmark of a missing bookmark", store.RemoveBookmark(ctx, user.Hex(), later.Hex()))
+		if bookmarks, err := store.GetBookmarks(ctx, user.Hex(), 1, 10); check(t, "GetBookmarks", err) && len(bookmarks) != 1 {
+			t.Errorf("RemoveBookmark: %d bookmarks left, want 1", len(bookmarks))
+		}
+		invalidID(t, "AddBookmark", store.AddBookmark(ctx, "not-an-id", first.Hex()))
+	})
+
+	t.Run("ReadingLists", func(t *testing.T) {
+		list, err := store.InsertReadingList(ctx, types.NewReadingListFromParams(types.CreateReadingListParams{Name: "Weekend reads"}, user))
+		if err != nil {
+			t.Fatalf("InsertReadingList: %v", err)
+		}
+		t.Cleanup(func() { store.DeleteReadingList(ctx, list.ID.Hex()) })
+		for _, post := range []primitive.ObjectID{later, first, later} {
+			check(t, "AddToReadingList", store.AddToReadingList(ctx, list.ID.Hex(), post.Hex()))
+		}
+		if got, err := store.GetReadingList(ctx, list.ID.Hex()); check(t, "GetReadingList", err) {
+			if !slices.Equal(got.Posts, []primitive.ObjectID{later, first}) || got.Name != list.Name {
+				t.Errorf("GetReadingList: got %q with posts %v, want %q with %v in the order added", got.Name, got.Posts, list.Name, []primitive.ObjectID{later, first})
+			}
+		}
+		private := true
+		check(t, "UpdateReadingList", store.UpdateReadingList(ctx, list.ID, types.UpdateReadingListParams{Name: "Renamed", Private: &private}))
+		check(t, "RemoveFromReadingList", store.RemoveFromReadingList(ctx, list.ID.Hex(), later.Hex()))
+		if got, err := store.GetReadingList(ctx, list.ID.Hex()); check(t, "GetReadingList", err) {
+			if got.Name != "Renamed" || !got.Private || !slices.Equal(got.Posts, []primitive.ObjectID{first}) {
+				t.Errorf("GetReadingList after updates: got %+v", got)
+			}
+		}
+		if lists, err := store.GetReadingListsByOwner(ctx, user.Hex()); check(t, "GetReadingListsByOwner", err) {
+			if got := ids(lists, func(l *types.ReadingList) primitive.ObjectID { return l.ID }); !sameIDs(got, list.ID) {
+				t.Errorf("GetReadingListsByOwner: got %v, want only %s", got, list.ID.Hex())
+			}
+		}
+		if lists, err := store.GetReadingListsByOwner(ctx, primitive.NewObjectID().Hex()); check(t, "GetReadingListsByOwner of nobody", err) && (lists == nil || len(lists) > 0) {
+			t.Errorf("GetReadingListsByOwner of nobody: got %v, want an empty list", lists)
+		}
+
+		missing := primitive.NewObjectID()
+		_, err = store.GetReadingList(ctx, missing.Hex())
+		notFound(t, "GetReadingList of a missing list", err)
+		notFound(t, "UpdateReadingList of a missing list", store.UpdateReadingList(ctx, missing, types.UpdateReadingListParams{Name: "x"}))
+		notFound(t, "AddToReadingList of a missing list", store.AddToReadingList(ctx, missing.Hex(), first.Hex()))
+		notFound(t, "RemoveFromReadingList of a missing list", store.RemoveFromReadingList(ctx, missing.Hex(), first.Hex()))
+		check(t, "DeleteReadingList", store.DeleteReadingList(ctx, list.ID.Hex()))
+		notFound(t, "DeleteReadingList of a missing list", store.DeleteReadingList(ctx, list.ID.Hex()))
+		invalidID(t, "GetReadingList", func() error { _, err := store.GetReadingList(ctx, "not-an-id"); return err }())
+	})
+}
+
+func testJobStore(t *testing.T, ctx context.Context, store db.JobStore) {
+	now := time.Now().Truncate(time.Millisecond)
+	insert := func(runAt time.Time) *types.Job {
+		t.Helper()
+		job, err := store.InsertJob(ctx, types.NewJob("dbtest", map[string]string{"key": "value"}, 3, runAt))
+		if err != nil {
+			t.Fatalf("InsertJob: %v", err)
+		}
+		return job
+	}
+	later := insert(now.Add(time.Hour))
+	due := insert(now.Add(-time.Minute))
+
+	claimed, err := store.ClaimJob(ctx, now, time.Minute)
+	if check(t, "ClaimJob", err) {
+		if claimed == nil || claimed.ID != due.ID {
+			t.Fatalf("ClaimJob: got %+v, want the due job %s", claimed, due.ID.Hex())
+		}
+		if claimed.Status != types.JobStatusRunning || claimed.Attempts != 1 || !claimed.LockedUntil.Equal(now.Add(time.Minute)) {
+			t.Errorf("ClaimJob: got status %s, %d attempts, locked until %v", claimed.Status, claimed.Attempts, claimed.LockedUntil)
+		}
+		if claimed.Payload["key"] != "value" {
+			t.Errorf("ClaimJob: payload %v, want key=value", claimed.Payload)
+		}
+	}
+	if again, err := store.ClaimJob(ctx, now, time.Minute); check(t, "ClaimJob", err) && again != nil {
+		t.Errorf("ClaimJob: claimed %s, which is leased or not due", again.ID.Hex())
+	}
+	expired, err := store.ClaimJob(ctx, now.Add(2*time.Minute), time.Minute)
+	if !check(t, "ClaimJob after the lease", err) {
+		return
+	}
+	if expired == nil || expired.ID != due.ID || expired.Attempts != 2 {
+		t.Fatalf("ClaimJob after the lease: got %+v, want %s on its second attempt", expired, due.ID.Hex())
+	}
+	// The first claim is lost.
+	leaseLost(t, "CompleteJob on a lost lease", store.CompleteJob(ctx, claimed))
+	leaseLost(t, "RetryJob on a lost lease", store.RetryJob(ctx, claimed, now, "late"))
+	leaseLost(t, "KillJob on a lost lease", store.KillJob(ctx, claimed, "late"))
+
+	check(t, "RetryJob", store.RetryJob(ctx, expired, now.Add(time.Second), "boom"))
+	if got, err := store.GetJob(ctx, due.ID.Hex()); check(t, "GetJob", err) {
+		if got.Status != types.JobStatusPending || got.LastError != "boom" || !got.RunAt.Equal(now.Add(time.Second)) {
+			t.Errorf("RetryJob: got status %s, error %q, run at %v", got.Status, got.LastError, got.RunAt)
+		}
+	}
+	// A job that is no longer running is not the worker's either.
+	leaseLost(t, "CompleteJob of a pending job", store.CompleteJob(ctx, expired))
+	notFound(t, "RequeueJob of a job that is not dead", store.RequeueJob(ctx, due.ID.Hex()))
+	retried, err := store.ClaimJob(ctx, now.Add(3*time.Minute), time.Minute)
+	if !check(t, "ClaimJob after RetryJob", err) {
+		return
+	}
+	if retried == nil || retried.ID != due.ID {
+		t.Fatalf("ClaimJob after RetryJob: got %+v, want %s", retried, due.ID.Hex())
+	}
+	check(t, "KillJob", store.KillJob(ctx, retried, "gave up"))
+	if dead, err := store.GetJobs(ctx, types.JobStatusDead, 1, 10); check(t, "GetJobs", err) {
+		if got := ids(dead, func(j *types.Job) primitive.ObjectID { return j.ID }); !sameIDs(got, due.ID) {
+			t.Errorf("GetJobs of dead jobs: got %v, want only %s", got, due.ID.Hex())
+		}
+	}
+	check(t, "RequeueJob", store.RequeueJob(ctx, due.ID.Hex()))
+	if got, err := store.GetJob(ctx, due.ID.Hex()); check(t, "GetJob", err) && (got.Status != types.JobStatusPending || got.Attempts != 0) {
+		t.Errorf("RequeueJob: got status %s with %d attempts, want pending with none", got.Status, got.Attempts)
+	}
+	if claimed, err := store.ClaimJob(ctx, time.Now().Add(time.Minute), time.Minute); check(t, "ClaimJob", err) && claimed != nil {
+		check(t, "CompleteJob", store.CompleteJob(ctx, claimed))
+	}
+	if got, err := store.GetJob(ctx, due.ID.Hex()); check(t, "GetJob", err) && got.Status != types.JobStatusDone {
+		t.Errorf("CompleteJob: got status %s, want %s", got.Status, types.JobStatusDone)
+	}
+	if all, err := store.GetJobs(ctx, "", 1, 10); check(t, "GetJobs", err) {
+		if got := ids(all, func(j *types.Job) primitive.ObjectID { return j.ID }); !slices.Contains(got, later.ID) || !slices.Contains(got, due.ID) {
+			t.Errorf("GetJobs: got %v, want both jobs", got)
+		}
+	}
+
+	// Queue.EnqueueOnce picks the ID of the jobs it inserts.
+	keyed := types.NewJob("dbtest", nil, 3, now.Add(time.Hour))
+	keyed.ID = primitive.NewObjectID()
+	if got, err := store.InsertJob(ctx, keyed); check(t, "InsertJob with an ID", err) && got.ID != keyed.ID {
+		t.Errorf("InsertJob with an ID: got ID %s, want %s", got.ID.Hex(), keyed.ID.Hex())
+	}
+	_, err = store.InsertJob(ctx, types.NewJob("dbtest", nil, 3, now.Add(time.Hour)))
+	check(t, "InsertJob", err)
+	duplicate := types.NewJob("dbtest", nil, 3, now.Add(time.Hour))
+	duplicate.ID = keyed.ID
+	_, err = store.InsertJob(ctx, duplicate)
+	conflict(t, "InsertJob with a taken ID", err)
+
+	_, err = store.GetJob(ctx, primitive.NewObjectID().Hex())
+	notFound(t, "GetJob of a missing job", err)
+	notFound(t, "RequeueJob of a missing job", store.RequeueJob(ctx, primitive.NewObjectID().Hex()))
+	invalidID(t, "RequeueJob", store.RequeueJob(ctx, "not-an-id"))
+}
+
+func testNotificationStore(t *testing.T, ctx context.Context, store db.NotificationStore) {
+	var (
+		recipient = primitive.NewObjectID()
+		post      = primitive.NewObjectID()
+		now       = time.Now().Truncate(time.Millisecond)
+	)
+	newNotification := func(actor string, excerpt string, age time.Duration) *types.Notification {
+		summary := types.UserSummary{ID: primitive.NewObjectID(), FirstName: actor}
+		return &types.Notification{
+			Recipient:  recipient,
+			Type:       "repost",
+			GroupKey:   "repost:" + post.Hex(),
+			PostID:     &post,
+			Excerpt:    excerpt,
+			Actors:     []types.UserSummary{summary},
+			ActorIDs:   []primitive.ObjectID{summary.ID},
+			ActorCount: 1,
+			CreatedAt:  now.Add(-age),
+			UpdatedAt:  now.Add(-age),
+		}
+	}
+	first := newNotification("alice", "first", 3*time.Minute)
+	check(t, "AddNotification", store.AddNotification(ctx, first))
+	second := newNotification("bob", "second", 2*time.Minute)
+	check(t, "AddNotification to the same group", store.AddNotification(ctx, second))
+	second.UpdatedAt = now.Add(-time.Minute)
+	check(t, "AddNotification by the same actor", store.AddNotification(ctx, second))
+
+	inbox, err := store.GetNotifications(ctx, recipient.Hex(), false, 1, 10)
+	if check(t, "GetNotifications", err) {
+		if len(inbox) != 1 {
+			t.Fatalf("AddNotification: %d notifications, want one for the group", len(inbox))
+		}
+		got := inbox[0]
+		if got.ActorCount != 2 || len(got.Actors) != 2 || got.Actors[0].FirstName != "bob" || got.Excerpt != "second" || !got.UpdatedAt.Equal(second.UpdatedAt) {
+			t.Errorf("AddNotification: got %d actors %+v, excerpt %q, updated %v", got.ActorCount, got.Actors, got.Excerpt, got.UpdatedAt)
+		}
+	}
+	for i := range 3 {
+		check(t, "AddNotification", store.AddNotification(ctx, newNotification("more", "more", time.Duration(i)*time.Second)))
+	}
+	if inbox, err := store.GetNotifications(ctx, recipient.Hex(), true, 1, 10); check(t, "GetNotifications", err) && len(inbox) == 1 {
+		if got := inbox[0]; got.ActorCount != 5 || len(got.Actors) != 3 {
+			t.Errorf("AddNotification: got %d actors with %d shown, want 5 with 3 shown", got.ActorCount, len(got.Actors))
+		}
+		check(t, "MarkRead", store.MarkRead(ctx, recipient.Hex(), inbox[0].ID.Hex()))
+	}
+	if n, err := store.CountUnread(ctx, recipient.Hex()); check(t, "CountUnread", err) && n != 0 {
+		t.Errorf("MarkRead: %d unread, want none", n)
+	}
+
+	// a read notification closes its group
+	check(t, "AddNotification after MarkRead", store.AddNotification(ctx, newNotification("carol", "third", 0)))
+	other := newNotification("dave", "other group", 0)
+	other.GroupKey = "friend_request"
+	check(t, "AddNotification", store.AddNotification(ctx, other))
+	if n, err := store.CountUnread(ctx, recipient.Hex()); check(t, "CountUnread", err) && n != 2 {
+		t.Errorf("CountUnread: %d, want 2", n)
+	}
+	if inbox, err := store.GetNotifications(ctx, recipient.Hex(), false, 1, 10); check(t, "GetNotifications", err) && len(inbox) != 3 {
+		t.Errorf("GetNotifications: %d notifications, want 3", len(inbox))
+	}
+	check(t, "MarkAllRead", store.MarkAllRead(ctx, recipient.Hex()))
+	if unread, err := store.GetNotifications(ctx, recipient.Hex(), true, 1, 10); check(t, "GetNotifications", err) && len(unread) != 0 {
+		t.Errorf("MarkAllRead: %d unread, want none", len(unread))
+	}
+	notFound(t, "MarkRead of another user's notification", store.MarkRead(ctx, primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()))
+	invalidID(t, "MarkRead", store.MarkRead(ctx, recipient.Hex(), "not-an-id"))
+}
+
+func testTokenStore(t *testing.T, ctx context.Context, store db.TokenStore) {
+	id := "dbtest-" + primitive.NewObjectID().Hex()
+	expires := time.Now().Add(time.Hour)
+	check(t, "UseToken", store.UseToken(ctx, id, expires))
+	if err := store.UseToken(ctx, id, expires); !errors.Is(err, db.ErrTokenUsed) {
+		t.Errorf("UseToken twice: got error %v, want %v", err, db.ErrTokenUsed)
+	}
+}
+
+func testWebhookStore(t *testing.T, ctx context.Context, store db.WebhookStore) {
+	webhook, err := store.InsertWebhook(ctx, types.NewWebhookFromParams(types.CreateWebhookParams{
+		URL:    "https://example.com/hooks",
+		Events: []string{types.WebhookPostCreated},
+	}, "secret"))
+	if err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	t.Cleanup(func() { store.DeleteWebhook(ctx, webhook.ID.Hex()) })
+	all, err := store.InsertWebhook(ctx, types.NewWebhookFromParams(types.CreateWebhookParams{
+		URL:    "https://example.com/all",
+		Events: []string{types.WebhookAllEvents},
+	}, "secret"))
+	if err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	t.Cleanup(func() { store.DeleteWebhook(ctx, all.ID.Hex()) })
+
+	if got, err := store.GetWebhook(ctx, webhook.ID.Hex()); check(t, "GetWebhook", err) {
+		if got.URL != webhook.URL || got.Secret != "secret" || !slices.Equal(got.Events, webhook.Events) || !got.Active {
+			t.Errorf("GetWebhook: got %+v", got)
+		}
+	}
+	forEvent := func(event string) []primitive.ObjectID {
+		t.Helper()
+		webhooks, err := store.GetWebhooksForEvent(ctx, event)
+		check(t, "GetWebhooksForEvent", err)
+		return ids(webhooks, func(w *types.Webhook) primitive.ObjectID { return w.ID })
+	}
+	if got := forEvent(types.WebhookPostCreated); !sameIDs(got, webhook.ID, all.ID) {
+		t.Errorf("GetWebhooksForEvent: got %v, want both webhooks", got)
+	}
+	if got := forEvent(types.WebhookPostDeleted); !sameIDs(got, all.ID) {
+		t.Errorf("GetWebhooksForEvent: got %v, want only the catch-all", got)
+	}
+	inactive := false
+	check(t, "UpdateWebhook", store.UpdateWebhook(ctx, all.ID, types.UpdateWebhookParams{Active: &inactive, Events: []string{types.WebhookPostDeleted}}))
+	if got := forEvent(types.WebhookPostDeleted); len(got) != 0 {
+		t.Errorf("GetWebhooksForEvent: got %v, want no inactive webhooks", got)
+	}
+	if got, err := store.GetWebhooks(ctx); check(t, "GetWebhooks", err) && len(got) != 2 {
+		t.Errorf("GetWebhooks: got %d webhooks, want 2", len(got))
+	}
+
+	delivery, err := store.InsertDelivery(ctx, &types.WebhookDelivery{
+		Webhook:   webhook.ID,
+		Event:     types.WebhookPostCreated,
+		Payload:   `{"event":"post.created"}`,
+		Status:    types.DeliveryPending,
+		Attempts:  []types.DeliveryAttempt{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("InsertDelivery: %v", err)
+	}
+	// Webhook fan-outs pick the ID of the deliveries they insert.
+	_, err = store.InsertDelivery(ctx, &types.WebhookDelivery{ID: delivery.ID, Webhook: webhook.ID, Status: types.DeliveryPending, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	conflict(t, "InsertDelivery with a taken ID", err)
+	check(t, "RecordAttempt", store.RecordAttempt(ctx, delivery.ID, types.DeliveryFailed, types.DeliveryAttempt{At: time.Now(), StatusCode: 500}))
+	check(t, "RecordAttempt", store.RecordAttempt(ctx, delivery.ID, types.DeliverySucceeded, types.DeliveryAttempt{At: time.Now(), StatusCode: 200}))
+	if got, err := store.GetDelivery(ctx, delivery.ID.Hex()); check(t, "GetDelivery", err) {
+		if got.Status != types.DeliverySucceeded || len(got.Attempts) != 2 || got.Attempts[1].StatusCode != 200 || got.Payload != delivery.Payload {
+			t.Errorf("RecordAttempt: got status %s with attempts %+v", got.Status, got.Attempts)
+		}
+	}
+	check(t, "ResetDelivery", store.ResetDelivery(ctx, delivery.ID.Hex()))
+	if got, err := store.GetDeliveries(ctx, webhook.ID.Hex(), 1, 10); check(t, "GetDeliveries", err) {
+		if len(got) != 1 || got[0].Status != types.DeliveryPending {
+			t.Errorf("GetDeliveries after ResetDelivery: got %+v", got)
+		}
+	}
+
+	missing := primitive.NewObjectID()
+	_, err = store.GetWebhook(ctx, missing.Hex())
+	notFound(t, "GetWebhook of a missing webhook", err)
+	notFound(t, "UpdateWebhook of a missing webhook", store.UpdateWebhook(ctx, missing, types.UpdateWebhookParams{URL: "https://example.com"}))
+	notFound(t, "ResetDelivery of a missing delivery", store.ResetDelivery(ctx, missing.Hex()))
+	check(t, "DeleteWebhook", store.DeleteWebhook(ctx, webhook.ID.Hex()))
+	_, err = store.GetDelivery(ctx, delivery.ID.Hex())
+	notFound(t, "GetDelivery after DeleteWebhook", err)
+	notFound(t, "DeleteWebhook of a missing webhook", store.DeleteWebhook(ctx, webhook.ID.Hex()))
+}
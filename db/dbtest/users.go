@@ -0,0 +1,412 @@
+package dbtest
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newUser(name string) *types.User {
+	return &types.User{
+		FirstName: name,
+		LastName:  "conformance",
+		Email:     name + "-" + primitive.NewObjectID().Hex() + "@conformance.test",
+		Password:  "not-a-hash",
+		Language:  types.DefaultLanguage,
+		TimeZone:  types.DefaultTimeZone,
+		Devices:   []types.Device{},
+		Friends:   []primitive.ObjectID{},
+		Blocked:   []primitive.ObjectID{},
+		Notifications: types.NotificationSettings{
+			Events: map[string]types.ChannelPreference{},
+			Digest: types.DigestDaily,
+		},
+		LastDigestAt: time.Now(),
+	}
+}
+
+func insertUser(t *testing.T, ctx context.Context, store db.UserStore, name string) *types.User {
+	t.Helper()
+	user, err := store.InsertUser(ctx, newUser(name))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if user.ID.IsZero() {
+		t.Fatalf("InsertUser: no ID assigned")
+	}
+	t.Cleanup(func() { store.DeleteUser(ctx, user.ID.Hex(), 0) })
+	return user
+}
+
+func getUser(t *testing.T, ctx context.Context, store db.UserStore, user *types.User) *types.User {
+	t.Helper()
+	got, err := store.GetUser(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	return got
+}
+
+func testUserStore(t *testing.T, ctx context.Context, store db.UserStore) {
+	alice := insertUser(t, ctx, store, "alice")
+	bob := insertUser(t, ctx, store, "bob")
+
+	t.Run("Lookups", func(t *testing.T) { checkUserLookups(t, ctx, store, alice) })
+	t.Run("Batches", func(t *testing.T) { checkUserBatches(t, ctx, store, alice, bob) })
+	t.Run("Updates", func(t *testing.T) { checkUserUpdates(t, ctx, store, alice) })
+	t.Run("UniqueEmail", func(t *testing.T) { checkUniqueEmail(t, ctx, store, alice, bob) })
+	t.Run("Versions", func(t *testing.T) { checkUserVersions(t, ctx, store, alice, bob) })
+	t.Run("Friends", func(t *testing.T) { checkFriends(t, ctx, store, alice, bob) })
+	t.Run("Blocks", func(t *testing.T) { checkBlocks(t, ctx, store) })
+	t.Run("Devices", func(t *testing.T) { checkDevices(t, ctx, store, alice, bob) })
+	t.Run("NotificationSettings", func(t *testing.T) { checkNotificationSettings(t, ctx, store, alice) })
+	t.Run("Digests", func(t *testing.T) { checkDigests(t, ctx, store, alice, bob) })
+
+	if !check(t, "DeleteUser", store.DeleteUser(ctx, alice.ID.Hex(), 0)) {
+		return
+	}
+	_, err := store.GetUser(ctx, alice.ID.Hex())
+	notFound(t, "GetUser after DeleteUser", err)
+	notFound(t, "DeleteUser of a missing user", store.DeleteUser(ctx, alice.ID.Hex(), 0))
+	invalidID(t, "DeleteUser", store.DeleteUser(ctx, "not-an-id", 0))
+	users, err := store.GetUsers(ctx)
+	if check(t, "GetUsers", err) {
+		got := ids(users, func(u *types.User) primitive.ObjectID { return u.ID })
+		if slices.Contains(got, alice.ID) || !slices.Contains(got, bob.ID) {
+			t.Errorf("GetUsers: deleted user listed or remaining user missing")
+		}
+	}
+}
+
+func checkUserLookups(t *testing.T, ctx context.Context, store db.UserStore, alice *types.User) {
+	got := getUser(t, ctx, store, alice)
+	if got.Email != alice.Email || got.FirstName != alice.FirstName || got.TimeZone != alice.TimeZone {
+		t.Errorf("GetUser: got %+v, want %+v", got, alice)
+	}
+	if d := got.LastDigestAt.Sub(alice.LastDigestAt); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("GetUser: last digest at %v, want %v", got.LastDigestAt, alice.LastDigestAt)
+	}
+	got.FirstName = "changed"
+	if again := getUser(t, ctx, store, alice); again.FirstName != alice.FirstName {
+		t.Errorf("GetUser: changing a returned user changed the stored one")
+	}
+	if byOID, err := store.GetUserByObjectID(ctx, alice.ID); check(t, "GetUserByObjectID", err) && byOID.Email != alice.Email {
+		t.Errorf("GetUserByObjectID: got %s, want %s", byOID.Email, alice.Email)
+	}
+	if byEmail, err := store.GetUserByEmail(ctx, alice.Email); check(t, "GetUserByEmail", err) && byEmail.ID != alice.ID {
+		t.Errorf("GetUserByEmail: got %s, want %s", byEmail.ID.Hex(), alice.ID.Hex())
+	}
+
+	_, err := store.GetUser(ctx, primitive.NewObjectID().Hex())
+	notFound(t, "GetUser of a missing user", err)
+	_, err = store.GetUserByObjectID(ctx, primitive.NewObjectID())
+	notFound(t, "GetUserByObjectID of a missing user", err)
+	_, err = store.GetUserByEmail(ctx, "nobody-"+primitive.NewObjectID().Hex()+"@conformance.test")
+	notFound(t, "GetUserByEmail of a missing address", err)
+	_, err = store.GetUser(ctx, "not-an-id")
+	invalidID(t, "GetUser", err)
+
+	dup := newUser("alice")
+	dup.ID = alice.ID
+	_, err = store.InsertUser(ctx, dup)
+	conflict(t, "InsertUser with a taken ID", err)
+}
+
+func checkUserBatches(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	carol := insertUser(t, ctx, store, "carol")
+	batch := []primitive.ObjectID{alice.ID, carol.ID, primitive.NewObjectID(), alice.ID}
+	if users, err := store.GetUsersByIDs(ctx, batch); check(t, "GetUsersByIDs", err) {
+		if got := ids(users, func(u *types.User) primitive.ObjectID { return u.ID }); !sameIDs(got, alice.ID, carol.ID) {
+			t.Errorf("GetUsersByIDs: got %v, want %s and %s", got, alice.ID.Hex(), carol.ID.Hex())
+		}
+		for _, user := range users {
+			if user.ID == carol.ID && (user.Email != carol.Email || user.Notifications.Digest != carol.Notifications.Digest) {
+				t.Errorf("GetUsersByIDs: got %+v, want %+v", user, carol)
+			}
+		}
+	}
+	err := store.UpdateUser(ctx, db.UserFilter{ID: carol.ID}, types.UpdateUserParams{FirstName: "Caroline"})
+	if check(t, "UpdateUser", err) {
+		users, err := store.GetUsersByIDs(ctx, []primitive.ObjectID{carol.ID})
+		if check(t, "GetUsersByIDs after UpdateUser", err) && (len(users) != 1 || users[0].FirstName != "Caroline") {
+			t.Errorf("GetUsersByIDs after UpdateUser: got %+v, want Caroline", users)
+		}
+	}
+	if users, err := store.GetUsersByIDs(ctx, []primitive.ObjectID{carol.ID, bob.ID}, "firstName", "lastName"); check(t, "GetUsersByIDs with fields", err) {
+		if got := ids(users, func(u *types.User) primitive.ObjectID { return u.ID }); !sameIDs(got, carol.ID, bob.ID) {
+			t.Errorf("GetUsersByIDs with fields: got %v, want %s and %s", got, carol.ID.Hex(), bob.ID.Hex())
+		}
+		for _, user := range users {
+			if len(user.FirstName) == 0 || user.LastName != "conformance" || len(user.Email) > 0 || len(user.Password) > 0 || user.Version != 0 {
+				t.Errorf("GetUsersByIDs with fields: got %+v, want only the ID and name", user)
+			}
+		}
+	}
+	if users, err := store.GetUsersByIDs(ctx, nil); check(t, "GetUsersByIDs with no IDs", err) && (users == nil || len(users) > 0) {
+		t.Errorf("GetUsersByIDs with no IDs: got %v, want an empty list", users)
+	}
+}
+
+func checkUserUpdates(t *testing.T, ctx context.Context, store db.UserStore, alice *types.User) {
+	check(t, "MarkEmailVerified", store.MarkEmailVerified(ctx, alice.ID.Hex(), alice.Email))
+	if !getUser(t, ctx, store, alice).EmailVerified {
+		t.Errorf("MarkEmailVerified: email not verified")
+	}
+
+	email := "alice-" + primitive.NewObjectID().Hex() + "@conformance.test"
+	params := types.UpdateUserParams{FirstName: "Alicia", Email: email}
+	check(t, "UpdateUser", store.UpdateUser(ctx, db.UserFilter{ID: alice.ID}, params))
+	got := getUser(t, ctx, store, alice)
+	if got.FirstName != "Alicia" || got.LastName != alice.LastName || got.Email != email {
+		t.Errorf("UpdateUser: got %s %s <%s>, want Alicia %s <%s>", got.FirstName, got.LastName, got.Email, alice.LastName, email)
+	}
+	if got.EmailVerified {
+		t.Errorf("UpdateUser: a new email is still verified")
+	}
+	notFound(t, "MarkEmailVerified of a replaced email", store.MarkEmailVerified(ctx, alice.ID.Hex(), alice.Email))
+	notFound(t, "MarkEmailVerified of a missing user", store.MarkEmailVerified(ctx, primitive.NewObjectID().Hex(), email))
+	invalidID(t, "MarkEmailVerified", store.MarkEmailVerified(ctx, "not-an-id", email))
+	alice.Email = email
+
+	check(t, "UpdateUser by email", store.UpdateUser(ctx, db.UserFilter{Email: email}, types.UpdateUserParams{LastName: "Updated"}))
+	if got := getUser(t, ctx, store, alice); got.LastName != "Updated" {
+		t.Errorf("UpdateUser by email: last name %q, want Updated", got.LastName)
+	}
+	alice.LastName = "Updated"
+
+	missing := db.UserFilter{ID: primitive.NewObjectID()}
+	notFound(t, "UpdateUser of a missing user", store.UpdateUser(ctx, missing, params))
+	notFound(t, "UpdateUser of a missing user with no fields", store.UpdateUser(ctx, missing, types.UpdateUserParams{}))
+	emptyFilter(t, "UpdateUser", store.UpdateUser(ctx, db.UserFilter{}, params))
+}
+
+func checkUniqueEmail(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	dup := newUser("carol")
+	dup.Email = alice.Email
+	user, err := store.InsertUser(ctx, dup)
+	conflict(t, "InsertUser with a taken email", err)
+	if err == nil {
+		store.DeleteUser(ctx, user.ID.Hex(), 0)
+	}
+	err = store.UpdateUser(ctx, db.UserFilter{ID: bob.ID}, types.UpdateUserParams{Email: alice.Email})
+	conflict(t, "UpdateUser to a taken email", err)
+	if got := getUser(t, ctx, store, bob); got.Email != bob.Email {
+		t.Errorf("UpdateUser to a taken email: email changed to %s", got.Email)
+	}
+	check(t, "UpdateUser to the user's own email", store.UpdateUser(ctx, db.UserFilter{ID: bob.ID}, types.UpdateUserParams{Email: bob.Email}))
+}
+
+func checkUserVersions(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	if bob.Version != 1 {
+		t.Errorf("InsertUser: version %d, want 1", bob.Version)
+	}
+	version := getUser(t, ctx, store, alice).Version
+	params := types.UpdateUserParams{FirstName: "Ally"}
+	versionMismatch(t, "UpdateUser", store.UpdateUser(ctx, db.UserFilter{ID: alice.ID, Version: version - 1}, params))
+	check(t, "UpdateUser at the current version", store.UpdateUser(ctx, db.UserFilter{ID: alice.ID, Version: version}, params))
+	if got := getUser(t, ctx, store, alice); got.FirstName != params.FirstName || got.Version != version+1 {
+		t.Errorf("UpdateUser at the current version: got %s at version %d, want %s at %d", got.FirstName, got.Version, params.FirstName, version+1)
+	}
+	version++
+	check(t, "AddFriend", store.AddFriend(ctx, db.UserFilter{ID: alice.ID}, bob.ID))
+	check(t, "RemoveFriend", store.RemoveFriend(ctx, db.UserFilter{ID: alice.ID}, bob.ID))
+	if got := getUser(t, ctx, store, alice).Version; got != version+2 {
+		t.Errorf("AddFriend and RemoveFriend: version %d, want %d", got, version+2)
+	}
+	versionMismatch(t, "AddFriend", store.AddFriend(ctx, db.UserFilter{ID: alice.ID, Version: version}, bob.ID))
+	versionMismatch(t, "DeleteUser", store.DeleteUser(ctx, alice.ID.Hex(), version))
+	notFound(t, "DeleteUser of a missing user at a version", store.DeleteUser(ctx, primitive.NewObjectID().Hex(), 1))
+}
+
+func checkFriends(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	for range 2 {
+		check(t, "AddFriend", store.AddFriend(ctx, db.UserFilter{ID: alice.ID}, bob.ID))
+	}
+	if got := getUser(t, ctx, store, alice).Friends; !sameIDs(got, bob.ID) {
+		t.Errorf("AddFriend twice: friends %v, want only %s", got, bob.ID.Hex())
+	}
+	if got := getUser(t, ctx, store, bob).Friends; len(got) != 0 {
+		t.Errorf("AddFriend: friendship is not one-way, bob has friends %v", got)
+	}
+	check(t, "RemoveFriend", store.RemoveFriend(ctx, db.UserFilter{ID: alice.ID}, bob.ID))
+	check(t, "RemoveFriend of a non-friend", store.RemoveFriend(ctx, db.UserFilter{ID: alice.ID}, bob.ID))
+	if got := getUser(t, ctx, store, alice).Friends; len(got) != 0 {
+		t.Errorf("RemoveFriend: friends %v, want none", got)
+	}
+	missing := primitive.NewObjectID()
+	notFound(t, "AddFriend of a missing friend", store.AddFriend(ctx, db.UserFilter{ID: alice.ID}, missing))
+	notFound(t, "AddFriend to a missing user", store.AddFriend(ctx, db.UserFilter{ID: missing}, bob.ID))
+	notFound(t, "RemoveFriend from a missing user", store.RemoveFriend(ctx, db.UserFilter{ID: missing}, bob.ID))
+	check(t, "RemoveFriend of a missing friend", store.RemoveFriend(ctx, db.UserFilter{ID: alice.ID}, missing))
+	stale := db.UserFilter{ID: alice.ID, Version: getUser(t, ctx, store, alice).Version - 1}
+	versionMismatch(t, "AddFriend", store.AddFriend(ctx, stale, bob.ID))
+	versionMismatch(t, "RemoveFriend", store.RemoveFriend(ctx, stale, bob.ID))
+	current := db.UserFilter{ID: alice.ID, Version: stale.Version + 1}
+	check(t, "AddFriend at the current version", store.AddFriend(ctx, current, bob.ID))
+	if got := getUser(t, ctx, store, alice).Version; got <= current.Version {
+		t.Errorf("AddFriend: version %d, want it bumped past %d", got, current.Version)
+	}
+	emptyFilter(t, "AddFriend", store.AddFriend(ctx, db.UserFilter{}, bob.ID))
+	emptyFilter(t, "RemoveFriend", store.RemoveFriend(ctx, db.UserFilter{}, bob.ID))
+}
+
+// checkBlocks uses users of its own, so the friendships it makes do not leak
+// into the other checks.
+func checkBlocks(t *testing.T, ctx context.Context, store db.UserStore) {
+	carol := insertUser(t, ctx, store, "carol")
+	dan := insertUser(t, ctx, store, "dan")
+	erin := insertUser(t, ctx, store, "erin")
+	check(t, "AddFriend", store.AddFriend(ctx, db.UserFilter{ID: dan.ID}, carol.ID))
+	for range 2 {
+		check(t, "BlockUser", store.BlockUser(ctx, db.UserFilter{ID: carol.ID}, erin.ID))
+	}
+	if got := getUser(t, ctx, store, carol).Blocked; !sameIDs(got, erin.ID) {
+		t.Errorf("BlockUser twice: blocked %v, want only %s", got, erin.ID.Hex())
+	}
+
+	viewer, err := store.GetViewer(ctx, carol.ID)
+	if check(t, "GetViewer", err) {
+		if viewer.ID != carol.ID || !sameIDs(viewer.FriendOf, dan.ID) || !sameIDs(viewer.Hidden, erin.ID) {
+			t.Errorf("GetViewer: got %+v, want friend of %s hiding %s", viewer, dan.ID.Hex(), erin.ID.Hex())
+		}
+	}
+	viewer, err = store.GetViewer(ctx, erin.ID)
+	if check(t, "GetViewer of the blocked user", err) && (len(viewer.FriendOf) != 0 || !sameIDs(viewer.Hidden, carol.ID)) {
+		t.Errorf("GetViewer of the blocked user: got %+v, want hiding only %s", viewer, carol.ID.Hex())
+	}
+	_, err = store.GetViewer(ctx, primitive.NewObjectID())
+	notFound(t, "GetViewer of a missing user", err)
+
+	check(t, "UnblockUser", store.UnblockUser(ctx, db.UserFilter{ID: carol.ID}, erin.ID))
+	check(t, "UnblockUser of an unblocked user", store.UnblockUser(ctx, db.UserFilter{ID: carol.ID}, erin.ID))
+	viewer, err = store.GetViewer(ctx, erin.ID)
+	if check(t, "GetViewer after UnblockUser", err) && len(viewer.Hidden) != 0 {
+		t.Errorf("GetViewer after UnblockUser: hiding %v, want none", viewer.Hidden)
+	}
+
+	missing := primitive.NewObjectID()
+	notFound(t, "BlockUser of a missing user", store.BlockUser(ctx, db.UserFilter{ID: carol.ID}, missing))
+	notFound(t, "BlockUser by a missing user", store.BlockUser(ctx, db.UserFilter{ID: missing}, erin.ID))
+	notFound(t, "UnblockUser by a missing user", store.UnblockUser(ctx, db.UserFilter{ID: missing}, erin.ID))
+	stale := db.UserFilter{ID: carol.ID, Version: getUser(t, ctx, store, carol).Version - 1}
+	versionMismatch(t, "BlockUser", store.BlockUser(ctx, stale, erin.ID))
+	versionMismatch(t, "UnblockUser", store.UnblockUser(ctx, stale, erin.ID))
+	current := db.UserFilter{ID: carol.ID, Version: stale.Version + 1}
+	check(t, "BlockUser at the current version", store.BlockUser(ctx, current, erin.ID))
+	if got := getUser(t, ctx, store, carol).Version; got <= current.Version {
+		t.Errorf("BlockUser: version %d, want it bumped past %d", got, current.Version)
+	}
+	emptyFilter(t, "BlockUser", store.BlockUser(ctx, db.UserFilter{}, erin.ID))
+	emptyFilter(t, "UnblockUser", store.UnblockUser(ctx, db.UserFilter{}, erin.ID))
+}
+
+func checkDevices(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	token := "token-" + primitive.NewObjectID().Hex()
+	device := types.Device{Token: token, Platform: types.PlatformAndroid, AppVersion: "1.0.0", LastSeen: time.Now()}
+	check(t, "UpsertDevice", store.UpsertDevice(ctx, alice.ID.Hex(), device))
+	device.AppVersion = "1.1.0"
+	check(t, "UpsertDevice of a known token", store.UpsertDevice(ctx, alice.ID.Hex(), device))
+	if got := getUser(t, ctx, store, alice).Devices; len(got) != 1 || got[0].AppVersion != "1.1.0" {
+		t.Errorf("UpsertDevice twice: devices %+v, want one on 1.1.0", got)
+	}
+
+	check(t, "UpsertDevice to another user", store.UpsertDevice(ctx, bob.ID.Hex(), device))
+	if got := getUser(t, ctx, store, alice).Devices; len(got) != 0 {
+		t.Errorf("UpsertDevice: token still registered to its previous user: %+v", got)
+	}
+	if got := getUser(t, ctx, store, bob).Devices; len(got) != 1 || got[0].Token != token {
+		t.Errorf("UpsertDevice: devices %+v, want %s", got, token)
+	}
+	if owners, err := store.GetUsersByDeviceTokens(ctx, []string{token, "token-unknown"}); check(t, "GetUsersByDeviceTokens", err) {
+		if got := ids(owners, func(u *types.User) primitive.ObjectID { return u.ID }); !sameIDs(got, bob.ID) {
+			t.Errorf("GetUsersByDeviceTokens: got %v, want only %s", got, bob.ID.Hex())
+		}
+	}
+	if owners, err := store.GetUsersByDeviceTokens(ctx, nil); check(t, "GetUsersByDeviceTokens with no tokens", err) && (owners == nil || len(owners) > 0) {
+		t.Errorf("GetUsersByDeviceTokens with no tokens: got %v, want an empty list", owners)
+	}
+	notFound(t, "UpsertDevice of a missing user", store.UpsertDevice(ctx, primitive.NewObjectID().Hex(), device))
+
+	version := getUser(t, ctx, store, bob).Version
+	check(t, "RemoveDevice", store.RemoveDevice(ctx, bob.ID.Hex(), token))
+	if got := getUser(t, ctx, store, bob).Version; got <= version {
+		t.Errorf("RemoveDevice: version %d, want it bumped past %d", got, version)
+	}
+	notFound(t, "RemoveDevice of a missing user", store.RemoveDevice(ctx, primitive.NewObjectID().Hex(), token))
+	if got := getUser(t, ctx, store, bob).Devices; len(got) != 0 {
+		t.Errorf("RemoveDevice: devices %+v, want none", got)
+	}
+
+	other := "token-" + primitive.NewObjectID().Hex()
+	check(t, "UpsertDevice", store.UpsertDevice(ctx, alice.ID.Hex(), device))
+	check(t, "UpsertDevice", store.UpsertDevice(ctx, bob.ID.Hex(), types.Device{Token: other, Platform: types.PlatformWeb}))
+	check(t, "RemoveDeviceTokens", store.RemoveDeviceTokens(ctx, []string{token, other}))
+	if got := len(getUser(t, ctx, store, alice).Devices) + len(getUser(t, ctx, store, bob).Devices); got != 0 {
+		t.Errorf("RemoveDeviceTokens: %d device(s) left, want none", got)
+	}
+	check(t, "RemoveDeviceTokens with no tokens", store.RemoveDeviceTokens(ctx, nil))
+}
+
+func checkNotificationSettings(t *testing.T, ctx context.Context, store db.UserStore, alice *types.User) {
+	settings := types.NotificationSettings{
+		Events: map[string]types.ChannelPreference{
+			types.EventNewPost: {Push: false, InApp: true, Email: true},
+		},
+		QuietHours: types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer},
+		Digest:     types.DigestWeekly,
+	}
+	check(t, "UpdateNotificationSettings", store.UpdateNotificationSettings(ctx, alice.ID.Hex(), settings))
+	got := getUser(t, ctx, store, alice).Notifications
+	if got.Digest != types.DigestWeekly || got.QuietHours != settings.QuietHours || got.Events[types.EventNewPost] != settings.Events[types.EventNewPost] {
+		t.Errorf("UpdateNotificationSettings: got %+v, want %+v", got, settings)
+	}
+
+	check(t, "UpdateNotificationSettings without events", store.UpdateNotificationSettings(ctx, alice.ID.Hex(), types.NotificationSettings{Digest: types.DigestDaily}))
+	if got := getUser(t, ctx, store, alice).Notifications.Events; got == nil || len(got) != 0 {
+		t.Errorf("UpdateNotificationSettings without events: events %v, want an empty map", got)
+	}
+	notFound(t, "UpdateNotificationSettings of a missing user",
+		store.UpdateNotificationSettings(ctx, primitive.NewObjectID().Hex(), settings))
+}
+
+func checkDigests(t *testing.T, ctx context.Context, store db.UserStore, alice, bob *types.User) {
+	// alice is on daily digests, bob on weekly ones, and both were sent one
+	// when they signed up.
+	check(t, "UpdateNotificationSettings", store.UpdateNotificationSettings(ctx, bob.ID.Hex(), types.NotificationSettings{Digest: types.DigestWeekly}))
+	now := time.Now()
+	sentBefore := now.Add(time.Hour)
+
+	due, err := store.GetDigestDue(ctx, types.DigestDaily, sentBefore)
+	if check(t, "GetDigestDue", err) {
+		got := ids(due, func(u *types.User) primitive.ObjectID { return u.ID })
+		if !slices.Contains(got, alice.ID) || slices.Contains(got, bob.ID) {
+			t.Errorf("GetDigestDue: due %v, want alice but not bob", got)
+		}
+	}
+	due, err = store.GetDigestDue(ctx, types.DigestDaily, now.Add(-time.Hour))
+	if check(t, "GetDigestDue", err) {
+		if due == nil {
+			t.Errorf("GetDigestDue: got nil, want an empty list")
+		}
+		if slices.Contains(ids(due, func(u *types.User) primitive.ObjectID { return u.ID }), alice.ID) {
+			t.Errorf("GetDigestDue: alice is due before her last digest")
+		}
+	}
+
+	claimed, err := store.ClaimDigest(ctx, alice.ID, sentBefore, now)
+	if check(t, "ClaimDigest", err) && !claimed {
+		t.Errorf("ClaimDigest: a due digest was not claimed")
+	}
+	claimed, err = store.ClaimDigest(ctx, alice.ID, now.Add(-time.Minute), now)
+	if check(t, "ClaimDigest", err) && claimed {
+		t.Errorf("ClaimDigest: a digest was claimed twice")
+	}
+	claimed, err = store.ClaimDigest(ctx, primitive.NewObjectID(), sentBefore, now)
+	if check(t, "ClaimDigest of a missing user", err) && claimed {
+		t.Errorf("ClaimDigest: claimed a digest for a missing user")
+	}
+}
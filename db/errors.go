@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"maps"
+	"strconv"
+)
+
+// The stores report these errors, whatever the backend, so callers can tell a
+// missing document from a failing database without knowing which one they
+// talk to. Check them with errors.Is.
+var (
+	// ErrNotFound is returned when the document a method reads or writes
+	// does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would reuse a unique key, such as
+	// an ID that is already taken.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidID is returned for an ID that is not a hex ObjectID.
+	ErrInvalidID = errors.New("invalid id")
+	// ErrVersionMismatch is returned by a write made on condition that the
+	// document is at a version, when it has since moved on.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrLeaseLost is returned when a worker records the outcome of a job it
+	// no longer holds: its lease ran out and the job was claimed again.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// parseID converts a hex ID passed to a store, reporting ErrInvalidID if it is
+// malformed.
+func parseID(id string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: %s", ErrInvalidID, strconv.Quote(id))
+	}
+	return oid, nil
+}
+
+// mongoError translates the driver's errors for missing documents and
+// duplicate keys into ErrNotFound and ErrConflict.
+func mongoError(err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// notMatched explains why a write to the document filter selects matched
+// nothing: ErrVersionMismatch if the write was conditioned on a version and
+// the document exists at another one, otherwise ErrNotFound.
+func notMatched(ctx context.Context, coll *mongo.Collection, filter bson.M) error {
+	if _, ok := filter["version"]; !ok {
+		return ErrNotFound
+	}
+	unversioned := maps.Clone(filter)
+	delete(unversioned, "version")
+	n, err := coll.CountDocuments(ctx, unversioned, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filters are plain structs rather than query documents so that every backend
+// can translate them: each has a bson form for the Mongo stores, a where
+// clause for the SQL stores and a match for the memory stores.
+
+// errEmptyFilter is returned by updates given a filter that sets no field,
+// which would otherwise change whichever document came first.
+var errEmptyFilter = errors.New("update filter selects no document")
+
+// UserFilter selects users. Unset fields match every user. A write given a
+// Version reports ErrVersionMismatch if the user it would otherwise select is
+// at another version.
+type UserFilter struct {
+	ID      primitive.ObjectID
+	Email   string
+	Version int64
+}
+
+func (f UserFilter) IsZero() bool {
+	return f == UserFilter{}
+}
+
+func (f UserFilter) bson() bson.M {
+	m := bson.M{}
+	if !f.ID.IsZero() {
+		m["_id"] = f.ID
+	}
+	if len(f.Email) > 0 {
+		m["email"] = f.Email
+	}
+	if f.Version > 0 {
+		m["version"] = f.Version
+	}
+	return m
+}
+
+func (f UserFilter) match(user *types.User) bool {
+	return (f.ID.IsZero() || user.ID == f.ID) &&
+		(len(f.Email) == 0 || user.Email == f.Email) &&
+		(f.Version == 0 || user.Version == f.Version)
+}
+
+func (f UserFilter) where() (string, []any) {
+	var w sqlWhere
+	if !f.ID.IsZero() {
+		w.add(`id = ?`, f.ID.Hex())
+	}
+	if len(f.Email) > 0 {
+		w.add(`email = ?`, f.Email)
+	}
+	if f.Version > 0 {
+		w.add(`version = ?`, f.Version)
+	}
+	return w.String(), w.args
+}
+
+// PostFilter selects posts. Unset fields match every post. Kinds decides which
+// posts are visible to a reader, e.g. feeds leave out plain reposts. A write
+// given a Version reports ErrVersionMismatch if the post it would otherwise
+// select is at another version.
+type PostFilter struct {
+	ID      primitive.ObjectID
+	Authors []primitive.ObjectID
+	Kinds   []string
+	// RepostOf selects the reposts and quotes of a post.
+	RepostOf primitive.ObjectID
+	// CreatedFrom and CreatedTo bound the creation time, both inclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Version     int64
+	// Viewer, if set, selects only the posts the viewer may read.
+	Viewer *types.Viewer
+}
+
+func (f PostFilter) IsZero() bool {
+	return f.ID.IsZero() && len(f.Authors) == 0 && len(f.Kinds) == 0 && f.RepostOf.IsZero() &&
+		f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() && f.Version == 0 && f.Viewer == nil
+}
+
+func (f PostFilter) bson() bson.M {
+	m := bson.M{}
+	if !f.ID.IsZero() {
+		m["_id"] = f.ID
+	}
+	if len(f.Authors) > 0 {
+		m["author"] = bson.M{"$in": f.Authors}
+	}
+	if len(f.Kinds) > 0 {
+		m["kind"] = bson.M{"$in": f.Kinds}
+	}
+	if !f.RepostOf.IsZero() {
+		m["repost_of"] = f.RepostOf
+	}
+	created := bson.M{}
+	if !f.CreatedFrom.IsZero() {
+		created["$gte"] = f.CreatedFrom
+	}
+	if !f.CreatedTo.IsZero() {
+		created["$lte"] = f.CreatedTo
+	}
+	if len(created) > 0 {
+		m["created_at"] = created
+	}
+	if f.Version > 0 {
+		m["version"] = f.Version
+	}
+	if f.Viewer != nil {
+		// Under $and, so as not to clash with the author condition above.
+		m["$and"] = bson.A{visibleTo(*f.Viewer)}
+	}
+	return m
+}
+
+// visibleTo selects the posts viewer may read. Posts stored before they had a
+// visibility are public.
+func visibleTo(viewer types.Viewer) bson.M {
+	readable := bson.A{
+		bson.M{"visibility": bson.M{"$in": bson.A{types.PostVisibilityPublic, "", nil}}},
+		bson.M{"visibility": types.PostVisibilityFriends, "author": bson.M{"$in": nonNil(viewer.FriendOf)}},
+	}
+	if !viewer.ID.IsZero() {
+		readable = append(readable, bson.M{"author": viewer.ID})
+	}
+	m := bson.M{"$or": readable}
+	if len(viewer.Hidden) > 0 {
+		m["author"] = bson.M{"$nin": viewer.Hidden}
+	}
+	return m
+}
+
+// nonNil returns ids, or an empty slice if it is nil, which Mongo would take
+// for null rather than an array.
+func nonNil(ids []primitive.ObjectID) []primitive.ObjectID {
+	if ids == nil {
+		return []primitive.ObjectID{}
+	}
+	return ids
+}
+
+// match compares times at millisecond precision, the precision posts are
+// stored with.
+func (f PostFilter) match(post *types.Post) bool {
+	return (f.ID.IsZero() || post.ID == f.ID) &&
+		(len(f.Authors) == 0 || slices.Contains(f.Authors, post.Author)) &&
+		(len(f.Kinds) == 0 || slices.Contains(f.Kinds, post.Kind)) &&
+		(f.RepostOf.IsZero() || post.RepostOf != nil && *post.RepostOf == f.RepostOf) &&
+		(f.CreatedFrom.IsZero() || !post.CreatedAt.Before(f.CreatedFrom.Truncate(time.Millisecond))) &&
+		(f.CreatedTo.IsZero() || !post.CreatedAt.After(f.CreatedTo.Truncate(time.Millisecond))) &&
+		(f.Version == 0 || post.Version == f.Version) &&
+		(f.Viewer == nil || f.Viewer.CanSee(post))
+}
+
+func (f PostFilter) where() (string, []any) {
+	var w sqlWhere
+	if !f.ID.IsZero() {
+		w.add(`id = ?`, f.ID.Hex())
+	}
+	if len(f.Authors) > 0 {
+		w.add(`author IN (`+placeholders(len(f.Authors))+`)`, hexIDs(f.Authors)...)
+	}
+	if len(f.Kinds) > 0 {
+		kinds := make([]any, len(f.Kinds))
+		for i, kind := range f.Kinds {
+			kinds[i] = kind
+		}
+		w.add(`kind IN (`+placeholders(len(f.Kinds))+`)`, kinds...)
+	}
+	if !f.RepostOf.IsZero() {
+		w.add(`repost_of = ?`, f.RepostOf.Hex())
+	}
+	if !f.CreatedFrom.IsZero() {
+		w.add(`created_at >= ?`, millis(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		w.add(`created_at <= ?`, millis(f.CreatedTo))
+	}
+	if f.Version > 0 {
+		w.add(`version = ?`, f.Version)
+	}
+	if f.Viewer != nil {
+		if hidden := f.Viewer.Hidden; len(hidden) > 0 {
+			w.add(`author NOT IN (`+placeholders(len(hidden))+`)`, hexIDs(hidden)...)
+		}
+		readable, args := `visibility = ?`, []any{types.PostVisibilityPublic}
+		if friendOf := f.Viewer.FriendOf; len(friendOf) > 0 {
+			readable += ` OR (visibility = ? AND author IN (` + placeholders(len(friendOf)) + `))`
+			args = append(append(args, types.PostVisibilityFriends), hexIDs(friendOf)...)
+		}
+		if !f.Viewer.ID.IsZero() {
+			readable += ` OR author = ?`
+			args = append(args, f.Viewer.ID.Hex())
+		}
+		w.add(`(`+readable+`)`, args...)
+	}
+	return w.String(), w.args
+}
+
+// Sort orders found posts by creation time. Posts created at the same time
+// are ordered by ID.
+type Sort string
+
+const (
+	SortOldest Sort = "oldest"
+	SortNewest Sort = "newest"
+)
+
+// FindOptions orders and pages the posts a filter selects. The zero value
+// returns every post, oldest first.
+type FindOptions struct {
+	Sort  Sort
+	Skip  int64
+	Limit int64
+}
+
+func (o FindOptions) direction() int {
+	if o.Sort == SortNewest {
+		return -1
+	}
+	return 1
+}
+
+func (o FindOptions) mongo() *options.FindOptions {
+	return options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: o.direction()}, {Key: "_id", Value: o.direction()}}).
+		SetSkip(o.Skip).
+		SetLimit(o.Limit)
+}
+
+func (o FindOptions) apply(posts []*types.Post) []*types.Post {
+	slices.SortStableFunc(posts, func(a, b *types.Post) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c * o.direction()
+		}
+		return strings.Compare(a.ID.Hex(), b.ID.Hex()) * o.direction()
+	})
+	posts = posts[min(o.Skip, int64(len(posts))):]
+	if o.Limit > 0 && int64(len(posts)) > o.Limit {
+		posts = posts[:o.Limit]
+	}
+	return posts
+}
+
+// clauses returns the ORDER BY, LIMIT and OFFSET clauses of a query.
+func (o FindOptions) clauses() (string, []any) {
+	order := ` ASC`
+	if o.direction() < 0 {
+		order = ` DESC`
+	}
+	query := ` ORDER BY created_at` + order + `, id` + order
+	if o.Limit == 0 && o.Skip == 0 {
+		return query, nil
+	}
+	// Not every database takes an OFFSET without a LIMIT.
+	limit := o.Limit
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+	return query + ` LIMIT ? OFFSET ?`, []any{limit, o.Skip}
+}
+
+// sqlWhere joins conditions with AND, collecting their arguments.
+type sqlWhere struct {
+	conds []string
+	args  []any
+}
+
+func (w *sqlWhere) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conds) == 0 {
+		return `1 = 1`
+	}
+	return strings.Join(w.conds, ` AND `)
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"time"
+)
+
+const jobColl = "jobs"
+
+type JobStore interface {
+	InsertJob(context.Context, *types.Job) (*types.Job, error)
+	// ClaimJob leases the next due job until now+lease, or returns nil when
+	// none is due. Running jobs whose lease expired are claimed again.
+	ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*types.Job, error)
+	// CompleteJob, RetryJob and KillJob record the outcome of job as
+	// ClaimJob returned it. They report ErrLeaseLost if the job has been
+	// claimed again since, or is no longer running.
+	CompleteJob(ctx context.Context, job *types.Job) error
+	RetryJob(ctx context.Context, job *types.Job, runAt time.Time, reason string) error
+	KillJob(ctx context.Context, job *types.Job, reason string) error
+	RequeueJob(context.Context, string) error
+	GetJob(context.Context, string) (*types.Job, error)
+	GetJobs(ctx context.Context, status string, page int64, limit int64) ([]*types.Job, error)
+}
+
+type MongoJobStore struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+}
+
+func NewMongoJobStore(client *mongo.Client) *MongoJobStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoJobStore{
+		client: client,
+		coll:   client.Database(dbname).Collection(jobColl),
+	}
+}
+
+func (s *MongoJobStore) InsertJob(ctx context.Context, job *types.Job) (*types.Job, error) {
+	res, err := s.coll.InsertOne(ctx, job)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	job.ID = res.InsertedID.(primitive.ObjectID)
+	return job, nil
+}
+
+func (s *MongoJobStore) ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*types.Job, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": types.JobStatusPending, "run_at": bson.M{"$lte": now}},
+		bson.M{"status": types.JobStatusRunning, "locked_until": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       types.JobStatusRunning,
+			"locked_until": now.Add(lease),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+	var job types.Job
+	err := s.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *MongoJobStore) CompleteJob(ctx context.Context, job *types.Job) error {
+	return s.setStatus(ctx, job, bson.M{"status": types.JobStatusDone})
+}
+
+func (s *MongoJobStore) RetryJob(ctx context.Context, job *types.Job, runAt time.Time, reason string) error {
+	return s.setStatus(ctx, job, bson.M{
+		"status":     types.JobStatusPending,
+		"run_at":     runAt,
+		"last_error": reason,
+	})
+}
+
+func (s *MongoJobStore) KillJob(ctx context.Context, job *types.Job, reason string) error {
+	return s.setStatus(ctx, job, bson.M{
+		"status":     types.JobStatusDead,
+		"last_error": reason,
+	})
+}
+
+func (s *MongoJobStore) RequeueJob(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": oid, "status": types.JobStatusDead}
+	update := bson.M{"$set": bson.M{
+		"status":     types.JobStatusPending,
+		"attempts":   0,
+		"run_at":     time.Now(),
+		"updated_at": time.Now(),
+	}}
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoJobStore) GetJob(ctx context.Context, id string) (*types.Job, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var job types.Job
+	if err := s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&job); err != nil {
+		return nil, mongoError(err)
+	}
+	return &job, nil
+}
+
+func (s *MongoJobStore) GetJobs(ctx context.Context, status string, page int64, limit int64) ([]*types.Job, error) {
+	filter := bson.M{}
+	if len(status) > 0 {
+		filter["status"] = status
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cur, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []*types.Job{}
+	if err := cur.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// setStatus updates job if it is still running on the claim it was returned
+// with, which the attempt count identifies.
+func (s *MongoJobStore) setStatus(ctx context.Context, job *types.Job, set bson.M) error {
+	set["updated_at"] = time.Now()
+	filter := bson.M{"_id": job.ID, "status": types.JobStatusRunning, "attempts": job.Attempts}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
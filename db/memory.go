@@ -0,0 +1,82 @@
+package db
+
+import (
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+)
+
+// The memory stores keep documents the way Mongo would hand them back: every
+// read and write goes through a BSON round trip, so callers never share state
+// with the store and times lose the same precision they would in Mongo.
+
+func clone[T any](v *T) (*T, error) {
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out T
+	if err := bson.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// projectUsers returns users with only the given top-level fields and the ID
+// set, as a projection would, or users as they are given no fields. The SQL
+// stores load whole users and project them the same way.
+func projectUsers(users []*types.User, fields []string) ([]*types.User, error) {
+	projected := make([]*types.User, 0, len(users))
+	for _, user := range users {
+		if len(fields) == 0 {
+			projected = append(projected, user)
+			continue
+		}
+		b, err := bson.Marshal(user)
+		if err != nil {
+			return nil, err
+		}
+		var doc, kept bson.D
+		if err := bson.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		for _, e := range doc {
+			if e.Key == "_id" || slices.Contains(fields, e.Key) {
+				kept = append(kept, e)
+			}
+		}
+		if b, err = bson.Marshal(kept); err != nil {
+			return nil, err
+		}
+		var out types.User
+		if err := bson.Unmarshal(b, &out); err != nil {
+			return nil, err
+		}
+		projected = append(projected, &out)
+	}
+	return projected, nil
+}
+
+// applySet returns doc with the top-level fields in set replaced, as a $set
+// of set would.
+func applySet[T any](doc *T, set bson.M) (*T, error) {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var m bson.M
+	if err := bson.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range set {
+		m[k] = v
+	}
+	if b, err = bson.Marshal(m); err != nil {
+		return nil, err
+	}
+	var out T
+	if err := bson.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
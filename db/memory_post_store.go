@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryPostStore is a PostStore that keeps posts in memory. It behaves like
+// MongoPostStore, errors included, and is safe for concurrent use. Bookmarks
+// live in their own store, so deleting a post here leaves them alone.
+type MemoryPostStore struct {
+	mu    sync.RWMutex
+	posts map[primitive.ObjectID]*types.Post
+	// order keeps posts in insertion order, as a collection scan would.
+	order []primitive.ObjectID
+}
+
+func NewMemoryPostStore() *MemoryPostStore {
+	return &MemoryPostStore{
+		posts: map[primitive.ObjectID]*types.Post{},
+	}
+}
+
+func (s *MemoryPostStore) UpdatePost(ctx context.Context, filter PostFilter, params types.UpdatePostParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.order {
+		post := s.posts[id]
+		if !filter.match(post) {
+			continue
+		}
+		updated, err := applySet(post, params.ToBSON())
+		if err != nil {
+			return err
+		}
+		updated.Version++
+		s.posts[id] = updated
+		return nil
+	}
+	return s.notMatched(filter)
+}
+
+// notMatched is notMatched for the memory store. Callers hold s.mu.
+func (s *MemoryPostStore) notMatched(filter PostFilter) error {
+	if filter.Version == 0 {
+		return ErrNotFound
+	}
+	filter.Version = 0
+	for _, post := range s.posts {
+		if filter.match(post) {
+			return ErrVersionMismatch
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryPostStore) DeletePost(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filter := PostFilter{ID: oid, Version: version}
+	if post, ok := s.posts[oid]; !ok || !filter.match(post) {
+		return s.notMatched(filter)
+	}
+	delete(s.posts, oid)
+	s.order = slices.DeleteFunc(s.order, func(id primitive.ObjectID) bool { return id == oid })
+	return nil
+}
+
+func (s *MemoryPostStore) InsertPost(ctx context.Context, post *types.Post) (*types.Post, error) {
+	if post.ID.IsZero() {
+		post.ID = primitive.NewObjectID()
+	}
+	if post.Version == 0 {
+		post.Version = 1
+	}
+	if len(post.Visibility) == 0 {
+		post.Visibility = types.PostVisibilityPublic
+	}
+	stored, err := clone(post)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.posts[post.ID]; ok {
+		return nil, ErrConflict
+	}
+	if post.Kind == types.PostKindRepost {
+		for _, other := range s.posts {
+			if other.Kind == types.PostKindRepost && other.Author == post.Author && *other.RepostOf == *post.RepostOf {
+				return nil, ErrConflict
+			}
+		}
+	}
+	s.posts[post.ID] = stored
+	s.order = append(s.order, post.ID)
+	return post, nil
+}
+
+func (s *MemoryPostStore) GetPosts(ctx context.Context) ([]*types.Post, error) {
+	return s.find(func(*types.Post) bool { return true })
+}
+
+func (s *MemoryPostStore) GetPostByID(ctx context.Context, id string) (*types.Post, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	post, ok := s.posts[oid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(post)
+}
+
+func (s *MemoryPostStore) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*types.Post, error) {
+	return s.find(func(post *types.Post) bool { return slices.Contains(ids, post.ID) })
+}
+
+func (s *MemoryPostStore) GetPostsByUserID(ctx context.Context, id string) ([]*types.Post, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.find(func(post *types.Post) bool { return post.Author == oid })
+}
+
+func (s *MemoryPostStore) GetPostsSince(ctx context.Context, since time.Time) ([]*types.Post, error) {
+	return s.find(func(post *types.Post) bool { return !post.CreatedAt.Before(since) })
+}
+
+func (s *MemoryPostStore) FindPosts(ctx context.Context, filter PostFilter, opts FindOptions) ([]*types.Post, error) {
+	posts, err := s.find(filter.match)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*types.Post{}, opts.apply(posts)...), nil
+}
+
+func (s *MemoryPostStore) GetRecentPostsByAuthors(ctx context.Context, authors []primitive.ObjectID, since time.Time, limit int64) ([]*types.Post, error) {
+	posts, err := s.find(func(post *types.Post) bool {
+		return slices.Contains(authors, post.Author) &&
+			post.Kind != types.PostKindRepost &&
+			!post.CreatedAt.Before(since)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(posts, func(a, b *types.Post) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if limit > 0 && int64(len(posts)) > limit {
+		posts = posts[:limit]
+	}
+	if posts == nil {
+		posts = []*types.Post{}
+	}
+	return posts, nil
+}
+
+func (s *MemoryPostStore) IncrementPostStat(ctx context.Context, id string, stat string, delta int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, ok := s.posts[oid]
+	if !ok {
+		return ErrNotFound
+	}
+	post.Stats.Add(stat, delta)
+	return nil
+}
+
+// find returns copies of the posts keep selects, in insertion order.
+func (s *MemoryPostStore) find(keep func(*types.Post) bool) ([]*types.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var posts []*types.Post
+	for _, id := range s.order {
+		post := s.posts[id]
+		if !keep(post) {
+			continue
+		}
+		c, err := clone(post)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, c)
+	}
+	return posts, nil
+}
@@ -0,0 +1,397 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryUserStore is a UserStore that keeps users in memory. It behaves like
+// MongoUserStore, errors included, and is safe for concurrent use.
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]*types.User
+	// order keeps users in insertion order, as a collection scan would.
+	order []primitive.ObjectID
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users: map[primitive.ObjectID]*types.User{},
+	}
+}
+
+func (s *MemoryUserStore) UpdateUser(ctx context.Context, filter UserFilter, params types.UpdateUserParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.first(filter)
+	if user == nil {
+		return s.notMatched(filter)
+	}
+	if len(params.Email) > 0 && s.emailTaken(params.Email, user.ID) {
+		return ErrConflict
+	}
+	updated, err := applySet(user, params.ToBSON())
+	if err != nil {
+		return err
+	}
+	updated.Version++
+	s.users[user.ID] = updated
+	return nil
+}
+
+func (s *MemoryUserStore) DeleteUser(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filter := UserFilter{ID: oid, Version: version}
+	if user, ok := s.users[oid]; !ok || !filter.match(user) {
+		return s.notMatched(filter)
+	}
+	delete(s.users, oid)
+	s.order = slices.DeleteFunc(s.order, func(id primitive.ObjectID) bool { return id == oid })
+	return nil
+}
+
+func (s *MemoryUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	stored, err := clone(user)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user.ID]; ok || s.emailTaken(user.Email, user.ID) {
+		return nil, ErrConflict
+	}
+	s.users[user.ID] = stored
+	s.order = append(s.order, user.ID)
+	return user, nil
+}
+
+func (s *MemoryUserStore) GetUsers(ctx context.Context) ([]*types.User, error) {
+	return s.find(func(*types.User) bool { return true })
+}
+
+func (s *MemoryUserStore) GetUser(ctx context.Context, id string) (*types.User, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByObjectID(ctx, oid)
+}
+
+func (s *MemoryUserStore) GetUserByObjectID(ctx context.Context, id primitive.ObjectID) (*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(user)
+}
+
+func (s *MemoryUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	users, err := s.find(func(user *types.User) bool { return user.Email == email })
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return users[0], nil
+}
+
+func (s *MemoryUserStore) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID, fields ...string) ([]*types.User, error) {
+	users, err := s.find(func(user *types.User) bool { return slices.Contains(ids, user.ID) })
+	if err != nil {
+		return nil, err
+	}
+	return projectUsers(users, fields)
+}
+
+func (s *MemoryUserStore) AddFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	s.mu.RLock()
+	_, ok := s.users[friend]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return s.updateRelations(filter, friend, func(user *types.User) {
+		if !slices.Contains(user.Friends, friend) {
+			user.Friends = append(user.Friends, friend)
+		}
+	})
+}
+
+func (s *MemoryUserStore) RemoveFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	return s.updateRelations(filter, friend, func(user *types.User) {
+		user.Friends = slices.DeleteFunc(user.Friends, func(id primitive.ObjectID) bool { return id == friend })
+	})
+}
+
+func (s *MemoryUserStore) BlockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	s.mu.RLock()
+	_, ok := s.users[blocked]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return s.updateRelations(filter, blocked, func(user *types.User) {
+		if !slices.Contains(user.Blocked, blocked) {
+			user.Blocked = append(user.Blocked, blocked)
+		}
+	})
+}
+
+func (s *MemoryUserStore) UnblockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	return s.updateRelations(filter, blocked, func(user *types.User) {
+		user.Blocked = slices.DeleteFunc(user.Blocked, func(id primitive.ObjectID) bool { return id == blocked })
+	})
+}
+
+func (s *MemoryUserStore) GetViewer(ctx context.Context, id primitive.ObjectID) (*types.Viewer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	viewer := &types.Viewer{ID: id, Hidden: slices.Clone(user.Blocked)}
+	for _, other := range s.order {
+		u := s.users[other]
+		if slices.Contains(u.Friends, id) {
+			viewer.FriendOf = append(viewer.FriendOf, other)
+		}
+		if slices.Contains(u.Blocked, id) && !slices.Contains(viewer.Hidden, other) {
+			viewer.Hidden = append(viewer.Hidden, other)
+		}
+	}
+	return viewer, nil
+}
+
+// updateRelations applies update to the first user filter selects, for changes
+// to their friends or blocked users.
+func (s *MemoryUserStore) updateRelations(filter UserFilter, friend primitive.ObjectID, update func(*types.User)) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.first(filter)
+	if user == nil {
+		return s.notMatched(filter)
+	}
+	update(user)
+	user.Version++
+	return nil
+}
+
+// first returns the first user filter selects, or nil. Callers hold s.mu.
+func (s *MemoryUserStore) first(filter UserFilter) *types.User {
+	for _, id := range s.order {
+		if user := s.users[id]; filter.match(user) {
+			return user
+		}
+	}
+	return nil
+}
+
+// notMatched is notMatched for the memory store. Callers hold s.mu.
+func (s *MemoryUserStore) notMatched(filter UserFilter) error {
+	if filter.Version == 0 {
+		return ErrNotFound
+	}
+	filter.Version = 0
+	if s.first(filter) != nil {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
+
+// emailTaken reports whether a user other than except has email, which the
+// unique index on users.email forbids.
+func (s *MemoryUserStore) emailTaken(email string, except primitive.ObjectID) bool {
+	for _, user := range s.users {
+		if user.Email == email && user.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// UpsertDevice registers device for the user, refreshing it if the token is
+// already registered, and removes the token from any other user.
+func (s *MemoryUserStore) UpsertDevice(ctx context.Context, userID string, device types.Device) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	stored, err := clone(&device)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, user := range s.users {
+		if id != oid && slices.ContainsFunc(user.Devices, func(d types.Device) bool { return d.Token == device.Token }) {
+			user.Devices = slices.DeleteFunc(user.Devices, func(d types.Device) bool { return d.Token == device.Token })
+			user.Version++
+		}
+	}
+	user, ok := s.users[oid]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Version++
+	if i := slices.IndexFunc(user.Devices, func(d types.Device) bool { return d.Token == device.Token }); i >= 0 {
+		user.Devices[i] = *stored
+		return nil
+	}
+	user.Devices = append(user.Devices, *stored)
+	return nil
+}
+
+func (s *MemoryUserStore) RemoveDevice(ctx context.Context, userID string, token string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[oid]
+	if !ok {
+		return ErrNotFound
+	}
+	removeTokens(user, []string{token})
+	user.Version++
+	return nil
+}
+
+// RemoveDeviceTokens unregisters the given tokens from every user.
+func (s *MemoryUserStore) RemoveDeviceTokens(ctx context.Context, tokens []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if removeTokens(user, tokens) {
+			user.Version++
+		}
+	}
+	return nil
+}
+
+// removeTokens removes tokens from the user's devices and reports whether it
+// found any.
+func removeTokens(user *types.User, tokens []string) bool {
+	n := len(user.Devices)
+	user.Devices = slices.DeleteFunc(user.Devices, func(d types.Device) bool { return slices.Contains(tokens, d.Token) })
+	removed := len(user.Devices) < n
+	if slices.Contains(tokens, user.FCMToken) {
+		user.FCMToken = ""
+		removed = true
+	}
+	return removed
+}
+
+func (s *MemoryUserStore) GetUsersByDeviceTokens(ctx context.Context, tokens []string) ([]*types.User, error) {
+	users, err := s.find(func(user *types.User) bool {
+		return slices.ContainsFunc(user.DeviceTokens(), func(token string) bool { return slices.Contains(tokens, token) })
+	})
+	if users == nil && err == nil {
+		users = []*types.User{}
+	}
+	return users, err
+}
+
+func (s *MemoryUserStore) UpdateNotificationSettings(ctx context.Context, userID string, settings types.NotificationSettings) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	if settings.Events == nil {
+		settings.Events = map[string]types.ChannelPreference{}
+	}
+	stored, err := clone(&settings)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[oid]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Notifications = *stored
+	user.Version++
+	return nil
+}
+
+func (s *MemoryUserStore) GetDigestDue(ctx context.Context, frequency string, sentBefore time.Time) ([]*types.User, error) {
+	users, err := s.find(func(user *types.User) bool {
+		return user.Notifications.Digest == frequency && user.LastDigestAt.Before(sentBefore)
+	})
+	if users == nil && err == nil {
+		users = []*types.User{}
+	}
+	return users, err
+}
+
+func (s *MemoryUserStore) ClaimDigest(ctx context.Context, userID primitive.ObjectID, sentBefore time.Time, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok || !user.LastDigestAt.Before(sentBefore) {
+		return false, nil
+	}
+	user.LastDigestAt = now.Truncate(time.Millisecond)
+	return true, nil
+}
+
+func (s *MemoryUserStore) MarkEmailVerified(ctx context.Context, userID string, email string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[oid]
+	if !ok || user.Email != email {
+		return ErrNotFound
+	}
+	user.EmailVerified = true
+	user.Version++
+	return nil
+}
+
+// find returns copies of the users keep selects, in insertion order.
+func (s *MemoryUserStore) find(keep func(*types.User) bool) ([]*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var users []*types.User
+	for _, id := range s.order {
+		user := s.users[id]
+		if !keep(user) {
+			continue
+		}
+		c, err := clone(user)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, c)
+	}
+	return users, nil
+}
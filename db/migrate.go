@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"slices"
+	"time"
+)
+
+// The migrations collection holds a document per applied migration, keyed by
+// its version, and the lock document that keeps two runners, such as
+// instances starting together, from migrating at once.
+const (
+	migrationColl   = "migrations"
+	migrationLockID = "lock"
+)
+
+// migrationLease is how long the lock is held without being renewed. A runner
+// that dies keeps the others waiting at most this long.
+const migrationLease = 10 * time.Minute
+
+// MongoMigration is one versioned change to the Mongo database, such as an
+// index. Down undoes Up. Both must be safe to run again after failing part
+// way. Migrations are never changed after release; a fix is a new migration.
+type MongoMigration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, database *mongo.Database) error
+	Down        func(ctx context.Context, database *mongo.Database) error
+}
+
+// MigrationStatus reports whether a migration is applied. AppliedAt is zero
+// for a pending migration.
+type MigrationStatus struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// MongoMigrator applies and rolls back mongoMigrations, recording the
+// applied versions in the migrations collection.
+type MongoMigrator struct {
+	database   *mongo.Database
+	coll       *mongo.Collection
+	migrations []MongoMigration
+	// owner identifies this runner in the lock document.
+	owner string
+}
+
+func NewMongoMigrator(client *mongo.Client) *MongoMigrator {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	database := client.Database(dbname)
+	return &MongoMigrator{
+		database:   database,
+		coll:       database.Collection(migrationColl),
+		migrations: mongoMigrations,
+		owner:      primitive.NewObjectID().Hex(),
+	}
+}
+
+// Status lists every migration, oldest first, with the time it was applied.
+// Applied versions this build does not know, left by a newer one, are listed
+// too.
+func (m *MongoMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status, ok := applied[migration.Version]
+		if !ok {
+			status = MigrationStatus{Version: migration.Version, Description: migration.Description}
+		}
+		delete(applied, migration.Version)
+		statuses = append(statuses, status)
+	}
+	for _, status := range applied {
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return statuses, nil
+}
+
+// Up applies the pending migrations up to version target, or all of them if
+// target is 0, and returns those it applied. It stops at the first that
+// fails.
+func (m *MongoMigrator) Up(ctx context.Context, target int) ([]MongoMigration, error) {
+	var done []MongoMigration
+	err := m.locked(ctx, func(applied map[int]MigrationStatus) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || (target > 0 && migration.Version > target) {
+				continue
+			}
+			if err := m.renew(ctx); err != nil {
+				return err
+			}
+			if err := migration.Up(ctx, m.database); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+			}
+			status := MigrationStatus{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()}
+			if _, err := m.coll.InsertOne(ctx, status); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the applied migrations newer than version target, newest
+// first, and returns those it rolled back. It fails without rolling back
+// anything if one of them is unknown to this build.
+func (m *MongoMigrator) Down(ctx context.Context, target int) ([]MongoMigration, error) {
+	var done []MongoMigration
+	err := m.locked(ctx, func(applied map[int]MigrationStatus) error {
+		for version := range applied {
+			if version > target && !slices.ContainsFunc(m.migrations, func(migration MongoMigration) bool { return migration.Version == version }) {
+				return fmt.Errorf("migration %d is applied but unknown to this build", version)
+			}
+		}
+		for _, migration := range slices.Backward(m.migrations) {
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= target {
+				continue
+			}
+			if err := m.renew(ctx); err != nil {
+				return err
+			}
+			if err := migration.Down(ctx, m.database); err != nil {
+				return fmt.Errorf("rolling back migration %d (%s): %w", migration.Version, migration.Description, err)
+			}
+			if _, err := m.coll.DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// applied returns the applied migrations by version.
+func (m *MongoMigrator) applied(ctx context.Context) (map[int]MigrationStatus, error) {
+	cur, err := m.coll.Find(ctx, bson.M{"_id": bson.M{"$ne": migrationLockID}})
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	if err := cur.All(ctx, &statuses); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]MigrationStatus, len(statuses))
+	for _, status := range statuses {
+		applied[status.Version] = status
+	}
+	return applied, nil
+}
+
+// locked runs fn with the applied migrations while holding the lock, waiting
+// for another runner to finish first.
+func (m *MongoMigrator) locked(ctx context.Context, fn func(applied map[int]MigrationStatus) error) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock(context.WithoutCancel(ctx))
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+// lock takes the lock once it is free or its lease has expired. Taking a held
+// lock fails on the lock document's unique _id.
+func (m *MongoMigrator) lock(ctx context.Context) error {
+	for {
+		now := time.Now()
+		filter := bson.M{"_id": migrationLockID, "expires_at": bson.M{"$lte": now}}
+		update := bson.M{"$set": bson.M{"owner": m.owner, "expires_at": now.Add(migrationLease)}}
+		_, err := m.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// renew extends the lease before each migration, so that a long index build
+// does not let another runner in, and fails if the lock was lost.
+func (m *MongoMigrator) renew(ctx context.Context) error {
+	filter := bson.M{"_id": migrationLockID, "owner": m.owner}
+	update := bson.M{"$set": bson.M{"expires_at": time.Now().Add(migrationLease)}}
+	res, err := m.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("migration lock lost to another runner")
+	}
+	return nil
+}
+
+func (m *MongoMigrator) unlock(ctx context.Context) error {
+	_, err := m.coll.DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": m.owner})
+	return err
+}
@@ -0,0 +1,344 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// RealtimeEventColl holds the events realtime.MongoBroker publishes. They
+// expire after RealtimeEventTTL; only change stream consumers that fell behind
+// need them.
+const (
+	RealtimeEventColl = "realtime_events"
+	RealtimeEventTTL  = time.Hour
+)
+
+// mongoMigrations are the Mongo schema versions in order. Indexes the store
+// queries need are added here, named, so that Down can drop them.
+var mongoMigrations = []MongoMigration{
+	{
+		Version:     1,
+		Description: "index posts by author and creation time",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection(postColl), "author_created_at",
+				bson.D{{Key: "author", Value: 1}, {Key: "created_at", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(postColl), "author_created_at")
+		},
+	},
+	{
+		Version:     2,
+		Description: "index posts by creation time",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection(postColl), "created_at",
+				bson.D{{Key: "created_at", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(postColl), "created_at")
+		},
+	},
+	{
+		Version:     3,
+		Description: "make user emails unique",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			users := database.Collection(userColl)
+			if err := checkUniqueEmails(ctx, users); err != nil {
+				return err
+			}
+			// Mongo refuses a second index on the same keys that differs
+			// only in uniqueness.
+			if err := dropIndex(ctx, users, "email_1"); err != nil {
+				return err
+			}
+			return createIndex(ctx, users, "email_unique", bson.D{{Key: "email", Value: 1}}, true)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			users := database.Collection(userColl)
+			if err := dropIndex(ctx, users, "email_unique"); err != nil {
+				return err
+			}
+			return createIndex(ctx, users, "email_1", bson.D{{Key: "email", Value: 1}}, false)
+		},
+	},
+	{
+		Version:     4,
+		Description: "index users by digest frequency and last digest",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection(userColl), "digest_last_digest_at",
+				bson.D{{Key: "notifications.digest", Value: 1}, {Key: "last_digest_at", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(userColl), "digest_last_digest_at")
+		},
+	},
+	{
+		Version:     5,
+		Description: "start posts and users at version 1",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			for _, coll := range []string{postColl, userColl} {
+				_, err := database.Collection(coll).UpdateMany(ctx,
+					bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			for _, coll := range []string{postColl, userColl} {
+				_, err := database.Collection(coll).UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"version": ""}})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     6,
+		Description: "index users by device token",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndex(ctx, database.Collection(userColl), "devices.token_1",
+				bson.D{{Key: "devices.token", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(userColl), "devices.token_1")
+		},
+	},
+	{
+		Version:     7,
+		Description: "add the post and user text indexes",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			err := createIndexes(ctx, database.Collection(postColl), mongo.IndexModel{
+				Keys:    bson.D{{Key: "content", Value: "text"}, {Key: "tags", Value: "text"}},
+				Options: options.Index().SetName("posts_text").SetWeights(bson.M{"content": 1, "tags": 3}),
+			})
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, database.Collection(userColl), mongo.IndexModel{
+				Keys:    bson.D{{Key: "firstName", Value: "text"}, {Key: "lastName", Value: "text"}},
+				Options: options.Index().SetName("users_text"),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			if err := dropIndex(ctx, database.Collection(postColl), "posts_text"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, database.Collection(userColl), "users_text")
+		},
+	},
+	{
+		Version:     8,
+		Description: "index bookmarks and reading lists",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			bookmarks := database.Collection(bookmarkColl)
+			if err := createIndex(ctx, bookmarks, "user_1_post_1", bson.D{{Key: "user", Value: 1}, {Key: "post", Value: 1}}, true); err != nil {
+				return err
+			}
+			if err := createIndex(ctx, bookmarks, "user_1_created_at_-1", bson.D{{Key: "user", Value: 1}, {Key: "created_at", Value: -1}}, false); err != nil {
+				return err
+			}
+			if err := createIndex(ctx, bookmarks, "post_1", bson.D{{Key: "post", Value: 1}}, false); err != nil {
+				return err
+			}
+			lists := database.Collection(readingListColl)
+			if err := createIndex(ctx, lists, "owner_1", bson.D{{Key: "owner", Value: 1}}, false); err != nil {
+				return err
+			}
+			return createIndex(ctx, lists, "posts_1", bson.D{{Key: "posts", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			if err := dropIndexes(ctx, database.Collection(bookmarkColl), "user_1_post_1", "user_1_created_at_-1", "post_1"); err != nil {
+				return err
+			}
+			return dropIndexes(ctx, database.Collection(readingListColl), "owner_1", "posts_1")
+		},
+	},
+	{
+		Version:     9,
+		Description: "index jobs by status",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			jobs := database.Collection(jobColl)
+			for _, field := range []string{"run_at", "locked_until"} {
+				if err := createIndex(ctx, jobs, "status_1_"+field+"_1", bson.D{{Key: "status", Value: 1}, {Key: field, Value: 1}}, false); err != nil {
+					return err
+				}
+			}
+			return createIndex(ctx, jobs, "status_1_created_at_-1", bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndexes(ctx, database.Collection(jobColl), "status_1_run_at_1", "status_1_locked_until_1", "status_1_created_at_-1")
+		},
+	},
+	{
+		Version:     10,
+		Description: "index notifications by recipient, one unread per group",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndexes(ctx, database.Collection(notificationColl),
+				mongo.IndexModel{
+					Keys: bson.D{{Key: "recipient", Value: 1}, {Key: "group_key", Value: 1}},
+					Options: options.Index().
+						SetName("recipient_1_group_key_1").
+						SetUnique(true).
+						SetPartialFilterExpression(bson.M{"read": false}),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "recipient", Value: 1}, {Key: "read", Value: 1}, {Key: "updated_at", Value: -1}},
+					Options: options.Index().SetName("recipient_1_read_1_updated_at_-1"),
+				},
+			)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndexes(ctx, database.Collection(notificationColl), "recipient_1_group_key_1", "recipient_1_read_1_updated_at_-1")
+		},
+	},
+	{
+		Version:     11,
+		Description: "expire used tokens",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndexes(ctx, database.Collection(usedTokenColl), mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_1").SetExpireAfterSeconds(0),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(usedTokenColl), "expires_at_1")
+		},
+	},
+	{
+		Version:     12,
+		Description: "index webhooks by event and deliveries by webhook",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			err := createIndex(ctx, database.Collection(webhookColl), "active_1_events_1",
+				bson.D{{Key: "active", Value: 1}, {Key: "events", Value: 1}}, false)
+			if err != nil {
+				return err
+			}
+			return createIndex(ctx, database.Collection(deliveryColl), "webhook_1_created_at_-1",
+				bson.D{{Key: "webhook", Value: 1}, {Key: "created_at", Value: -1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			if err := dropIndex(ctx, database.Collection(webhookColl), "active_1_events_1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, database.Collection(deliveryColl), "webhook_1_created_at_-1")
+		},
+	},
+	{
+		Version:     13,
+		Description: "index users by friend and blocked user",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			users := database.Collection(userColl)
+			if err := createIndex(ctx, users, "friends_1", bson.D{{Key: "friends", Value: 1}}, false); err != nil {
+				return err
+			}
+			return createIndex(ctx, users, "blocked_1", bson.D{{Key: "blocked", Value: 1}}, false)
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndexes(ctx, database.Collection(userColl), "friends_1", "blocked_1")
+		},
+	},
+	{
+		Version:     14,
+		Description: "allow a user one repost of a post",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndexes(ctx, database.Collection(postColl), mongo.IndexModel{
+				Keys: bson.D{{Key: "repost_of", Value: 1}, {Key: "author", Value: 1}},
+				Options: options.Index().SetName("repost_of_1_author_1").SetUnique(true).
+					SetPartialFilterExpression(bson.M{"kind": types.PostKindRepost}),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(postColl), "repost_of_1_author_1")
+		},
+	},
+	{
+		Version:     15,
+		Description: "expire real-time events",
+		Up: func(ctx context.Context, database *mongo.Database) error {
+			return createIndexes(ctx, database.Collection(RealtimeEventColl), mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetName("created_at_1").SetExpireAfterSeconds(int32(RealtimeEventTTL.Seconds())),
+			})
+		},
+		Down: func(ctx context.Context, database *mongo.Database) error {
+			return dropIndex(ctx, database.Collection(RealtimeEventColl), "created_at_1")
+		},
+	},
+}
+
+func createIndex(ctx context.Context, coll *mongo.Collection, name string, keys bson.D, unique bool) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(name).SetUnique(unique),
+	})
+	return err
+}
+
+// createIndexes creates indexes that need more options than createIndex
+// takes. Each must be named.
+func createIndexes(ctx context.Context, coll *mongo.Collection, models ...mongo.IndexModel) error {
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	return err
+}
+
+func dropIndexes(ctx context.Context, coll *mongo.Collection, names ...string) error {
+	for _, name := range names {
+		if err := dropIndex(ctx, coll, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropIndex drops the named index, if it or its collection exists.
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	const (
+		namespaceNotFound = 26
+		indexNotFound     = 27
+	)
+	_, err := coll.Indexes().DropOne(ctx, name)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && (serverErr.HasErrorCode(namespaceNotFound) || serverErr.HasErrorCode(indexNotFound)) {
+		return nil
+	}
+	return err
+}
+
+// checkUniqueEmails fails, naming a few of them, if users share an address,
+// which would fail the unique index with a less helpful error. Those accounts
+// have to be merged by hand first.
+func checkUniqueEmails(ctx context.Context, users *mongo.Collection) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$email", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 5}},
+	}
+	cur, err := users.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var dups []struct {
+		Email string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &dups); err != nil {
+		return err
+	}
+	if len(dups) == 0 {
+		return nil
+	}
+	emails := make([]string, len(dups))
+	for i, dup := range dups {
+		emails[i] = dup.Email
+	}
+	return fmt.Errorf("users share email addresses, merge them first: %s", strings.Join(emails, ", "))
+}
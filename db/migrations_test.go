@@ -0,0 +1,14 @@
+package db
+
+import "testing"
+
+func TestMongoMigrationsAreInOrder(t *testing.T) {
+	for i, migration := range mongoMigrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, migration.Version, i+1)
+		}
+		if migration.Up == nil || migration.Down == nil || len(migration.Description) == 0 {
+			t.Errorf("migration %d lacks Up, Down or a description", migration.Version)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+)
+
+const (
+	notificationColl = "notifications"
+	// maxNotificationActors is how many recent actors a grouped notification
+	// keeps for display.
+	maxNotificationActors = 3
+)
+
+type NotificationStore interface {
+	// AddNotification stores n in its recipient's inbox, folding it into an
+	// unread notification with the same group key when there is one.
+	AddNotification(context.Context, *types.Notification) error
+	GetNotifications(ctx context.Context, recipient string, unreadOnly bool, page int64, limit int64) ([]*types.Notification, error)
+	CountUnread(ctx context.Context, recipient string) (int64, error)
+	MarkRead(ctx context.Context, recipient string, id string) error
+	MarkAllRead(ctx context.Context, recipient string) error
+}
+
+type MongoNotificationStore struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+}
+
+func NewMongoNotificationStore(client *mongo.Client) *MongoNotificationStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoNotificationStore{
+		client: client,
+		coll:   client.Database(dbname).Collection(notificationColl),
+	}
+}
+
+func (s *MongoNotificationStore) AddNotification(ctx context.Context, n *types.Notification) error {
+	for {
+		grouped, err := s.group(ctx, n)
+		if err != nil || grouped {
+			return err
+		}
+		_, err = s.coll.InsertOne(ctx, n)
+		if mongo.IsDuplicateKeyError(err) {
+			// another worker opened the group first; join it
+			continue
+		}
+		return err
+	}
+}
+
+// group folds n into the recipient's unread notification with the same group
+// key and reports whether there was one.
+func (s *MongoNotificationStore) group(ctx context.Context, n *types.Notification) (bool, error) {
+	filter := bson.M{"recipient": n.Recipient, "group_key": n.GroupKey, "read": false}
+	set := bson.M{"updated_at": n.UpdatedAt, "excerpt": n.Excerpt}
+	if n.PostID != nil {
+		set["post_id"] = n.PostID
+	}
+	if len(n.Actors) > 0 {
+		actor := n.Actors[0]
+		newActor := bson.M{}
+		for k, v := range filter {
+			newActor[k] = v
+		}
+		newActor["actor_ids"] = bson.M{"$ne": actor.ID}
+		update := bson.M{
+			"$set":      set,
+			"$push":     bson.M{"actors": bson.M{"$each": bson.A{actor}, "$position": 0, "$slice": maxNotificationActors}},
+			"$addToSet": bson.M{"actor_ids": actor.ID},
+			"$inc":      bson.M{"actor_count": 1},
+		}
+		res, err := s.coll.UpdateOne(ctx, newActor, update)
+		if err != nil {
+			return false, err
+		}
+		if res.MatchedCount > 0 {
+			return true, nil
+		}
+	}
+	// the same actor again, or an event without actors
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *MongoNotificationStore) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, page int64, limit int64) ([]*types.Notification, error) {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"recipient": oid}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cur, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	notifications := []*types.Notification{}
+	if err := cur.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (s *MongoNotificationStore) CountUnread(ctx context.Context, recipient string) (int64, error) {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return 0, err
+	}
+	return s.coll.CountDocuments(ctx, bson.M{"recipient": oid, "read": false})
+}
+
+func (s *MongoNotificationStore) MarkRead(ctx context.Context, recipient string, id string) error {
+	uid, nid, err := parseIDPair(recipient, id)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": nid, "recipient": uid}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoNotificationStore) MarkAllRead(ctx context.Context, recipient string) error {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"recipient": oid, "read": false}
+	_, err = s.coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
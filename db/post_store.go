@@ -6,50 +6,86 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"os"
+	"time"
 )
 
 const postColl = "posts"
 
-type Map map[string]any
-
 type PostStore interface {
+	// InsertPost stores post at version 1, unless it has one already, and
+	// public unless it has a visibility.
 	InsertPost(context.Context, *types.Post) (*types.Post, error)
-	UpdatePost(ctx context.Context, filter Map, params types.UpdatePostParams) error
-	DeletePost(context.Context, string) error
+	// UpdatePost updates the first post filter selects and moves it to the
+	// next version.
+	UpdatePost(ctx context.Context, filter PostFilter, params types.UpdatePostParams) error
+	// DeletePost deletes the post, on condition that it is at version unless
+	// version is 0.
+	DeletePost(ctx context.Context, id string, version int64) error
 	GetPosts(context.Context) ([]*types.Post, error)
 	GetPostByID(context.Context, string) (*types.Post, error)
+	GetPostsByIDs(context.Context, []primitive.ObjectID) ([]*types.Post, error)
 	GetPostsByUserID(context.Context, string) ([]*types.Post, error)
+	GetPostsSince(context.Context, time.Time) ([]*types.Post, error)
+	// FindPosts returns the posts filter selects, ordered and paged by opts.
+	FindPosts(ctx context.Context, filter PostFilter, opts FindOptions) ([]*types.Post, error)
+	// GetRecentPostsByAuthors returns up to limit posts and quotes, newest
+	// first, that authors published since the given time.
+	GetRecentPostsByAuthors(ctx context.Context, authors []primitive.ObjectID, since time.Time, limit int64) ([]*types.Post, error)
+	IncrementPostStat(ctx context.Context, id string, stat string, delta int64) error
 }
 type MongoPostStore struct {
-	client *mongo.Client
-	coll   *mongo.Collection
+	client    *mongo.Client
+	coll      *mongo.Collection
+	bookmarks *mongo.Collection
+	lists     *mongo.Collection
 }
 
 func NewMongoPostStore(client *mongo.Client) *MongoPostStore {
 	dbname := os.Getenv(MongoDBNameEnvName)
 	return &MongoPostStore{
-		client: client,
-		coll:   client.Database(dbname).Collection(postColl),
+		client:    client,
+		coll:      client.Database(dbname).Collection(postColl),
+		bookmarks: client.Database(dbname).Collection(bookmarkColl),
+		lists:     client.Database(dbname).Collection(readingListColl),
 	}
 }
 
-func (s *MongoPostStore) UpdatePost(ctx context.Context, filter Map, params types.UpdatePostParams) error {
-	oid, _ := primitive.ObjectIDFromHex(filter["_id"].(string))
-
-	filter["_id"] = oid
-	update := bson.M{"$set": params.ToBSON()}
-	_, err := s.coll.UpdateOne(ctx, filter, update)
+func (s *MongoPostStore) UpdatePost(ctx context.Context, filter PostFilter, params types.UpdatePostParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	update := bson.M{"$set": params.ToBSON(), "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
+	}
 	return nil
 }
 
-func (s *MongoPostStore) DeletePost(ctx context.Context, id string) error {
-	oid, _ := primitive.ObjectIDFromHex(id)
-
-	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": oid})
+func (s *MongoPostStore) DeletePost(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	filter := PostFilter{ID: oid, Version: version}.bson()
+	res, err := s.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return notMatched(ctx, s.coll, filter)
+	}
+	// drop the post from everyone's bookmarks and reading lists
+	_, err = s.bookmarks.DeleteMany(ctx, bson.M{"post": oid})
+	if err != nil {
+		return err
+	}
+	_, err = s.lists.UpdateMany(ctx, bson.M{"posts": oid}, bson.M{"$pull": bson.M{"posts": oid}})
 	if err != nil {
 		return err
 	}
@@ -57,9 +93,15 @@ func (s *MongoPostStore) DeletePost(ctx context.Context, id string) error {
 }
 
 func (s *MongoPostStore) InsertPost(ctx context.Context, post *types.Post) (*types.Post, error) {
+	if post.Version == 0 {
+		post.Version = 1
+	}
+	if len(post.Visibility) == 0 {
+		post.Visibility = types.PostVisibilityPublic
+	}
 	res, err := s.coll.InsertOne(ctx, post)
 	if err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 	post.ID = res.InsertedID.(primitive.ObjectID)
 	return post, nil
@@ -78,18 +120,31 @@ func (s *MongoPostStore) GetPosts(ctx context.Context) ([]*types.Post, error) {
 }
 
 func (s *MongoPostStore) GetPostByID(ctx context.Context, id string) (*types.Post, error) {
-	oid, err := primitive.ObjectIDFromHex(id)
+	oid, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
 	var post types.Post
 	if err := s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&post); err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 	return &post, nil
 }
+
+func (s *MongoPostStore) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*types.Post, error) {
+	cur, err := s.coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var posts []*types.Post
+	if err := cur.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
 func (s *MongoPostStore) GetPostsByUserID(ctx context.Context, id string) ([]*types.Post, error) {
-	oid, err := primitive.ObjectIDFromHex(id)
+	oid, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
@@ -104,3 +159,66 @@ func (s *MongoPostStore) GetPostsByUserID(ctx context.Context, id string) ([]*ty
 	}
 	return posts, nil
 }
+
+func (s *MongoPostStore) GetPostsSince(ctx context.Context, since time.Time) ([]*types.Post, error) {
+	cur, err := s.coll.Find(ctx, bson.M{"created_at": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+	var posts []*types.Post
+	if err := cur.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *MongoPostStore) FindPosts(ctx context.Context, filter PostFilter, opts FindOptions) ([]*types.Post, error) {
+	cur, err := s.coll.Find(ctx, filter.bson(), opts.mongo())
+	if err != nil {
+		return nil, err
+	}
+	posts := []*types.Post{}
+	if err := cur.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *MongoPostStore) GetRecentPostsByAuthors(ctx context.Context, authors []primitive.ObjectID, since time.Time, limit int64) ([]*types.Post, error) {
+	posts := []*types.Post{}
+	if len(authors) == 0 {
+		return posts, nil
+	}
+	filter := bson.M{
+		"author":     bson.M{"$in": authors},
+		"kind":       bson.M{"$ne": types.PostKindRepost},
+		"created_at": bson.M{"$gte": since},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit)
+	cur, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *MongoPostStore) IncrementPostStat(ctx context.Context, id string, stat string, delta int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$inc": bson.M{"stats." + stat: delta}}
+	res, err := s.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/lib/pq"
+	"strconv"
+)
+
+const PostgresURLEnvName = "POSTGRES_URL"
+
+// postgresSearchConfig is the text search configuration posts and users are
+// indexed with, matching the English stemming of Mongo's text indexes.
+const postgresSearchConfig = "english"
+
+// postSearchDocument is what post searches match: the content and the tags.
+// The posts_search index is built on the same expression.
+const postSearchDocument = `to_tsvector('` + postgresSearchConfig + `', content) || jsonb_to_tsvector('` + postgresSearchConfig + `', tags, '["string"]')`
+
+var postgres = &sqlDialect{
+	name: "postgres",
+	placeholder: func(n int) string {
+		return "$" + strconv.Itoa(n)
+	},
+	isDuplicate: func(err error) bool {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == "23505"
+	},
+	lock:       `SELECT pg_advisory_xact_lock(7331)`,
+	forUpdate:  ` FOR UPDATE`,
+	skipLocked: ` FOR UPDATE SKIP LOCKED`,
+	migrations: []string{
+		`CREATE TABLE users (
+			id             TEXT PRIMARY KEY,
+			first_name     TEXT NOT NULL,
+			last_name      TEXT NOT NULL,
+			email          TEXT NOT NULL,
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			password       TEXT NOT NULL,
+			fcm_token      TEXT NOT NULL DEFAULT '',
+			language       TEXT NOT NULL,
+			time_zone      TEXT NOT NULL,
+			notifications  JSONB NOT NULL,
+			digest         TEXT NOT NULL,
+			last_digest_at BIGINT NOT NULL
+		);
+		CREATE INDEX users_email ON users (email);
+		CREATE INDEX users_digest ON users (digest, last_digest_at);
+		CREATE INDEX users_fcm_token ON users (fcm_token) WHERE fcm_token <> '';
+		CREATE INDEX users_search ON users USING GIN (to_tsvector('english', first_name || ' ' || last_name));
+
+		CREATE TABLE user_devices (
+			token         TEXT PRIMARY KEY,
+			user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			platform      TEXT NOT NULL,
+			app_version   TEXT NOT NULL,
+			last_seen     BIGINT NOT NULL,
+			registered_at BIGINT NOT NULL
+		);
+		CREATE INDEX user_devices_user_id ON user_devices (user_id);
+
+		CREATE TABLE user_friends (
+			user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			friend_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			added_at  BIGINT NOT NULL,
+			PRIMARY KEY (user_id, friend_id)
+		);
+		CREATE INDEX user_friends_friend_id ON user_friends (friend_id);
+
+		CREATE TABLE posts (
+			id         TEXT PRIMARY KEY,
+			content    TEXT NOT NULL,
+			author     TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			kind       TEXT NOT NULL,
+			repost_of  TEXT,
+			tags       JSONB NOT NULL,
+			reactions  BIGINT NOT NULL DEFAULT 0,
+			comments   BIGINT NOT NULL DEFAULT 0,
+			views      BIGINT NOT NULL DEFAULT 0,
+			reposts    BIGINT NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX posts_author ON posts (author, created_at);
+		CREATE INDEX posts_created_at ON posts (created_at);
+		CREATE INDEX posts_search ON posts USING GIN (to_tsvector('english', content));`,
+		// One account per address: fails on databases that already hold
+		// duplicates, which have to be merged by hand first.
+		`DROP INDEX users_email;
+		CREATE UNIQUE INDEX users_email ON users (email);`,
+		`ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+		ALTER TABLE posts ADD COLUMN version BIGINT NOT NULL DEFAULT 1;`,
+		// Posts outlive their author and may name one that does not exist,
+		// as they do in Mongo.
+		`ALTER TABLE posts DROP CONSTRAINT posts_author_fkey;`,
+		// The stores besides users and posts, so that a SQL backend needs no
+		// Mongo.
+		`CREATE TABLE bookmarks (
+			user_id    TEXT NOT NULL,
+			post_id    TEXT NOT NULL,
+			id         TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, post_id)
+		);
+		CREATE INDEX bookmarks_user_created_at ON bookmarks (user_id, created_at);
+		CREATE INDEX bookmarks_post_id ON bookmarks (post_id);
+
+		CREATE TABLE reading_lists (
+			id         TEXT PRIMARY KEY,
+			owner      TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			private    BOOLEAN NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX reading_lists_owner ON reading_lists (owner, created_at);
+
+		CREATE TABLE reading_list_posts (
+			list_id  TEXT NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+			post_id  TEXT NOT NULL,
+			position BIGINT NOT NULL,
+			PRIMARY KEY (list_id, post_id)
+		);
+		CREATE INDEX reading_list_posts_post_id ON reading_list_posts (post_id);
+
+		CREATE TABLE jobs (
+			id           TEXT PRIMARY KEY,
+			type         TEXT NOT NULL,
+			payload      JSONB NOT NULL,
+			status       TEXT NOT NULL,
+			attempts     BIGINT NOT NULL,
+			max_attempts BIGINT NOT NULL,
+			last_error   TEXT NOT NULL,
+			run_at       BIGINT NOT NULL,
+			locked_until BIGINT NOT NULL,
+			created_at   BIGINT NOT NULL,
+			updated_at   BIGINT NOT NULL
+		);
+		CREATE INDEX jobs_status_run_at ON jobs (status, run_at);
+		CREATE INDEX jobs_status_locked_until ON jobs (status, locked_until);
+		CREATE INDEX jobs_status_created_at ON jobs (status, created_at);
+
+		CREATE TABLE notifications (
+			id          TEXT PRIMARY KEY,
+			recipient   TEXT NOT NULL,
+			type        TEXT NOT NULL,
+			group_key   TEXT NOT NULL,
+			post_id     TEXT,
+			excerpt     TEXT NOT NULL,
+			actors      JSONB NOT NULL,
+			actor_ids   JSONB NOT NULL,
+			actor_count BIGINT NOT NULL,
+			read        BOOLEAN NOT NULL,
+			created_at  BIGINT NOT NULL,
+			updated_at  BIGINT NOT NULL
+		);
+		-- at most one unread notification per group
+		CREATE UNIQUE INDEX notifications_unread_group ON notifications (recipient, group_key) WHERE NOT read;
+		CREATE INDEX notifications_recipient ON notifications (recipient, read, updated_at);
+
+		CREATE TABLE used_tokens (
+			id         TEXT PRIMARY KEY,
+			expires_at BIGINT NOT NULL
+		);
+		CREATE INDEX used_tokens_expires_at ON used_tokens (expires_at);
+
+		CREATE TABLE webhooks (
+			id         TEXT PRIMARY KEY,
+			url        TEXT NOT NULL,
+			secret     TEXT NOT NULL,
+			events     JSONB NOT NULL,
+			active     BOOLEAN NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE webhook_deliveries (
+			id         TEXT PRIMARY KEY,
+			webhook    TEXT NOT NULL,
+			event      TEXT NOT NULL,
+			payload    TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			attempts   JSONB NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook, created_at);`,
+		// Post visibility and blocked users.
+		`ALTER TABLE posts ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+
+		CREATE TABLE user_blocks (
+			user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			blocked_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			added_at   BIGINT NOT NULL,
+			PRIMARY KEY (user_id, blocked_id)
+		);
+		CREATE INDEX user_blocks_blocked_id ON user_blocks (blocked_id);`,
+		// Reposts by original.
+		`CREATE INDEX posts_repost_of ON posts (repost_of, author) WHERE repost_of IS NOT NULL;`,
+		// One repost of a post per user; quotes are not limited.
+		`DROP INDEX posts_repost_of;
+		CREATE UNIQUE INDEX posts_repost_of ON posts (repost_of, author) WHERE kind = 'repost';`,
+		// Search tags along with content.
+		`DROP INDEX posts_search;
+		CREATE INDEX posts_search ON posts USING GIN ((` + postSearchDocument + `));`,
+	},
+}
+
+// OpenPostgres connects to the Postgres database at url and migrates its
+// schema to the latest version.
+func OpenPostgres(ctx context.Context, url string) (*sql.DB, error) {
+	sqlDB, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	if err := postgres.migrate(ctx, sqlDB); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return sqlDB, nil
+}
+
+func NewPostgresUserStore(sqlDB *sql.DB) *SQLUserStore {
+	return &SQLUserStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresPostStore(sqlDB *sql.DB) *SQLPostStore {
+	return &SQLPostStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresBookmarkStore(sqlDB *sql.DB) *SQLBookmarkStore {
+	return &SQLBookmarkStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresJobStore(sqlDB *sql.DB) *SQLJobStore {
+	return &SQLJobStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresNotificationStore(sqlDB *sql.DB) *SQLNotificationStore {
+	return &SQLNotificationStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresTokenStore(sqlDB *sql.DB) *SQLTokenStore {
+	return &SQLTokenStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func NewPostgresWebhookStore(sqlDB *sql.DB) *SQLWebhookStore {
+	return &SQLWebhookStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+// PostgresSearchStore answers searches with Postgres full-text search over
+// the posts and users tables.
+type PostgresSearchStore struct {
+	sqlStore
+}
+
+func NewPostgresSearchStore(sqlDB *sql.DB) *PostgresSearchStore {
+	return &PostgresSearchStore{sqlStore{db: sqlDB, dialect: postgres}}
+}
+
+func (s *PostgresSearchStore) Search(ctx context.Context, params types.SearchParams) (*types.SearchResult, error) {
+	result := &types.SearchResult{
+		Query: params.Query,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Posts: []*types.PostHit{},
+		Users: []*types.UserHit{},
+	}
+	terms := types.SearchTerms(params.Query)
+	if params.Type != types.SearchTypeUsers {
+		if err := s.searchPosts(ctx, params, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	if params.Type != types.SearchTypePosts {
+		if err := s.searchUsers(ctx, params, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *PostgresSearchStore) searchPosts(ctx context.Context, params types.SearchParams, terms []string, result *types.SearchResult) error {
+	var (
+		document    = postSearchDocument
+		query       = `websearch_to_tsquery('` + postgresSearchConfig + `', ?)`
+		where, args = searchFilter(params).where()
+	)
+	filter := document + ` @@ ` + query + ` AND ` + where
+	args = append([]any{params.Query}, args...)
+	if err := s.queryRow(ctx, `SELECT COUNT(*) FROM posts WHERE `+filter, args...).Scan(&result.TotalPosts); err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, `SELECT `+postColumns+`, ts_rank(`+document+`, `+query+`) AS score
+		FROM posts WHERE `+filter+` ORDER BY score DESC, created_at DESC LIMIT ? OFFSET ?`,
+		append(append([]any{params.Query}, args...), params.Limit, params.Skip())...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var score float64
+		post, err := scanPost(rows, &score)
+		if err != nil {
+			return err
+		}
+		result.Posts = append(result.Posts, &types.PostHit{
+			Post:       post,
+			Score:      score,
+			Highlights: types.Highlight(post.Content, terms),
+		})
+	}
+	return rows.Err()
+}
+
+func (s *PostgresSearchStore) searchUsers(ctx context.Context, params types.SearchParams, terms []string, result *types.SearchResult) error {
+	var (
+		document = `to_tsvector('` + postgresSearchConfig + `', first_name || ' ' || last_name)`
+		query    = `websearch_to_tsquery('` + postgresSearchConfig + `', ?)`
+	)
+	visible, args := unhidden(`id`, params.Viewer)
+	filter := document + ` @@ ` + query + ` AND ` + visible
+	args = append([]any{params.Query}, args...)
+	if err := s.queryRow(ctx, `SELECT COUNT(*) FROM users WHERE `+filter, args...).Scan(&result.TotalUsers); err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, `SELECT id, first_name, last_name, ts_rank(`+document+`, `+query+`) AS score
+		FROM users WHERE `+filter+` ORDER BY score DESC, id LIMIT ? OFFSET ?`,
+		append(append([]any{params.Query}, args...), params.Limit, params.Skip())...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			user  types.UserSummary
+			id    string
+			score float64
+		)
+		if err := rows.Scan(&id, &user.FirstName, &user.LastName, &score); err != nil {
+			return err
+		}
+		if user.ID, err = scanID(id); err != nil {
+			return err
+		}
+		result.Users = append(result.Users, &types.UserHit{
+			User:       &user,
+			Score:      score,
+			Highlights: types.Highlight(user.FirstName+" "+user.LastName, terms),
+		})
+	}
+	return rows.Err()
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+)
+
+type SearchStore interface {
+	Search(context.Context, types.SearchParams) (*types.SearchResult, error)
+}
+
+type MongoSearchStore struct {
+	client *mongo.Client
+	posts  *mongo.Collection
+	users  *mongo.Collection
+}
+
+func NewMongoSearchStore(client *mongo.Client) *MongoSearchStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoSearchStore{
+		client: client,
+		posts:  client.Database(dbname).Collection(postColl),
+		users:  client.Database(dbname).Collection(userColl),
+	}
+}
+
+func (s *MongoSearchStore) Search(ctx context.Context, params types.SearchParams) (*types.SearchResult, error) {
+	result := &types.SearchResult{
+		Query: params.Query,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Posts: []*types.PostHit{},
+		Users: []*types.UserHit{},
+	}
+	terms := types.SearchTerms(params.Query)
+	if params.Type != types.SearchTypeUsers {
+		if err := s.searchPosts(ctx, params, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	if params.Type != types.SearchTypePosts {
+		if err := s.searchUsers(ctx, params, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *MongoSearchStore) searchPosts(ctx context.Context, params types.SearchParams, terms []string, result *types.SearchResult) error {
+	filter := searchFilter(params).bson()
+	filter["$text"] = bson.M{"$search": params.Query}
+	total, err := s.posts.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	result.TotalPosts = total
+
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "created_at", Value: -1}}).
+		SetSkip(params.Skip()).
+		SetLimit(params.Limit)
+	cur, err := s.posts.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	var docs []struct {
+		types.Post `bson:",inline"`
+		Score      float64 `bson:"score"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return err
+	}
+	for i := range docs {
+		post := docs[i].Post
+		result.Posts = append(result.Posts, &types.PostHit{
+			Post:       &post,
+			Score:      docs[i].Score,
+			Highlights: types.Highlight(post.Content, terms),
+		})
+	}
+	return nil
+}
+
+func (s *MongoSearchStore) searchUsers(ctx context.Context, params types.SearchParams, terms []string, result *types.SearchResult) error {
+	filter := bson.M{"$text": bson.M{"$search": params.Query}}
+	if hidden := params.Viewer.Hidden; len(hidden) > 0 {
+		filter["_id"] = bson.M{"$nin": hidden}
+	}
+	total, err := s.users.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	result.TotalUsers = total
+
+	opts := options.Find().
+		SetProjection(bson.M{"firstName": 1, "lastName": 1, "score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}).
+		SetSkip(params.Skip()).
+		SetLimit(params.Limit)
+	cur, err := s.users.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	var docs []struct {
+		types.UserSummary `bson:",inline"`
+		Score             float64 `bson:"score"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return err
+	}
+	for i := range docs {
+		user := docs[i].UserSummary
+		result.Users = append(result.Users, &types.UserHit{
+			User:       &user,
+			Score:      docs[i].Score,
+			Highlights: types.Highlight(user.FirstName+" "+user.LastName, terms),
+		})
+	}
+	return nil
+}
+
+// searchFilter selects the posts a search may return, besides matching its
+// query.
+func searchFilter(params types.SearchParams) PostFilter {
+	filter := PostFilter{
+		CreatedFrom: params.From,
+		CreatedTo:   params.To,
+		Viewer:      &params.Viewer,
+	}
+	if !params.Author.IsZero() {
+		filter.Authors = []primitive.ObjectID{params.Author}
+	}
+	return filter
+}
+
+// unhidden returns a SQL condition on the user ID column selecting the users
+// the viewer may find, and its arguments.
+func unhidden(column string, viewer types.Viewer) (string, []any) {
+	if len(viewer.Hidden) == 0 {
+		return `1 = 1`, nil
+	}
+	return column + ` NOT IN (` + placeholders(len(viewer.Hidden)) + `)`, hexIDs(viewer.Hidden)
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The SQL stores keep documents in tables with the same shape on every SQL
+// database, so they share their queries and differ only in a sqlDialect:
+//
+//   - IDs are ObjectIDs stored as their hex strings, so clients see the same
+//     IDs whichever backend is in use.
+//   - Times are stored as Unix milliseconds, the precision Mongo keeps, so
+//     they round-trip the same everywhere.
+//   - Nested documents (notification settings, tags) are stored as JSON.
+//   - Missing rows are reported as ErrNotFound and reused IDs as
+//     ErrConflict, as the Mongo stores do.
+
+// sqlDialect holds what differs between the SQL databases.
+type sqlDialect struct {
+	name string
+	// placeholder returns the nth bind parameter, counting from 1.
+	placeholder func(n int) string
+	// isDuplicate reports whether err is a unique constraint violation.
+	isDuplicate func(err error) bool
+	// lock, if set, is run in the migration transaction so that instances
+	// starting together do not migrate at once.
+	lock string
+	// forUpdate, if set, is appended to a select whose rows the transaction
+	// goes on to update, and skipLocked to one that claims a row, so that
+	// concurrent transactions skip it. SQLite needs neither: it runs one
+	// write transaction at a time.
+	forUpdate  string
+	skipLocked string
+	// migrations are the schema versions in order; each is run once, in a
+	// transaction, and never changed after release.
+	migrations []string
+}
+
+// rebind rewrites the ? placeholders the queries are written with into the
+// dialect's own.
+func (d *sqlDialect) rebind(query string) string {
+	if d.placeholder == nil {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrate brings the schema up to date, recording applied versions in
+// schema_migrations.
+func (d *sqlDialect) migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if len(d.lock) > 0 {
+		if _, err := tx.ExecContext(ctx, d.lock); err != nil {
+			return err
+		}
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for i := current; i < len(d.migrations); i++ {
+		if _, err := tx.ExecContext(ctx, d.migrations[i]); err != nil {
+			return fmt.Errorf("%s migration %d: %w", d.name, i+1, err)
+		}
+		_, err := tx.ExecContext(ctx, d.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), i+1, millis(time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlStore is what the SQL stores share.
+type sqlStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+func (s sqlStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s sqlStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s sqlStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// inTx runs fn in a transaction, committing if it returns nil.
+func (s sqlStore) inTx(ctx context.Context, fn func(tx sqlTx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(sqlTx{tx: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect *sqlDialect
+}
+
+func (t sqlTx) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t sqlTx) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t sqlTx) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+// insertError turns a unique constraint violation, by an insert or an
+// update, into ErrConflict.
+func (s sqlStore) insertError(err error) error {
+	if err != nil && s.dialect.isDuplicate(err) {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// rowQuerier is a sqlStore or a sqlTx.
+type rowQuerier interface {
+	queryRow(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// notMatchedRow is notMatched for the SQL stores. Given the ErrNotFound of a
+// write conditioned on version, it reports ErrVersionMismatch instead if the
+// row that the write selects but for its version exists. Other errors are
+// returned as they are.
+func notMatchedRow(ctx context.Context, q rowQuerier, err error, version int64, table string, unversioned string, args ...any) error {
+	if version == 0 || !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var exists int
+	err = q.queryRow(ctx, `SELECT 1 FROM `+table+` WHERE `+unversioned+` LIMIT 1`, args...).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// matchedOne turns an update that matched no row into ErrNotFound.
+func matchedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// setColumns turns the fields of a $set document into the SET clause of an
+// update, given the column each field is stored in.
+func setColumns(set map[string]any, columns map[string]string) (string, []any, error) {
+	var (
+		sets string
+		args []any
+	)
+	for field, value := range set {
+		column, ok := columns[field]
+		if !ok {
+			return "", nil, errors.New("unsupported field " + field)
+		}
+		if t, ok := value.(time.Time); ok {
+			value = millis(t)
+		}
+		if len(sets) > 0 {
+			sets += ", "
+		}
+		sets += column + " = ?"
+		args = append(args, value)
+	}
+	return sets, args, nil
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+// placeholders returns n comma separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// qualified prefixes each of the comma separated columns with table.
+func qualified(table string, columns string) string {
+	fields := strings.Split(columns, ",")
+	for i, field := range fields {
+		fields[i] = table + "." + strings.TrimSpace(field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+func hexIDs(ids []primitive.ObjectID) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id.Hex()
+	}
+	return args
+}
+
+func scanID(s string) (primitive.ObjectID, error) {
+	oid, err := parseID(s)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("malformed id " + strconv.Quote(s) + " in database")
+	}
+	return oid, nil
+}
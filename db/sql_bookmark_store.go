@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const readingListColumns = `id, owner, name, private, created_at, updated_at`
+
+// SQLBookmarkStore is a BookmarkStore on a SQL database. The posts of a
+// reading list live in reading_list_posts, in the order they were added.
+type SQLBookmarkStore struct {
+	sqlStore
+}
+
+func (s *SQLBookmarkStore) AddBookmark(ctx context.Context, userID string, postID string) error {
+	uid, pid, err := parseIDPair(userID, postID)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `INSERT INTO bookmarks (user_id, post_id, id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, post_id) DO NOTHING`,
+		uid.Hex(), pid.Hex(), primitive.NewObjectID().Hex(), millis(time.Now()))
+	return err
+}
+
+func (s *SQLBookmarkStore) RemoveBookmark(ctx context.Context, userID string, postID string) error {
+	uid, pid, err := parseIDPair(userID, postID)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?`, uid.Hex(), pid.Hex())
+	return err
+}
+
+func (s *SQLBookmarkStore) GetBookmarks(ctx context.Context, userID string, page int64, limit int64) ([]*types.Bookmark, error) {
+	uid, err := parseID(userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(ctx, `SELECT id, user_id, post_id, created_at FROM bookmarks
+		WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, uid.Hex(), limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bookmarks := []*types.Bookmark{}
+	for rows.Next() {
+		var (
+			bookmark       types.Bookmark
+			id, user, post string
+			createdAt      int64
+		)
+		if err := rows.Scan(&id, &user, &post, &createdAt); err != nil {
+			return nil, err
+		}
+		if bookmark.ID, err = scanID(id); err != nil {
+			return nil, err
+		}
+		if bookmark.User, err = scanID(user); err != nil {
+			return nil, err
+		}
+		if bookmark.Post, err = scanID(post); err != nil {
+			return nil, err
+		}
+		bookmark.CreatedAt = fromMillis(createdAt)
+		bookmarks = append(bookmarks, &bookmark)
+	}
+	return bookmarks, rows.Err()
+}
+
+func (s *SQLBookmarkStore) InsertReadingList(ctx context.Context, list *types.ReadingList) (*types.ReadingList, error) {
+	if list.ID.IsZero() {
+		list.ID = primitive.NewObjectID()
+	}
+	err := s.inTx(ctx, func(tx sqlTx) error {
+		_, err := tx.exec(ctx, `INSERT INTO reading_lists (`+readingListColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+			list.ID.Hex(), list.Owner.Hex(), list.Name, list.Private, millis(list.CreatedAt), millis(list.UpdatedAt))
+		if err != nil {
+			return s.insertError(err)
+		}
+		for _, post := range list.Posts {
+			if err := addToReadingList(ctx, tx, list.ID, post); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SQLBookmarkStore) GetReadingList(ctx context.Context, id string) (*types.ReadingList, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := s.findReadingLists(ctx, `id = ?`, oid.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, ErrNotFound
+	}
+	return lists[0], nil
+}
+
+func (s *SQLBookmarkStore) GetReadingListsByOwner(ctx context.Context, ownerID string) ([]*types.ReadingList, error) {
+	oid, err := parseID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.findReadingLists(ctx, `owner = ?`, oid.Hex())
+}
+
+// readingListFields maps the fields of UpdateReadingListParams.ToBSON to
+// reading_lists columns.
+var readingListFields = map[string]string{
+	"name":       "name",
+	"private":    "private",
+	"updated_at": "updated_at",
+}
+
+func (s *SQLBookmarkStore) UpdateReadingList(ctx context.Context, id primitive.ObjectID, params types.UpdateReadingListParams) error {
+	sets, args, err := setColumns(params.ToBSON(), readingListFields)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE reading_lists SET `+sets+` WHERE id = ?`, append(args, id.Hex())...)
+	return matchedOne(res, err)
+}
+
+func (s *SQLBookmarkStore) DeleteReadingList(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `DELETE FROM reading_lists WHERE id = ?`, oid.Hex())
+	return matchedOne(res, err)
+}
+
+func (s *SQLBookmarkStore) AddToReadingList(ctx context.Context, listID string, postID string) error {
+	lid, pid, err := parseIDPair(listID, postID)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		res, err := tx.exec(ctx, `UPDATE reading_lists SET updated_at = ? WHERE id = ?`, millis(time.Now()), lid.Hex())
+		if err := matchedOne(res, err); err != nil {
+			return err
+		}
+		return addToReadingList(ctx, tx, lid, pid)
+	})
+}
+
+func (s *SQLBookmarkStore) RemoveFromReadingList(ctx context.Context, listID string, postID string) error {
+	lid, pid, err := parseIDPair(listID, postID)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		res, err := tx.exec(ctx, `UPDATE reading_lists SET updated_at = ? WHERE id = ?`, millis(time.Now()), lid.Hex())
+		if err := matchedOne(res, err); err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `DELETE FROM reading_list_posts WHERE list_id = ? AND post_id = ?`, lid.Hex(), pid.Hex())
+		return err
+	})
+}
+
+// addToReadingList appends post to the list's posts unless it is already
+// there.
+func addToReadingList(ctx context.Context, tx sqlTx, list, post primitive.ObjectID) error {
+	_, err := tx.exec(ctx, `INSERT INTO reading_list_posts (list_id, post_id, position)
+		SELECT CAST(? AS TEXT), CAST(? AS TEXT), COALESCE(MAX(position), 0) + 1 FROM reading_list_posts WHERE list_id = ?
+		ON CONFLICT (list_id, post_id) DO NOTHING`,
+		list.Hex(), post.Hex(), list.Hex())
+	return err
+}
+
+// findReadingLists returns the reading lists matching where, with their
+// posts, oldest first.
+func (s *SQLBookmarkStore) findReadingLists(ctx context.Context, where string, args ...any) ([]*types.ReadingList, error) {
+	var lists []*types.ReadingList
+	err := s.inTx(ctx, func(tx sqlTx) error {
+		rows, err := tx.query(ctx, `SELECT `+readingListColumns+` FROM reading_lists WHERE `+where+` ORDER BY created_at, id`, args...)
+		if err != nil {
+			return err
+		}
+		byID := map[string]*types.ReadingList{}
+		for rows.Next() {
+			var (
+				list                 = &types.ReadingList{Posts: []primitive.ObjectID{}}
+				id, owner            string
+				createdAt, updatedAt int64
+			)
+			if err := rows.Scan(&id, &owner, &list.Name, &list.Private, &createdAt, &updatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if list.ID, err = scanID(id); err != nil {
+				rows.Close()
+				return err
+			}
+			if list.Owner, err = scanID(owner); err != nil {
+				rows.Close()
+				return err
+			}
+			list.CreatedAt, list.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+			lists = append(lists, list)
+			byID[id] = list
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(lists) == 0 {
+			return nil
+		}
+		rows, err = tx.query(ctx, `SELECT list_id, post_id FROM reading_list_posts
+			WHERE list_id IN (SELECT id FROM reading_lists WHERE `+where+`) ORDER BY position, post_id`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var listID, postID string
+			if err := rows.Scan(&listID, &postID); err != nil {
+				return err
+			}
+			post, err := scanID(postID)
+			if err != nil {
+				return err
+			}
+			if list, ok := byID[listID]; ok {
+				list.Posts = append(list.Posts, post)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if lists == nil {
+		lists = []*types.ReadingList{}
+	}
+	return lists, nil
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const jobColumns = `id, type, payload, status, attempts, max_attempts, last_error,
+	run_at, locked_until, created_at, updated_at`
+
+// SQLJobStore is a JobStore on a SQL database.
+type SQLJobStore struct {
+	sqlStore
+}
+
+func (s *SQLJobStore) InsertJob(ctx context.Context, job *types.Job) (*types.Job, error) {
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.exec(ctx, `INSERT INTO jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID.Hex(), job.Type, string(payload), job.Status, job.Attempts, job.MaxAttempts, job.LastError,
+		millis(job.RunAt), millis(job.LockedUntil), millis(job.CreatedAt), millis(job.UpdatedAt))
+	if err != nil {
+		return nil, s.insertError(err)
+	}
+	return job, nil
+}
+
+func (s *SQLJobStore) ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*types.Job, error) {
+	var job *types.Job
+	err := s.inTx(ctx, func(tx sqlTx) error {
+		var id string
+		err := tx.queryRow(ctx, `SELECT id FROM jobs
+			WHERE (status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?)
+			ORDER BY run_at LIMIT 1`+s.dialect.skipLocked,
+			types.JobStatusPending, millis(now), types.JobStatusRunning, millis(now)).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `UPDATE jobs SET status = ?, locked_until = ?, updated_at = ?, attempts = attempts + 1 WHERE id = ?`,
+			types.JobStatusRunning, millis(now.Add(lease)), millis(now), id)
+		if err != nil {
+			return err
+		}
+		job, err = scanJob(tx.queryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLJobStore) CompleteJob(ctx context.Context, job *types.Job) error {
+	return s.setStatus(ctx, job, `status = ?`, types.JobStatusDone)
+}
+
+func (s *SQLJobStore) RetryJob(ctx context.Context, job *types.Job, runAt time.Time, reason string) error {
+	return s.setStatus(ctx, job, `status = ?, run_at = ?, last_error = ?`, types.JobStatusPending, millis(runAt), reason)
+}
+
+func (s *SQLJobStore) KillJob(ctx context.Context, job *types.Job, reason string) error {
+	return s.setStatus(ctx, job, `status = ?, last_error = ?`, types.JobStatusDead, reason)
+}
+
+// setStatus applies sets to job if it is still running on the claim it was
+// returned with, which the attempt count identifies.
+func (s *SQLJobStore) setStatus(ctx context.Context, job *types.Job, sets string, args ...any) error {
+	res, err := s.exec(ctx, `UPDATE jobs SET `+sets+`, updated_at = ? WHERE id = ? AND status = ? AND attempts = ?`,
+		append(args, millis(time.Now()), job.ID.Hex(), types.JobStatusRunning, job.Attempts)...)
+	if err = matchedOne(res, err); errors.Is(err, ErrNotFound) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (s *SQLJobStore) RequeueJob(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	now := millis(time.Now())
+	res, err := s.exec(ctx, `UPDATE jobs SET status = ?, attempts = 0, run_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		types.JobStatusPending, now, now, oid.Hex(), types.JobStatusDead)
+	return matchedOne(res, err)
+}
+
+func (s *SQLJobStore) GetJob(ctx context.Context, id string) (*types.Job, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := scanJob(s.queryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, oid.Hex()))
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *SQLJobStore) GetJobs(ctx context.Context, status string, page int64, limit int64) ([]*types.Job, error) {
+	where, args := `1 = 1`, []any{}
+	if len(status) > 0 {
+		where, args = `status = ?`, append(args, status)
+	}
+	rows, err := s.query(ctx, `SELECT `+jobColumns+` FROM jobs WHERE `+where+`
+		ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []*types.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// scanJob scans a job from row, or returns nil if row is an *sql.Row that
+// matched nothing.
+func scanJob(row interface{ Scan(...any) error }) (*types.Job, error) {
+	var (
+		job                                      types.Job
+		id, payload                              string
+		runAt, lockedUntil, createdAt, updatedAt int64
+	)
+	err := row.Scan(&id, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.LastError,
+		&runAt, &lockedUntil, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if job.ID, err = scanID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(payload), &job.Payload); err != nil {
+		return nil, err
+	}
+	job.RunAt, job.LockedUntil = fromMillis(runAt), fromMillis(lockedUntil)
+	job.CreatedAt, job.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+	return &job, nil
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+)
+
+const notificationColumns = `id, recipient, type, group_key, post_id, excerpt, actors, actor_ids,
+	actor_count, read, created_at, updated_at`
+
+// SQLNotificationStore is a NotificationStore on a SQL database. Actors are
+// stored as JSON and grouped in Go, inside the transaction that reads them.
+type SQLNotificationStore struct {
+	sqlStore
+}
+
+func (s *SQLNotificationStore) AddNotification(ctx context.Context, n *types.Notification) error {
+	for {
+		err := s.inTx(ctx, func(tx sqlTx) error {
+			grouped, err := s.group(ctx, tx, n)
+			if err != nil || grouped {
+				return err
+			}
+			return s.insert(ctx, tx, n)
+		})
+		if errors.Is(err, ErrConflict) {
+			// another worker opened the group first; join it
+			continue
+		}
+		return err
+	}
+}
+
+// group folds n into the recipient's unread notification with the same group
+// key and reports whether there was one.
+func (s *SQLNotificationStore) group(ctx context.Context, tx sqlTx, n *types.Notification) (bool, error) {
+	current, err := scanNotification(tx.queryRow(ctx, `SELECT `+notificationColumns+` FROM notifications
+		WHERE recipient = ? AND group_key = ? AND NOT read`+s.dialect.forUpdate, n.Recipient.Hex(), n.GroupKey))
+	if err != nil || current == nil {
+		return false, err
+	}
+	current.UpdatedAt, current.Excerpt = n.UpdatedAt, n.Excerpt
+	if n.PostID != nil {
+		current.PostID = n.PostID
+	}
+	// the same actor again, or an event without actors, only refreshes it
+	if len(n.Actors) > 0 && !slices.Contains(current.ActorIDs, n.Actors[0].ID) {
+		actor := n.Actors[0]
+		current.Actors = append([]types.UserSummary{actor}, current.Actors...)
+		if len(current.Actors) > maxNotificationActors {
+			current.Actors = current.Actors[:maxNotificationActors]
+		}
+		current.ActorIDs = append(current.ActorIDs, actor.ID)
+		current.ActorCount++
+	}
+	actors, actorIDs, err := marshalActors(current)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.exec(ctx, `UPDATE notifications SET post_id = ?, excerpt = ?, actors = ?, actor_ids = ?, actor_count = ?, updated_at = ?
+		WHERE id = ?`, hexOrNil(current.PostID), current.Excerpt, actors, actorIDs, current.ActorCount, millis(current.UpdatedAt),
+		current.ID.Hex())
+	return err == nil, err
+}
+
+func (s *SQLNotificationStore) insert(ctx context.Context, tx sqlTx, n *types.Notification) error {
+	if n.ID.IsZero() {
+		n.ID = primitive.NewObjectID()
+	}
+	actors, actorIDs, err := marshalActors(n)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec(ctx, `INSERT INTO notifications (`+notificationColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		n.ID.Hex(), n.Recipient.Hex(), n.Type, n.GroupKey, hexOrNil(n.PostID), n.Excerpt, actors, actorIDs,
+		n.ActorCount, n.Read, millis(n.CreatedAt), millis(n.UpdatedAt))
+	return s.insertError(err)
+}
+
+func (s *SQLNotificationStore) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, page int64, limit int64) ([]*types.Notification, error) {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return nil, err
+	}
+	where := `recipient = ?`
+	if unreadOnly {
+		where += ` AND NOT read`
+	}
+	rows, err := s.query(ctx, `SELECT `+notificationColumns+` FROM notifications WHERE `+where+`
+		ORDER BY updated_at DESC, id DESC LIMIT ? OFFSET ?`, oid.Hex(), limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []*types.Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *SQLNotificationStore) CountUnread(ctx context.Context, recipient string) (int64, error) {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = s.queryRow(ctx, `SELECT COUNT(*) FROM notifications WHERE recipient = ? AND NOT read`, oid.Hex()).Scan(&n)
+	return n, err
+}
+
+func (s *SQLNotificationStore) MarkRead(ctx context.Context, recipient string, id string) error {
+	uid, nid, err := parseIDPair(recipient, id)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE notifications SET read = ? WHERE id = ? AND recipient = ?`, true, nid.Hex(), uid.Hex())
+	return matchedOne(res, err)
+}
+
+func (s *SQLNotificationStore) MarkAllRead(ctx context.Context, recipient string) error {
+	oid, err := parseID(recipient)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `UPDATE notifications SET read = ? WHERE recipient = ? AND NOT read`, true, oid.Hex())
+	return err
+}
+
+func marshalActors(n *types.Notification) (string, string, error) {
+	actors, ids := n.Actors, n.ActorIDs
+	if actors == nil {
+		actors = []types.UserSummary{}
+	}
+	if ids == nil {
+		ids = []primitive.ObjectID{}
+	}
+	a, err := json.Marshal(actors)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return "", "", err
+	}
+	return string(a), string(b), nil
+}
+
+func hexOrNil(id *primitive.ObjectID) any {
+	if id == nil {
+		return nil
+	}
+	return id.Hex()
+}
+
+// scanNotification scans a notification from row, or returns nil if row is
+// an *sql.Row that matched nothing.
+func scanNotification(row interface{ Scan(...any) error }) (*types.Notification, error) {
+	var (
+		n                    types.Notification
+		id, recipient        string
+		postID               sql.NullString
+		actors, actorIDs     string
+		createdAt, updatedAt int64
+	)
+	err := row.Scan(&id, &recipient, &n.Type, &n.GroupKey, &postID, &n.Excerpt, &actors, &actorIDs,
+		&n.ActorCount, &n.Read, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n.ID, err = scanID(id); err != nil {
+		return nil, err
+	}
+	if n.Recipient, err = scanID(recipient); err != nil {
+		return nil, err
+	}
+	if postID.Valid {
+		oid, err := scanID(postID.String)
+		if err != nil {
+			return nil, err
+		}
+		n.PostID = &oid
+	}
+	if err := json.Unmarshal([]byte(actors), &n.Actors); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(actorIDs), &n.ActorIDs); err != nil {
+		return nil, err
+	}
+	n.CreatedAt, n.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+	return &n, nil
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// postStatColumns maps the stats IncrementPostStat takes to posts columns.
+var postStatColumns = map[string]string{
+	types.StatReactions: "reactions",
+	types.StatComments:  "comments",
+	types.StatViews:     "views",
+	types.StatReposts:   "reposts",
+}
+
+const postColumns = `id, content, author, kind, repost_of, tags,
+	reactions, comments, views, reposts, created_at, updated_at, version, visibility`
+
+// SQLPostStore is a PostStore on a SQL database. Like in Mongo, posts outlive
+// their author. Bookmarks are kept by another store, so deleting a post leaves
+// them alone.
+type SQLPostStore struct {
+	sqlStore
+}
+
+func (s *SQLPostStore) InsertPost(ctx context.Context, post *types.Post) (*types.Post, error) {
+	if post.ID.IsZero() {
+		post.ID = primitive.NewObjectID()
+	}
+	if post.Version == 0 {
+		post.Version = 1
+	}
+	if len(post.Visibility) == 0 {
+		post.Visibility = types.PostVisibilityPublic
+	}
+	tags, err := json.Marshal(post.Tags)
+	if err != nil {
+		return nil, err
+	}
+	var repostOf any
+	if post.RepostOf != nil {
+		repostOf = post.RepostOf.Hex()
+	}
+	_, err = s.exec(ctx, `INSERT INTO posts (`+postColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		post.ID.Hex(), post.Content, post.Author.Hex(), post.Kind, repostOf, string(tags),
+		post.Stats.Reactions, post.Stats.Comments, post.Stats.Views, post.Stats.Reposts,
+		millis(post.CreatedAt), millis(post.UpdatedAt), post.Version, post.Visibility)
+	if err != nil {
+		return nil, s.insertError(err)
+	}
+	return post, nil
+}
+
+func (s *SQLPostStore) UpdatePost(ctx context.Context, filter PostFilter, params types.UpdatePostParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	update := params.ToBSON()
+	sets := `version = version + 1, updated_at = ?`
+	args := []any{millis(update["updated_at"].(time.Time))}
+	if content, ok := update["content"]; ok {
+		tags, err := json.Marshal(update["tags"])
+		if err != nil {
+			return err
+		}
+		sets += `, content = ?, tags = ?`
+		args = append(args, content, string(tags))
+	}
+	if visibility, ok := update["visibility"]; ok {
+		sets += `, visibility = ?`
+		args = append(args, visibility)
+	}
+	where, whereArgs := filter.where()
+	res, err := s.exec(ctx, `UPDATE posts SET `+sets+` WHERE id = (SELECT id FROM posts WHERE `+where+` ORDER BY id LIMIT 1)`,
+		append(args, whereArgs...)...)
+	if err := matchedOne(res, err); err != nil {
+		unversioned := filter
+		unversioned.Version = 0
+		where, args := unversioned.where()
+		return notMatchedRow(ctx, s, err, filter.Version, `posts`, where, args...)
+	}
+	return nil
+}
+
+func (s *SQLPostStore) DeletePost(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	where, args := PostFilter{ID: oid, Version: version}.where()
+	res, err := s.exec(ctx, `DELETE FROM posts WHERE `+where, args...)
+	if err := matchedOne(res, err); err != nil {
+		return notMatchedRow(ctx, s, err, version, `posts`, `id = ?`, oid.Hex())
+	}
+	return nil
+}
+
+func (s *SQLPostStore) GetPosts(ctx context.Context) ([]*types.Post, error) {
+	return s.findPosts(ctx, `1 = 1 ORDER BY id`)
+}
+
+func (s *SQLPostStore) GetPostByID(ctx context.Context, id string) (*types.Post, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := s.findPosts(ctx, `id = ?`, oid.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, ErrNotFound
+	}
+	return posts[0], nil
+}
+
+func (s *SQLPostStore) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*types.Post, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return s.findPosts(ctx, `id IN (`+placeholders(len(ids))+`) ORDER BY id`, hexIDs(ids)...)
+}
+
+func (s *SQLPostStore) GetPostsByUserID(ctx context.Context, id string) ([]*types.Post, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.findPosts(ctx, `author = ? ORDER BY id`, oid.Hex())
+}
+
+func (s *SQLPostStore) GetPostsSince(ctx context.Context, since time.Time) ([]*types.Post, error) {
+	return s.findPosts(ctx, `created_at >= ? ORDER BY id`, millis(since))
+}
+
+func (s *SQLPostStore) FindPosts(ctx context.Context, filter PostFilter, opts FindOptions) ([]*types.Post, error) {
+	where, args := filter.where()
+	clauses, clauseArgs := opts.clauses()
+	posts, err := s.findPosts(ctx, where+clauses, append(args, clauseArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*types.Post{}, posts...), nil
+}
+
+func (s *SQLPostStore) GetRecentPostsByAuthors(ctx context.Context, authors []primitive.ObjectID, since time.Time, limit int64) ([]*types.Post, error) {
+	posts := []*types.Post{}
+	if len(authors) == 0 {
+		return posts, nil
+	}
+	where := `author IN (` + placeholders(len(authors)) + `) AND kind <> ? AND created_at >= ? ORDER BY created_at DESC, id DESC`
+	args := append(hexIDs(authors), types.PostKindRepost, millis(since))
+	if limit > 0 {
+		where += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	found, err := s.findPosts(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	return append(posts, found...), nil
+}
+
+func (s *SQLPostStore) IncrementPostStat(ctx context.Context, id string, stat string, delta int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	column, ok := postStatColumns[stat]
+	if !ok {
+		return fmt.Errorf("unknown post stat %q", stat)
+	}
+	res, err := s.exec(ctx, `UPDATE posts SET `+column+` = `+column+` + ? WHERE id = ?`, delta, oid.Hex())
+	return matchedOne(res, err)
+}
+
+// findPosts returns the posts matching where, which may end in ORDER BY and
+// LIMIT clauses.
+func (s *SQLPostStore) findPosts(ctx context.Context, where string, args ...any) ([]*types.Post, error) {
+	rows, err := s.query(ctx, `SELECT `+postColumns+` FROM posts WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []*types.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// scanPost scans a row of postColumns, followed by any extra columns into
+// extra.
+func scanPost(rows *sql.Rows, extra ...any) (*types.Post, error) {
+	var (
+		post                 types.Post
+		id, author, tags     string
+		repostOf             sql.NullString
+		createdAt, updatedAt int64
+	)
+	dest := []any{&id, &post.Content, &author, &post.Kind, &repostOf, &tags,
+		&post.Stats.Reactions, &post.Stats.Comments, &post.Stats.Views, &post.Stats.Reposts, &createdAt, &updatedAt, &post.Version, &post.Visibility}
+	err := rows.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if post.ID, err = scanID(id); err != nil {
+		return nil, err
+	}
+	if post.Author, err = scanID(author); err != nil {
+		return nil, err
+	}
+	if repostOf.Valid {
+		ref, err := scanID(repostOf.String)
+		if err != nil {
+			return nil, err
+		}
+		post.RepostOf = &ref
+	}
+	if err := json.Unmarshal([]byte(tags), &post.Tags); err != nil {
+		return nil, err
+	}
+	post.CreatedAt = fromMillis(createdAt)
+	post.UpdatedAt = fromMillis(updatedAt)
+	return &post, nil
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// SQLTokenStore is a TokenStore on a SQL database. Expired records are
+// deleted as new tokens are redeemed, in place of Mongo's TTL index.
+type SQLTokenStore struct {
+	sqlStore
+}
+
+func (s *SQLTokenStore) UseToken(ctx context.Context, id string, expires time.Time) error {
+	if _, err := s.exec(ctx, `DELETE FROM used_tokens WHERE expires_at <= ?`, millis(time.Now())); err != nil {
+		return err
+	}
+	_, err := s.exec(ctx, `INSERT INTO used_tokens (id, expires_at) VALUES (?, ?)`, id, millis(expires))
+	if err != nil && s.dialect.isDuplicate(err) {
+		return ErrTokenUsed
+	}
+	return err
+}
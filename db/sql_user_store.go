@@ -0,0 +1,601 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// userFields maps the fields of UpdateUserParams.ToBSON to users columns.
+var userFields = map[string]string{
+	"firstName":     "first_name",
+	"lastName":      "last_name",
+	"email":         "email",
+	"emailVerified": "email_verified",
+	"password":      "password",
+	"language":      "language",
+	"timeZone":      "time_zone",
+}
+
+const userColumns = `id, first_name, last_name, email, email_verified, password, fcm_token,
+	language, time_zone, notifications, last_digest_at, version`
+
+// SQLUserStore is a UserStore on a SQL database. Devices, friends and blocked
+// users live in their own tables, user_devices, user_friends and user_blocks,
+// which are cleaned up with the user.
+type SQLUserStore struct {
+	sqlStore
+}
+
+func (s *SQLUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	notifications, err := json.Marshal(user.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	err = s.inTx(ctx, func(tx sqlTx) error {
+		_, err := tx.exec(ctx, `INSERT INTO users (`+userColumns+`, digest)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			user.ID.Hex(), user.FirstName, user.LastName, user.Email, user.EmailVerified, user.Password, user.FCMToken,
+			user.Language, user.TimeZone, string(notifications), millis(user.LastDigestAt), user.Version, user.Notifications.Digest)
+		if err != nil {
+			return s.insertError(err)
+		}
+		for _, device := range user.Devices {
+			if err := upsertDevice(ctx, tx, user.ID, device); err != nil {
+				return err
+			}
+		}
+		for _, friend := range user.Friends {
+			if err := addFriend(ctx, tx, user.ID, friend); err != nil {
+				return err
+			}
+		}
+		for _, blocked := range user.Blocked {
+			if err := blockUser(ctx, tx, user.ID, blocked); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLUserStore) UpdateUser(ctx context.Context, filter UserFilter, params types.UpdateUserParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	var (
+		sets []string
+		args []any
+	)
+	for field, value := range params.ToBSON() {
+		column, ok := userFields[field]
+		if !ok {
+			return fmt.Errorf("unsupported user field %q", field)
+		}
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	// An update with no fields still bumps the version, as Mongo's does,
+	// and so still reports a missing user
+	sets = append(sets, "version = version + 1")
+	where, whereArgs := firstUser(filter)
+	res, err := s.exec(ctx, `UPDATE users SET `+strings.Join(sets, ", ")+` WHERE id = `+where, append(args, whereArgs...)...)
+	if err := matchedOne(res, s.insertError(err)); err != nil {
+		unversioned := filter
+		unversioned.Version = 0
+		where, args := unversioned.where()
+		return notMatchedRow(ctx, s, err, filter.Version, `users`, where, args...)
+	}
+	return nil
+}
+
+func (s *SQLUserStore) DeleteUser(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	where, args := UserFilter{ID: oid, Version: version}.where()
+	res, err := s.exec(ctx, `DELETE FROM users WHERE `+where, args...)
+	if err := matchedOne(res, err); err != nil {
+		return notMatchedRow(ctx, s, err, version, `users`, `id = ?`, oid.Hex())
+	}
+	return nil
+}
+
+func (s *SQLUserStore) GetUsers(ctx context.Context) ([]*types.User, error) {
+	users, err := s.findUsers(ctx, `1 = 1`)
+	if len(users) == 0 {
+		return nil, err
+	}
+	return users, err
+}
+
+func (s *SQLUserStore) GetUser(ctx context.Context, id string) (*types.User, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByObjectID(ctx, oid)
+}
+
+func (s *SQLUserStore) GetUserByObjectID(ctx context.Context, id primitive.ObjectID) (*types.User, error) {
+	return s.findUser(ctx, `id = ?`, id.Hex())
+}
+
+func (s *SQLUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	return s.findUser(ctx, `id = (SELECT MIN(id) FROM users WHERE email = ?)`, email)
+}
+
+func (s *SQLUserStore) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID, fields ...string) ([]*types.User, error) {
+	if len(ids) == 0 {
+		return []*types.User{}, nil
+	}
+	users, err := s.findUsers(ctx, `id IN (`+placeholders(len(ids))+`)`, hexIDs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	return projectUsers(users, fields)
+}
+
+func (s *SQLUserStore) AddFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		if _, err := tx.firstUserID(ctx, UserFilter{ID: friend}); err != nil {
+			return err
+		}
+		user, err := tx.firstUserID(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if err := addFriend(ctx, tx, user, friend); err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, user.Hex())
+	})
+}
+
+func (s *SQLUserStore) RemoveFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		user, err := tx.firstUserID(ctx, filter)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `DELETE FROM user_friends WHERE user_id = ? AND friend_id = ?`, user.Hex(), friend.Hex())
+		if err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, user.Hex())
+	})
+}
+
+func (s *SQLUserStore) BlockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		if _, err := tx.firstUserID(ctx, UserFilter{ID: blocked}); err != nil {
+			return err
+		}
+		user, err := tx.firstUserID(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if err := blockUser(ctx, tx, user, blocked); err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, user.Hex())
+	})
+}
+
+func (s *SQLUserStore) UnblockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		user, err := tx.firstUserID(ctx, filter)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `DELETE FROM user_blocks WHERE user_id = ? AND blocked_id = ?`, user.Hex(), blocked.Hex())
+		if err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, user.Hex())
+	})
+}
+
+func (s *SQLUserStore) GetViewer(ctx context.Context, id primitive.ObjectID) (*types.Viewer, error) {
+	viewer := &types.Viewer{ID: id}
+	err := s.inTx(ctx, func(tx sqlTx) error {
+		if _, err := tx.firstUserID(ctx, UserFilter{ID: id}); err != nil {
+			return err
+		}
+		var err error
+		viewer.FriendOf, err = queryIDs(ctx, tx, `SELECT user_id FROM user_friends WHERE friend_id = ?`, id.Hex())
+		if err != nil {
+			return err
+		}
+		viewer.Hidden, err = queryIDs(ctx, tx, `SELECT blocked_id FROM user_blocks WHERE user_id = ?
+			UNION SELECT user_id FROM user_blocks WHERE blocked_id = ?`, id.Hex(), id.Hex())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return viewer, nil
+}
+
+// queryIDs returns the IDs query selects, in a single column.
+func queryIDs(ctx context.Context, tx sqlTx, query string, args ...any) ([]primitive.ObjectID, error) {
+	rows, err := tx.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []primitive.ObjectID
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			return nil, err
+		}
+		id, err := scanID(hex)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// firstUser returns a subquery for the ID of the first user filter selects.
+func firstUser(filter UserFilter) (string, []any) {
+	where, args := filter.where()
+	return `(SELECT id FROM users WHERE ` + where + ` ORDER BY id LIMIT 1)`, args
+}
+
+// firstUserID returns the ID of the first user filter selects, or ErrNotFound
+// or ErrVersionMismatch.
+func (t sqlTx) firstUserID(ctx context.Context, filter UserFilter) (primitive.ObjectID, error) {
+	where, args := firstUser(filter)
+	var id string
+	err := t.queryRow(ctx, `SELECT id FROM users WHERE id = `+where, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		unversioned := filter
+		unversioned.Version = 0
+		where, args := unversioned.where()
+		return primitive.NilObjectID, notMatchedRow(ctx, t, ErrNotFound, filter.Version, `users`, where, args...)
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return scanID(id)
+}
+
+// bumpVersion moves the users where selects to their next version, for
+// changes made to user_devices, user_friends and user_blocks.
+func bumpVersion(ctx context.Context, tx sqlTx, where string, args ...any) error {
+	_, err := tx.exec(ctx, `UPDATE users SET version = version + 1 WHERE `+where, args...)
+	return err
+}
+
+// addFriend adds friend to the user's friends unless it is already there or
+// either user is missing.
+func addFriend(ctx context.Context, tx sqlTx, user, friend primitive.ObjectID) error {
+	_, err := tx.exec(ctx, `INSERT INTO user_friends (user_id, friend_id, added_at)
+		SELECT CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS BIGINT) WHERE EXISTS (SELECT 1 FROM users WHERE id = ?) AND EXISTS (SELECT 1 FROM users WHERE id = ?)
+		ON CONFLICT (user_id, friend_id) DO NOTHING`,
+		user.Hex(), friend.Hex(), millis(time.Now()), user.Hex(), friend.Hex())
+	return err
+}
+
+// blockUser adds blocked to the users the user blocks unless it is already
+// there or either user is missing.
+func blockUser(ctx context.Context, tx sqlTx, user, blocked primitive.ObjectID) error {
+	_, err := tx.exec(ctx, `INSERT INTO user_blocks (user_id, blocked_id, added_at)
+		SELECT CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS BIGINT) WHERE EXISTS (SELECT 1 FROM users WHERE id = ?) AND EXISTS (SELECT 1 FROM users WHERE id = ?)
+		ON CONFLICT (user_id, blocked_id) DO NOTHING`,
+		user.Hex(), blocked.Hex(), millis(time.Now()), user.Hex(), blocked.Hex())
+	return err
+}
+
+// UpsertDevice registers device for the user, refreshing it if the token is
+// already registered, and removes the token from any other user.
+func (s *SQLUserStore) UpsertDevice(ctx context.Context, userID string, device types.Device) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		err := bumpVersion(ctx, tx, `id IN (SELECT user_id FROM user_devices WHERE token = ? AND user_id <> ?)`, device.Token, oid.Hex())
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `DELETE FROM user_devices WHERE token = ? AND user_id <> ?`, device.Token, oid.Hex())
+		if err != nil {
+			return err
+		}
+		var exists int
+		err = tx.queryRow(ctx, `SELECT 1 FROM users WHERE id = ?`, oid.Hex()).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := upsertDevice(ctx, tx, oid, device); err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, oid.Hex())
+	})
+}
+
+func upsertDevice(ctx context.Context, tx sqlTx, user primitive.ObjectID, device types.Device) error {
+	_, err := tx.exec(ctx, `INSERT INTO user_devices (token, user_id, platform, app_version, last_seen, registered_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (token) DO UPDATE SET
+			user_id = excluded.user_id, platform = excluded.platform,
+			app_version = excluded.app_version, last_seen = excluded.last_seen`,
+		device.Token, user.Hex(), device.Platform, device.AppVersion, millis(device.LastSeen), millis(time.Now()))
+	return err
+}
+
+func (s *SQLUserStore) RemoveDevice(ctx context.Context, userID string, token string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		if _, err := tx.firstUserID(ctx, UserFilter{ID: oid}); err != nil {
+			return err
+		}
+		if _, err := tx.exec(ctx, `DELETE FROM user_devices WHERE user_id = ? AND token = ?`, oid.Hex(), token); err != nil {
+			return err
+		}
+		_, err := tx.exec(ctx, `UPDATE users SET fcm_token = '' WHERE id = ? AND fcm_token = ?`, oid.Hex(), token)
+		if err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx, `id = ?`, oid.Hex())
+	})
+}
+
+// RemoveDeviceTokens unregisters the given tokens from every user.
+func (s *SQLUserStore) RemoveDeviceTokens(ctx context.Context, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	args := make([]any, len(tokens))
+	for i, token := range tokens {
+		args[i] = token
+	}
+	in := `(` + placeholders(len(tokens)) + `)`
+	return s.inTx(ctx, func(tx sqlTx) error {
+		err := bumpVersion(ctx, tx, `id IN (SELECT user_id FROM user_devices WHERE token IN `+in+`) OR fcm_token IN `+in,
+			append(args, args...)...)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.exec(ctx, `DELETE FROM user_devices WHERE token IN `+in, args...); err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `UPDATE users SET fcm_token = '' WHERE fcm_token IN `+in, args...)
+		return err
+	})
+}
+
+func (s *SQLUserStore) GetUsersByDeviceTokens(ctx context.Context, tokens []string) ([]*types.User, error) {
+	users := []*types.User{}
+	if len(tokens) == 0 {
+		return users, nil
+	}
+	args := make([]any, len(tokens))
+	for i, token := range tokens {
+		args[i] = token
+	}
+	in := `(` + placeholders(len(tokens)) + `)`
+	found, err := s.findUsers(ctx, `id IN (SELECT user_id FROM user_devices WHERE token IN `+in+`) OR fcm_token IN `+in,
+		append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return append(users, found...), nil
+}
+
+func (s *SQLUserStore) UpdateNotificationSettings(ctx context.Context, userID string, settings types.NotificationSettings) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	if settings.Events == nil {
+		settings.Events = map[string]types.ChannelPreference{}
+	}
+	notifications, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE users SET notifications = ?, digest = ?, version = version + 1 WHERE id = ?`,
+		string(notifications), settings.Digest, oid.Hex())
+	return matchedOne(res, err)
+}
+
+func (s *SQLUserStore) GetDigestDue(ctx context.Context, frequency string, sentBefore time.Time) ([]*types.User, error) {
+	users, err := s.findUsers(ctx, `digest = ? AND last_digest_at < ?`, frequency, millis(sentBefore))
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []*types.User{}
+	}
+	return users, nil
+}
+
+func (s *SQLUserStore) ClaimDigest(ctx context.Context, userID primitive.ObjectID, sentBefore time.Time, now time.Time) (bool, error) {
+	res, err := s.exec(ctx, `UPDATE users SET last_digest_at = ? WHERE id = ? AND last_digest_at < ?`,
+		millis(now), userID.Hex(), millis(sentBefore))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLUserStore) MarkEmailVerified(ctx context.Context, userID string, email string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE users SET email_verified = ?, version = version + 1 WHERE id = ? AND email = ?`, true, oid.Hex(), email)
+	return matchedOne(res, err)
+}
+
+func (s *SQLUserStore) findUser(ctx context.Context, where string, args ...any) (*types.User, error) {
+	users, err := s.findUsers(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return users[0], nil
+}
+
+// findUsers returns the users matching where, with their devices and friends,
+// in ID order, which is the order they were created in.
+func (s *SQLUserStore) findUsers(ctx context.Context, where string, args ...any) ([]*types.User, error) {
+	var users []*types.User
+	err := s.inTx(ctx, func(tx sqlTx) error {
+		rows, err := tx.query(ctx, `SELECT `+userColumns+` FROM users WHERE `+where+` ORDER BY id`, args...)
+		if err != nil {
+			return err
+		}
+		byID := map[string]*types.User{}
+		for rows.Next() {
+			user, err := scanUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			users = append(users, user)
+			byID[user.ID.Hex()] = user
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		matching := `SELECT id FROM users WHERE ` + where
+		rows, err = tx.query(ctx, `SELECT user_id, token, platform, app_version, last_seen FROM user_devices
+			WHERE user_id IN (`+matching+`) ORDER BY registered_at, token`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var (
+				userID   string
+				device   types.Device
+				lastSeen int64
+			)
+			if err := rows.Scan(&userID, &device.Token, &device.Platform, &device.AppVersion, &lastSeen); err != nil {
+				rows.Close()
+				return err
+			}
+			device.LastSeen = fromMillis(lastSeen)
+			if user, ok := byID[userID]; ok {
+				user.Devices = append(user.Devices, device)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		err = scanRelations(ctx, tx, `SELECT user_id, friend_id FROM user_friends
+			WHERE user_id IN (`+matching+`) ORDER BY added_at, friend_id`, args, func(userID string, friend primitive.ObjectID) {
+			if user, ok := byID[userID]; ok {
+				user.Friends = append(user.Friends, friend)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return scanRelations(ctx, tx, `SELECT user_id, blocked_id FROM user_blocks
+			WHERE user_id IN (`+matching+`) ORDER BY added_at, blocked_id`, args, func(userID string, blocked primitive.ObjectID) {
+			if user, ok := byID[userID]; ok {
+				user.Blocked = append(user.Blocked, blocked)
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// scanRelations calls add with each user ID and related user ID that query
+// selects, such as a user and one of their friends.
+func scanRelations(ctx context.Context, tx sqlTx, query string, args []any, add func(string, primitive.ObjectID)) error {
+	rows, err := tx.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID, relatedID string
+		if err := rows.Scan(&userID, &relatedID); err != nil {
+			return err
+		}
+		related, err := scanID(relatedID)
+		if err != nil {
+			return err
+		}
+		add(userID, related)
+	}
+	return rows.Err()
+}
+
+func scanUser(rows *sql.Rows) (*types.User, error) {
+	var (
+		user          = &types.User{Devices: []types.Device{}, Friends: []primitive.ObjectID{}, Blocked: []primitive.ObjectID{}}
+		id            string
+		notifications string
+		lastDigestAt  int64
+	)
+	err := rows.Scan(&id, &user.FirstName, &user.LastName, &user.Email, &user.EmailVerified, &user.Password, &user.FCMToken,
+		&user.Language, &user.TimeZone, &notifications, &lastDigestAt, &user.Version)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID, err = scanID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(notifications), &user.Notifications); err != nil {
+		return nil, err
+	}
+	user.LastDigestAt = fromMillis(lastDigestAt)
+	return user, nil
+}
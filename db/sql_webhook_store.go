@@ -0,0 +1,261 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"time"
+)
+
+const (
+	webhookColumns  = `id, url, secret, events, active, created_at, updated_at`
+	deliveryColumns = `id, webhook, event, payload, status, attempts, created_at, updated_at`
+)
+
+// webhookFields maps the fields of UpdateWebhookParams.ToBSON to webhooks
+// columns.
+var webhookFields = map[string]string{
+	"url":        "url",
+	"events":     "events",
+	"active":     "active",
+	"updated_at": "updated_at",
+}
+
+// SQLWebhookStore is a WebhookStore on a SQL database. Events and delivery
+// attempts are stored as JSON.
+type SQLWebhookStore struct {
+	sqlStore
+}
+
+func (s *SQLWebhookStore) InsertWebhook(ctx context.Context, webhook *types.Webhook) (*types.Webhook, error) {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.exec(ctx, `INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		webhook.ID.Hex(), webhook.URL, webhook.Secret, string(events), webhook.Active,
+		millis(webhook.CreatedAt), millis(webhook.UpdatedAt))
+	if err != nil {
+		return nil, s.insertError(err)
+	}
+	return webhook, nil
+}
+
+func (s *SQLWebhookStore) GetWebhook(ctx context.Context, id string) (*types.Webhook, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := s.findWebhooks(ctx, `id = ?`, oid.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrNotFound
+	}
+	return webhooks[0], nil
+}
+
+func (s *SQLWebhookStore) GetWebhooks(ctx context.Context) ([]*types.Webhook, error) {
+	return s.findWebhooks(ctx, `1 = 1`)
+}
+
+// GetWebhooksForEvent filters the active webhooks by event in Go: there are
+// few of them, and events are JSON.
+func (s *SQLWebhookStore) GetWebhooksForEvent(ctx context.Context, event string) ([]*types.Webhook, error) {
+	webhooks, err := s.findWebhooks(ctx, `active = ?`, true)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(webhooks, func(webhook *types.Webhook) bool {
+		return !slices.Contains(webhook.Events, event) && !slices.Contains(webhook.Events, types.WebhookAllEvents)
+	}), nil
+}
+
+func (s *SQLWebhookStore) findWebhooks(ctx context.Context, where string, args ...any) ([]*types.Webhook, error) {
+	rows, err := s.query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []*types.Webhook{}
+	for rows.Next() {
+		var (
+			webhook              types.Webhook
+			id, events           string
+			createdAt, updatedAt int64
+		)
+		if err := rows.Scan(&id, &webhook.URL, &webhook.Secret, &events, &webhook.Active, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		if webhook.ID, err = scanID(id); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, err
+		}
+		webhook.CreatedAt, webhook.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+		webhooks = append(webhooks, &webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *SQLWebhookStore) UpdateWebhook(ctx context.Context, id primitive.ObjectID, params types.UpdateWebhookParams) error {
+	set := params.ToBSON()
+	if events, ok := set["events"]; ok {
+		b, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		set["events"] = string(b)
+	}
+	sets, args, err := setColumns(set, webhookFields)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE webhooks SET `+sets+` WHERE id = ?`, append(args, id.Hex())...)
+	return matchedOne(res, err)
+}
+
+func (s *SQLWebhookStore) DeleteWebhook(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx sqlTx) error {
+		res, err := tx.exec(ctx, `DELETE FROM webhooks WHERE id = ?`, oid.Hex())
+		if err := matchedOne(res, err); err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `DELETE FROM webhook_deliveries WHERE webhook = ?`, oid.Hex())
+		return err
+	})
+}
+
+func (s *SQLWebhookStore) InsertDelivery(ctx context.Context, delivery *types.WebhookDelivery) (*types.WebhookDelivery, error) {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	attempts := delivery.Attempts
+	if attempts == nil {
+		attempts = []types.DeliveryAttempt{}
+	}
+	b, err := json.Marshal(attempts)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.exec(ctx, `INSERT INTO webhook_deliveries (`+deliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID.Hex(), delivery.Webhook.Hex(), delivery.Event, delivery.Payload, delivery.Status, string(b),
+		millis(delivery.CreatedAt), millis(delivery.UpdatedAt))
+	if err != nil {
+		return nil, s.insertError(err)
+	}
+	return delivery, nil
+}
+
+func (s *SQLWebhookStore) GetDelivery(ctx context.Context, id string) (*types.WebhookDelivery, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := scanDelivery(s.queryRow(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, oid.Hex()))
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrNotFound
+	}
+	return delivery, nil
+}
+
+func (s *SQLWebhookStore) GetDeliveries(ctx context.Context, webhookID string, page int64, limit int64) ([]*types.WebhookDelivery, error) {
+	oid, err := parseID(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook = ?
+		ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, oid.Hex(), limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []*types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLWebhookStore) RecordAttempt(ctx context.Context, id primitive.ObjectID, status string, attempt types.DeliveryAttempt) error {
+	return s.inTx(ctx, func(tx sqlTx) error {
+		var attempts string
+		err := tx.queryRow(ctx, `SELECT attempts FROM webhook_deliveries WHERE id = ?`+s.dialect.forUpdate, id.Hex()).Scan(&attempts)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var log []types.DeliveryAttempt
+		if err := json.Unmarshal([]byte(attempts), &log); err != nil {
+			return err
+		}
+		b, err := json.Marshal(append(log, attempt))
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, updated_at = ? WHERE id = ?`,
+			status, string(b), millis(time.Now()), id.Hex())
+		return err
+	})
+}
+
+func (s *SQLWebhookStore) ResetDelivery(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := s.exec(ctx, `UPDATE webhook_deliveries SET status = ?, updated_at = ? WHERE id = ?`,
+		types.DeliveryPending, millis(time.Now()), oid.Hex())
+	return matchedOne(res, err)
+}
+
+// scanDelivery scans a delivery from row, or returns nil if row is an
+// *sql.Row that matched nothing.
+func scanDelivery(row interface{ Scan(...any) error }) (*types.WebhookDelivery, error) {
+	var (
+		delivery             types.WebhookDelivery
+		id, webhook          string
+		attempts             string
+		createdAt, updatedAt int64
+	)
+	err := row.Scan(&id, &webhook, &delivery.Event, &delivery.Payload, &delivery.Status, &attempts, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if delivery.ID, err = scanID(id); err != nil {
+		return nil, err
+	}
+	if delivery.Webhook, err = scanID(webhook); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(attempts), &delivery.Attempts); err != nil {
+		return nil, err
+	}
+	delivery.CreatedAt, delivery.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+	return &delivery, nil
+}
@@ -0,0 +1,422 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"net/url"
+	"strings"
+)
+
+// SQLitePathEnvName names the database file of the sqlite backend. It is
+// created, with its schema, on first start.
+const SQLitePathEnvName = "SQLITE_PATH"
+
+var sqliteDialect = &sqlDialect{
+	name: "sqlite",
+	isDuplicate: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) &&
+			(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE)
+	},
+	migrations: []string{
+		`CREATE TABLE users (
+			id             TEXT PRIMARY KEY,
+			first_name     TEXT NOT NULL,
+			last_name      TEXT NOT NULL,
+			email          TEXT NOT NULL,
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			password       TEXT NOT NULL,
+			fcm_token      TEXT NOT NULL DEFAULT '',
+			language       TEXT NOT NULL,
+			time_zone      TEXT NOT NULL,
+			notifications  TEXT NOT NULL,
+			digest         TEXT NOT NULL,
+			last_digest_at BIGINT NOT NULL
+		);
+		CREATE INDEX users_email ON users (email);
+		CREATE INDEX users_digest ON users (digest, last_digest_at);
+		CREATE INDEX users_fcm_token ON users (fcm_token) WHERE fcm_token <> '';
+
+		CREATE TABLE user_devices (
+			token         TEXT PRIMARY KEY,
+			user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			platform      TEXT NOT NULL,
+			app_version   TEXT NOT NULL,
+			last_seen     BIGINT NOT NULL,
+			registered_at BIGINT NOT NULL
+		);
+		CREATE INDEX user_devices_user_id ON user_devices (user_id);
+
+		CREATE TABLE user_friends (
+			user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			friend_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			added_at  BIGINT NOT NULL,
+			PRIMARY KEY (user_id, friend_id)
+		);
+		CREATE INDEX user_friends_friend_id ON user_friends (friend_id);
+
+		CREATE TABLE posts (
+			id         TEXT PRIMARY KEY,
+			content    TEXT NOT NULL,
+			author     TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			kind       TEXT NOT NULL,
+			repost_of  TEXT,
+			tags       TEXT NOT NULL,
+			reactions  BIGINT NOT NULL DEFAULT 0,
+			comments   BIGINT NOT NULL DEFAULT 0,
+			views      BIGINT NOT NULL DEFAULT 0,
+			reposts    BIGINT NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX posts_author ON posts (author, created_at);
+		CREATE INDEX posts_created_at ON posts (created_at);
+
+		-- The full-text indexes hold no copy of the text; triggers keep them
+		-- in step with the tables they index.
+		CREATE VIRTUAL TABLE posts_fts USING fts5(
+			content, content = 'posts', content_rowid = 'rowid', tokenize = 'porter unicode61'
+		);
+		CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+			INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;
+		CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		END;
+		CREATE TRIGGER posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+			INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;
+
+		CREATE VIRTUAL TABLE users_fts USING fts5(
+			first_name, last_name, content = 'users', content_rowid = 'rowid', tokenize = 'porter unicode61'
+		);
+		CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+			INSERT INTO users_fts (rowid, first_name, last_name) VALUES (new.rowid, new.first_name, new.last_name);
+		END;
+		CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+			INSERT INTO users_fts (users_fts, rowid, first_name, last_name) VALUES ('delete', old.rowid, old.first_name, old.last_name);
+		END;
+		CREATE TRIGGER users_fts_update AFTER UPDATE OF first_name, last_name ON users BEGIN
+			INSERT INTO users_fts (users_fts, rowid, first_name, last_name) VALUES ('delete', old.rowid, old.first_name, old.last_name);
+			INSERT INTO users_fts (rowid, first_name, last_name) VALUES (new.rowid, new.first_name, new.last_name);
+		END;`,
+		// One account per address: fails on databases that already hold
+		// duplicates, which have to be merged by hand first.
+		`DROP INDEX users_email;
+		CREATE UNIQUE INDEX users_email ON users (email);`,
+		`ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+		ALTER TABLE posts ADD COLUMN version BIGINT NOT NULL DEFAULT 1;`,
+		// Posts outlive their author and may name one that does not exist,
+		// as they do in Mongo. SQLite cannot drop a constraint, so the table
+		// is rebuilt, keeping the rowids the full-text index refers to.
+		`CREATE TABLE posts_rebuilt (
+			id         TEXT PRIMARY KEY,
+			content    TEXT NOT NULL,
+			author     TEXT NOT NULL,
+			kind       TEXT NOT NULL,
+			repost_of  TEXT,
+			tags       TEXT NOT NULL,
+			reactions  BIGINT NOT NULL DEFAULT 0,
+			comments   BIGINT NOT NULL DEFAULT 0,
+			views      BIGINT NOT NULL DEFAULT 0,
+			reposts    BIGINT NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			version    BIGINT NOT NULL DEFAULT 1
+		);
+		INSERT INTO posts_rebuilt (rowid, id, content, author, kind, repost_of, tags, reactions, comments, views, reposts, created_at, updated_at, version)
+			SELECT rowid, id, content, author, kind, repost_of, tags, reactions, comments, views, reposts, created_at, updated_at, version FROM posts;
+		DROP TABLE posts;
+		ALTER TABLE posts_rebuilt RENAME TO posts;
+		CREATE INDEX posts_author ON posts (author, created_at);
+		CREATE INDEX posts_created_at ON posts (created_at);
+		CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+			INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;
+		CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		END;
+		CREATE TRIGGER posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+			INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;`,
+		// The stores besides users and posts, so that a SQL backend needs no
+		// Mongo.
+		`CREATE TABLE bookmarks (
+			user_id    TEXT NOT NULL,
+			post_id    TEXT NOT NULL,
+			id         TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, post_id)
+		);
+		CREATE INDEX bookmarks_user_created_at ON bookmarks (user_id, created_at);
+		CREATE INDEX bookmarks_post_id ON bookmarks (post_id);
+
+		CREATE TABLE reading_lists (
+			id         TEXT PRIMARY KEY,
+			owner      TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			private    BOOLEAN NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX reading_lists_owner ON reading_lists (owner, created_at);
+
+		CREATE TABLE reading_list_posts (
+			list_id  TEXT NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+			post_id  TEXT NOT NULL,
+			position BIGINT NOT NULL,
+			PRIMARY KEY (list_id, post_id)
+		);
+		CREATE INDEX reading_list_posts_post_id ON reading_list_posts (post_id);
+
+		CREATE TABLE jobs (
+			id           TEXT PRIMARY KEY,
+			type         TEXT NOT NULL,
+			payload      TEXT NOT NULL,
+			status       TEXT NOT NULL,
+			attempts     BIGINT NOT NULL,
+			max_attempts BIGINT NOT NULL,
+			last_error   TEXT NOT NULL,
+			run_at       BIGINT NOT NULL,
+			locked_until BIGINT NOT NULL,
+			created_at   BIGINT NOT NULL,
+			updated_at   BIGINT NOT NULL
+		);
+		CREATE INDEX jobs_status_run_at ON jobs (status, run_at);
+		CREATE INDEX jobs_status_locked_until ON jobs (status, locked_until);
+		CREATE INDEX jobs_status_created_at ON jobs (status, created_at);
+
+		CREATE TABLE notifications (
+			id          TEXT PRIMARY KEY,
+			recipient   TEXT NOT NULL,
+			type        TEXT NOT NULL,
+			group_key   TEXT NOT NULL,
+			post_id     TEXT,
+			excerpt     TEXT NOT NULL,
+			actors      TEXT NOT NULL,
+			actor_ids   TEXT NOT NULL,
+			actor_count BIGINT NOT NULL,
+			read        BOOLEAN NOT NULL,
+			created_at  BIGINT NOT NULL,
+			updated_at  BIGINT NOT NULL
+		);
+		-- at most one unread notification per group
+		CREATE UNIQUE INDEX notifications_unread_group ON notifications (recipient, group_key) WHERE NOT read;
+		CREATE INDEX notifications_recipient ON notifications (recipient, read, updated_at);
+
+		CREATE TABLE used_tokens (
+			id         TEXT PRIMARY KEY,
+			expires_at BIGINT NOT NULL
+		);
+		CREATE INDEX used_tokens_expires_at ON used_tokens (expires_at);
+
+		CREATE TABLE webhooks (
+			id         TEXT PRIMARY KEY,
+			url        TEXT NOT NULL,
+			secret     TEXT NOT NULL,
+			events     TEXT NOT NULL,
+			active     BOOLEAN NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE webhook_deliveries (
+			id         TEXT PRIMARY KEY,
+			webhook    TEXT NOT NULL,
+			event      TEXT NOT NULL,
+			payload    TEXT NOT NULL,
+			status     TEXT NOT NULL,
+			attempts   TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook, created_at);`,
+		// Post visibility and blocked users.
+		`ALTER TABLE posts ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+
+		CREATE TABLE user_blocks (
+			user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			blocked_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			added_at   BIGINT NOT NULL,
+			PRIMARY KEY (user_id, blocked_id)
+		);
+		CREATE INDEX user_blocks_blocked_id ON user_blocks (blocked_id);`,
+		// Reposts by original.
+		`CREATE INDEX posts_repost_of ON posts (repost_of, author) WHERE repost_of IS NOT NULL;`,
+		// One repost of a post per user; quotes are not limited.
+		`DROP INDEX posts_repost_of;
+		CREATE UNIQUE INDEX posts_repost_of ON posts (repost_of, author) WHERE kind = 'repost';`,
+	},
+}
+
+// OpenSQLite opens the SQLite database at path, creating the file if needed,
+// and migrates its schema to the latest version. The driver is pure Go and
+// comes with FTS5, so it needs neither cgo nor build tags.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%s is not set", SQLitePathEnvName)
+	}
+	params := url.Values{
+		"_pragma": {"foreign_keys(1)", "journal_mode(WAL)", "busy_timeout(5000)"},
+	}
+	sqlDB, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite takes one writer at a time anyway; a single connection keeps
+	// transactions from waiting on each other's locks.
+	sqlDB.SetMaxOpenConns(1)
+	if err := sqliteDialect.migrate(ctx, sqlDB); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return sqlDB, nil
+}
+
+func NewSQLiteUserStore(sqlDB *sql.DB) *SQLUserStore {
+	return &SQLUserStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLitePostStore(sqlDB *sql.DB) *SQLPostStore {
+	return &SQLPostStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLiteBookmarkStore(sqlDB *sql.DB) *SQLBookmarkStore {
+	return &SQLBookmarkStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLiteJobStore(sqlDB *sql.DB) *SQLJobStore {
+	return &SQLJobStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLiteNotificationStore(sqlDB *sql.DB) *SQLNotificationStore {
+	return &SQLNotificationStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLiteTokenStore(sqlDB *sql.DB) *SQLTokenStore {
+	return &SQLTokenStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func NewSQLiteWebhookStore(sqlDB *sql.DB) *SQLWebhookStore {
+	return &SQLWebhookStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+// SQLiteSearchStore answers searches from the FTS5 indexes of posts and
+// users. Like Mongo's text search, a document matches if it has any of the
+// query's terms, and ranks higher the more it has.
+type SQLiteSearchStore struct {
+	sqlStore
+}
+
+func NewSQLiteSearchStore(sqlDB *sql.DB) *SQLiteSearchStore {
+	return &SQLiteSearchStore{sqlStore{db: sqlDB, dialect: sqliteDialect}}
+}
+
+func (s *SQLiteSearchStore) Search(ctx context.Context, params types.SearchParams) (*types.SearchResult, error) {
+	result := &types.SearchResult{
+		Query: params.Query,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Posts: []*types.PostHit{},
+		Users: []*types.UserHit{},
+	}
+	terms := types.SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return result, nil
+	}
+	match := ftsMatch(terms)
+	if params.Type != types.SearchTypeUsers {
+		if err := s.searchPosts(ctx, params, match, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	if params.Type != types.SearchTypePosts {
+		if err := s.searchUsers(ctx, params, match, terms, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ftsMatch builds an FTS5 query matching any of terms. Each term is quoted,
+// so nothing in a user's query is taken as FTS5 syntax.
+func ftsMatch(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " OR ")
+}
+
+func (s *SQLiteSearchStore) searchPosts(ctx context.Context, params types.SearchParams, match string, terms []string, result *types.SearchResult) error {
+	where, args := searchFilter(params).where()
+	args = append([]any{match}, args...)
+	// posts_fts has only a content column, so the filter's columns need no
+	// table name.
+	from := `posts_fts JOIN posts ON posts.rowid = posts_fts.rowid WHERE posts_fts MATCH ? AND ` + where
+	if err := s.queryRow(ctx, `SELECT COUNT(*) FROM `+from, args...).Scan(&result.TotalPosts); err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, `SELECT `+qualified("posts", postColumns)+`, -bm25(posts_fts) AS score FROM `+from+`
+		ORDER BY score DESC, posts.created_at DESC LIMIT ? OFFSET ?`,
+		append(args, params.Limit, params.Skip())...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var score float64
+		post, err := scanPost(rows, &score)
+		if err != nil {
+			return err
+		}
+		result.Posts = append(result.Posts, &types.PostHit{
+			Post:       post,
+			Score:      score,
+			Highlights: types.Highlight(post.Content, terms),
+		})
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteSearchStore) searchUsers(ctx context.Context, params types.SearchParams, match string, terms []string, result *types.SearchResult) error {
+	visible, args := unhidden(`users.id`, params.Viewer)
+	from := `users_fts JOIN users ON users.rowid = users_fts.rowid WHERE users_fts MATCH ? AND ` + visible
+	args = append([]any{match}, args...)
+	if err := s.queryRow(ctx, `SELECT COUNT(*) FROM `+from, args...).Scan(&result.TotalUsers); err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, `SELECT users.id, users.first_name, users.last_name, -bm25(users_fts) AS score FROM `+from+`
+		ORDER BY score DESC, users.id LIMIT ? OFFSET ?`,
+		append(args, params.Limit, params.Skip())...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			user  types.UserSummary
+			id    string
+			score float64
+		)
+		if err := rows.Scan(&id, &user.FirstName, &user.LastName, &score); err != nil {
+			return err
+		}
+		if user.ID, err = scanID(id); err != nil {
+			return err
+		}
+		result.Users = append(result.Users, &types.UserHit{
+			User:       &user,
+			Score:      score,
+			Highlights: types.Highlight(user.FirstName+" "+user.LastName, terms),
+		})
+	}
+	return rows.Err()
+}
@@ -0,0 +1,150 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/db/dbtest"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStores(t *testing.T) {
+	dbtest.Run(t, db.Store{User: db.NewMemoryUserStore(), Post: db.NewMemoryPostStore()})
+}
+
+func TestSQLiteStores(t *testing.T) {
+	sqlDB, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	dbtest.Run(t, db.Store{
+		User:         db.NewSQLiteUserStore(sqlDB),
+		Post:         db.NewSQLitePostStore(sqlDB),
+		Bookmark:     db.NewSQLiteBookmarkStore(sqlDB),
+		Job:          db.NewSQLiteJobStore(sqlDB),
+		Notification: db.NewSQLiteNotificationStore(sqlDB),
+		Token:        db.NewSQLiteTokenStore(sqlDB),
+		Webhook:      db.NewSQLiteWebhookStore(sqlDB),
+	})
+}
+
+// TestPostgresStores runs in a scratch schema of the database at
+// POSTGRES_URL, which is dropped afterwards.
+func TestPostgresStores(t *testing.T) {
+	base := os.Getenv(db.PostgresURLEnvName)
+	if len(base) == 0 {
+		t.Skipf("%s is not set", db.PostgresURLEnvName)
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("postgres", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if err := pingWithin(ctx, admin.PingContext); err != nil {
+		t.Skipf("postgres is unreachable: %v", err)
+	}
+	schema := "dbtest_" + primitive.NewObjectID().Hex()
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	sqlDB, err := db.OpenPostgres(ctx, u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	dbtest.Run(t, db.Store{
+		User:         db.NewPostgresUserStore(sqlDB),
+		Post:         db.NewPostgresPostStore(sqlDB),
+		Bookmark:     db.NewPostgresBookmarkStore(sqlDB),
+		Job:          db.NewPostgresJobStore(sqlDB),
+		Notification: db.NewPostgresNotificationStore(sqlDB),
+		Token:        db.NewPostgresTokenStore(sqlDB),
+		Webhook:      db.NewPostgresWebhookStore(sqlDB),
+	})
+	t.Run("search by tag", func(t *testing.T) { testPostgresSearchTags(t, sqlDB) })
+}
+
+// testPostgresSearchTags checks that a post is found by a tag missing from
+// its content.
+func testPostgresSearchTags(t *testing.T, sqlDB *sql.DB) {
+	ctx := context.Background()
+	post := types.NewPostFromParams(types.CreatePostParams{Content: "Notes from the meetup", Author: primitive.NewObjectID().Hex()})
+	post.Tags = []string{"golang"}
+	post, err := db.NewPostgresPostStore(sqlDB).InsertPost(ctx, post)
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	res, err := db.NewPostgresSearchStore(sqlDB).Search(ctx, types.SearchParams{Query: "golang", Type: types.SearchTypePosts, Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if res.TotalPosts != 1 || len(res.Posts) != 1 || res.Posts[0].Post.ID != post.ID {
+		t.Errorf("Search(golang): got %d posts, want the tagged one", res.TotalPosts)
+	}
+}
+
+// TestMongoStores runs in a scratch database on the server at MONGO_DB_URL,
+// which is dropped afterwards.
+func TestMongoStores(t *testing.T) {
+	endpoint := os.Getenv("MONGO_DB_URL")
+	if len(endpoint) == 0 {
+		t.Skip("MONGO_DB_URL is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(endpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(ctx) })
+	ping := func(ctx context.Context) error { return client.Ping(ctx, nil) }
+	if err := pingWithin(ctx, ping); err != nil {
+		t.Skipf("mongo is unreachable: %v", err)
+	}
+	scratch := "dbtest_" + primitive.NewObjectID().Hex()
+	t.Setenv(db.MongoDBNameEnvName, scratch)
+	t.Cleanup(func() {
+		if err := client.Database(scratch).Drop(ctx); err != nil {
+			t.Errorf("dropping %s: %v", scratch, err)
+		}
+	})
+	if _, err := db.NewMongoMigrator(client).Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Run(t, db.Store{
+		User:         db.NewMongoUserStore(client),
+		Post:         db.NewMongoPostStore(client),
+		Bookmark:     db.NewMongoBookmarkStore(client),
+		Job:          db.NewMongoJobStore(client),
+		Notification: db.NewMongoNotificationStore(client),
+		Token:        db.NewMongoTokenStore(client),
+		Webhook:      db.NewMongoWebhookStore(client),
+	})
+}
+
+func pingWithin(ctx context.Context, ping func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	return ping(ctx)
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"time"
+)
+
+const usedTokenColl = "used_tokens"
+
+var ErrTokenUsed = errors.New("token already used")
+
+// TokenStore remembers which single-use tokens have been redeemed.
+type TokenStore interface {
+	// UseToken marks the token with the given ID as redeemed, or returns
+	// ErrTokenUsed if it already was. The record may be forgotten once the
+	// token expires.
+	UseToken(ctx context.Context, id string, expires time.Time) error
+}
+
+type MongoTokenStore struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+}
+
+func NewMongoTokenStore(client *mongo.Client) *MongoTokenStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoTokenStore{
+		client: client,
+		coll:   client.Database(dbname).Collection(usedTokenColl),
+	}
+}
+
+func (s *MongoTokenStore) UseToken(ctx context.Context, id string, expires time.Time) error {
+	_, err := s.coll.InsertOne(ctx, bson.M{"_id": id, "expires_at": expires})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTokenUsed
+	}
+	return err
+}
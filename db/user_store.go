@@ -6,7 +6,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"os"
+	"slices"
+	"time"
 )
 
 const userColl = "users"
@@ -14,13 +17,50 @@ const userColl = "users"
 type UserStore interface {
 	GetUser(context.Context, string) (*types.User, error)
 	GetUserByObjectID(context.Context, primitive.ObjectID) (*types.User, error)
+	GetUserByEmail(context.Context, string) (*types.User, error)
+	// GetUsersByIDs returns the users with the given IDs in one query,
+	// leaving out those that do not exist. Given fields, the top-level bson
+	// names of types.User fields, it loads only those and the ID.
+	GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID, fields ...string) ([]*types.User, error)
 
-	UpdateUser(ctx context.Context, filter Map, params types.UpdateUserParams) error
-	DeleteUser(context.Context, string) error
+	// UpdateUser updates the first user filter selects. It returns
+	// ErrConflict if the new email belongs to another user. Like every
+	// other change but ClaimDigest, it moves the user to the next version.
+	UpdateUser(ctx context.Context, filter UserFilter, params types.UpdateUserParams) error
+	// DeleteUser deletes the user, on condition that they are at version
+	// unless version is 0.
+	DeleteUser(ctx context.Context, id string, version int64) error
+	// InsertUser stores user at version 1, unless they have one already. It
+	// returns ErrConflict if the user's ID or email is taken.
 	InsertUser(context.Context, *types.User) (*types.User, error)
 	GetUsers(context.Context) ([]*types.User, error)
-	AddFriend(context.Context, Map, string, string) error
-	RemoveFriend(context.Context, Map, string, string) error
+	// AddFriend adds friend to the friends of the first user filter selects.
+	AddFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error
+	RemoveFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error
+	// BlockUser adds blocked to the users the first user filter selects
+	// blocks.
+	BlockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error
+	UnblockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error
+	// GetViewer returns what the user may see: who lists them as a friend,
+	// and who they block or are blocked by.
+	GetViewer(ctx context.Context, id primitive.ObjectID) (*types.Viewer, error)
+	UpsertDevice(ctx context.Context, userID string, device types.Device) error
+	RemoveDevice(ctx context.Context, userID string, token string) error
+	RemoveDeviceTokens(ctx context.Context, tokens []string) error
+	// GetUsersByDeviceTokens returns the users any of tokens is registered
+	// to, as a device or as their legacy FCM token.
+	GetUsersByDeviceTokens(ctx context.Context, tokens []string) ([]*types.User, error)
+	UpdateNotificationSettings(ctx context.Context, userID string, settings types.NotificationSettings) error
+	// MarkEmailVerified marks email verified if it is still the user's
+	// address, or returns ErrNotFound.
+	MarkEmailVerified(ctx context.Context, userID string, email string) error
+	// GetDigestDue returns the users on the given digest frequency whose
+	// last digest went out before sentBefore.
+	GetDigestDue(ctx context.Context, frequency string, sentBefore time.Time) ([]*types.User, error)
+	// ClaimDigest records that a digest goes out to the user at now, unless
+	// another worker already did since sentBefore. It reports whether the
+	// claim succeeded.
+	ClaimDigest(ctx context.Context, userID primitive.ObjectID, sentBefore time.Time, now time.Time) (bool, error)
 }
 
 type MongoUserStore struct {
@@ -36,36 +76,44 @@ func NewMongoUserStore(client *mongo.Client) *MongoUserStore {
 	}
 }
 
-func (s *MongoUserStore) UpdateUser(ctx context.Context, filter Map, params types.UpdateUserParams) error {
-	oid, err := primitive.ObjectIDFromHex(filter["_id"].(string))
-	if err != nil {
-		return err
+func (s *MongoUserStore) UpdateUser(ctx context.Context, filter UserFilter, params types.UpdateUserParams) error {
+	if filter.IsZero() {
+		return errEmptyFilter
 	}
-	filter["_id"] = oid
-	update := bson.M{"$set": params.ToBSON()}
-	_, err = s.coll.UpdateOne(ctx, filter, update)
+	update := bson.M{"$set": params.ToBSON(), "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
 	if err != nil {
-		return err
+		return mongoError(err)
+	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
 	}
 	return nil
 }
 
-func (s *MongoUserStore) DeleteUser(ctx context.Context, id string) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+func (s *MongoUserStore) DeleteUser(ctx context.Context, id string, version int64) error {
+	oid, err := parseID(id)
 	if err != nil {
 		return err
 	}
-	_, err = s.coll.DeleteOne(ctx, bson.M{"_id": oid})
+	filter := UserFilter{ID: oid, Version: version}.bson()
+	res, err := s.coll.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
 	}
+	if res.DeletedCount == 0 {
+		return notMatched(ctx, s.coll, filter)
+	}
 	return nil
 }
 
 func (s *MongoUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if user.Version == 0 {
+		user.Version = 1
+	}
 	res, err := s.coll.InsertOne(ctx, user)
 	if err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 	user.ID = res.InsertedID.(primitive.ObjectID)
 	return user, nil
@@ -84,13 +132,13 @@ func (s *MongoUserStore) GetUsers(ctx context.Context) ([]*types.User, error) {
 }
 
 func (s *MongoUserStore) GetUser(ctx context.Context, id string) (*types.User, error) {
-	oid, err := primitive.ObjectIDFromHex(id)
+	oid, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
 	var user types.User
 	if err := s.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&user); err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 	return &user, nil
 }
@@ -98,47 +146,304 @@ func (s *MongoUserStore) GetUserByObjectID(ctx context.Context, id primitive.Obj
 
 	var user types.User
 	if err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 	return &user, nil
 }
-func (s *MongoUserStore) AddFriend(ctx context.Context, filter Map, id string, userID string) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+
+func (s *MongoUserStore) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID, fields ...string) ([]*types.User, error) {
+	users := []*types.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	opts := options.Find()
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for _, field := range fields {
+			projection[field] = 1
+		}
+		opts.SetProjection(projection)
+	}
+	cur, err := s.coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *MongoUserStore) AddFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	n, err := s.coll.CountDocuments(ctx, bson.M{"_id": friend})
 	if err != nil {
 		return err
 	}
-	uid, err := primitive.ObjectIDFromHex(userID)
+	if n == 0 {
+		return ErrNotFound
+	}
+	update := bson.M{"$addToSet": bson.M{"friends": friend}, "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
+	}
+	return nil
+}
 
-	filter["_id"] = oid
+func (s *MongoUserStore) RemoveFriend(ctx context.Context, filter UserFilter, friend primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	update := bson.M{"$pull": bson.M{"friends": friend}, "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
+	}
+	return nil
+}
+
+func (s *MongoUserStore) BlockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	n, err := s.coll.CountDocuments(ctx, bson.M{"_id": blocked})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	update := bson.M{"$addToSet": bson.M{"blocked": blocked}, "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
+	}
+	return nil
+}
+
+func (s *MongoUserStore) UnblockUser(ctx context.Context, filter UserFilter, blocked primitive.ObjectID) error {
+	if filter.IsZero() {
+		return errEmptyFilter
+	}
+	update := bson.M{"$pull": bson.M{"blocked": blocked}, "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, filter.bson(), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return notMatched(ctx, s.coll, filter.bson())
+	}
+	return nil
+}
+
+func (s *MongoUserStore) GetViewer(ctx context.Context, id primitive.ObjectID) (*types.Viewer, error) {
+	var user struct {
+		Blocked []primitive.ObjectID `bson:"blocked"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"blocked": 1})
+	if err := s.coll.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&user); err != nil {
+		return nil, mongoError(err)
+	}
+	viewer := &types.Viewer{ID: id, Hidden: user.Blocked}
+	related := []struct {
+		field string
+		ids   *[]primitive.ObjectID
+	}{
+		{"friends", &viewer.FriendOf},
+		{"blocked", &viewer.Hidden},
+	}
+	for _, r := range related {
+		cur, err := s.coll.Find(ctx, bson.M{r.field: id}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return nil, err
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.All(ctx, &docs); err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if !slices.Contains(*r.ids, doc.ID) {
+				*r.ids = append(*r.ids, doc.ID)
+			}
+		}
+	}
+	return viewer, nil
+}
+
+// UpsertDevice registers device for the user, refreshing it if the token is
+// already registered. A token belongs to one user at a time, so it is first
+// removed from any other user.
+func (s *MongoUserStore) UpsertDevice(ctx context.Context, userID string, device types.Device) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.coll.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$ne": oid}, "devices.token": device.Token},
+		bson.M{"$pull": bson.M{"devices": bson.M{"token": device.Token}}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": oid, "devices.token": device.Token},
+		bson.M{"$set": bson.M{"devices.$": device}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	res, err = s.coll.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$push": bson.M{"devices": device}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
-	update := bson.M{"$addToSet": bson.M{"friends": uid}}
+func (s *MongoUserStore) RemoveDevice(ctx context.Context, userID string, token string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"devices": bson.M{"token": token}}, "$inc": bson.M{"version": 1}}
+	res, err := s.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.coll.UpdateOne(ctx, bson.M{"_id": oid, "fcmToken": token}, bson.M{"$set": bson.M{"fcmToken": ""}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	_, err = s.coll.UpdateOne(ctx, filter, update)
+// RemoveDeviceTokens unregisters the given tokens from every user.
+func (s *MongoUserStore) RemoveDeviceTokens(ctx context.Context, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"devices.token": bson.M{"$in": tokens}},
+		bson.M{"$pull": bson.M{"devices": bson.M{"token": bson.M{"$in": tokens}}}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	_, err = s.coll.UpdateMany(ctx,
+		bson.M{"fcmToken": bson.M{"$in": tokens}},
+		bson.M{"$set": bson.M{"fcmToken": ""}, "$inc": bson.M{"version": 1}})
 	if err != nil {
 		return err
 	}
 	return nil
 }
-func (s *MongoUserStore) RemoveFriend(ctx context.Context, filter Map, id string, userID string) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+
+func (s *MongoUserStore) GetUsersByDeviceTokens(ctx context.Context, tokens []string) ([]*types.User, error) {
+	users := []*types.User{}
+	if len(tokens) == 0 {
+		return users, nil
+	}
+	cur, err := s.coll.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"devices.token": bson.M{"$in": tokens}},
+		bson.M{"fcmToken": bson.M{"$in": tokens}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *MongoUserStore) UpdateNotificationSettings(ctx context.Context, userID string, settings types.NotificationSettings) error {
+	oid, err := parseID(userID)
 	if err != nil {
 		return err
 	}
-	uid, err := primitive.ObjectIDFromHex(userID)
+	if settings.Events == nil {
+		settings.Events = map[string]types.ChannelPreference{}
+	}
+	res, err := s.coll.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"notifications": settings}, "$inc": bson.M{"version": 1}})
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func digestDueFilter(sentBefore time.Time) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"last_digest_at": bson.M{"$lt": sentBefore}},
+		bson.M{"last_digest_at": bson.M{"$exists": false}},
+	}}
+}
+
+func (s *MongoUserStore) GetDigestDue(ctx context.Context, frequency string, sentBefore time.Time) ([]*types.User, error) {
+	filter := digestDueFilter(sentBefore)
+	filter["notifications.digest"] = frequency
+	cur, err := s.coll.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	users := []*types.User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
 
-	filter["_id"] = oid
+func (s *MongoUserStore) ClaimDigest(ctx context.Context, userID primitive.ObjectID, sentBefore time.Time, now time.Time) (bool, error) {
+	filter := digestDueFilter(sentBefore)
+	filter["_id"] = userID
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_digest_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
 
-	update := bson.M{"$pull": bson.M{"friends": uid}}
+func (s *MongoUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	var user types.User
+	if err := s.coll.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil, mongoError(err)
+	}
+	return &user, nil
+}
 
-	_, err = s.coll.UpdateOne(ctx, filter, update)
+func (s *MongoUserStore) MarkEmailVerified(ctx context.Context, userID string, email string) error {
+	oid, err := parseID(userID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": oid, "email": email}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"emailVerified": true}, "$inc": bson.M{"version": 1}})
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"time"
+)
+
+const (
+	webhookColl  = "webhooks"
+	deliveryColl = "webhook_deliveries"
+)
+
+type WebhookStore interface {
+	InsertWebhook(context.Context, *types.Webhook) (*types.Webhook, error)
+	GetWebhook(context.Context, string) (*types.Webhook, error)
+	GetWebhooks(context.Context) ([]*types.Webhook, error)
+	// GetWebhooksForEvent returns the active webhooks subscribed to event.
+	GetWebhooksForEvent(ctx context.Context, event string) ([]*types.Webhook, error)
+	UpdateWebhook(ctx context.Context, id primitive.ObjectID, params types.UpdateWebhookParams) error
+	DeleteWebhook(context.Context, string) error
+
+	InsertDelivery(context.Context, *types.WebhookDelivery) (*types.WebhookDelivery, error)
+	GetDelivery(context.Context, string) (*types.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, webhookID string, page int64, limit int64) ([]*types.WebhookDelivery, error)
+	// RecordAttempt appends attempt to the delivery's log and sets its status.
+	RecordAttempt(ctx context.Context, id primitive.ObjectID, status string, attempt types.DeliveryAttempt) error
+	// ResetDelivery marks a delivery pending again so it can be replayed.
+	ResetDelivery(context.Context, string) error
+}
+
+type MongoWebhookStore struct {
+	client     *mongo.Client
+	webhooks   *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewMongoWebhookStore(client *mongo.Client) *MongoWebhookStore {
+	dbname := os.Getenv(MongoDBNameEnvName)
+	return &MongoWebhookStore{
+		client:     client,
+		webhooks:   client.Database(dbname).Collection(webhookColl),
+		deliveries: client.Database(dbname).Collection(deliveryColl),
+	}
+}
+
+func (s *MongoWebhookStore) InsertWebhook(ctx context.Context, webhook *types.Webhook) (*types.Webhook, error) {
+	res, err := s.webhooks.InsertOne(ctx, webhook)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	webhook.ID = res.InsertedID.(primitive.ObjectID)
+	return webhook, nil
+}
+
+func (s *MongoWebhookStore) GetWebhook(ctx context.Context, id string) (*types.Webhook, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var webhook types.Webhook
+	if err := s.webhooks.FindOne(ctx, bson.M{"_id": oid}).Decode(&webhook); err != nil {
+		return nil, mongoError(err)
+	}
+	return &webhook, nil
+}
+
+func (s *MongoWebhookStore) GetWebhooks(ctx context.Context) ([]*types.Webhook, error) {
+	return s.findWebhooks(ctx, bson.M{})
+}
+
+func (s *MongoWebhookStore) GetWebhooksForEvent(ctx context.Context, event string) ([]*types.Webhook, error) {
+	filter := bson.M{
+		"active": true,
+		"events": bson.M{"$in": bson.A{event, types.WebhookAllEvents}},
+	}
+	return s.findWebhooks(ctx, filter)
+}
+
+func (s *MongoWebhookStore) findWebhooks(ctx context.Context, filter bson.M) ([]*types.Webhook, error) {
+	cur, err := s.webhooks.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []*types.Webhook{}
+	if err := cur.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *MongoWebhookStore) UpdateWebhook(ctx context.Context, id primitive.ObjectID, params types.UpdateWebhookParams) error {
+	res, err := s.webhooks.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": params.ToBSON()})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoWebhookStore) DeleteWebhook(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := s.webhooks.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.deliveries.DeleteMany(ctx, bson.M{"webhook": oid})
+	return err
+}
+
+func (s *MongoWebhookStore) InsertDelivery(ctx context.Context, delivery *types.WebhookDelivery) (*types.WebhookDelivery, error) {
+	res, err := s.deliveries.InsertOne(ctx, delivery)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	delivery.ID = res.InsertedID.(primitive.ObjectID)
+	return delivery, nil
+}
+
+func (s *MongoWebhookStore) GetDelivery(ctx context.Context, id string) (*types.WebhookDelivery, error) {
+	oid, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var delivery types.WebhookDelivery
+	if err := s.deliveries.FindOne(ctx, bson.M{"_id": oid}).Decode(&delivery); err != nil {
+		return nil, mongoError(err)
+	}
+	return &delivery, nil
+}
+
+func (s *MongoWebhookStore) GetDeliveries(ctx context.Context, webhookID string, page int64, limit int64) ([]*types.WebhookDelivery, error) {
+	oid, err := parseID(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cur, err := s.deliveries.Find(ctx, bson.M{"webhook": oid}, opts)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []*types.WebhookDelivery{}
+	if err := cur.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *MongoWebhookStore) RecordAttempt(ctx context.Context, id primitive.ObjectID, status string, attempt types.DeliveryAttempt) error {
+	update := bson.M{
+		"$set":  bson.M{"status": status, "updated_at": time.Now()},
+		"$push": bson.M{"attempts": attempt},
+	}
+	_, err := s.deliveries.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *MongoWebhookStore) ResetDelivery(ctx context.Context, id string) error {
+	oid, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"status": types.DeliveryPending, "updated_at": time.Now()}}
+	res, err := s.deliveries.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"slices"
+	"time"
+)
+
+const JobDigest = "mail.digest"
+
+// periods maps each digest frequency to the time between digests.
+var periods = map[string]time.Duration{
+	types.DigestDaily:  24 * time.Hour,
+	types.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+type Config struct {
+	// Interval is how often Run looks for users due a digest.
+	Interval time.Duration
+	// MaxPosts caps the posts listed in one digest.
+	MaxPosts int64
+	// Now is the clock used to decide who is due; tests can replace it.
+	Now func() time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval: time.Hour,
+		MaxPosts: 10,
+		Now:      time.Now,
+	}
+}
+
+// Digester emails users who have not opened the app a digest of what their
+// friends posted since their last digest.
+type Digester struct {
+	userStore db.UserStore
+	postStore db.PostStore
+	jobs      queue.Enqueuer
+	sender    mail.Sender
+	links     *mail.Links
+	config    Config
+}
+
+func NewDigester(userStore db.UserStore, postStore db.PostStore, jobs queue.Enqueuer, sender mail.Sender, links *mail.Links, config Config) *Digester {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &Digester{
+		userStore: userStore,
+		postStore: postStore,
+		jobs:      jobs,
+		sender:    sender,
+		links:     links,
+		config:    config,
+	}
+}
+
+// Run calls Sweep every Interval until ctx is done.
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := d.Sweep(ctx); err != nil {
+			log.Printf("digest: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep queues a digest job for every user who is due one. Users are claimed
+// first, so several servers sweeping at once queue each digest only once.
+func (d *Digester) Sweep(ctx context.Context) error {
+	now := d.config.Now()
+	for frequency, period := range periods {
+		sentBefore := now.Add(-period)
+		users, err := d.userStore.GetDigestDue(ctx, frequency, sentBefore)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			claimed, err := d.userStore.ClaimDigest(ctx, user.ID, sentBefore, now)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+			since := user.LastDigestAt
+			if since.IsZero() || since.Before(sentBefore) {
+				since = sentBefore
+			}
+			payload := map[string]string{
+				"user":      user.ID.Hex(),
+				"frequency": frequency,
+				"since":     since.Format(time.RFC3339),
+			}
+			if _, err := d.jobs.Enqueue(ctx, JobDigest, payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleDigest emails the payload's user the posts their friends published
+// since the payload's time, unless the user opened the app since then or there
+// is nothing to tell.
+func (d *Digester) HandleDigest(ctx context.Context, job *types.Job) error {
+	user, err := d.userStore.GetUser(ctx, job.Payload["user"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	since, err := time.Parse(time.RFC3339, job.Payload["since"])
+	if err != nil {
+		return fmt.Errorf("digest since: %w", err)
+	}
+	if !user.EmailVerified || user.Notifications.Digest == types.DigestOff || user.LastSeen().After(since) {
+		return nil
+	}
+	posts, err := d.postStore.GetRecentPostsByAuthors(ctx, user.Friends, since, d.config.MaxPosts)
+	if err != nil {
+		return err
+	}
+	viewer, err := d.userStore.GetViewer(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	posts = slices.DeleteFunc(posts, func(post *types.Post) bool { return !viewer.CanSee(post) })
+	if len(posts) == 0 {
+		return nil
+	}
+	authorIDs := make([]primitive.ObjectID, len(posts))
+	for i, post := range posts {
+		authorIDs[i] = post.Author
+	}
+	found, err := d.userStore.GetUsersByIDs(ctx, authorIDs, "firstName", "lastName")
+	if err != nil {
+		return err
+	}
+	authors := map[primitive.ObjectID]*types.User{}
+	for _, author := range found {
+		authors[author.ID] = author
+	}
+	msg, err := Render(user, job.Payload["frequency"], posts, authors, d.links)
+	if err != nil {
+		return err
+	}
+	return d.sender.Send(ctx, msg)
+}
+
+type translation struct {
+	dailySubject  string
+	weeklySubject string
+	intro         string
+}
+
+var translations = map[string]translation{
+	"en": {
+		dailySubject:  "Your daily digest",
+		weeklySubject: "Your weekly digest",
+		intro:         "Here is what your friends posted while you were away.",
+	},
+	"fa": {
+		dailySubject:  "خلاصه روزانه شما",
+		weeklySubject: "خلاصه هفتگی شما",
+		intro:         "دوستانتان در نبود شما این پست‌ها را منتشر کردند.",
+	},
+}
+
+// Render builds the digest email listing posts for user.
+func Render(user *types.User, frequency string, posts []*types.Post, authors map[primitive.ObjectID]*types.User, links *mail.Links) (mail.Message, error) {
+	lang := user.Language
+	tr, ok := translations[lang]
+	if !ok {
+		lang = types.DefaultLanguage
+		tr = translations[lang]
+	}
+	subject := tr.dailySubject
+	if frequency == types.DigestWeekly {
+		subject = tr.weeklySubject
+	}
+	content := mail.Content{
+		Lang:        lang,
+		Title:       subject,
+		Intro:       tr.intro,
+		Unsubscribe: links.Unsubscribe(user.ID.Hex()),
+	}
+	for _, post := range posts {
+		var name string
+		if author := authors[post.Author]; author != nil {
+			name = author.FirstName + " " + author.LastName
+		}
+		content.Items = append(content.Items, mail.Item{
+			Title: name,
+			Text:  notify.Excerpt(post.Content),
+			Link:  notify.DeepLinkScheme + "post/" + post.ID.Hex(),
+		})
+	}
+	return mail.Compose(user.Email, subject, content)
+}
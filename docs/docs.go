@@ -23,31 +23,52 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/post": {
-            "post": {
+        "/admin/cache": {
+            "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Inserting Post",
-                "parameters": [
-                    {
-                        "description": "New Post",
-                        "name": "post",
-                        "in": "body",
-                        "required": true,
+                "summary": "Getting cache hits, misses and errors since startup, for users and posts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/types.CreatePostParams"
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/cache.Report"
+                            }
                         }
                     }
+                }
+            }
+        },
+        "/admin/export": {
+            "get": {
+                "description": "Reposts and quotes are left out. Markdown comes as a zip archive of the directory.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Exporting users and posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "jsonl, csv, wxr or markdown",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/types.Post"
+                            "type": "file"
                         }
                     },
                     "400": {
@@ -55,41 +76,37 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "type": "string"
-                        }
                     }
                 }
             }
         },
-        "/post/user/{id}": {
-            "get": {
+        "/admin/import": {
+            "post": {
+                "description": "The body is the file to import, or for markdown a zip archive of the directory. Imports larger than the body limit go through the import command.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Getting posts from given user id",
+                "summary": "Importing users and posts",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "66db2c856699531daa9abc16",
-                        "name": "id",
-                        "in": "path"
+                        "description": "jsonl, csv, wxr or markdown",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/types.Post"
-                            }
+                            "$ref": "#/definitions/bulk.Report"
                         }
                     },
                     "400": {
@@ -97,38 +114,47 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "string"
-                        }
                     }
                 }
             }
         },
-        "/post/{id}": {
+        "/admin/jobs": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Getting Post",
+                "summary": "Getting background jobs, newest first",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "66db2c856699531daa9abc16",
-                        "name": "id",
-                        "in": "path"
+                        "description": "pending, running, done or dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Jobs per page",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/types.Post"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.Job"
+                            }
                         }
                     },
                     "400": {
@@ -136,43 +162,33 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "string"
-                        }
                     }
                 }
-            },
-            "put": {
+            }
+        },
+        "/admin/jobs/{id}": {
+            "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Updating Post",
+                "summary": "Getting background job",
                 "parameters": [
                     {
                         "type": "string",
                         "example": "66db2c856699531daa9abc16",
                         "name": "id",
                         "in": "path"
-                    },
-                    {
-                        "description": "New content",
-                        "name": "content",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/types.UpdatePostParams"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.Job"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -187,15 +203,17 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/admin/jobs/{id}/retry": {
+            "post": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Deleting Post",
+                "summary": "Requeueing a dead job with fresh attempts",
                 "parameters": [
                     {
                         "type": "string",
@@ -226,59 +244,51 @@ const docTemplate = `{
                 }
             }
         },
-        "/posts": {
+        "/admin/webhooks": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Posts"
+                    "Admin"
                 ],
-                "summary": "Getting Posts",
+                "summary": "Getting webhooks",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/types.Post"
+                                "$ref": "#/definitions/types.Webhook"
                             }
                         }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "type": "string"
-                        }
                     }
                 }
-            }
-        },
-        "/user": {
+            },
             "post": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "Inserting user",
+                "summary": "Subscribing a URL to blog events. The secret is only returned here.",
                 "parameters": [
                     {
-                        "description": "New user",
-                        "name": "user",
+                        "description": "New webhook",
+                        "name": "webhook",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/types.CreateUserParams"
+                            "$ref": "#/definitions/types.CreateWebhookParams"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "map"
+                            "$ref": "#/definitions/types.WebhookWithSecret"
                         }
                     },
                     "400": {
@@ -286,25 +296,19 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "type": "string"
-                        }
                     }
                 }
             }
         },
-        "/user/{id}": {
+        "/admin/webhooks/{id}": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "Getting user",
+                "summary": "Getting webhook",
                 "parameters": [
                     {
                         "type": "string",
@@ -317,7 +321,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "map"
+                            "$ref": "#/definitions/types.Webhook"
                         }
                     },
                     "400": {
@@ -339,9 +343,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "Updating user",
+                "summary": "Updating webhook",
                 "parameters": [
                     {
                         "type": "string",
@@ -350,12 +354,12 @@ const docTemplate = `{
                         "in": "path"
                     },
                     {
-                        "description": "User",
-                        "name": "content",
+                        "description": "Changes",
+                        "name": "params",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/types.UpdateUserParams"
+                            "$ref": "#/definitions/types.UpdateWebhookParams"
                         }
                     }
                 ],
@@ -385,9 +389,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "Deleting User",
+                "summary": "Deleting webhook and its delivery log",
                 "parameters": [
                     {
                         "type": "string",
@@ -418,15 +422,15 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/{id}/add": {
-            "put": {
+        "/admin/webhooks/{id}/deliveries": {
+            "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "Adding Freiend",
+                "summary": "Getting delivery log of webhook, newest first",
                 "parameters": [
                     {
                         "type": "string",
@@ -435,14 +439,59 @@ const docTemplate = `{
                         "in": "path"
                     },
                     {
-                        "description": "User",
-                        "name": "userID",
-                        "in": "body",
-                        "required": true,
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Deliveries per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/types.PathParameter"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
                         }
                     }
+                }
+            }
+        },
+        "/admin/webhooks/{id}/deliveries/{deliveryID}/replay": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Sending a delivery again, whatever its status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    }
                 ],
                 "responses": {
                     "200": {
@@ -451,6 +500,12 @@ const docTemplate = `{
                             "type": "map"
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -460,29 +515,59 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/{id}/remove": {
-            "put": {
+        "/auth/password-reset": {
+            "post": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Auth"
                 ],
-                "summary": "Removing Freiend",
+                "summary": "Emailing a password reset link. The response does not reveal whether the address is registered.",
                 "parameters": [
                     {
-                        "type": "string",
-                        "example": "66db2c856699531daa9abc16",
-                        "name": "id",
-                        "in": "path"
+                        "description": "Account email",
+                        "name": "email",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.PasswordResetRequestParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password-reset/confirm": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Setting a new password with the token from a password reset email",
+                "parameters": [
                     {
-                        "description": "User",
-                        "name": "userID",
+                        "description": "Token and new password",
+                        "name": "reset",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/types.PathParameter"
+                            "$ref": "#/definitions/types.PasswordResetParams"
                         }
                     }
                 ],
@@ -493,8 +578,8 @@ const docTemplate = `{
                             "type": "map"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
@@ -502,15 +587,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/users": {
+        "/auth/verify-email": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Auth"
+                ],
+                "summary": "Verifying email address with the token from a verification email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Verification token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "Getting users",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -518,77 +612,3080 @@ const docTemplate = `{
                             "type": "map"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
+        },
+        "/auth/verify-email/resend": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Sending a new verification email",
+                "parameters": [
+                    {
+                        "description": "User to verify",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UserParam"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/list/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Getting reading list with its posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user viewing the list",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.ReadingListView"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Updating reading list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Changes, made by the owner",
+                        "name": "list",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UpdateReadingListParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Deleting reading list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Owner of the list",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UserParam"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/list/{id}/post": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Adding post to reading list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Post to add, by the owner",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.ReadingListPostParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/list/{id}/post/{postID}": {
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Removing post from reading list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Owner of the list",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UserParam"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/post": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Inserting Post",
+                "parameters": [
+                    {
+                        "description": "New Post",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.CreatePostParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/types.Post"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/post/user/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Getting posts from given user id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts of these kinds: post, repost or quote, comma separated",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or after this date",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or before this date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "oldest (default) or newest first",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posts per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "author to embed author summaries",
+                        "name": "expand",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user reading the posts",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.PostView"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/post/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Getting Post",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the copy the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "author to embed author summaries",
+                        "name": "expand",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user reading the post",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.PostView"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the post"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Updating Post",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "New content",
+                        "name": "content",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UpdatePostParams"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the post being edited, as a strong entity tag",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the edited post"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Deleting Post",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the post being deleted, as a strong entity tag",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/post/{id}/bookmark": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Bookmarking Post",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User bookmarking the post",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UserParam"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Removing Bookmark",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User removing the bookmark",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UserParam"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/post/{id}/repost": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Reposting or quoting Post",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Repost, or quote post when content is set",
+                        "name": "repost",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.CreateRepostParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/types.PostView"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Posts"
+                ],
+                "summary": "Getting Posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only posts from this user ID",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts of these kinds: post, repost or quote, comma separated",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or after this date",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or before this date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "oldest (default) or newest first",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posts per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "author to embed author summaries",
+                        "name": "expand",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user reading the posts",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.PostView"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/search": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Search"
+                ],
+                "summary": "Searching posts and users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "all, posts or users",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts from this user ID",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or after this date",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only posts created at or before this date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Results per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user searching, who finds the posts they may read",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.SearchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream": {
+            "get": {
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Stream"
+                ],
+                "summary": "Streaming events for the token's user as server-sent events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Stream token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/trending": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Trending"
+                ],
+                "summary": "Getting trending posts and tags",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum posts and tags to return",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.Trending"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/unsubscribe": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Turning off every email to the user named by a signed unsubscribe token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Unsubscribe token from an email",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Turning off every email to the user named by a signed unsubscribe token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Unsubscribe token from an email",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Inserting user",
+                "parameters": [
+                    {
+                        "description": "New user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.CreateUserParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Getting user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the copy the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Updating user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User",
+                        "name": "content",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UpdateUserParams"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the user being edited, as a strong entity tag",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the edited user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Deleting User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the user being deleted, as a strong entity tag",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/add": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Adding Freiend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User",
+                        "name": "userID",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.PathParameter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/block": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Blocking user, so that neither sees the other's posts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User to block",
+                        "name": "userID",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.PathParameter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/bookmarks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Getting bookmarked posts of given user id, newest bookmark first",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posts per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.PostView"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/devices": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Registering device for push notifications",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Device",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.RegisterDeviceParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Removing device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Device",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.RemoveDeviceParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/lists": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Getting reading lists of given user id; private lists only for their owner",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of user viewing the lists",
+                        "name": "viewer",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.ReadingList"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookmarks"
+                ],
+                "summary": "Creating reading list for given user id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "New reading list",
+                        "name": "list",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.CreateReadingListParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/types.ReadingList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/notification-settings": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Getting notification settings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.NotificationSettings"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Updating notification settings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Notification settings",
+                        "name": "settings",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.NotificationSettings"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.NotificationSettings"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/notifications": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Getting inbox of given user id, most recently active first",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only unread notifications",
+                        "name": "unread",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Notifications per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.NotificationPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/notifications/read": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Marking all notifications of given user id as read",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/notifications/unread": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Getting number of unread notifications of given user id",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.UnreadCount"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/notifications/{notificationID}/read": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Marking notification of given user id as read",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/remove": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Removing Freiend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User",
+                        "name": "userID",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.PathParameter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/stream-token": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stream"
+                ],
+                "summary": "Issuing a token that opens the real-time stream of given user id, given the user's password",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "Password of user",
+                        "name": "password",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.StreamTokenParams"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.StreamToken"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/unblock": {
+            "put": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Unblocking user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "66db2c856699531daa9abc16",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "description": "User to unblock",
+                        "name": "userID",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.PathParameter"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Getting users",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws": {
+            "get": {
+                "tags": [
+                    "Stream"
+                ],
+                "summary": "Streaming events for the token's user over a WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Stream token",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "bulk.RecordError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "email foo is invalid"
+                },
+                "record": {
+                    "type": "string",
+                    "example": "line 3"
+                }
+            }
+        },
+        "bulk.Report": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/bulk.RecordError"
+                    }
+                },
+                "posts_created": {
+                    "type": "integer",
+                    "example": 115
+                },
+                "records": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "users_created": {
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "cache.Report": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "integer"
+                },
+                "hit_ratio": {
+                    "type": "number"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "misses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "types.ChannelPreference": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "in_app": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "push": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
         "types.CreatePostParams": {
             "type": "object",
             "properties": {
-                "author": {
+                "author": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "content": {
+                    "type": "string",
+                    "example": "This is example."
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "visibility": {
+                    "type": "string",
+                    "example": "public"
+                }
+            }
+        },
+        "types.CreateReadingListParams": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "Weekend reads"
+                },
+                "private": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "types.CreateRepostParams": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "content": {
+                    "type": "string",
+                    "example": "Quoting this."
+                }
+            }
+        },
+        "types.CreateUserParams": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "fcmToken": {
+                    "type": "string"
+                },
+                "firstName": {
+                    "type": "string"
+                },
+                "language": {
+                    "type": "string"
+                },
+                "lastName": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "timeZone": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.CreateWebhookParams": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "post.created",
+                        "post.deleted"
+                    ]
+                },
+                "secret": {
+                    "description": "Secret signs payloads; one is generated when it is empty.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/blog"
+                }
+            }
+        },
+        "types.DeliveryAttempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "duration_ms": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "error": {
+                    "type": "string",
+                    "example": "unexpected status 500"
+                },
+                "status_code": {
+                    "type": "integer",
+                    "example": 500
+                }
+            }
+        },
+        "types.Device": {
+            "type": "object",
+            "properties": {
+                "app_version": {
+                    "type": "string",
+                    "example": "1.4.2"
+                },
+                "last_seen": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "platform": {
+                    "type": "string",
+                    "example": "android"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "fcm-registration-token"
+                }
+            }
+        },
+        "types.Job": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "connection refused"
+                },
+                "locked_until": {
+                    "type": "string",
+                    "example": "2024-09-06T16:24:33.648Z"
+                },
+                "max_attempts": {
+                    "type": "integer",
+                    "example": 8
+                },
+                "payload": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "run_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "notify.new_post"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                }
+            }
+        },
+        "types.NotificationPage": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "notifications": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.NotificationView"
+                    }
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "unread": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "types.NotificationSettings": {
+            "type": "object",
+            "properties": {
+                "digest": {
+                    "description": "Digest is how often to email a digest of friends' posts to a user who\nhas not opened the app: daily, weekly or off.",
+                    "type": "string",
+                    "example": "daily"
+                },
+                "events": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/types.ChannelPreference"
+                    }
+                },
+                "quiet_hours": {
+                    "$ref": "#/definitions/types.QuietHours"
+                }
+            }
+        },
+        "types.NotificationView": {
+            "type": "object",
+            "properties": {
+                "actor_count": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "actors": {
+                    "description": "Actors holds the most recent actors, newest first; ActorCount counts\nevery distinct actor in the group.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.UserSummary"
+                    }
+                },
+                "body": {
+                    "type": "string",
+                    "example": "a golang post"
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "excerpt": {
+                    "type": "string",
+                    "example": "a golang post"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "link": {
+                    "type": "string",
+                    "example": "blogapp://post/66db2c856699531daa9abc16"
+                },
+                "post_id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "read": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "recipient": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                },
+                "title": {
+                    "type": "string",
+                    "example": "foo bar and 4 others shared your post"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "repost"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                }
+            }
+        },
+        "types.PasswordResetParams": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "verysecurepassword"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.PasswordResetRequestParams": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "foobar@gmail.com"
+                }
+            }
+        },
+        "types.PathParameter": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                }
+            }
+        },
+        "types.Post": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                },
+                "content": {
+                    "type": "string",
+                    "example": "This is example."
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "kind": {
+                    "type": "string",
+                    "example": "post"
+                },
+                "repost_of": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "stats": {
+                    "$ref": "#/definitions/types.PostStats"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "golang",
+                        "mongo"
+                    ]
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "version": {
+                    "description": "Version starts at 1 and goes up with every edit, but not with the\nstats. It is served as the post's ETag.",
+                    "type": "integer",
+                    "example": 1
+                },
+                "visibility": {
+                    "description": "Visibility is public, friends, for the users the author lists as\nfriends, or private, for the author alone. Posts stored before it\nexisted have none and are public.",
+                    "type": "string",
+                    "example": "public"
+                }
+            }
+        },
+        "types.PostHit": {
+            "type": "object",
+            "properties": {
+                "highlights": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "a \u003cem\u003egolang\u003c/em\u003e post"
+                    ]
+                },
+                "post": {
+                    "$ref": "#/definitions/types.Post"
+                },
+                "score": {
+                    "type": "number",
+                    "example": 1.5
+                }
+            }
+        },
+        "types.PostStats": {
+            "type": "object",
+            "properties": {
+                "comments": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "reactions": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "reposts": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "views": {
+                    "type": "integer",
+                    "example": 140
+                }
+            }
+        },
+        "types.PostView": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                },
+                "author_summary": {
+                    "$ref": "#/definitions/types.UserSummary"
+                },
+                "content": {
+                    "type": "string",
+                    "example": "This is example."
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "kind": {
+                    "type": "string",
+                    "example": "post"
+                },
+                "original": {
+                    "$ref": "#/definitions/types.Post"
+                },
+                "original_author_summary": {
+                    "$ref": "#/definitions/types.UserSummary"
+                },
+                "original_unavailable": {
+                    "type": "boolean"
+                },
+                "repost_of": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "stats": {
+                    "$ref": "#/definitions/types.PostStats"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "golang",
+                        "mongo"
+                    ]
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "version": {
+                    "description": "Version starts at 1 and goes up with every edit, but not with the\nstats. It is served as the post's ETag.",
+                    "type": "integer",
+                    "example": 1
+                },
+                "visibility": {
+                    "description": "Visibility is public, friends, for the users the author lists as\nfriends, or private, for the author alone. Posts stored before it\nexisted have none and are public.",
+                    "type": "string",
+                    "example": "public"
+                }
+            }
+        },
+        "types.QuietHours": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "defer"
+                },
+                "enabled": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "end": {
+                    "type": "string",
+                    "example": "07:00"
+                },
+                "start": {
+                    "type": "string",
+                    "example": "22:00"
+                }
+            }
+        },
+        "types.ReadingList": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "id": {
                     "type": "string",
                     "example": "66db2c856699531daa9abc16"
                 },
-                "content": {
+                "name": {
                     "type": "string",
-                    "example": "This is example."
+                    "example": "Weekend reads"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                },
+                "posts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "[66db2c856699531daa9abc16",
+                        "9bdb2c85156699531daa9abc7]"
+                    ]
+                },
+                "private": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                }
+            }
+        },
+        "types.ReadingListPostParams": {
+            "type": "object",
+            "properties": {
+                "postID": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
                 },
+                "userID": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                }
+            }
+        },
+        "types.ReadingListView": {
+            "type": "object",
+            "properties": {
                 "created_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.PostView"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Weekend reads"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                },
+                "posts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "[66db2c856699531daa9abc16",
+                        "9bdb2c85156699531daa9abc7]"
+                    ]
+                },
+                "private": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                }
+            }
+        },
+        "types.RegisterDeviceParams": {
+            "type": "object",
+            "properties": {
+                "app_version": {
+                    "type": "string",
+                    "example": "1.4.2"
+                },
+                "platform": {
+                    "type": "string",
+                    "example": "android"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "fcm-registration-token"
+                }
+            }
+        },
+        "types.RemoveDeviceParams": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string",
+                    "example": "fcm-registration-token"
+                }
+            }
+        },
+        "types.SearchResult": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "posts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.PostHit"
+                    }
+                },
+                "query": {
+                    "type": "string",
+                    "example": "golang"
+                },
+                "totalPosts": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "totalUsers": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.UserHit"
+                    }
+                }
+            }
+        },
+        "types.StreamToken": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string",
+                    "example": "2024-09-07T16:23:33.648Z"
+                },
+                "token": {
                     "type": "string"
                 }
             }
         },
-        "types.CreateUserParams": {
+        "types.StreamTokenParams": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "verysecurepassword"
+                }
+            }
+        },
+        "types.Trending": {
+            "type": "object",
+            "properties": {
+                "computed_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "posts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.TrendingPost"
+                    }
+                },
+                "since": {
+                    "type": "string",
+                    "example": "2024-09-03T16:23:33.648Z"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.TrendingTag"
+                    }
+                }
+            }
+        },
+        "types.TrendingPost": {
+            "type": "object",
+            "properties": {
+                "post": {
+                    "$ref": "#/definitions/types.Post"
+                },
+                "score": {
+                    "type": "number",
+                    "example": 12.5
+                }
+            }
+        },
+        "types.TrendingTag": {
+            "type": "object",
+            "properties": {
+                "posts": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "score": {
+                    "type": "number",
+                    "example": 30.2
+                },
+                "tag": {
+                    "type": "string",
+                    "example": "golang"
+                }
+            }
+        },
+        "types.UnreadCount": {
+            "type": "object",
+            "properties": {
+                "unread": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "types.UpdatePostParams": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string",
+                    "example": "This is example."
+                },
+                "visibility": {
+                    "type": "string",
+                    "example": "friends"
+                }
+            }
+        },
+        "types.UpdateReadingListParams": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "Weekend reads"
+                },
+                "private": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "userID": {
+                    "type": "string",
+                    "example": "66db21cdb5d96466fa5f3c3c"
+                }
+            }
+        },
+        "types.UpdateUserParams": {
             "type": "object",
             "properties": {
                 "email": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "foobaz@gmail.com"
                 },
                 "fcmToken": {
                     "type": "string"
                 },
                 "firstName": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "foo"
+                },
+                "language": {
+                    "type": "string",
+                    "example": "fa"
                 },
                 "lastName": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "baz"
                 },
                 "password": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "verysecurepassword"
+                },
+                "timeZone": {
+                    "type": "string",
+                    "example": "Asia/Tehran"
                 }
             }
         },
-        "types.PathParameter": {
+        "types.UpdateWebhookParams": {
             "type": "object",
             "properties": {
-                "id": {
+                "active": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "post.created"
+                    ]
+                },
+                "url": {
                     "type": "string",
-                    "example": "66db2c856699531daa9abc16"
+                    "example": "https://example.com/hooks/blog"
                 }
             }
         },
-        "types.Post": {
+        "types.UserHit": {
             "type": "object",
             "properties": {
-                "author": {
+                "highlights": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "\u003cem\u003efoo\u003c/em\u003e bar"
+                    ]
+                },
+                "score": {
+                    "type": "number",
+                    "example": 1.5
+                },
+                "user": {
+                    "$ref": "#/definitions/types.UserSummary"
+                }
+            }
+        },
+        "types.UserParam": {
+            "type": "object",
+            "properties": {
+                "userID": {
                     "type": "string",
                     "example": "66db21cdb5d96466fa5f3c3c"
+                }
+            }
+        },
+        "types.UserSummary": {
+            "type": "object",
+            "properties": {
+                "firstName": {
+                    "type": "string",
+                    "example": "foo"
                 },
-                "content": {
+                "id": {
                     "type": "string",
-                    "example": "This is example."
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "lastName": {
+                    "type": "string",
+                    "example": "bar"
+                }
+            }
+        },
+        "types.Webhook": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean",
+                    "example": true
                 },
                 "created_at": {
                     "type": "string",
                     "example": "2024-09-06T16:23:33.648Z"
                 },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "post.created",
+                        "post.deleted"
+                    ]
+                },
                 "id": {
                     "type": "string",
                     "example": "66db2c856699531daa9abc16"
@@ -596,35 +3693,88 @@ const docTemplate = `{
                 "updated_at": {
                     "type": "string",
                     "example": "2024-09-06T16:23:33.648Z"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/blog"
                 }
             }
         },
-        "types.UpdatePostParams": {
+        "types.WebhookDelivery": {
             "type": "object",
             "properties": {
-                "content": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.DeliveryAttempt"
+                    }
+                },
+                "created_at": {
                     "type": "string",
-                    "example": "This is example."
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "event": {
+                    "type": "string",
+                    "example": "post.created"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
+                },
+                "payload": {
+                    "type": "string",
+                    "example": "{\"id\":\"...\",\"event\":\"post.created\"}"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "webhook": {
+                    "type": "string",
+                    "example": "66db2c856699531daa9abc16"
                 }
             }
         },
-        "types.UpdateUserParams": {
+        "types.WebhookWithSecret": {
             "type": "object",
             "properties": {
-                "fcmToken": {
-                    "type": "string"
+                "active": {
+                    "type": "boolean",
+                    "example": true
                 },
-                "firstName": {
+                "created_at": {
                     "type": "string",
-                    "example": "foo"
+                    "example": "2024-09-06T16:23:33.648Z"
                 },
-                "lastName": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "post.created",
+                        "post.deleted"
+                    ]
+                },
+                "id": {
                     "type": "string",
-                    "example": "baz"
+                    "example": "66db2c856699531daa9abc16"
                 },
-                "password": {
+                "secret": {
                     "type": "string",
-                    "example": "verysecurepassword"
+                    "example": "5f0c8e2a..."
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-09-06T16:23:33.648Z"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/blog"
                 }
             }
         }
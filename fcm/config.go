@@ -2,24 +2,40 @@ package fcm
 
 import (
 	"context"
+	"errors"
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
+	"github.com/MiladJlz/blog_app/notify"
 	"google.golang.org/api/option"
+	"os"
 )
 
-const filePath = "./service_account_key.json"
+const (
+	CredentialsFileEnvName = "FCM_CREDENTIALS_FILE"
+	defaultCredentialsFile = "./service_account_key.json"
+	maxMulticastTokens     = 500
+)
 
 type FirebaseMessagingClient struct {
 	client *messaging.Client
 }
 
 func NewFirebaseMessagingClient(ctx context.Context) (*FirebaseMessagingClient, error) {
+	filePath := os.Getenv(CredentialsFileEnvName)
+	if len(filePath) == 0 {
+		filePath = defaultCredentialsFile
+	}
 	opt := option.WithCredentialsFile(filePath)
 	app, err := firebase.NewApp(ctx, nil, opt)
 	if err != nil {
 		return nil, err
 	}
+	return NewFirebaseMessagingClientForApp(ctx, app)
+}
 
+// NewFirebaseMessagingClientForApp sends through app, whose options may point
+// it at another endpoint, as tests do.
+func NewFirebaseMessagingClientForApp(ctx context.Context, app *firebase.App) (*FirebaseMessagingClient, error) {
 	fcmClient, err := app.Messaging(ctx)
 	if err != nil {
 		return nil, err
@@ -27,12 +43,88 @@ func NewFirebaseMessagingClient(ctx context.Context) (*FirebaseMessagingClient,
 	return &FirebaseMessagingClient{client: fcmClient}, nil
 }
 
-func (c *FirebaseMessagingClient) SendNotification(ctx context.Context, tokens []string, message string) error {
-	_, err := c.client.SendEachForMulticast(ctx, &messaging.MulticastMessage{
-		Data: map[string]string{
-			message: message,
-		},
+func (c *FirebaseMessagingClient) Send(ctx context.Context, tokens []string, msg notify.Message) (*notify.SendResult, error) {
+	var registered []string
+	for _, token := range tokens {
+		if len(token) > 0 {
+			registered = append(registered, token)
+		}
+	}
+	res := &notify.SendResult{}
+	var errs []error
+	// FCM rejects a multicast without tokens or with more than
+	// maxMulticastTokens. A failed batch does not stop the others, so the
+	// result accounts for every token.
+	for start := 0; start < len(registered); start += maxMulticastTokens {
+		batch := registered[start:min(start+maxMulticastTokens, len(registered))]
+		br, err := c.client.SendEachForMulticast(ctx, newMulticastMessage(batch, msg))
+		if err != nil {
+			res.FailureCount += len(batch)
+			errs = append(errs, err)
+			continue
+		}
+		res.SuccessCount += br.SuccessCount
+		res.FailureCount += br.FailureCount
+		res.InvalidTokens = append(res.InvalidTokens, invalidTokens(batch, br)...)
+	}
+	return res, errors.Join(errs...)
+}
+
+// invalidTokens returns the tokens of batch that FCM will never deliver to
+// again. An invalid argument usually means a malformed token, but it can also
+// mean a malformed message; when every send in the batch failed that way the
+// message is to blame and no token is reported.
+func invalidTokens(batch []string, br *messaging.BatchResponse) []string {
+	var invalid, malformed []string
+	for i, resp := range br.Responses {
+		if resp.Success || resp.Error == nil || i >= len(batch) {
+			continue
+		}
+		switch {
+		case messaging.IsUnregistered(resp.Error), messaging.IsSenderIDMismatch(resp.Error):
+			invalid = append(invalid, batch[i])
+		case messaging.IsInvalidArgument(resp.Error):
+			malformed = append(malformed, batch[i])
+		}
+	}
+	if len(malformed) < len(br.Responses) {
+		invalid = append(invalid, malformed...)
+	}
+	return invalid
+}
+
+// newMulticastMessage builds a message that displays msg as a notification
+// and carries its data for the app, with platform options that collapse
+// repeated notifications for the same subject.
+func newMulticastMessage(tokens []string, msg notify.Message) *messaging.MulticastMessage {
+	m := &messaging.MulticastMessage{
 		Tokens: tokens,
-	})
-	return err
+		Notification: &messaging.Notification{
+			Title: msg.Title,
+			Body:  msg.Body,
+		},
+		Data: msg.Data,
+		Android: &messaging.AndroidConfig{
+			CollapseKey: msg.CollapseKey,
+			Priority:    "high",
+			Notification: &messaging.AndroidNotification{
+				Tag: msg.CollapseKey,
+			},
+		},
+		APNS: &messaging.APNSConfig{
+			Headers: map[string]string{
+				"apns-priority": "10",
+			},
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Sound:    "default",
+					ThreadID: msg.Data["type"],
+				},
+			},
+		},
+	}
+	if len(msg.CollapseKey) > 0 {
+		m.APNS.Headers["apns-collapse-id"] = msg.CollapseKey
+	}
+	return m
 }
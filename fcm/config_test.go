@@ -0,0 +1,134 @@
+package fcm_test
+
+import (
+	"context"
+	"encoding/json"
+	firebase "firebase.google.com/go/v4"
+	"fmt"
+	"github.com/MiladJlz/blog_app/fcm"
+	"github.com/MiladJlz/blog_app/notify"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFCM answers the FCM v1 send endpoint, failing the tokens in errors with
+// their FCM error code.
+type fakeFCM struct {
+	errors map[string]string
+
+	mu   sync.Mutex
+	sent map[string]int
+}
+
+func (f *fakeFCM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message struct {
+			Token string `json:"token"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := req.Message.Token
+	f.mu.Lock()
+	f.sent[token]++
+	f.mu.Unlock()
+	code, ok := f.errors[token]
+	if !ok {
+		if prefix, _, found := strings.Cut(token, "-"); found {
+			code, ok = f.errors[prefix+"-*"]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		fmt.Fprintf(w, `{"name":"projects/blog-test/messages/%s"}`, token)
+		return
+	}
+	status := http.StatusBadRequest
+	if code == "UNREGISTERED" {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":"%s","status":"%s","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"%s"}]}}`,
+		status, code, code, code)
+}
+
+func newClient(t *testing.T, fake *fakeFCM) *fcm.FirebaseMessagingClient {
+	t.Helper()
+	fake.sent = map[string]int{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: "blog-test"}, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	client, err := fcm.NewFirebaseMessagingClientForApp(ctx, app)
+	if err != nil {
+		t.Fatalf("NewFirebaseMessagingClientForApp: %v", err)
+	}
+	return client
+}
+
+func phones(n int) []string {
+	tokens := make([]string, n)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("phone-%d", i)
+	}
+	return tokens
+}
+
+// TestSendInBatches sends to more tokens than one multicast takes, so that
+// the invalid tokens of every batch have to be merged.
+func TestSendInBatches(t *testing.T) {
+	fake := &fakeFCM{errors: map[string]string{
+		"phone-10":   "UNREGISTERED",
+		"phone-600":  "SENDER_ID_MISMATCH",
+		"phone-700":  "INVALID_ARGUMENT",
+		"phone-1100": "UNREGISTERED",
+		"phone-1150": "QUOTA_EXCEEDED",
+	}}
+	client := newClient(t, fake)
+	tokens := append(phones(1203), "", "")
+
+	res, err := client.Send(context.Background(), tokens, notify.Message{Title: "Hello", Body: "Batched"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if res.SuccessCount != 1198 || res.FailureCount != 5 {
+		t.Errorf("Send: got %d sent and %d failed, want 1198 and 5", res.SuccessCount, res.FailureCount)
+	}
+	want := []string{"phone-10", "phone-1100", "phone-600", "phone-700"}
+	slices.Sort(res.InvalidTokens)
+	if !slices.Equal(res.InvalidTokens, want) {
+		t.Errorf("invalid tokens: got %v, want %v", res.InvalidTokens, want)
+	}
+	if len(fake.sent) != 1203 {
+		t.Errorf("tokens sent to: got %d, want 1203 without the empty ones", len(fake.sent))
+	}
+	for token, n := range fake.sent {
+		if n != 1 {
+			t.Errorf("%s: sent %d times, want once", token, n)
+		}
+	}
+}
+
+// TestSendMalformedMessage checks that a batch failing as a whole with invalid
+// arguments blames the message rather than the tokens.
+func TestSendMalformedMessage(t *testing.T) {
+	client := newClient(t, &fakeFCM{errors: map[string]string{"phone-*": "INVALID_ARGUMENT"}})
+
+	res, err := client.Send(context.Background(), phones(3), notify.Message{Title: "Broken"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if res.SuccessCount != 0 || res.FailureCount != 3 || len(res.InvalidTokens) != 0 {
+		t.Errorf("Send: got %+v, want every send failed and no token invalid", res)
+	}
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"github.com/MiladJlz/blog_app/token"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	PublicURLEnvName = "PUBLIC_URL"
+
+	PurposeUnsubscribe   = "unsubscribe"
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+
+	unsubscribeTTL   = 365 * 24 * time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// Links builds the signed links that emails point back to the API with.
+type Links struct {
+	baseURL string
+	signer  *token.Signer
+}
+
+func NewLinks(baseURL string, signer *token.Signer) *Links {
+	return &Links{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		signer:  signer,
+	}
+}
+
+// Unsubscribe returns a link that turns off every email to the user.
+func (l *Links) Unsubscribe(userID string) string {
+	return l.link("/unsubscribe", l.signer.Sign(PurposeUnsubscribe, userID, unsubscribeTTL))
+}
+
+// VerifyEmail returns a link that confirms email belongs to the user.
+func (l *Links) VerifyEmail(userID string, email string) string {
+	return l.link("/auth/verify-email", l.signer.Sign(PurposeVerifyEmail, VerifyEmailSubject(userID, email), verifyEmailTTL))
+}
+
+// ResetPassword returns a link to set a new password for the user.
+func (l *Links) ResetPassword(userID string) string {
+	return l.link("/auth/password-reset/confirm", l.signer.Sign(PurposeResetPassword, userID, resetPasswordTTL))
+}
+
+// VerifyEmailSubject binds a verification token to the address it was sent
+// to, so it cannot verify a different address after an email change.
+func VerifyEmailSubject(userID string, email string) string {
+	return userID + " " + email
+}
+
+func (l *Links) link(path string, tok string) string {
+	return l.baseURL + path + "?" + url.Values{"token": {tok}}.Encode()
+}
@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+const (
+	MailerEnvName = "MAILER"
+	FromEnvName   = "MAIL_FROM"
+)
+
+// Message is an email with a plain text and an HTML rendering of the same
+// content.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Unsubscribe, when set, is advertised in the List-Unsubscribe header.
+	Unsubscribe string
+}
+
+// Sender delivers email.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NoopSender drops every email.
+type NoopSender struct{}
+
+func (NoopSender) Send(ctx context.Context, msg Message) error {
+	return nil
+}
+
+// LogSender writes emails to the standard logger instead of sending them.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail: %q to %s", msg.Subject, msg.To)
+	return nil
+}
+
+// Recorder keeps every email in memory so tests can assert on them.
+type Recorder struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Send(ctx context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of the emails recorded so far.
+func (r *Recorder) Sent() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.sent...)
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = nil
+}
@@ -0,0 +1,146 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SMTPAddrEnvName     = "SMTP_ADDR"
+	SMTPUsernameEnvName = "SMTP_USERNAME"
+	SMTPPasswordEnvName = "SMTP_PASSWORD"
+)
+
+// SMTPSender sends email through an SMTP relay. Without a username it does
+// not authenticate, which suits local capture servers such as MailHog.
+type SMTPSender struct {
+	addr string
+	// from is the From header; envelope is its bare address.
+	from     string
+	envelope string
+	auth     smtp.Auth
+}
+
+func NewSMTPSender(addr string, from string, username string, password string) *SMTPSender {
+	s := &SMTPSender{
+		addr:     addr,
+		from:     from,
+		envelope: from,
+	}
+	if parsed, err := netmail.ParseAddress(from); err == nil {
+		s.envelope = parsed.Address
+	}
+	if len(username) > 0 {
+		host, _, _ := net.SplitHostPort(addr)
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// NewSMTPSenderFromEnv configures an SMTPSender from SMTP_ADDR, SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM.
+func NewSMTPSenderFromEnv() (*SMTPSender, error) {
+	addr := os.Getenv(SMTPAddrEnvName)
+	if len(addr) == 0 {
+		return nil, fmt.Errorf("%s is not set", SMTPAddrEnvName)
+	}
+	from := os.Getenv(FromEnvName)
+	if len(from) == 0 {
+		return nil, fmt.Errorf("%s is not set", FromEnvName)
+	}
+	return NewSMTPSender(addr, from, os.Getenv(SMTPUsernameEnvName), os.Getenv(SMTPPasswordEnvName)), nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	body, err := s.build(msg)
+	if err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(s.addr, s.auth, s.envelope, []string{msg.To}, body)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// build encodes msg as a multipart/alternative MIME message.
+func (s *SMTPSender) build(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	header := []struct{ key, value string }{
+		{"From", s.from},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(s.envelope)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	if len(msg.Unsubscribe) > 0 {
+		header = append(header,
+			struct{ key, value string }{"List-Unsubscribe", "<" + msg.Unsubscribe + ">"},
+			struct{ key, value string }{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		)
+	}
+	var head bytes.Buffer
+	for _, h := range header {
+		fmt.Fprintf(&head, "%s: %s\r\n", h.key, h.value)
+	}
+	head.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if len(part.content) == 0 {
+			continue
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if _, host, ok := strings.Cut(from, "@"); ok {
+		domain = host
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,241 @@
+package mail_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/token"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// envelope is an email as a captureServer received it.
+type envelope struct {
+	from string
+	to   []string
+	data string
+}
+
+// captureServer is a minimal SMTP server that keeps every email it is sent,
+// like the capture servers used in development.
+type captureServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	received []envelope
+}
+
+func newCaptureServer(t *testing.T) *captureServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &captureServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *captureServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *captureServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *captureServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 capture ready")
+	var env envelope
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 capture")
+		case "MAIL":
+			env = envelope{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			env.to = append(env.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			env.data = string(data)
+			s.mu.Lock()
+			s.received = append(s.received, env)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *captureServer) emails() []envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]envelope(nil), s.received...)
+}
+
+func TestSMTPSender(t *testing.T) {
+	server := newCaptureServer(t)
+	sender := mail.NewSMTPSender(server.addr(), "Blog <noreply@blog.test>", "", "")
+	msg, err := mail.Compose("reader@blog.test", "Your digest ✉", mail.Content{
+		Lang:  "en",
+		Title: "New posts",
+		Items: []mail.Item{{Title: "Gophers & friends", Text: "A post about Go", Link: "https://blog.test/posts/1"}},
+		// Long enough that quoted-printable has to wrap it.
+		Unsubscribe: "https://blog.test/unsubscribe?token=" + strings.Repeat("x", 100),
+	})
+	if err != nil {
+		t.Fatalf("Compose: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sender.Send(ctx, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	emails := server.emails()
+	if len(emails) != 1 {
+		t.Fatalf("emails: got %d, want 1", len(emails))
+	}
+	env := emails[0]
+	if env.from != "noreply@blog.test" || len(env.to) != 1 || env.to[0] != "reader@blog.test" {
+		t.Errorf("envelope: got from %q to %v, want the bare addresses", env.from, env.to)
+	}
+	parsed, err := netmail.ReadMessage(strings.NewReader(env.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject: got %q, %v, want %q", subject, err, msg.Subject)
+	}
+	if got, want := parsed.Header.Get("List-Unsubscribe"), "<"+msg.Unsubscribe+">"; got != want {
+		t.Errorf("List-Unsubscribe: got %q, want %q", got, want)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post: got %q", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type: got %q, %v, want multipart/alternative", mediaType, err)
+	}
+	// The multipart reader undoes the quoted-printable encoding.
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	want := map[string]string{"text/plain": msg.Text, "text/html": msg.HTML}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading %s part: %v", partType, err)
+		}
+		if string(body) != want[partType] {
+			t.Errorf("%s part: got %q, want %q", partType, body, want[partType])
+		}
+		delete(want, partType)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing parts: %v", want)
+	}
+}
+
+func TestSMTPSenderUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	sender := mail.NewSMTPSender(addr, "noreply@blog.test", "", "")
+	if err := sender.Send(context.Background(), mail.Message{To: "reader@blog.test", Subject: "Hi", Text: "Hi"}); err == nil {
+		t.Error("Send to a closed port: got no error")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	msg, err := mail.Compose("reader@blog.test", "سلام", mail.Content{
+		Lang:        "fa",
+		Title:       "<b>پست‌های تازه</b>",
+		Items:       []mail.Item{{Title: "Tom & Jerry", Link: "blogapp://posts/1"}},
+		Unsubscribe: "https://blog.test/unsubscribe?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("Compose: %v", err)
+	}
+	for _, want := range []string{`dir="rtl"`, "&lt;b&gt;", "Tom &amp; Jerry", `href="blogapp://posts/1"`, "لغو اشتراک"} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, msg.HTML)
+		}
+	}
+	for _, want := range []string{"<b>پست‌های تازه</b>", "* Tom & Jerry", "blogapp://posts/1", "لغو اشتراک: https://blog.test/unsubscribe?token=abc"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, msg.Text)
+		}
+	}
+	if msg.Unsubscribe != "https://blog.test/unsubscribe?token=abc" {
+		t.Errorf("Unsubscribe: got %q", msg.Unsubscribe)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	signer := token.NewSigner([]byte("secret"))
+	links := mail.NewLinks("https://blog.test/", signer)
+	for _, tc := range []struct {
+		link    string
+		path    string
+		purpose string
+		subject string
+	}{
+		{links.Unsubscribe("user-1"), "/unsubscribe", mail.PurposeUnsubscribe, "user-1"},
+		{links.VerifyEmail("user-1", "a@blog.test"), "/auth/verify-email", mail.PurposeVerifyEmail, mail.VerifyEmailSubject("user-1", "a@blog.test")},
+		{links.ResetPassword("user-1"), "/auth/password-reset/confirm", mail.PurposeResetPassword, "user-1"},
+	} {
+		path, query, _ := strings.Cut(tc.link, "?")
+		if path != "https://blog.test"+tc.path {
+			t.Errorf("link %s: got path %q, want %q", tc.link, path, tc.path)
+			continue
+		}
+		tok, _ := strings.CutPrefix(query, "token=")
+		if subject, err := signer.Verify(tc.purpose, tok); err != nil || subject != tc.subject {
+			t.Errorf("link %s: token verifies as %q, %v, want %q", tc.link, subject, err, tc.subject)
+		}
+	}
+	if _, err := signer.Verify(mail.PurposeResetPassword, strings.TrimPrefix(links.Unsubscribe("user-1"), "https://blog.test/unsubscribe?token=")); err == nil {
+		t.Error("an unsubscribe token was accepted to reset a password")
+	}
+}
@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Content is what an email says, independent of its HTML and text layouts.
+type Content struct {
+	Lang  string
+	Title string
+	Intro string
+	Items []Item
+	// Action is an optional call-to-action link shown after the items.
+	Action *Item
+	// Unsubscribe is the link that stops emails like this one.
+	Unsubscribe string
+}
+
+type Item struct {
+	Title string
+	Text  string
+	Link  string
+}
+
+var footers = map[string]string{
+	"en": "Unsubscribe",
+	"fa": "لغو اشتراک",
+}
+
+// rtlLanguages are laid out right to left in HTML emails.
+var rtlLanguages = map[string]bool{
+	"fa": true,
+}
+
+var htmlLayout = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family:sans-serif;max-width:600px;margin:auto">
+<h2>{{.Title}}</h2>
+{{if .Intro}}<p>{{.Intro}}</p>{{end}}
+{{range .Items}}<div style="margin:16px 0">
+{{if .Link}}<a href="{{.Link}}"><strong>{{.Title}}</strong></a>{{else}}<strong>{{.Title}}</strong>{{end}}
+{{if .Text}}<p style="margin:4px 0">{{.Text}}</p>{{end}}
+</div>
+{{end}}{{with .Action}}<p><a href="{{.Link}}" style="padding:8px 16px;background:#1a73e8;color:#fff;text-decoration:none">{{.Title}}</a></p>
+{{end}}{{if .Unsubscribe}}<p style="color:#888;font-size:12px"><a href="{{.Unsubscribe}}">{{.Footer}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+var textLayout = texttemplate.Must(texttemplate.New("text").Parse(`{{.Title}}
+{{if .Intro}}
+{{.Intro}}
+{{end}}{{range .Items}}
+* {{.Title}}{{if .Text}}
+  {{.Text}}{{end}}{{if .Link}}
+  {{.Link}}{{end}}
+{{end}}{{with .Action}}
+{{.Title}}: {{.Link}}
+{{end}}{{if .Unsubscribe}}
+--
+{{.Footer}}: {{.Unsubscribe}}
+{{end}}`))
+
+type htmlItem struct {
+	Title string
+	Text  string
+	Link  htmltemplate.URL
+}
+
+// Compose renders c into an email to the given address. Links are trusted, so
+// app deep links survive html/template's URL filtering.
+func Compose(to string, subject string, c Content) (Message, error) {
+	vars := struct {
+		Content
+		Dir    string
+		Footer string
+	}{
+		Content: c,
+		Dir:     "ltr",
+		Footer:  footers["en"],
+	}
+	if rtlLanguages[c.Lang] {
+		vars.Dir = "rtl"
+	}
+	if footer, ok := footers[c.Lang]; ok {
+		vars.Footer = footer
+	}
+	htmlVars := struct {
+		Lang, Dir, Title, Intro, Footer string
+		Items                           []htmlItem
+		Action                          *htmlItem
+		Unsubscribe                     htmltemplate.URL
+	}{
+		Lang:        c.Lang,
+		Dir:         vars.Dir,
+		Title:       c.Title,
+		Intro:       c.Intro,
+		Footer:      vars.Footer,
+		Unsubscribe: htmltemplate.URL(c.Unsubscribe),
+	}
+	for _, item := range c.Items {
+		htmlVars.Items = append(htmlVars.Items, htmlItem{item.Title, item.Text, htmltemplate.URL(item.Link)})
+	}
+	if c.Action != nil {
+		htmlVars.Action = &htmlItem{c.Action.Title, c.Action.Text, htmltemplate.URL(c.Action.Link)}
+	}
+	var html, text bytes.Buffer
+	if err := htmlLayout.Execute(&html, htmlVars); err != nil {
+		return Message{}, err
+	}
+	if err := textLayout.Execute(&text, vars); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:          to,
+		Subject:     subject,
+		Text:        text.String(),
+		HTML:        html.String(),
+		Unsubscribe: c.Unsubscribe,
+	}, nil
+}
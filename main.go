@@ -2,9 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/MiladJlz/blog_app/account"
 	"github.com/MiladJlz/blog_app/api"
+	"github.com/MiladJlz/blog_app/cache"
 	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/digest"
 	"github.com/MiladJlz/blog_app/fcm"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/realtime"
+	"github.com/MiladJlz/blog_app/search"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/trending"
+	"github.com/MiladJlz/blog_app/webhook"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
@@ -13,6 +25,16 @@ import (
 	"log"
 
 	"os"
+	"strconv"
+	"time"
+	// embedded so users' time zones resolve on hosts without zoneinfo
+	_ "time/tzdata"
+)
+
+const (
+	mongoURLEnvName      = "MONGO_DB_URL"
+	storeBackendEnvName  = "DB_BACKEND"
+	searchBackendEnvName = "SEARCH_BACKEND"
 )
 
 var config = fiber.Config{
@@ -31,23 +53,108 @@ var config = fiber.Config{
 // @BasePath		/
 func main() {
 	ctx := context.TODO()
-	mongoEndpoint := os.Getenv("MONGO_DB_URL")
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoEndpoint))
-
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	notifier, err := newNotifier(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	firebase, err := fcm.NewFirebaseMessagingClient(ctx)
-
+	sender, err := newMailer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer, err := newSigner()
+	if err != nil {
+		log.Fatal(err)
+	}
+	restrictions, err := api.ParseRestrictions(os.Getenv(api.UnverifiedRestrictionsEnvName))
+	if err != nil {
+		log.Fatal(err)
+	}
+	backend, store, err := newStores(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if backend.client != nil {
+		applied, err := db.NewMongoMigrator(backend.client).Up(ctx, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, migration := range applied {
+			log.Printf("applied migration %d: %s", migration.Version, migration.Description)
+		}
+	}
+	broker, err := newBroker(ctx, backend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	postStore, searchStore, err := newSearchBackend(backend, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	objectCache, err := newCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		cachedUsers *cache.UserStore
+		cachedPosts *cache.PostStore
+	)
+	if objectCache != nil {
+		cachedUsers = cache.NewUserStore(store.User, objectCache)
+		cachedPosts = cache.NewPostStore(postStore, objectCache)
+		store.User, postStore = cachedUsers, cachedPosts
+	}
 	var (
-		userStore = db.NewMongoUserStore(client)
-		postStore = db.NewMongoPostStore(client)
+		userStore     = store.User
+		bookmarkStore = store.Bookmark
+		jobStore      = store.Job
+		inboxStore    = store.Notification
+		tokenStore    = store.Token
+		webhookStore  = store.Webhook
+		ranker        = trending.NewRanker(postStore, trending.DefaultConfig())
+		jobs          = queue.NewQueue(jobStore, queue.DefaultConfig())
+		links         = mail.NewLinks(os.Getenv(mail.PublicURLEnvName), signer)
+		dispatcher    = notify.NewDispatcher(userStore, postStore, inboxStore, notifier, sender, links, broker, jobs)
+		digester      = digest.NewDigester(userStore, postStore, jobs, sender, links, digest.DefaultConfig())
+		accountMailer = account.NewMailer(userStore, sender, links)
+		hooks         = webhook.NewDispatcher(webhookStore, jobs)
 
-		userHandler = api.NewUserHandler(userStore)
-		postHandler = api.NewPostHandler(postStore, userStore, firebase)
+		userHandler     = api.NewUserHandler(userStore, jobs, restrictions)
+		postHandler     = api.NewPostHandler(postStore, userStore, jobs, restrictions)
+		searchHandler   = api.NewSearchHandler(searchStore, userStore)
+		trendingHandler = api.NewTrendingHandler(ranker)
+		bookmarkHandler = api.NewBookmarkHandler(bookmarkStore, postStore, userStore)
+		jobHandler      = api.NewJobHandler(jobStore)
+		inboxHandler    = api.NewNotificationHandler(inboxStore, userStore)
+		unsubHandler    = api.NewUnsubscribeHandler(userStore, signer)
+		authHandler     = api.NewAuthHandler(userStore, tokenStore, signer, jobs)
+		streamHandler   = api.NewStreamHandler(userStore, broker, signer)
+		webhookHandler  = api.NewWebhookHandler(webhookStore, jobs)
+		cacheHandler    = api.NewCacheHandler(cachedUsers, cachedPosts)
+		bulkHandler     = api.NewBulkHandler(userStore, postStore)
 
 		app = fiber.New(config)
 	)
+	jobs.Register(notify.JobNewPost, dispatcher.HandleNewPost)
+	jobs.Register(notify.JobRepost, dispatcher.HandleRepost)
+	jobs.Register(notify.JobFriendRequest, dispatcher.HandleFriendRequest)
+	jobs.Register(notify.JobPush, dispatcher.HandlePush)
+	jobs.Register(notify.JobEmail, dispatcher.HandleEmail)
+	jobs.Register(notify.JobDeliver, dispatcher.HandleDeliver)
+	jobs.Register(digest.JobDigest, digester.HandleDigest)
+	jobs.Register(account.JobVerifyEmail, accountMailer.HandleVerifyEmail)
+	jobs.Register(account.JobPasswordReset, accountMailer.HandlePasswordReset)
+	jobs.Register(webhook.JobFanOut, hooks.HandleFanOut)
+	jobs.Register(webhook.JobDeliver, hooks.HandleDeliver)
+	jobs.Start(ctx)
+	go ranker.Run(ctx)
+	go digester.Run(ctx)
+
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
 	// user handlers
@@ -58,6 +165,12 @@ func main() {
 	app.Get("/users", userHandler.HandleGetUsers)
 	app.Put("/user/:id/add", userHandler.HandleAddFriend)
 	app.Put("/user/:id/remove", userHandler.HandleRemoveFriend)
+	app.Put("/user/:id/block", userHandler.HandleBlockUser)
+	app.Put("/user/:id/unblock", userHandler.HandleUnblockUser)
+	app.Post("/user/:id/devices", userHandler.HandleRegisterDevice)
+	app.Delete("/user/:id/devices", userHandler.HandleRemoveDevice)
+	app.Get("/user/:id/notification-settings", userHandler.HandleGetNotificationSettings)
+	app.Put("/user/:id/notification-settings", userHandler.HandlePutNotificationSettings)
 
 	// post handlers
 	app.Post("/post", postHandler.HandleInsertPost)
@@ -66,11 +179,262 @@ func main() {
 	app.Get("/posts", postHandler.HandleGetPosts)
 	app.Get("/post/:id", postHandler.HandleGetPost)
 	app.Get("/post/user/:id", postHandler.HandleGetPostsByUserID)
+	app.Post("/post/:id/repost", postHandler.HandleRepost)
+
+	// bookmark handlers
+	app.Put("/post/:id/bookmark", bookmarkHandler.HandlePutBookmark)
+	app.Delete("/post/:id/bookmark", bookmarkHandler.HandleDeleteBookmark)
+	app.Get("/user/:id/bookmarks", bookmarkHandler.HandleGetBookmarks)
+	app.Post("/user/:id/lists", bookmarkHandler.HandleInsertReadingList)
+	app.Get("/user/:id/lists", bookmarkHandler.HandleGetReadingLists)
+	app.Get("/list/:id", bookmarkHandler.HandleGetReadingList)
+	app.Put("/list/:id", bookmarkHandler.HandlePutReadingList)
+	app.Delete("/list/:id", bookmarkHandler.HandleDeleteReadingList)
+	app.Put("/list/:id/post", bookmarkHandler.HandleAddToReadingList)
+	app.Delete("/list/:id/post/:postID", bookmarkHandler.HandleRemoveFromReadingList)
+
+	// auth handlers
+	app.Get("/auth/verify-email", authHandler.HandleVerifyEmail)
+	app.Post("/auth/verify-email/resend", authHandler.HandleResendVerification)
+	app.Post("/auth/password-reset", authHandler.HandleRequestPasswordReset)
+	app.Post("/auth/password-reset/confirm", authHandler.HandleConfirmPasswordReset)
+
+	// notification handlers
+	app.Get("/user/:id/notifications", inboxHandler.HandleGetNotifications)
+	app.Get("/user/:id/notifications/unread", inboxHandler.HandleGetUnreadCount)
+	app.Put("/user/:id/notifications/read", inboxHandler.HandleMarkAllRead)
+	app.Put("/user/:id/notifications/:notificationID/read", inboxHandler.HandleMarkRead)
+	app.Get("/unsubscribe", unsubHandler.HandleUnsubscribe)
+	app.Post("/unsubscribe", unsubHandler.HandleUnsubscribe)
+
+	// stream handlers
+	app.Post("/user/:id/stream-token", streamHandler.HandleStreamToken)
+	app.Get("/stream", streamHandler.HandleSSE)
+	app.Get("/ws", streamHandler.HandleWebSocket)
+
+	// search handlers
+	app.Get("/search", searchHandler.HandleSearch)
+
+	// trending handlers
+	app.Get("/trending", trendingHandler.HandleGetTrending)
+
+	// admin handlers
+	app.Get("/admin/jobs", jobHandler.HandleGetJobs)
+	app.Get("/admin/jobs/:id", jobHandler.HandleGetJob)
+	app.Post("/admin/jobs/:id/retry", jobHandler.HandleRetryJob)
+	app.Post("/admin/webhooks", webhookHandler.HandleInsertWebhook)
+	app.Get("/admin/webhooks", webhookHandler.HandleGetWebhooks)
+	app.Get("/admin/webhooks/:id", webhookHandler.HandleGetWebhook)
+	app.Put("/admin/webhooks/:id", webhookHandler.HandlePutWebhook)
+	app.Delete("/admin/webhooks/:id", webhookHandler.HandleDeleteWebhook)
+	app.Get("/admin/webhooks/:id/deliveries", webhookHandler.HandleGetDeliveries)
+	app.Post("/admin/webhooks/:id/deliveries/:deliveryID/replay", webhookHandler.HandleReplayDelivery)
+	app.Get("/admin/cache", cacheHandler.HandleGetCacheStats)
+	app.Post("/admin/import", bulkHandler.HandleImport)
+	app.Get("/admin/export", bulkHandler.HandleExport)
 
 	listenAddr := os.Getenv("HTTP_LISTEN_ADDRESS")
 	app.Listen(listenAddr)
 }
 
+// storeBackend is the database holding every store.
+type storeBackend struct {
+	name   string
+	search db.SearchStore
+	// client is the Mongo connection, nil unless the backend is Mongo.
+	client *mongo.Client
+}
+
+// newStores returns the stores of the backend selected by DB_BACKEND:
+// "mongo" (the default), which connects to MONGO_DB_URL, "postgres", which
+// connects to POSTGRES_URL, or "sqlite", which keeps them in the file at
+// SQLITE_PATH. The backend's full-text search is returned with it. Only the
+// mongo backend connects to Mongo.
+func newStores(ctx context.Context) (storeBackend, db.Store, error) {
+	switch kind := os.Getenv(storeBackendEnvName); kind {
+	case "", "mongo":
+		client, err := connectMongo(ctx)
+		if err != nil {
+			return storeBackend{}, db.Store{}, err
+		}
+		store := db.Store{
+			User:         db.NewMongoUserStore(client),
+			Post:         db.NewMongoPostStore(client),
+			Bookmark:     db.NewMongoBookmarkStore(client),
+			Job:          db.NewMongoJobStore(client),
+			Notification: db.NewMongoNotificationStore(client),
+			Token:        db.NewMongoTokenStore(client),
+			Webhook:      db.NewMongoWebhookStore(client),
+		}
+		return storeBackend{name: "mongo", search: db.NewMongoSearchStore(client), client: client}, store, nil
+	case "postgres":
+		sqlDB, err := db.OpenPostgres(ctx, os.Getenv(db.PostgresURLEnvName))
+		if err != nil {
+			return storeBackend{}, db.Store{}, err
+		}
+		store := db.Store{
+			User:         db.NewPostgresUserStore(sqlDB),
+			Post:         db.NewPostgresPostStore(sqlDB),
+			Bookmark:     db.NewPostgresBookmarkStore(sqlDB),
+			Job:          db.NewPostgresJobStore(sqlDB),
+			Notification: db.NewPostgresNotificationStore(sqlDB),
+			Token:        db.NewPostgresTokenStore(sqlDB),
+			Webhook:      db.NewPostgresWebhookStore(sqlDB),
+		}
+		return storeBackend{name: kind, search: db.NewPostgresSearchStore(sqlDB)}, store, nil
+	case "sqlite":
+		sqlDB, err := db.OpenSQLite(ctx, os.Getenv(db.SQLitePathEnvName))
+		if err != nil {
+			return storeBackend{}, db.Store{}, err
+		}
+		store := db.Store{
+			User:         db.NewSQLiteUserStore(sqlDB),
+			Post:         db.NewSQLitePostStore(sqlDB),
+			Bookmark:     db.NewSQLiteBookmarkStore(sqlDB),
+			Job:          db.NewSQLiteJobStore(sqlDB),
+			Notification: db.NewSQLiteNotificationStore(sqlDB),
+			Token:        db.NewSQLiteTokenStore(sqlDB),
+			Webhook:      db.NewSQLiteWebhookStore(sqlDB),
+		}
+		return storeBackend{name: kind, search: db.NewSQLiteSearchStore(sqlDB)}, store, nil
+	default:
+		return storeBackend{}, db.Store{}, fmt.Errorf("unknown store backend %q", kind)
+	}
+}
+
+// connectMongo connects to the Mongo server at MONGO_DB_URL.
+func connectMongo(ctx context.Context) (*mongo.Client, error) {
+	return mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv(mongoURLEnvName)))
+}
+
+// newSearchBackend returns the post store and search store for the backend
+// selected by SEARCH_BACKEND: the store backend's own full-text search (the
+// default, also selected by naming the store backend), or "index" for the
+// embedded inverted index kept in sync by the post store.
+func newSearchBackend(backend storeBackend, store db.Store) (db.PostStore, db.SearchStore, error) {
+	switch kind := os.Getenv(searchBackendEnvName); kind {
+	case "", backend.name:
+		return store.Post, backend.search, nil
+	case "index":
+		index, err := search.OpenInvertedIndex(os.Getenv(search.IndexDirEnvName))
+		if err != nil {
+			return nil, nil, err
+		}
+		return search.NewIndexedPostStore(store.Post, index), search.NewIndexSearchStore(index, store.Post, backend.search), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown search backend %q for store backend %q", kind, backend.name)
+	}
+}
+
+// newCache returns the cache for users and posts selected by CACHE_BACKEND:
+// "memory" (the default) for an LRU of CACHE_SIZE entries in each instance,
+// "redis" to share one at REDIS_ADDR between instances, or "none", for which
+// it returns nil. Entries live for CACHE_TTL.
+func newCache() (cache.Cache, error) {
+	ttl := cache.DefaultTTL
+	if value := os.Getenv(cache.TTLEnvName); len(value) > 0 {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < cache.MinTTL {
+			return nil, fmt.Errorf("invalid %s %q: want a duration of at least %s", cache.TTLEnvName, value, cache.MinTTL)
+		}
+		ttl = d
+	}
+	switch kind := os.Getenv(cache.BackendEnvName); kind {
+	case "", "memory":
+		size := cache.DefaultSize
+		if value := os.Getenv(cache.SizeEnvName); len(value) > 0 {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", cache.SizeEnvName, value)
+			}
+			size = n
+		}
+		return cache.NewLRU(size, ttl), nil
+	case "redis":
+		addr := os.Getenv(cache.RedisAddrEnvName)
+		if len(addr) == 0 {
+			return nil, fmt.Errorf("%s is not set", cache.RedisAddrEnvName)
+		}
+		return cache.NewRedis(addr, os.Getenv(cache.RedisPasswordEnvName), ttl), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", kind)
+	}
+}
+
+// newNotifier returns the push transport selected by NOTIFIER: "fcm" (the
+// default), "log", "noop" or "memory".
+func newNotifier(ctx context.Context) (notify.Notifier, error) {
+	switch kind := os.Getenv(notify.NotifierEnvName); kind {
+	case "", "fcm":
+		client, err := fcm.NewFirebaseMessagingClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case "log":
+		return notify.LogNotifier{}, nil
+	case "noop":
+		return notify.NoopNotifier{}, nil
+	case "memory":
+		return notify.NewRecorder(), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", kind)
+	}
+}
+
+// newBroker returns the real-time broker selected by REALTIME_BROKER:
+// "memory" (the default) for a single instance, or "mongo" to broadcast
+// between instances through a change stream, which needs the mongo store
+// backend.
+func newBroker(ctx context.Context, backend storeBackend) (realtime.Broker, error) {
+	switch kind := os.Getenv(realtime.BrokerEnvName); kind {
+	case "", "memory":
+		return realtime.NewMemoryBroker(), nil
+	case "mongo":
+		if backend.client == nil {
+			return nil, fmt.Errorf("realtime broker %q needs the mongo store backend, not %q", kind, backend.name)
+		}
+		broker := realtime.NewMongoBroker(backend.client)
+		go broker.Run(ctx)
+		return broker, nil
+	default:
+		return nil, fmt.Errorf("unknown realtime broker %q", kind)
+	}
+}
+
+// newMailer returns the email transport selected by MAILER: "smtp" (the
+// default), "log", "noop" or "memory".
+func newMailer() (mail.Sender, error) {
+	switch kind := os.Getenv(mail.MailerEnvName); kind {
+	case "", "smtp":
+		sender, err := mail.NewSMTPSenderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return sender, nil
+	case "log":
+		return mail.LogSender{}, nil
+	case "noop":
+		return mail.NoopSender{}, nil
+	case "memory":
+		return mail.NewRecorder(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", kind)
+	}
+}
+
+// newSigner returns the signer for the tokens in email links, keyed by
+// TOKEN_SECRET.
+func newSigner() (*token.Signer, error) {
+	secret := os.Getenv(token.SecretEnvName)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s is not set", token.SecretEnvName)
+	}
+	return token.NewSigner([]byte(secret)), nil
+}
+
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,333 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/realtime"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	JobNewPost       = "notify.new_post"
+	JobRepost        = "notify.repost"
+	JobFriendRequest = "notify.friend_request"
+	// JobPush delivers a push that was held back by the recipient's quiet
+	// hours.
+	JobPush = "notify.push"
+	// JobEmail emails an event to one recipient.
+	JobEmail = "notify.email"
+	// JobDeliver notifies one recipient of an event fanned out by another job.
+	JobDeliver = "notify.deliver"
+)
+
+// Dispatcher runs the notification jobs queued by the request handlers.
+type Dispatcher struct {
+	userStore         db.UserStore
+	postStore         db.PostStore
+	notificationStore db.NotificationStore
+	notifier          Notifier
+	sender            mail.Sender
+	links             *mail.Links
+	publisher         realtime.Publisher
+	scheduler         queue.Scheduler
+}
+
+func NewDispatcher(userStore db.UserStore, postStore db.PostStore, notificationStore db.NotificationStore, notifier Notifier, sender mail.Sender, links *mail.Links, publisher realtime.Publisher, scheduler queue.Scheduler) *Dispatcher {
+	return &Dispatcher{
+		userStore:         userStore,
+		postStore:         postStore,
+		notificationStore: notificationStore,
+		notifier:          notifier,
+		sender:            sender,
+		links:             links,
+		publisher:         publisher,
+		scheduler:         scheduler,
+	}
+}
+
+// HandleNewPost notifies the friends of the payload's author about a new post,
+// fanning out a JobDeliver per friend so that each is retried on its own.
+func (d *Dispatcher) HandleNewPost(ctx context.Context, job *types.Job) error {
+	author, err := d.userStore.GetUser(ctx, job.Payload["author"])
+	if err != nil {
+		return err
+	}
+	post, err := d.postStore.GetPostByID(ctx, job.Payload["post"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if post.Visibility == types.PostVisibilityPrivate {
+		return nil
+	}
+	friends, err := d.userStore.GetUsersByIDs(ctx, author.Friends)
+	if err != nil {
+		return err
+	}
+	// The author's friends may read friends-only posts too, unless a block
+	// stands between them.
+	friends = slices.DeleteFunc(friends, func(friend *types.User) bool {
+		return slices.Contains(author.Blocked, friend.ID) || slices.Contains(friend.Blocked, author.ID)
+	})
+	ev := Event{
+		Type:    types.EventNewPost,
+		Actor:   author,
+		PostID:  post.ID,
+		Excerpt: post.Content,
+	}
+	now := time.Now()
+	for _, friend := range friends {
+		key := job.ID.Hex() + "/" + friend.ID.Hex()
+		if _, err := d.scheduler.EnqueueOnce(ctx, key, JobDeliver, eventPayload(friend.ID, ev), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleDeliver notifies the payload's recipient of the event fanned out to
+// them.
+func (d *Dispatcher) HandleDeliver(ctx context.Context, job *types.Job) error {
+	recipient, err := d.userStore.GetUser(ctx, job.Payload["recipient"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ev, err := d.eventFromPayload(ctx, job.Payload)
+	if err != nil {
+		return err
+	}
+	return d.notify(ctx, job, recipient, ev)
+}
+
+// HandleRepost notifies the payload's recipient that their post was reposted
+// or quoted.
+func (d *Dispatcher) HandleRepost(ctx context.Context, job *types.Job) error {
+	recipient, err := d.userStore.GetUser(ctx, job.Payload["recipient"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	repost, err := d.postStore.GetPostByID(ctx, job.Payload["post"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	actor, err := d.userStore.GetUserByObjectID(ctx, repost.Author)
+	if err != nil {
+		return err
+	}
+	ev := Event{
+		Type:    types.EventRepost,
+		Actor:   actor,
+		PostID:  repost.ID,
+		Excerpt: repost.Content,
+	}
+	if repost.RepostOf != nil {
+		ev.Target = *repost.RepostOf
+		if original, err := d.postStore.GetPostByID(ctx, repost.RepostOf.Hex()); err == nil && len(ev.Excerpt) == 0 {
+			ev.Excerpt = original.Content
+		}
+	}
+	return d.notify(ctx, job, recipient, ev)
+}
+
+// HandleFriendRequest notifies the payload's recipient that the actor added
+// them as a friend.
+func (d *Dispatcher) HandleFriendRequest(ctx context.Context, job *types.Job) error {
+	recipient, err := d.userStore.GetUser(ctx, job.Payload["recipient"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	actor, err := d.userStore.GetUser(ctx, job.Payload["actor"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return d.notify(ctx, job, recipient, Event{
+		Type:  types.EventFriendRequest,
+		Actor: actor,
+	})
+}
+
+// HandlePush pushes an event that was deferred until the end of the
+// recipient's quiet hours. Preferences are checked again, since they may have
+// changed in the meantime.
+func (d *Dispatcher) HandlePush(ctx context.Context, job *types.Job) error {
+	recipient, err := d.userStore.GetUser(ctx, job.Payload["recipient"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ev, err := d.eventFromPayload(ctx, job.Payload)
+	if err != nil {
+		return err
+	}
+	return d.push(ctx, job, recipient, ev)
+}
+
+// notify delivers ev to recipient on the channels their preferences allow:
+// the in-app inbox and real-time stream, push and email, as part of job. It is
+// safe to retry: the inbox folds a repeated notification into the first, the
+// email job and any deferred push are enqueued once per job, and the stream
+// event is published last, once nothing is left to fail. Emails are sent by
+// their own jobs so a failing mail server does not hold up pushes.
+func (d *Dispatcher) notify(ctx context.Context, job *types.Job, recipient *types.User, ev Event) error {
+	pref := recipient.Preference(ev.Type)
+	if pref.InApp {
+		if err := d.notificationStore.AddNotification(ctx, NewNotification(recipient.ID, ev)); err != nil {
+			return err
+		}
+	}
+	if pref.Email && recipient.EmailVerified {
+		if _, err := d.scheduler.EnqueueOnce(ctx, job.ID.Hex()+"/email", JobEmail, eventPayload(recipient.ID, ev), time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := d.push(ctx, job, recipient, ev); err != nil {
+		return err
+	}
+	if pref.InApp {
+		return d.publish(ctx, recipient, ev)
+	}
+	return nil
+}
+
+// push sends ev to every device of recipient, in their language, as part of
+// job. During the recipient's quiet hours the push is deferred or not sent at
+// all. Tokens the notifier reports as invalid are unregistered.
+func (d *Dispatcher) push(ctx context.Context, job *types.Job, recipient *types.User, ev Event) error {
+	if !recipient.Preference(ev.Type).Push {
+		return nil
+	}
+	tokens := recipient.DeviceTokens()
+	if len(tokens) == 0 {
+		return nil
+	}
+	if until, quiet := recipient.QuietUntil(time.Now()); quiet {
+		if recipient.Notifications.QuietHours.Action != types.QuietHoursDefer {
+			return nil
+		}
+		_, err := d.scheduler.EnqueueOnce(ctx, job.ID.Hex()+"/push", JobPush, eventPayload(recipient.ID, ev), until)
+		return err
+	}
+	msg, err := Render(ev, language(recipient))
+	if err != nil {
+		return err
+	}
+	res, err := d.notifier.Send(ctx, tokens, msg)
+	if res != nil {
+		d.removeTokens(ctx, res.InvalidTokens)
+	}
+	return err
+}
+
+// language returns the language user reads notifications in.
+func language(user *types.User) string {
+	if len(user.Language) == 0 {
+		return types.DefaultLanguage
+	}
+	return user.Language
+}
+
+func eventPayload(recipient primitive.ObjectID, ev Event) map[string]string {
+	payload := map[string]string{
+		"recipient": recipient.Hex(),
+		"type":      ev.Type,
+		"excerpt":   ev.Excerpt,
+	}
+	if ev.Actor != nil {
+		payload["actor"] = ev.Actor.ID.Hex()
+	}
+	if !ev.PostID.IsZero() {
+		payload["post"] = ev.PostID.Hex()
+	}
+	if !ev.Target.IsZero() {
+		payload["target"] = ev.Target.Hex()
+	}
+	return payload
+}
+
+func (d *Dispatcher) eventFromPayload(ctx context.Context, payload map[string]string) (Event, error) {
+	ev := Event{
+		Type:    payload["type"],
+		Excerpt: payload["excerpt"],
+	}
+	if actorID, ok := payload["actor"]; ok {
+		actor, err := d.userStore.GetUser(ctx, actorID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return Event{}, err
+		}
+		ev.Actor = actor
+	}
+	if postID, ok := payload["post"]; ok {
+		ev.PostID, _ = primitive.ObjectIDFromHex(postID)
+	}
+	if target, ok := payload["target"]; ok {
+		ev.Target, _ = primitive.ObjectIDFromHex(target)
+	}
+	return ev, nil
+}
+
+// publish sends ev to the recipient's open streams. Streams are best effort,
+// so a failure to publish is only logged.
+func (d *Dispatcher) publish(ctx context.Context, recipient *types.User, ev Event) error {
+	msg, err := Render(ev, language(recipient))
+	if err != nil {
+		return err
+	}
+	data := types.StreamNotification{
+		Title: msg.Title,
+		Body:  msg.Body,
+		Link:  msg.DeepLink,
+	}
+	if !ev.PostID.IsZero() {
+		postID := ev.PostID
+		data.PostID = &postID
+	}
+	if ev.Actor != nil {
+		actor := types.NewUserSummary(ev.Actor)
+		data.Actor = &actor
+	}
+	streamEvent, err := realtime.NewEvent(ev.Type, data)
+	if err != nil {
+		return err
+	}
+	if err := d.publisher.Publish(ctx, recipient.ID.Hex(), streamEvent); err != nil {
+		log.Printf("notify: publishing %s to %s: %v", ev.Type, recipient.ID.Hex(), err)
+	}
+	return nil
+}
+
+// removeTokens unregisters dead device tokens. Failing to do so only costs a
+// wasted send next time, so it is logged rather than failing the job.
+func (d *Dispatcher) removeTokens(ctx context.Context, tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	if err := d.userStore.RemoveDeviceTokens(ctx, tokens); err != nil {
+		log.Printf("notify: removing %d invalid token(s): %v", len(tokens), err)
+	}
+}
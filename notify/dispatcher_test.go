@@ -0,0 +1,321 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/realtime"
+	"github.com/MiladJlz/blog_app/token"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// flakyNotifier fails the first failures sends, then records the rest.
+type flakyNotifier struct {
+	*notify.Recorder
+	failures int
+}
+
+func (n *flakyNotifier) Send(ctx context.Context, tokens []string, msg notify.Message) (*notify.SendResult, error) {
+	if n.failures > 0 {
+		n.failures--
+		return &notify.SendResult{FailureCount: len(tokens)}, errors.New("push service unavailable")
+	}
+	return n.Recorder.Send(ctx, tokens, msg)
+}
+
+type fixture struct {
+	users         *db.MemoryUserStore
+	posts         *db.MemoryPostStore
+	notifications db.NotificationStore
+	jobs          db.JobStore
+	queue         *queue.Queue
+	notifier      *flakyNotifier
+	mail          *mail.Recorder
+	broker        *realtime.MemoryBroker
+	dispatcher    *notify.Dispatcher
+	now           time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	sqlDB, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "notify.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	f := &fixture{
+		users:         db.NewMemoryUserStore(),
+		posts:         db.NewMemoryPostStore(),
+		notifications: db.NewSQLiteNotificationStore(sqlDB),
+		jobs:          db.NewSQLiteJobStore(sqlDB),
+		notifier:      &flakyNotifier{Recorder: notify.NewRecorder()},
+		mail:          mail.NewRecorder(),
+		broker:        realtime.NewMemoryBroker(),
+		now:           time.Now(),
+	}
+	config := queue.DefaultConfig()
+	config.Now = func() time.Time { return f.now }
+	f.queue = queue.NewQueue(f.jobs, config)
+	links := mail.NewLinks("https://blog.test", token.NewSigner([]byte("secret")))
+	f.dispatcher = notify.NewDispatcher(f.users, f.posts, f.notifications, f.notifier, f.mail, links, f.broker, f.queue)
+	f.queue.Register(notify.JobNewPost, f.dispatcher.HandleNewPost)
+	f.queue.Register(notify.JobDeliver, f.dispatcher.HandleDeliver)
+	f.queue.Register(notify.JobPush, f.dispatcher.HandlePush)
+	f.queue.Register(notify.JobEmail, f.dispatcher.HandleEmail)
+	return f
+}
+
+func (f *fixture) insertUser(t *testing.T, name string, update func(*types.User)) *types.User {
+	t.Helper()
+	user := &types.User{
+		FirstName: name,
+		Email:     name + "@blog.test",
+		Language:  types.DefaultLanguage,
+		TimeZone:  types.DefaultTimeZone,
+		Devices:   []types.Device{{Token: name + "-phone"}},
+		Friends:   []primitive.ObjectID{},
+		Blocked:   []primitive.ObjectID{},
+		Notifications: types.NotificationSettings{
+			Events: map[string]types.ChannelPreference{},
+		},
+	}
+	if update != nil {
+		update(user)
+	}
+	user, err := f.users.InsertUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	return user
+}
+
+// drain runs the due jobs, moving the clock past the backoff of the first
+// retries but not to the end of any quiet hours.
+func (f *fixture) drain(t *testing.T) {
+	t.Helper()
+	for range 5 {
+		for {
+			found, err := f.queue.RunOnce(context.Background())
+			if err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+			if !found {
+				break
+			}
+		}
+		f.now = f.now.Add(time.Minute)
+	}
+}
+
+// pending counts the jobs of jobType waiting to run.
+func (f *fixture) pending(t *testing.T, jobType string) int {
+	t.Helper()
+	jobs, err := f.jobs.GetJobs(context.Background(), types.JobStatusPending, 1, 100)
+	if err != nil {
+		t.Fatalf("GetJobs: %v", err)
+	}
+	n := 0
+	for _, job := range jobs {
+		if job.Type == jobType {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fixture) inbox(t *testing.T, user *types.User) []*types.Notification {
+	t.Helper()
+	notifications, err := f.notifications.GetNotifications(context.Background(), user.ID.Hex(), false, 1, 10)
+	if err != nil {
+		t.Fatalf("GetNotifications: %v", err)
+	}
+	return notifications
+}
+
+func pushedTo(notifier *flakyNotifier, token string) int {
+	n := 0
+	for _, sent := range notifier.Sent() {
+		for _, t := range sent.Tokens {
+			if t == token {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestNewPostFanOut(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	emailed := f.insertUser(t, "emailed", func(u *types.User) {
+		u.EmailVerified = true
+		u.Notifications.Events[types.EventNewPost] = types.ChannelPreference{Push: true, InApp: true, Email: true}
+	})
+	// Quiet hours from the hour before this one to at least an hour from now.
+	hour := time.Now().In(time.UTC).Hour()
+	quiet := f.insertUser(t, "quiet", func(u *types.User) {
+		u.TimeZone = "UTC"
+		u.Notifications.QuietHours = types.QuietHours{Enabled: true, Start: fmt.Sprintf("%02d:00", (hour+23)%24), End: fmt.Sprintf("%02d:00", (hour+2)%24), Action: types.QuietHoursDefer}
+	})
+	blocking := f.insertUser(t, "blocking", nil)
+	author := f.insertUser(t, "author", func(u *types.User) {
+		u.Friends = []primitive.ObjectID{emailed.ID, quiet.ID, blocking.ID}
+	})
+	if err := f.users.BlockUser(ctx, db.UserFilter{ID: blocking.ID}, author.ID); err != nil {
+		t.Fatalf("BlockUser: %v", err)
+	}
+	post, err := f.posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Fresh post", Author: author.ID.Hex()}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	stream := f.broker.Subscribe(emailed.ID.Hex())
+	defer stream.Close()
+
+	job, err := f.queue.Enqueue(ctx, notify.JobNewPost, map[string]string{"author": author.ID.Hex(), "post": post.ID.Hex()})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	// A retried fan-out must not deliver twice.
+	for range 2 {
+		if err := f.dispatcher.HandleNewPost(ctx, job); err != nil {
+			t.Fatalf("HandleNewPost: %v", err)
+		}
+	}
+	// The first push fails, so its delivery is retried.
+	f.notifier.failures = 1
+	f.drain(t)
+
+	if got := pushedTo(f.notifier, "emailed-phone"); got != 1 {
+		t.Errorf("pushes to a friend whose first push failed: got %d, want 1", got)
+	}
+	if got, deferred := pushedTo(f.notifier, "quiet-phone"), f.pending(t, notify.JobPush); got != 0 || deferred != 1 {
+		t.Errorf("pushes to a friend in quiet hours: got %d sent and %d deferred, want 1 deferred", got, deferred)
+	}
+	if got := pushedTo(f.notifier, "blocking-phone"); got != 0 {
+		t.Errorf("pushes to a friend who blocks the author: got %d, want none", got)
+	}
+	if sent := f.mail.Sent(); len(sent) != 1 || sent[0].To != emailed.Email {
+		t.Errorf("emails: got %d, want one to %s", len(sent), emailed.Email)
+	}
+	for _, friend := range []*types.User{emailed, quiet} {
+		if inbox := f.inbox(t, friend); len(inbox) != 1 || inbox[0].Type != types.EventNewPost {
+			t.Errorf("inbox of %s: got %d notifications, want the new post once", friend.FirstName, len(inbox))
+		}
+	}
+	if inbox := f.inbox(t, blocking); len(inbox) != 0 {
+		t.Errorf("inbox of a friend who blocks the author: got %d notifications, want none", len(inbox))
+	}
+	if events := len(stream.C); events != 1 {
+		t.Errorf("stream events: got %d, want 1", events)
+	}
+}
+
+func TestPrivatePostsAreNotAnnounced(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	friend := f.insertUser(t, "friend", nil)
+	author := f.insertUser(t, "author", func(u *types.User) { u.Friends = []primitive.ObjectID{friend.ID} })
+	post, err := f.posts.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: "Just for me", Author: author.ID.Hex(), Visibility: types.PostVisibilityPrivate}))
+	if err != nil {
+		t.Fatalf("InsertPost: %v", err)
+	}
+	if _, err := f.queue.Enqueue(ctx, notify.JobNewPost, map[string]string{"author": author.ID.Hex(), "post": post.ID.Hex()}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	f.drain(t)
+	if sent := f.notifier.Sent(); len(sent) != 0 {
+		t.Errorf("pushes for a private post: got %d, want none", len(sent))
+	}
+	if inbox := f.inbox(t, friend); len(inbox) != 0 {
+		t.Errorf("inbox for a private post: got %d notifications, want none", len(inbox))
+	}
+}
+
+func TestInvalidTokensAreRemoved(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	friend := f.insertUser(t, "friend", func(u *types.User) {
+		u.Devices = append(u.Devices, types.Device{Token: "stale-phone"})
+	})
+	actor := f.insertUser(t, "actor", nil)
+	f.notifier.Invalidate("stale-phone")
+	if _, err := f.queue.Enqueue(ctx, notify.JobFriendRequest, map[string]string{"recipient": friend.ID.Hex(), "actor": actor.ID.Hex()}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	f.queue.Register(notify.JobFriendRequest, f.dispatcher.HandleFriendRequest)
+	f.drain(t)
+	got, err := f.users.GetUser(ctx, friend.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if tokens := got.DeviceTokens(); len(tokens) != 1 || tokens[0] != "friend-phone" {
+		t.Errorf("device tokens after an invalid one was reported: got %v, want only friend-phone", tokens)
+	}
+}
+
+func TestQuietHoursDeferOrDropPushes(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.queue.Register(notify.JobFriendRequest, f.dispatcher.HandleFriendRequest)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Quiet hours in Tokyo from the hour before this one there to at least
+	// an hour from now.
+	local := time.Now().In(tokyo)
+	end := (local.Hour() + 2) % 24
+	quietHours := func(action string) func(*types.User) {
+		return func(u *types.User) {
+			u.TimeZone = tokyo.String()
+			u.Notifications.QuietHours = types.QuietHours{Enabled: true, Start: fmt.Sprintf("%02d:00", (local.Hour()+23)%24), End: fmt.Sprintf("%02d:00", end), Action: action}
+		}
+	}
+	deferring := f.insertUser(t, "deferring", quietHours(types.QuietHoursDefer))
+	dropping := f.insertUser(t, "dropping", quietHours(types.QuietHoursDrop))
+	actor := f.insertUser(t, "actor", nil)
+	for _, recipient := range []*types.User{deferring, dropping} {
+		if _, err := f.queue.Enqueue(ctx, notify.JobFriendRequest, map[string]string{"recipient": recipient.ID.Hex(), "actor": actor.ID.Hex()}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	f.drain(t)
+
+	if sent := f.notifier.Sent(); len(sent) != 0 {
+		t.Errorf("pushes during quiet hours: got %d, want none", len(sent))
+	}
+	for _, recipient := range []*types.User{deferring, dropping} {
+		if inbox := f.inbox(t, recipient); len(inbox) != 1 {
+			t.Errorf("inbox of %s: got %d notifications, want the request", recipient.FirstName, len(inbox))
+		}
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end, 0, 0, 0, tokyo)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	jobs, err := f.jobs.GetJobs(ctx, types.JobStatusPending, 1, 100)
+	if err != nil {
+		t.Fatalf("GetJobs: %v", err)
+	}
+	var pushes []*types.Job
+	for _, job := range jobs {
+		if job.Type == notify.JobPush {
+			pushes = append(pushes, job)
+		}
+	}
+	if len(pushes) != 1 || pushes[0].Payload["recipient"] != deferring.ID.Hex() {
+		t.Fatalf("deferred pushes: got %+v, want one to %s", pushes, deferring.FirstName)
+	}
+	if !pushes[0].RunAt.Equal(until) {
+		t.Errorf("deferred push: runs at %v, want the end of quiet hours at %v", pushes[0].RunAt, until)
+	}
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/mail"
+	"github.com/MiladJlz/blog_app/types"
+)
+
+var openLabels = map[string]string{
+	"en": "Open in the app",
+	"fa": "مشاهده در برنامه",
+}
+
+// HandleEmail emails an event to the payload's recipient if they still want
+// emails for it.
+func (d *Dispatcher) HandleEmail(ctx context.Context, job *types.Job) error {
+	recipient, err := d.userStore.GetUser(ctx, job.Payload["recipient"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ev, err := d.eventFromPayload(ctx, job.Payload)
+	if err != nil {
+		return err
+	}
+	if !recipient.Preference(ev.Type).Email || !recipient.EmailVerified {
+		return nil
+	}
+	msg, err := RenderEmail(ev, recipient, d.links)
+	if err != nil {
+		return err
+	}
+	return d.sender.Send(ctx, msg)
+}
+
+// RenderEmail renders ev as an email to recipient in their language.
+func RenderEmail(ev Event, recipient *types.User, links *mail.Links) (mail.Message, error) {
+	lang := recipient.Language
+	if len(lang) == 0 {
+		lang = types.DefaultLanguage
+	}
+	push, err := Render(ev, lang)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	content := mail.Content{
+		Lang:        lang,
+		Title:       push.Title,
+		Intro:       push.Body,
+		Unsubscribe: links.Unsubscribe(recipient.ID.Hex()),
+	}
+	if len(push.DeepLink) > 0 {
+		label, ok := openLabels[lang]
+		if !ok {
+			label = openLabels[types.DefaultLanguage]
+		}
+		content.Action = &mail.Item{Title: label, Link: push.DeepLink}
+	}
+	return mail.Compose(recipient.Email, push.Title, content)
+}
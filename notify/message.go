@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const (
+	DeepLinkScheme = "blogapp://"
+	maxExcerptLen  = 120
+)
+
+// Event is something that happened that a user should be told about.
+type Event struct {
+	Type    string
+	Actor   *types.User
+	PostID  primitive.ObjectID
+	Excerpt string
+	// Target is the recipient's post the event is about, if any. Events on
+	// the same target are grouped in the inbox.
+	Target primitive.ObjectID
+	// Others is how many more actors did the same thing; it selects the
+	// grouped wording ("foo bar and 4 others ...").
+	Others int
+}
+
+// GroupKey identifies the events that are folded into one inbox notification.
+func (ev Event) GroupKey() string {
+	switch {
+	case !ev.Target.IsZero():
+		return ev.Type + ":" + ev.Target.Hex()
+	case !ev.PostID.IsZero():
+		return ev.Type + ":" + ev.PostID.Hex()
+	default:
+		return ev.Type
+	}
+}
+
+// Message is an Event rendered for one language, ready for a transport.
+type Message struct {
+	Title       string
+	Body        string
+	Data        map[string]string
+	DeepLink    string
+	CollapseKey string
+}
+
+type messageTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+var templates = map[string]map[string]messageTemplate{
+	"en": {
+		types.EventNewPost:       newTemplate("{{.Actor}} published a new post", "{{.Excerpt}}"),
+		types.EventRepost:        newTemplate("{{.Actor}} shared your post", "{{.Excerpt}}"),
+		types.EventComment:       newTemplate("{{.Actor}} commented on your post", "{{.Excerpt}}"),
+		types.EventFriendRequest: newTemplate("New friend", "{{.Actor}} added you as a friend"),
+		types.EventMention:       newTemplate("{{.Actor}} mentioned you", "{{.Excerpt}}"),
+	},
+	"fa": {
+		types.EventNewPost:       newTemplate("{{.Actor}} پست جدیدی منتشر کرد", "{{.Excerpt}}"),
+		types.EventRepost:        newTemplate("{{.Actor}} پست شما را به اشتراک گذاشت", "{{.Excerpt}}"),
+		types.EventComment:       newTemplate("{{.Actor}} برای پست شما نظر گذاشت", "{{.Excerpt}}"),
+		types.EventFriendRequest: newTemplate("دوست جدید", "{{.Actor}} شما را به دوستانش اضافه کرد"),
+		types.EventMention:       newTemplate("{{.Actor}} از شما نام برد", "{{.Excerpt}}"),
+	},
+}
+
+// groupTemplates word an event that several actors took part in.
+var groupTemplates = map[string]map[string]messageTemplate{
+	"en": {
+		types.EventNewPost:       newTemplate("{{.Actor}} and {{.Others}} others published new posts", "{{.Excerpt}}"),
+		types.EventRepost:        newTemplate("{{.Actor}} and {{.Others}} others shared your post", "{{.Excerpt}}"),
+		types.EventComment:       newTemplate("{{.Actor}} and {{.Others}} others commented on your post", "{{.Excerpt}}"),
+		types.EventFriendRequest: newTemplate("New friends", "{{.Actor}} and {{.Others}} others added you as a friend"),
+		types.EventMention:       newTemplate("{{.Actor}} and {{.Others}} others mentioned you", "{{.Excerpt}}"),
+	},
+	"fa": {
+		types.EventNewPost:       newTemplate("{{.Actor}} و {{.Others}} نفر دیگر پست‌های جدیدی منتشر کردند", "{{.Excerpt}}"),
+		types.EventRepost:        newTemplate("{{.Actor}} و {{.Others}} نفر دیگر پست شما را به اشتراک گذاشتند", "{{.Excerpt}}"),
+		types.EventComment:       newTemplate("{{.Actor}} و {{.Others}} نفر دیگر برای پست شما نظر گذاشتند", "{{.Excerpt}}"),
+		types.EventFriendRequest: newTemplate("دوستان جدید", "{{.Actor}} و {{.Others}} نفر دیگر شما را به دوستانشان اضافه کردند"),
+		types.EventMention:       newTemplate("{{.Actor}} و {{.Others}} نفر دیگر از شما نام بردند", "{{.Excerpt}}"),
+	},
+}
+
+func newTemplate(title string, body string) messageTemplate {
+	return messageTemplate{
+		title: template.Must(template.New("title").Parse(title)),
+		body:  template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// Render turns ev into a Message in lang, falling back to English when there
+// is no translation.
+func Render(ev Event, lang string) (Message, error) {
+	set := templates
+	if ev.Others > 0 {
+		set = groupTemplates
+	}
+	tmpl, ok := set[lang][ev.Type]
+	if !ok {
+		tmpl, ok = set[types.DefaultLanguage][ev.Type]
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("no template for event %s", ev.Type)
+	}
+	vars := map[string]string{
+		"Actor":   actorName(ev.Actor),
+		"Excerpt": Excerpt(ev.Excerpt),
+		"Others":  strconv.Itoa(ev.Others),
+	}
+	var title, body bytes.Buffer
+	if err := tmpl.title.Execute(&title, vars); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.body.Execute(&body, vars); err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{
+		Title: title.String(),
+		Body:  body.String(),
+		Data:  map[string]string{"type": ev.Type},
+	}
+	if ev.Actor != nil {
+		msg.Data["user_id"] = ev.Actor.ID.Hex()
+		msg.DeepLink = DeepLinkScheme + "user/" + ev.Actor.ID.Hex()
+		msg.CollapseKey = ev.Type + ":" + ev.Actor.ID.Hex()
+	}
+	if !ev.PostID.IsZero() {
+		msg.Data["post_id"] = ev.PostID.Hex()
+		msg.DeepLink = DeepLinkScheme + "post/" + ev.PostID.Hex()
+	}
+	if len(msg.DeepLink) > 0 {
+		msg.Data["link"] = msg.DeepLink
+	}
+	if len(msg.CollapseKey) > 0 {
+		msg.Data["collapse_key"] = msg.CollapseKey
+	}
+	return msg, nil
+}
+
+// RenderNotification renders an inbox notification in lang, naming its most
+// recent actor and counting the rest.
+func RenderNotification(n *types.Notification, lang string) (*types.NotificationView, error) {
+	ev := Event{
+		Type:    n.Type,
+		Excerpt: n.Excerpt,
+	}
+	if len(n.Actors) > 0 {
+		actor := n.Actors[0]
+		ev.Actor = &types.User{ID: actor.ID, FirstName: actor.FirstName, LastName: actor.LastName}
+		ev.Others = n.ActorCount - 1
+	}
+	if n.PostID != nil {
+		ev.PostID = *n.PostID
+	}
+	msg, err := Render(ev, lang)
+	if err != nil {
+		return nil, err
+	}
+	return &types.NotificationView{
+		Notification: n,
+		Title:        msg.Title,
+		Body:         msg.Body,
+		Link:         msg.DeepLink,
+	}, nil
+}
+
+// NewNotification builds the inbox entry for ev addressed to recipient.
+func NewNotification(recipient primitive.ObjectID, ev Event) *types.Notification {
+	now := time.Now()
+	n := &types.Notification{
+		Recipient: recipient,
+		Type:      ev.Type,
+		GroupKey:  ev.GroupKey(),
+		Excerpt:   Excerpt(ev.Excerpt),
+		Actors:    []types.UserSummary{},
+		ActorIDs:  []primitive.ObjectID{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !ev.PostID.IsZero() {
+		postID := ev.PostID
+		n.PostID = &postID
+	}
+	if ev.Actor != nil {
+		n.Actors = append(n.Actors, types.NewUserSummary(ev.Actor))
+		n.ActorIDs = append(n.ActorIDs, ev.Actor.ID)
+		n.ActorCount = 1
+	}
+	return n
+}
+
+// Excerpt shortens text to at most maxExcerptLen characters.
+func Excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxExcerptLen {
+		return text
+	}
+	return string(runes[:maxExcerptLen-1]) + "…"
+}
+
+func actorName(user *types.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.FirstName + " " + user.LastName
+}
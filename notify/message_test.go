@@ -0,0 +1,111 @@
+package notify_test
+
+import (
+	"github.com/MiladJlz/blog_app/notify"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	actor := &types.User{ID: primitive.NewObjectID(), FirstName: "Foo", LastName: "Bar"}
+	postID := primitive.NewObjectID()
+	repost := notify.Event{Type: types.EventRepost, Actor: actor, PostID: postID, Excerpt: "Worth sharing"}
+	friend := notify.Event{Type: types.EventFriendRequest, Actor: actor}
+	grouped := repost
+	grouped.Others = 4
+	tests := []struct {
+		name      string
+		ev        notify.Event
+		lang      string
+		wantTitle string
+		wantBody  string
+	}{
+		{"english", repost, "en", "Foo Bar shared your post", "Worth sharing"},
+		{"persian", repost, "fa", "Foo Bar پست شما را به اشتراک گذاشت", "Worth sharing"},
+		{"persian without an excerpt", friend, "fa", "دوست جدید", "Foo Bar شما را به دوستانش اضافه کرد"},
+		{"untranslated language", friend, "de", "New friend", "Foo Bar added you as a friend"},
+		{"no language", friend, "", "New friend", "Foo Bar added you as a friend"},
+		{"grouped, english", grouped, "en", "Foo Bar and 4 others shared your post", "Worth sharing"},
+		{"grouped, persian", grouped, "fa", "Foo Bar و 4 نفر دیگر پست شما را به اشتراک گذاشتند", "Worth sharing"},
+		{"grouped, untranslated language", grouped, "de", "Foo Bar and 4 others shared your post", "Worth sharing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := notify.Render(tt.ev, tt.lang)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if msg.Title != tt.wantTitle || msg.Body != tt.wantBody {
+				t.Errorf("Render(%s, %q) = %q / %q, want %q / %q", tt.ev.Type, tt.lang, msg.Title, msg.Body, tt.wantTitle, tt.wantBody)
+			}
+		})
+	}
+
+	msg, err := notify.Render(repost, "fa")
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	link := notify.DeepLinkScheme + "post/" + postID.Hex()
+	if msg.DeepLink != link || msg.Data["link"] != link || msg.Data["post_id"] != postID.Hex() || msg.Data["user_id"] != actor.ID.Hex() || msg.Data["type"] != types.EventRepost {
+		t.Errorf("Render: got link %s and data %v", msg.DeepLink, msg.Data)
+	}
+	if msg, _ := notify.Render(friend, "en"); msg.DeepLink != notify.DeepLinkScheme+"user/"+actor.ID.Hex() {
+		t.Errorf("Render without a post: got link %s, want the actor's profile", msg.DeepLink)
+	}
+	if _, err := notify.Render(notify.Event{Type: "unknown", Actor: actor}, "fa"); err == nil {
+		t.Error("Render of an unknown event: got no error")
+	}
+}
+
+// TestRenderEveryEvent checks that every event a user can be notified of
+// reads differently in each language, alone and grouped.
+func TestRenderEveryEvent(t *testing.T) {
+	actor := &types.User{ID: primitive.NewObjectID(), FirstName: "Foo"}
+	for _, eventType := range types.NotifiableEvents {
+		for _, others := range []int{0, 2} {
+			ev := notify.Event{Type: eventType, Actor: actor, Excerpt: "Hello", Others: others}
+			en, err := notify.Render(ev, "en")
+			if err != nil {
+				t.Errorf("Render(%s, en): %v", eventType, err)
+				continue
+			}
+			fa, err := notify.Render(ev, "fa")
+			if err != nil {
+				t.Errorf("Render(%s, fa): %v", eventType, err)
+				continue
+			}
+			if en.Title == fa.Title || !strings.Contains(en.Title+en.Body, "Foo") || !strings.Contains(fa.Title+fa.Body, "Foo") {
+				t.Errorf("%s with %d others: got %q in English and %q in Persian", eventType, others, en.Title, fa.Title)
+			}
+			if others > 0 && !strings.Contains(fa.Title+fa.Body, "2") {
+				t.Errorf("%s with %d others: %q does not count them", eventType, others, fa.Title+fa.Body)
+			}
+		}
+	}
+}
+
+func TestRenderNotification(t *testing.T) {
+	postID := primitive.NewObjectID()
+	n := &types.Notification{
+		Type:       types.EventComment,
+		PostID:     &postID,
+		Excerpt:    strings.Repeat("a", 200),
+		Actors:     []types.UserSummary{{ID: primitive.NewObjectID(), FirstName: "Foo", LastName: "Bar"}},
+		ActorCount: 3,
+	}
+	view, err := notify.RenderNotification(n, "de")
+	if err != nil {
+		t.Fatalf("RenderNotification: %v", err)
+	}
+	if view.Title != "Foo Bar and 2 others commented on your post" {
+		t.Errorf("title: got %q", view.Title)
+	}
+	if body := []rune(view.Body); len(body) != 120 || body[119] != '…' {
+		t.Errorf("body: got %d characters ending in %q, want 120 ending in an ellipsis", len(body), body[len(body)-1])
+	}
+	if view.Link != notify.DeepLinkScheme+"post/"+postID.Hex() {
+		t.Errorf("link: got %s", view.Link)
+	}
+}
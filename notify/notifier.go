@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+const NotifierEnvName = "NOTIFIER"
+
+// Notifier delivers push notifications to device tokens. Send returns a
+// result even when it fails, covering every token it tried.
+type Notifier interface {
+	Send(ctx context.Context, tokens []string, msg Message) (*SendResult, error)
+}
+
+// SendResult reports how a Send went per token. InvalidTokens lists the
+// tokens the transport says will never be delivered to again, so callers can
+// unregister them.
+type SendResult struct {
+	SuccessCount  int
+	FailureCount  int
+	InvalidTokens []string
+}
+
+// NoopNotifier drops every notification.
+type NoopNotifier struct{}
+
+func (NoopNotifier) Send(ctx context.Context, tokens []string, msg Message) (*SendResult, error) {
+	return &SendResult{SuccessCount: len(tokens)}, nil
+}
+
+// LogNotifier writes notifications to the standard logger instead of sending them.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, tokens []string, msg Message) (*SendResult, error) {
+	log.Printf("notify: %q (%s) to %d device(s)", msg.Title, msg.DeepLink, len(tokens))
+	return &SendResult{SuccessCount: len(tokens)}, nil
+}
+
+type Notification struct {
+	Tokens  []string
+	Message Message
+}
+
+// Recorder keeps every notification in memory so tests can assert on them.
+type Recorder struct {
+	mu      sync.Mutex
+	sent    []Notification
+	invalid map[string]bool
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Send(ctx context.Context, tokens []string, msg Message) (*SendResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, Notification{
+		Tokens:  append([]string(nil), tokens...),
+		Message: msg,
+	})
+	res := &SendResult{}
+	for _, token := range tokens {
+		if r.invalid[token] {
+			res.FailureCount++
+			res.InvalidTokens = append(res.InvalidTokens, token)
+			continue
+		}
+		res.SuccessCount++
+	}
+	return res, nil
+}
+
+// Invalidate makes later sends report tokens as invalid.
+func (r *Recorder) Invalidate(tokens ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.invalid == nil {
+		r.invalid = map[string]bool{}
+	}
+	for _, token := range tokens {
+		r.invalid[token] = true
+	}
+}
+
+// Sent returns a copy of the notifications recorded so far.
+func (r *Recorder) Sent() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.sent...)
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = nil
+	r.invalid = nil
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type HandlerFunc func(ctx context.Context, job *types.Job) error
+
+// Enqueuer is the part of Queue that request handlers need.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, jobType string, payload map[string]string) (*types.Job, error)
+}
+
+// Scheduler is the part of Queue that defers work to a later time.
+type Scheduler interface {
+	EnqueueAt(ctx context.Context, jobType string, payload map[string]string, runAt time.Time) (*types.Job, error)
+	EnqueueOnce(ctx context.Context, key string, jobType string, payload map[string]string, runAt time.Time) (*types.Job, error)
+}
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// Lease is how long a worker owns a claimed job before another worker
+	// may pick it up again.
+	Lease time.Duration
+	// Timeout is how long a handler may run. It is kept shorter than Lease,
+	// leaving the worker time to record the outcome while it owns the job.
+	Timeout     time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Now         func() time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:      4,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		Timeout:      50 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  2 * time.Second,
+		MaxBackoff:   30 * time.Minute,
+		Now:          time.Now,
+	}
+}
+
+// Queue runs jobs stored in a JobStore on a pool of worker goroutines. Failed
+// jobs are retried with exponential backoff and marked dead once they run out
+// of attempts.
+type Queue struct {
+	jobStore db.JobStore
+	config   Config
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+func NewQueue(jobStore db.JobStore, config Config) *Queue {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.Timeout <= 0 || config.Timeout >= config.Lease {
+		config.Timeout = config.Lease * 5 / 6
+	}
+	return &Queue{
+		jobStore: jobStore,
+		config:   config,
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+func (q *Queue) Register(jobType string, handler HandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload map[string]string) (*types.Job, error) {
+	return q.jobStore.InsertJob(ctx, types.NewJob(jobType, payload, q.config.MaxAttempts, q.config.Now()))
+}
+
+// EnqueueAt schedules a job to run no earlier than runAt.
+func (q *Queue) EnqueueAt(ctx context.Context, jobType string, payload map[string]string, runAt time.Time) (*types.Job, error) {
+	job := types.NewJob(jobType, payload, q.config.MaxAttempts, q.config.Now())
+	job.RunAt = runAt
+	return q.jobStore.InsertJob(ctx, job)
+}
+
+// EnqueueOnce schedules a job to run no earlier than runAt, unless a job was
+// already enqueued under key; then it returns a nil job and no error. Jobs
+// that fan out into others key them by their own ID, so that a retry does not
+// enqueue the same work twice. Keys only dedupe while the job is stored.
+func (q *Queue) EnqueueOnce(ctx context.Context, key string, jobType string, payload map[string]string, runAt time.Time) (*types.Job, error) {
+	job := types.NewJob(jobType, payload, q.config.MaxAttempts, q.config.Now())
+	job.ID = KeyID(key)
+	job.RunAt = runAt
+	job, err := q.jobStore.InsertJob(ctx, job)
+	if errors.Is(err, db.ErrConflict) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// KeyID derives the ID of the job enqueued under key.
+func KeyID(key string) primitive.ObjectID {
+	var id primitive.ObjectID
+	sum := sha256.Sum256([]byte(key))
+	copy(id[:], sum[:])
+	return id
+}
+
+// Start launches the workers; they stop when ctx is done.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.config.Workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// RunOnce claims and processes a single due job. It reports whether a job was
+// found, which lets tests drive the queue without workers.
+func (q *Queue) RunOnce(ctx context.Context) (bool, error) {
+	job, err := q.jobStore.ClaimJob(ctx, q.config.Now(), q.config.Lease)
+	if err != nil || job == nil {
+		return false, err
+	}
+	return true, q.process(ctx, job)
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		found, err := q.RunOnce(ctx)
+		if err != nil {
+			log.Printf("queue: %v", err)
+		}
+		if found {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.config.PollInterval):
+		}
+	}
+}
+
+// process runs job and records the outcome. If the job outlived its lease and
+// was claimed again, the outcome is dropped and the error says so.
+func (q *Queue) process(ctx context.Context, job *types.Job) error {
+	err := q.record(ctx, job)
+	if errors.Is(err, db.ErrLeaseLost) {
+		return fmt.Errorf("job %s (%s) ran past its lease: %w", job.ID.Hex(), job.Type, err)
+	}
+	return err
+}
+
+func (q *Queue) record(ctx context.Context, job *types.Job) error {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		return q.jobStore.KillJob(ctx, job, fmt.Sprintf("no handler for job type %s", job.Type))
+	}
+	err := q.run(ctx, handler, job)
+	if err == nil {
+		return q.jobStore.CompleteJob(ctx, job)
+	}
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("queue: job %s (%s) is dead after %d attempts: %v", job.ID.Hex(), job.Type, job.Attempts, err)
+		return q.jobStore.KillJob(ctx, job, err.Error())
+	}
+	runAt := q.config.Now().Add(Backoff(job.Attempts, q.config.BaseBackoff, q.config.MaxBackoff))
+	return q.jobStore.RetryJob(ctx, job, runAt, err.Error())
+}
+
+// run calls handler with the Timeout as its deadline, turning a panic into an
+// error so one bad job cannot take a worker down.
+func (q *Queue) run(ctx context.Context, handler HandlerFunc, job *types.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, q.config.Timeout)
+	defer cancel()
+	return handler(ctx, job)
+}
+
+// Backoff returns the delay before retry number attempt: base doubled for
+// every earlier attempt, capped at maxDelay, with up to 20% random jitter.
+func Backoff(attempt int, base time.Duration, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
@@ -0,0 +1,185 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/types"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newQueue returns a queue on a scratch SQLite job store, with a clock the
+// test moves by hand.
+func newQueue(t *testing.T) (*queue.Queue, db.JobStore, *time.Time) {
+	t.Helper()
+	sqlDB, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	store := db.NewSQLiteJobStore(sqlDB)
+	now := time.Now().Truncate(time.Millisecond)
+	config := queue.DefaultConfig()
+	config.MaxAttempts = 3
+	config.Now = func() time.Time { return now }
+	return queue.NewQueue(store, config), store, &now
+}
+
+func runOnce(t *testing.T, q *queue.Queue) bool {
+	t.Helper()
+	found, err := q.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	return found
+}
+
+func getJob(t *testing.T, store db.JobStore, job *types.Job) *types.Job {
+	t.Helper()
+	got, err := store.GetJob(context.Background(), job.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	return got
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newQueue(t)
+	var runs int
+	q.Register("flaky", func(ctx context.Context, job *types.Job) error {
+		runs++
+		if runs == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	job, err := q.Enqueue(ctx, "flaky", map[string]string{"n": "1"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if !runOnce(t, q) {
+		t.Fatal("RunOnce: no job found")
+	}
+	got := getJob(t, store, job)
+	if got.Status != types.JobStatusPending || got.LastError != "boom" || !got.RunAt.After(*now) {
+		t.Fatalf("failed job: got status %s, error %q, run at %v, want a later retry", got.Status, got.LastError, got.RunAt)
+	}
+	if runOnce(t, q) {
+		t.Fatal("RunOnce: ran a job before its backoff was over")
+	}
+	*now = got.RunAt
+	if !runOnce(t, q) {
+		t.Fatal("RunOnce after the backoff: no job found")
+	}
+	if got := getJob(t, store, job); got.Status != types.JobStatusDone || got.Attempts != 2 {
+		t.Errorf("retried job: got status %s after %d attempts, want done after 2", got.Status, got.Attempts)
+	}
+}
+
+func TestDeadJobs(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newQueue(t)
+	q.Register("failing", func(ctx context.Context, job *types.Job) error { return errors.New("always") })
+	q.Register("panicking", func(ctx context.Context, job *types.Job) error { panic("oops") })
+	failing, _ := q.Enqueue(ctx, "failing", nil)
+	panicking, _ := q.Enqueue(ctx, "panicking", nil)
+	unknown, _ := q.Enqueue(ctx, "unknown", nil)
+
+	for range 10 {
+		*now = now.Add(time.Hour)
+		for runOnce(t, q) {
+		}
+	}
+	if got := getJob(t, store, failing); got.Status != types.JobStatusDead || got.Attempts != 3 || got.LastError != "always" {
+		t.Errorf("failing job: got status %s after %d attempts with %q, want dead after 3", got.Status, got.Attempts, got.LastError)
+	}
+	if got := getJob(t, store, panicking); got.Status != types.JobStatusDead || got.LastError != "panic: oops" {
+		t.Errorf("panicking job: got status %s with %q, want dead with the panic", got.Status, got.LastError)
+	}
+	if got := getJob(t, store, unknown); got.Status != types.JobStatusDead || got.Attempts != 1 {
+		t.Errorf("job without a handler: got status %s after %d attempts, want dead after 1", got.Status, got.Attempts)
+	}
+}
+
+func TestEnqueueAt(t *testing.T) {
+	ctx := context.Background()
+	q, _, now := newQueue(t)
+	var ran []string
+	q.Register("later", func(ctx context.Context, job *types.Job) error {
+		ran = append(ran, job.Payload["key"])
+		return nil
+	})
+	if _, err := q.EnqueueAt(ctx, "later", map[string]string{"key": "at"}, now.Add(time.Hour)); err != nil {
+		t.Fatalf("EnqueueAt: %v", err)
+	}
+	for range 2 {
+		job, err := q.EnqueueOnce(ctx, "same key", "later", map[string]string{"key": "once"}, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("EnqueueOnce: %v", err)
+		}
+		if job != nil && job.ID != queue.KeyID("same key") {
+			t.Errorf("EnqueueOnce: job ID %s, want the key's", job.ID.Hex())
+		}
+	}
+	if runOnce(t, q) {
+		t.Fatal("RunOnce: ran a job before it was due")
+	}
+	*now = now.Add(time.Hour)
+	for runOnce(t, q) {
+	}
+	if len(ran) != 2 {
+		t.Errorf("ran %q, want the scheduled job and the keyed one once", ran)
+	}
+	if job, err := q.EnqueueOnce(ctx, "same key", "later", nil, *now); err != nil || job != nil {
+		t.Errorf("EnqueueOnce of a completed key: got %v, %v, want no job", job, err)
+	}
+}
+
+// TestLeaseLost has a handler outlive its lease, with another worker claiming
+// the job meanwhile: the first worker must not record its outcome.
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newQueue(t)
+	lease := queue.DefaultConfig().Lease
+	var runs int
+	q.Register("slow", func(ctx context.Context, job *types.Job) error {
+		runs++
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) >= lease {
+			t.Errorf("handler deadline %v, want one sooner than the %s lease", deadline, lease)
+		}
+		if runs == 1 {
+			*now = now.Add(lease)
+			if !runOnce(t, q) {
+				t.Error("RunOnce after the lease: no job found")
+			}
+		}
+		return nil
+	})
+	job, err := q.Enqueue(ctx, "slow", nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	found, err := q.RunOnce(ctx)
+	if !found || !errors.Is(err, db.ErrLeaseLost) {
+		t.Errorf("RunOnce: got %v, %v, want the lease lost", found, err)
+	}
+	if got := getJob(t, store, job); got.Status != types.JobStatusDone || got.Attempts != 2 || runs != 2 {
+		t.Errorf("job: got status %s after %d attempts and %d runs, want done by the second", got.Status, got.Attempts, runs)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, maxDelay := time.Second, time.Minute
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 20: time.Minute} {
+		got := queue.Backoff(attempt, base, maxDelay)
+		if got < want || got > want+want/5 {
+			t.Errorf("Backoff(%d) = %v, want %v plus up to 20%%", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	BrokerEnvName = "REALTIME_BROKER"
+
+	// TokenPurpose is what stream tokens are signed for.
+	TokenPurpose = "stream"
+
+	// subscriptionBuffer is how many events a slow subscriber may fall
+	// behind before events for it are dropped.
+	subscriptionBuffer = 64
+)
+
+// Event is a message delivered to one user's open streams. Its Type is the
+// notification event it carries: a new friend post, a repost or a friend
+// request. Comments and reactions have no endpoints yet, so no events are
+// published for them.
+type Event struct {
+	ID   string          `json:"id" bson:"id"`
+	Type string          `json:"type" bson:"type"`
+	Data json.RawMessage `json:"data" bson:"data"`
+}
+
+func NewEvent(eventType string, data any) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:   primitive.NewObjectID().Hex(),
+		Type: eventType,
+		Data: b,
+	}, nil
+}
+
+// Publisher is the part of a Broker that producers of events need.
+type Publisher interface {
+	Publish(ctx context.Context, userID string, ev Event) error
+}
+
+// Broker routes events to the streams a user has open. Delivery is best
+// effort: events published while a user has no stream open are not kept.
+type Broker interface {
+	Publisher
+	Subscribe(userID string) *Subscription
+}
+
+type Subscription struct {
+	C     <-chan Event
+	close func()
+}
+
+// Close stops delivery to the subscription and closes C.
+func (s *Subscription) Close() {
+	s.close()
+}
@@ -0,0 +1,58 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryBroker delivers events to subscribers in the same process.
+type MemoryBroker struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subs: map[string]map[chan Event]struct{}{},
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, userID string, ev Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs[userID] {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("realtime: dropping %s event for slow subscriber of %s", ev.Type, userID)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(userID string) *Subscription {
+	ch := make(chan Event, subscriptionBuffer)
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[chan Event]struct{}{}
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return &Subscription{
+		C: ch,
+		close: func() {
+			once.Do(func() {
+				b.mu.Lock()
+				delete(b.subs[userID], ch)
+				if len(b.subs[userID]) == 0 {
+					delete(b.subs, userID)
+				}
+				b.mu.Unlock()
+				close(ch)
+			})
+		},
+	}
+}
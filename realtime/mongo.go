@@ -0,0 +1,94 @@
+package realtime
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"os"
+	"time"
+)
+
+// MongoBroker broadcasts events between server instances through a change
+// stream on a shared collection. Each instance delivers the events it sees to
+// its own subscribers, so every instance must call Run. Change streams need a
+// replica set.
+type MongoBroker struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+	local  *MemoryBroker
+}
+
+type storedEvent struct {
+	User      string    `bson:"user"`
+	Event     Event     `bson:"event"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func NewMongoBroker(client *mongo.Client) *MongoBroker {
+	dbname := os.Getenv(db.MongoDBNameEnvName)
+	return &MongoBroker{
+		client: client,
+		coll:   client.Database(dbname).Collection(db.RealtimeEventColl),
+		local:  NewMemoryBroker(),
+	}
+}
+
+func (b *MongoBroker) Publish(ctx context.Context, userID string, ev Event) error {
+	_, err := b.coll.InsertOne(ctx, storedEvent{
+		User:      userID,
+		Event:     ev,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+func (b *MongoBroker) Subscribe(userID string) *Subscription {
+	return b.local.Subscribe(userID)
+}
+
+// Run watches the collection until ctx is done, reconnecting after errors and
+// resuming where the previous change stream stopped.
+func (b *MongoBroker) Run(ctx context.Context) {
+	var resume bson.Raw
+	for {
+		var err error
+		resume, err = b.watch(ctx, resume)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("realtime: change stream: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (b *MongoBroker) watch(ctx context.Context, resume bson.Raw) (bson.Raw, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+	opts := options.ChangeStream()
+	if resume != nil {
+		opts.SetResumeAfter(resume)
+	}
+	stream, err := b.coll.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return resume, err
+	}
+	defer stream.Close(context.Background())
+	for stream.Next(ctx) {
+		var change struct {
+			Doc storedEvent `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			log.Printf("realtime: decoding change: %v", err)
+		} else {
+			b.local.Publish(ctx, change.Doc.User, change.Doc.Event)
+		}
+		resume = stream.ResumeToken()
+	}
+	return resume, stream.Err()
+}
@@ -0,0 +1,170 @@
+package realtime
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The subset of RFC 6455 the stream needs: the server sends text frames and
+// pings, and reads client frames only to answer pings and notice closes.
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+
+	closeNormal        = 1000
+	closeProtocolError = 1002
+
+	// maxClientPayload caps client frames; clients only send control
+	// frames, so anything longer is rejected.
+	maxClientPayload = 4096
+	writeTimeout     = 10 * time.Second
+)
+
+var (
+	errFrameTooLarge = errors.New("websocket: client frame too large")
+	errUnmasked      = errors.New("websocket: client frame not masked")
+)
+
+// AcceptKey returns the Sec-WebSocket-Accept value for a client's
+// Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// WebSocket is a server side connection after the opening handshake.
+type WebSocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu sync.Mutex
+	// closing is set once a close frame is sent; nothing may follow it.
+	closing bool
+}
+
+func NewWebSocket(conn net.Conn) *WebSocket {
+	return &WebSocket{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+func (ws *WebSocket) WriteText(p []byte) error {
+	return ws.writeFrame(opText, p)
+}
+
+func (ws *WebSocket) Ping() error {
+	return ws.writeFrame(opPing, nil)
+}
+
+func (ws *WebSocket) Close() error {
+	ws.sendClose(closeNormal)
+	return ws.conn.Close()
+}
+
+// sendClose sends a close frame with code, unless one was sent already.
+func (ws *WebSocket) sendClose(code uint16) error {
+	return ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+func (ws *WebSocket) writeFrame(op byte, p []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closing {
+		return net.ErrClosed
+	}
+	ws.closing = op == opClose
+	header := []byte{0x80 | op}
+	switch n := len(p); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := ws.conn.Write(append(header, p...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadLoop reads client frames until the connection closes, answering pings.
+// Data frames from the client are ignored. Client frames must be masked; an
+// unmasked one is answered with a close frame with status 1002.
+func (ws *WebSocket) ReadLoop() error {
+	for {
+		op, payload, err := ws.readFrame()
+		if errors.Is(err, errUnmasked) {
+			ws.sendClose(closeProtocolError)
+		}
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opClose:
+			return io.EOF
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (ws *WebSocket) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errUnmasked
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxClientPayload {
+		return 0, nil, errFrameTooLarge
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,70 @@
+package realtime_test
+
+import (
+	"bytes"
+	"github.com/MiladJlz/blog_app/realtime"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serve runs the read loop of a server socket on one end of a pipe and
+// returns the client end, and the loop's error once it stops.
+func serve(t *testing.T) (net.Conn, <-chan error) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	ws := realtime.NewWebSocket(server)
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.ReadLoop()
+		ws.Close()
+	}()
+	return client, done
+}
+
+func readFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	payload := make([]byte, head[1]&0x7F)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	return head[0], payload
+}
+
+func TestMaskedPing(t *testing.T) {
+	client, _ := serve(t)
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x89, 0x80 | 2}, mask...)
+	frame = append(frame, 'h'^1, 'i'^2)
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	if head, payload := readFrame(t, client); head != 0x8A || string(payload) != "hi" {
+		t.Errorf("got frame %#x %q, want a pong with hi", head, payload)
+	}
+}
+
+// TestUnmaskedFrame checks that a client frame without a mask is answered
+// with a single close frame with status 1002.
+func TestUnmaskedFrame(t *testing.T) {
+	client, done := serve(t)
+	if _, err := client.Write([]byte{0x89, 2, 'h', 'i'}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	if head, payload := readFrame(t, client); head != 0x88 || !bytes.Equal(payload, []byte{0x03, 0xEA}) {
+		t.Errorf("got frame %#x %x, want a close with 1002", head, payload)
+	}
+	if err := <-done; err == nil {
+		t.Error("ReadLoop: got no error")
+	}
+	if n, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("after the close frame: read %d bytes, %v, want EOF", n, err)
+	}
+}
@@ -0,0 +1,379 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	IndexDirEnvName = "SEARCH_INDEX_DIR"
+
+	snapshotFile     = "index.snapshot"
+	logFile          = "index.log"
+	compactThreshold = 1000
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// tagWeight counts each tag as this many occurrences of its terms, as the
+	// Mongo text index weighs tags over content.
+	tagWeight = 3
+)
+
+type Hit struct {
+	ID    primitive.ObjectID
+	Score float64
+}
+
+type SearchIndex interface {
+	Index(context.Context, *types.Post) error
+	Remove(context.Context, primitive.ObjectID) error
+	Search(context.Context, types.SearchParams) ([]Hit, int64, error)
+	Rebuild(context.Context, []*types.Post) error
+	Close() error
+}
+
+type document struct {
+	ID         primitive.ObjectID
+	Author     primitive.ObjectID
+	Visibility string
+	CreatedAt  time.Time
+	Terms      map[string]int
+	Length     int
+}
+
+type logEntry struct {
+	Remove bool      `json:"remove,omitempty"`
+	Doc    *document `json:"doc"`
+}
+
+// InvertedIndex is a BM25-ranked inverted index over post content and tags. It
+// is held in memory and persisted in dir as a snapshot plus an append-only log
+// of the changes made since the snapshot was written. Every change is synced
+// to disk before it is acknowledged.
+type InvertedIndex struct {
+	mu          sync.RWMutex
+	dir         string
+	docs        map[primitive.ObjectID]*document
+	postings    map[string]map[primitive.ObjectID]int
+	totalLength int
+	log         *os.File
+	logOps      int
+}
+
+func OpenInvertedIndex(dir string) (*InvertedIndex, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	idx := &InvertedIndex{
+		dir:      dir,
+		docs:     map[primitive.ObjectID]*document{},
+		postings: map[string]map[primitive.ObjectID]int{},
+	}
+	if err := idx.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	torn, err := idx.replayLog()
+	if err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	idx.log = log
+	// Entries appended after a torn line would be lost with it on the next
+	// replay, so the log is started afresh.
+	if torn {
+		if err := idx.compact(); err != nil {
+			log.Close()
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+func (idx *InvertedIndex) Index(ctx context.Context, post *types.Post) error {
+	doc := newDocument(post)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.ID)
+	idx.add(doc)
+	return idx.appendLog(logEntry{Doc: doc})
+}
+
+func (idx *InvertedIndex) Remove(ctx context.Context, id primitive.ObjectID) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.docs[id]; !ok {
+		return nil
+	}
+	idx.remove(id)
+	return idx.appendLog(logEntry{Remove: true, Doc: &document{ID: id}})
+}
+
+func (idx *InvertedIndex) Search(ctx context.Context, params types.SearchParams) ([]Hit, int64, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 {
+		return []Hit{}, 0, nil
+	}
+	var (
+		n      = float64(len(idx.docs))
+		avgLen = float64(idx.totalLength) / n
+		scores = map[primitive.ObjectID]float64{}
+		seen   = map[string]bool{}
+	)
+	for _, term := range Tokenize(params.Query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := idx.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			doc := idx.docs[id]
+			if !matches(doc, params) {
+				continue
+			}
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(doc.Length)/avgLen
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return idx.docs[hits[i].ID].CreatedAt.After(idx.docs[hits[j].ID].CreatedAt)
+	})
+	total := int64(len(hits))
+	start := min(params.Skip(), total)
+	end := min(start+params.Limit, total)
+	return hits[start:end], total, nil
+}
+
+// Rebuild discards the current contents and indexes posts from scratch.
+func (idx *InvertedIndex) Rebuild(ctx context.Context, posts []*types.Post) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = map[primitive.ObjectID]*document{}
+	idx.postings = map[string]map[primitive.ObjectID]int{}
+	idx.totalLength = 0
+	for _, post := range posts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		idx.add(newDocument(post))
+	}
+	return idx.compact()
+}
+
+func (idx *InvertedIndex) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.log.Close()
+}
+
+func newDocument(post *types.Post) *document {
+	doc := &document{
+		ID:         post.ID,
+		Author:     post.Author,
+		Visibility: post.Visibility,
+		CreatedAt:  post.CreatedAt,
+		Terms:      map[string]int{},
+	}
+	for _, term := range Tokenize(post.Content) {
+		doc.Terms[term]++
+		doc.Length++
+	}
+	for _, tag := range post.Tags {
+		for _, term := range Tokenize(tag) {
+			doc.Terms[term] += tagWeight
+			doc.Length += tagWeight
+		}
+	}
+	return doc
+}
+
+func matches(doc *document, params types.SearchParams) bool {
+	if !params.Author.IsZero() && doc.Author != params.Author {
+		return false
+	}
+	if !params.From.IsZero() && doc.CreatedAt.Before(params.From) {
+		return false
+	}
+	if !params.To.IsZero() && doc.CreatedAt.After(params.To) {
+		return false
+	}
+	return params.Viewer.CanSee(&types.Post{Author: doc.Author, Visibility: doc.Visibility})
+}
+
+func (idx *InvertedIndex) add(doc *document) {
+	idx.docs[doc.ID] = doc
+	idx.totalLength += doc.Length
+	for term, tf := range doc.Terms {
+		postings, ok := idx.postings[term]
+		if !ok {
+			postings = map[primitive.ObjectID]int{}
+			idx.postings[term] = postings
+		}
+		postings[doc.ID] = tf
+	}
+}
+
+func (idx *InvertedIndex) remove(id primitive.ObjectID) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.Terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= doc.Length
+	delete(idx.docs, id)
+}
+
+func (idx *InvertedIndex) appendLog(entry logEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := idx.log.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := idx.log.Sync(); err != nil {
+		return err
+	}
+	idx.logOps++
+	if idx.logOps >= compactThreshold {
+		return idx.compact()
+	}
+	return nil
+}
+
+// compact writes a fresh snapshot and truncates the change log.
+func (idx *InvertedIndex) compact() error {
+	path := filepath.Join(idx.dir, snapshotFile)
+	tmp, err := os.CreateTemp(idx.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	docs := make([]*document, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	if err := gob.NewEncoder(tmp).Encode(docs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(idx.dir); err != nil {
+		return err
+	}
+	if idx.log != nil {
+		if err := idx.log.Truncate(0); err != nil {
+			return err
+		}
+		if err := idx.log.Sync(); err != nil {
+			return err
+		}
+	}
+	idx.logOps = 0
+	return nil
+}
+
+// syncDir syncs dir, so that a snapshot renamed into it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (idx *InvertedIndex) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(idx.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var docs []*document
+	if err := gob.NewDecoder(f).Decode(&docs); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		idx.add(doc)
+	}
+	return nil
+}
+
+// replayLog applies the logged changes on top of the snapshot. A truncated
+// final line, left by a crash mid-write, is ignored and reported as torn.
+func (idx *InvertedIndex) replayLog() (torn bool, err error) {
+	f, err := os.Open(filepath.Join(idx.dir, logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return len(line) > 0, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return false, err
+		}
+		idx.remove(entry.Doc.ID)
+		if !entry.Remove {
+			idx.add(entry.Doc)
+		}
+		idx.logOps++
+	}
+}
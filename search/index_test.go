@@ -0,0 +1,213 @@
+package search_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/search"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openIndex(t *testing.T, dir string) *search.InvertedIndex {
+	t.Helper()
+	idx, err := search.OpenInvertedIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenInvertedIndex: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func newPost(author primitive.ObjectID, content string) *types.Post {
+	post := types.NewPostFromParams(types.CreatePostParams{Content: content, Author: author.Hex()})
+	post.ID = primitive.NewObjectID()
+	return post
+}
+
+func index(t *testing.T, idx search.SearchIndex, posts ...*types.Post) {
+	t.Helper()
+	for _, post := range posts {
+		if err := idx.Index(context.Background(), post); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+}
+
+// hitIDs searches idx and returns the IDs of the hits in rank order.
+func hitIDs(t *testing.T, idx search.SearchIndex, params types.SearchParams) []primitive.ObjectID {
+	t.Helper()
+	if params.Page == 0 {
+		params.Page, params.Limit = 1, 10
+	}
+	hits, total, err := idx.Search(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Search %q: %v", params.Query, err)
+	}
+	ids := []primitive.ObjectID{}
+	for i, hit := range hits {
+		if hit.Score <= 0 {
+			t.Errorf("Search %q: hit %d scored %f", params.Query, i, hit.Score)
+		}
+		if i > 0 && hit.Score > hits[i-1].Score {
+			t.Errorf("Search %q: hit %d outranks the hit before it", params.Query, i)
+		}
+		ids = append(ids, hit.ID)
+	}
+	if params.Page == 1 && total < int64(len(ids)) {
+		t.Errorf("Search %q: total %d below the %d hits returned", params.Query, total, len(ids))
+	}
+	return ids
+}
+
+func TestBM25Ranking(t *testing.T) {
+	idx := openIndex(t, t.TempDir())
+	author := primitive.NewObjectID()
+	var (
+		once     = newPost(author, "Mongo stores documents and builds indexes over them")
+		twice    = newPost(author, "Mongo replicas copy what the Mongo primary writes down")
+		short    = newPost(author, "Mongo documents")
+		tagged   = newPost(author, "Reading about #mongo documents")
+		untagged = newPost(author, "Reading about mongo documents")
+		other    = newPost(author, "Postgres has tables instead")
+	)
+	index(t, idx, once, twice, short, tagged, untagged, other)
+
+	ids := hitIDs(t, idx, types.SearchParams{Query: "mongo"})
+	if len(ids) != 5 || slices.Contains(ids, other.ID) {
+		t.Fatalf("Search mongo: got %d hits %v, want the 5 posts mentioning it", len(ids), ids)
+	}
+	rank := func(post *types.Post) int { return slices.Index(ids, post.ID) }
+	if rank(twice) > rank(once) {
+		t.Errorf("a post mentioning the term twice ranks below one of the same length mentioning it once")
+	}
+	if rank(short) > rank(once) {
+		t.Errorf("a short post ranks below a long one with the same term frequency")
+	}
+	if rank(tagged) > rank(untagged) {
+		t.Errorf("a post tagged with the term ranks below one only mentioning it")
+	}
+
+	// "postgres" is in one post and "documents" in four, so the rare term
+	// decides the ranking.
+	ids = hitIDs(t, idx, types.SearchParams{Query: "postgres documents"})
+	if len(ids) == 0 || ids[0] != other.ID {
+		t.Errorf("Search postgres documents: got %v, want the post with the rarer term first", ids)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "the and"}); len(ids) != 0 {
+		t.Errorf("Search for stop words: got %v, want no hits", ids)
+	}
+}
+
+func TestSearchParams(t *testing.T) {
+	idx := openIndex(t, t.TempDir())
+	var (
+		alice, bob = primitive.NewObjectID(), primitive.NewObjectID()
+		now        = time.Now()
+		old        = newPost(alice, "An old post on gardening")
+		public     = newPost(alice, "A new post on gardening")
+		private    = newPost(alice, "A private note on gardening")
+		bobs       = newPost(bob, "Bob is gardening too")
+	)
+	old.CreatedAt = now.Add(-48 * time.Hour)
+	private.Visibility = types.PostVisibilityPrivate
+	index(t, idx, old, public, private, bobs)
+
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "gardening", Author: bob}); !slices.Equal(ids, []primitive.ObjectID{bobs.ID}) {
+		t.Errorf("Search by author: got %v, want %v", ids, bobs.ID)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "gardening", Author: alice, From: now.Add(-time.Hour)}); !slices.Equal(ids, []primitive.ObjectID{public.ID}) {
+		t.Errorf("Search from a time: got %v, want %v", ids, public.ID)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "gardening", To: now.Add(-time.Hour)}); !slices.Equal(ids, []primitive.ObjectID{old.ID}) {
+		t.Errorf("Search to a time: got %v, want %v", ids, old.ID)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "gardening", Viewer: types.Viewer{ID: alice}}); !slices.Contains(ids, private.ID) {
+		t.Errorf("Search by the author: private post missing from %v", ids)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "gardening", Viewer: types.Viewer{ID: bob, Hidden: []primitive.ObjectID{alice}}}); !slices.Equal(ids, []primitive.ObjectID{bobs.ID}) {
+		t.Errorf("Search by a blocked viewer: got %v, want %v", ids, bobs.ID)
+	}
+
+	all := hitIDs(t, idx, types.SearchParams{Query: "gardening"})
+	if slices.Contains(all, private.ID) || len(all) != 3 {
+		t.Fatalf("Search by an anonymous viewer: got %v, want the 3 public posts", all)
+	}
+	hits, total, err := idx.Search(context.Background(), types.SearchParams{Query: "gardening", Page: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("Search page 2: %v", err)
+	}
+	if total != 3 || len(hits) != 1 || hits[0].ID != all[2] {
+		t.Errorf("Search page 2: got %d of %d hits, want the last of 3", len(hits), total)
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := search.OpenInvertedIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenInvertedIndex: %v", err)
+	}
+	author := primitive.NewObjectID()
+	kept := newPost(author, "Persisted across restarts")
+	removed := newPost(author, "Removed before the restart")
+	edited := newPost(author, "Persisted then edited")
+	index(t, idx, kept, removed, edited)
+	if err := idx.Remove(context.Background(), removed.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	edited.Content = "Rewritten entirely"
+	index(t, idx, edited)
+	if err := idx.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	idx = openIndex(t, dir)
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "persisted"}); !slices.Equal(ids, []primitive.ObjectID{kept.ID}) {
+		t.Errorf("Search after replaying the log: got %v, want %v", ids, kept.ID)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "rewritten"}); !slices.Equal(ids, []primitive.ObjectID{edited.ID}) {
+		t.Errorf("Search after replaying an edit: got %v, want %v", ids, edited.ID)
+	}
+
+	// A crash mid-write leaves a torn line at the end of the log.
+	log, err := os.OpenFile(filepath.Join(dir, "index.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("opening the log: %v", err)
+	}
+	log.WriteString(`{"doc":{"ID":`)
+	log.Close()
+	idx.Close()
+	idx = openIndex(t, dir)
+	later := newPost(author, "Persisted after the crash")
+	index(t, idx, later)
+	idx.Close()
+
+	idx = openIndex(t, dir)
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "persisted"}); len(ids) != 2 || !slices.Contains(ids, later.ID) {
+		t.Errorf("Search after a torn log: got %v, want %v and %v", ids, kept.ID, later.ID)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	dir := t.TempDir()
+	idx := openIndex(t, dir)
+	author := primitive.NewObjectID()
+	stale := newPost(author, "Stale entry about rebuilding")
+	index(t, idx, stale)
+	fresh := newPost(author, "Fresh entry about rebuilding")
+	if err := idx.Rebuild(context.Background(), []*types.Post{fresh}); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "rebuilding"}); !slices.Equal(ids, []primitive.ObjectID{fresh.ID}) {
+		t.Errorf("Search after Rebuild: got %v, want %v", ids, fresh.ID)
+	}
+	idx.Close()
+	idx = openIndex(t, dir)
+	if ids := hitIDs(t, idx, types.SearchParams{Query: "rebuilding"}); !slices.Equal(ids, []primitive.ObjectID{fresh.ID}) {
+		t.Errorf("Search after reopening the snapshot: got %v, want %v", ids, fresh.ID)
+	}
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+)
+
+// IndexedPostStore keeps a SearchIndex in sync with every write made through
+// the wrapped PostStore. Index failures are logged rather than returned, since
+// the post itself has been stored and the index can be rebuilt.
+type IndexedPostStore struct {
+	db.PostStore
+	index SearchIndex
+}
+
+func NewIndexedPostStore(store db.PostStore, index SearchIndex) *IndexedPostStore {
+	return &IndexedPostStore{
+		PostStore: store,
+		index:     index,
+	}
+}
+
+func (s *IndexedPostStore) InsertPost(ctx context.Context, post *types.Post) (*types.Post, error) {
+	insertedPost, err := s.PostStore.InsertPost(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.index.Index(ctx, insertedPost); err != nil {
+		log.Printf("search: indexing post %s: %v", insertedPost.ID.Hex(), err)
+	}
+	return insertedPost, nil
+}
+
+// UpdatePost reindexes every post filter selects, but for its version, which
+// includes the one that was updated.
+func (s *IndexedPostStore) UpdatePost(ctx context.Context, filter db.PostFilter, params types.UpdatePostParams) error {
+	if err := s.PostStore.UpdatePost(ctx, filter, params); err != nil {
+		return err
+	}
+	filter.Version = 0
+	posts, err := s.PostStore.FindPosts(ctx, filter, db.FindOptions{})
+	if err != nil {
+		log.Printf("search: reloading updated posts: %v", err)
+		return nil
+	}
+	for _, post := range posts {
+		if err := s.index.Index(ctx, post); err != nil {
+			log.Printf("search: indexing post %s: %v", post.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (s *IndexedPostStore) DeletePost(ctx context.Context, id string, version int64) error {
+	if err := s.PostStore.DeletePost(ctx, id, version); err != nil {
+		return err
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	if err := s.index.Remove(ctx, oid); err != nil {
+		log.Printf("search: removing post %s: %v", id, err)
+	}
+	return nil
+}
+
+// Reindex rebuilds the index from every post in store.
+func Reindex(ctx context.Context, store db.PostStore, index SearchIndex) (int, error) {
+	posts, err := store.GetPosts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := index.Rebuild(ctx, posts); err != nil {
+		return 0, err
+	}
+	return len(posts), nil
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IndexSearchStore answers post searches from a SearchIndex and delegates
+// user searches to another SearchStore.
+type IndexSearchStore struct {
+	index     SearchIndex
+	postStore db.PostStore
+	users     db.SearchStore
+}
+
+func NewIndexSearchStore(index SearchIndex, postStore db.PostStore, users db.SearchStore) *IndexSearchStore {
+	return &IndexSearchStore{
+		index:     index,
+		postStore: postStore,
+		users:     users,
+	}
+}
+
+func (s *IndexSearchStore) Search(ctx context.Context, params types.SearchParams) (*types.SearchResult, error) {
+	result := &types.SearchResult{
+		Query: params.Query,
+		Page:  params.Page,
+		Limit: params.Limit,
+		Posts: []*types.PostHit{},
+		Users: []*types.UserHit{},
+	}
+	if params.Type != types.SearchTypeUsers {
+		posts, total, err := s.searchPosts(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		result.TotalPosts = total
+		terms := types.SearchTerms(params.Query)
+		for _, hit := range posts {
+			hit.Highlights = types.Highlight(hit.Post.Content, terms)
+			result.Posts = append(result.Posts, hit)
+		}
+	}
+	if params.Type != types.SearchTypePosts {
+		userParams := params
+		userParams.Type = types.SearchTypeUsers
+		users, err := s.users.Search(ctx, userParams)
+		if err != nil {
+			return nil, err
+		}
+		result.TotalUsers = users.TotalUsers
+		result.Users = users.Users
+	}
+	return result, nil
+}
+
+// maxStaleRetries bounds how often searchPosts searches again after dropping
+// hits for posts that are gone from the post store.
+const maxStaleRetries = 3
+
+// searchPosts loads the posts the index finds for params in one batch. The
+// index may lag behind the post store when indexing failed after a write: hits
+// for posts that are gone are removed from it, hits for posts the viewer may
+// no longer see are reindexed, and the search is run again, so that the page
+// is filled with readable posts and the total no longer counts the stale hits.
+func (s *IndexSearchStore) searchPosts(ctx context.Context, params types.SearchParams) ([]*types.PostHit, int64, error) {
+	for attempt := 0; ; attempt++ {
+		hits, total, err := s.index.Search(ctx, params)
+		if err != nil {
+			return nil, 0, err
+		}
+		ids := make([]primitive.ObjectID, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.ID
+		}
+		found, err := s.postStore.GetPostsByIDs(ctx, ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		posts := make(map[primitive.ObjectID]*types.Post, len(found))
+		for _, post := range found {
+			posts[post.ID] = post
+		}
+		postHits := make([]*types.PostHit, 0, len(hits))
+		var gone, changed []primitive.ObjectID
+		for _, hit := range hits {
+			post, ok := posts[hit.ID]
+			switch {
+			case !ok:
+				gone = append(gone, hit.ID)
+			case !params.Viewer.CanSee(post):
+				changed = append(changed, hit.ID)
+			default:
+				postHits = append(postHits, &types.PostHit{Post: post, Score: hit.Score})
+			}
+		}
+		stale := len(gone) + len(changed)
+		if stale == 0 || attempt == maxStaleRetries {
+			return postHits, total - int64(stale), nil
+		}
+		for _, id := range gone {
+			if err := s.index.Remove(ctx, id); err != nil {
+				return nil, 0, err
+			}
+		}
+		for _, id := range changed {
+			if err := s.index.Index(ctx, posts[id]); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package search_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/search"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"testing"
+)
+
+func TestIndexSearchStore(t *testing.T) {
+	ctx := context.Background()
+	idx := openIndex(t, t.TempDir())
+	posts := db.NewMemoryPostStore()
+	indexed := search.NewIndexedPostStore(posts, idx)
+	store := search.NewIndexSearchStore(idx, posts, nil)
+	author := primitive.NewObjectID()
+	var inserted []*types.Post
+	for _, content := range []string{"علي writes about چای", "Tea with علی", "More tea", "Still tea"} {
+		post, err := indexed.InsertPost(ctx, types.NewPostFromParams(types.CreatePostParams{Content: content, Author: author.Hex()}))
+		if err != nil {
+			t.Fatalf("InsertPost: %v", err)
+		}
+		inserted = append(inserted, post)
+	}
+
+	result, err := store.Search(ctx, types.SearchParams{Query: "علی", Type: types.SearchTypePosts, Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.TotalPosts != 2 || len(result.Posts) != 2 {
+		t.Fatalf("Search علی: got %d of %d posts, want 2", len(result.Posts), result.TotalPosts)
+	}
+	for _, hit := range result.Posts {
+		if len(hit.Highlights) != 1 || !(hit.Highlights[0] == "<em>علي</em> writes about چای" || hit.Highlights[0] == "Tea with <em>علی</em>") {
+			t.Errorf("Search علی: highlights %q, want the name marked as written", hit.Highlights)
+		}
+	}
+
+	// Writes that bypass the index leave it stale: one post is gone and
+	// another is now private.
+	if err := posts.DeletePost(ctx, inserted[1].ID.Hex(), 0); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if err := posts.UpdatePost(ctx, db.PostFilter{ID: inserted[2].ID}, types.UpdatePostParams{Visibility: types.PostVisibilityPrivate}); err != nil {
+		t.Fatalf("UpdatePost: %v", err)
+	}
+	result, err = store.Search(ctx, types.SearchParams{Query: "tea", Type: types.SearchTypePosts, Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.TotalPosts != 1 || len(result.Posts) != 1 || result.Posts[0].Post.ID != inserted[3].ID {
+		t.Errorf("Search tea over a stale index: got %d of %d posts, want only %s", len(result.Posts), result.TotalPosts, inserted[3].ID.Hex())
+	}
+	hits, _, err := idx.Search(ctx, types.SearchParams{Query: "tea", Page: 1, Limit: 10, Viewer: types.Viewer{ID: author}})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	var ids []primitive.ObjectID
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	if slices.Contains(ids, inserted[1].ID) || !slices.Contains(ids, inserted[2].ID) {
+		t.Errorf("index after a stale search: got %v, want the deleted post removed and the private one kept", ids)
+	}
+}
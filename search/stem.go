@@ -0,0 +1,210 @@
+package search
+
+// Stem reduces an English word to its stem using the Porter algorithm.
+// Words that are not plain lower-case ASCII are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &stemmer{b: []byte(word)}
+	s.step1a()
+	s.step1b()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+}
+
+func (s *stemmer) isConsonant(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.isConsonant(i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in b[:end].
+func (s *stemmer) measure(end int) int {
+	n, i := 0, 0
+	for i < end && s.isConsonant(i) {
+		i++
+	}
+	for i < end {
+		for i < end && !s.isConsonant(i) {
+			i++
+		}
+		if i >= end {
+			break
+		}
+		for i < end && s.isConsonant(i) {
+			i++
+		}
+		n++
+	}
+	return n
+}
+
+func (s *stemmer) hasVowel(end int) bool {
+	for i := 0; i < end; i++ {
+		if !s.isConsonant(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stemmer) endsDoubleConsonant(end int) bool {
+	return end >= 2 && s.b[end-1] == s.b[end-2] && s.isConsonant(end-1)
+}
+
+// endsCVC reports whether b[:end] ends consonant-vowel-consonant where the
+// final consonant is not w, x or y.
+func (s *stemmer) endsCVC(end int) bool {
+	if end < 3 || !s.isConsonant(end-1) || s.isConsonant(end-2) || !s.isConsonant(end-3) {
+		return false
+	}
+	switch s.b[end-1] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+func (s *stemmer) hasSuffix(suffix string) bool {
+	return len(s.b) >= len(suffix) && string(s.b[len(s.b)-len(suffix):]) == suffix
+}
+
+// replace swaps suffix for repl when the remaining stem has a measure above min.
+func (s *stemmer) replace(suffix, repl string, min int) bool {
+	if !s.hasSuffix(suffix) {
+		return false
+	}
+	stem := len(s.b) - len(suffix)
+	if s.measure(stem) > min {
+		s.b = append(s.b[:stem], repl...)
+	}
+	return true
+}
+
+func (s *stemmer) step1a() {
+	switch {
+	case s.hasSuffix("sses"), s.hasSuffix("ies"):
+		s.b = s.b[:len(s.b)-2]
+	case s.hasSuffix("ss"):
+	case s.hasSuffix("s"):
+		s.b = s.b[:len(s.b)-1]
+	}
+}
+
+func (s *stemmer) step1b() {
+	if s.hasSuffix("eed") {
+		if s.measure(len(s.b)-3) > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+		return
+	}
+	var stem int
+	switch {
+	case s.hasSuffix("ed") && s.hasVowel(len(s.b)-2):
+		stem = len(s.b) - 2
+	case s.hasSuffix("ing") && s.hasVowel(len(s.b)-3):
+		stem = len(s.b) - 3
+	default:
+		return
+	}
+	s.b = s.b[:stem]
+	switch {
+	case s.hasSuffix("at"), s.hasSuffix("bl"), s.hasSuffix("iz"):
+		s.b = append(s.b, 'e')
+	case s.endsDoubleConsonant(len(s.b)):
+		switch s.b[len(s.b)-1] {
+		case 'l', 's', 'z':
+		default:
+			s.b = s.b[:len(s.b)-1]
+		}
+	case s.measure(len(s.b)) == 1 && s.endsCVC(len(s.b)):
+		s.b = append(s.b, 'e')
+	}
+}
+
+func (s *stemmer) step1c() {
+	if s.hasSuffix("y") && s.hasVowel(len(s.b)-1) {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+var step2Suffixes = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var step3Suffixes = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (s *stemmer) step2() {
+	for _, r := range step2Suffixes {
+		if s.replace(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+func (s *stemmer) step3() {
+	for _, r := range step3Suffixes {
+		if s.replace(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+func (s *stemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		if !s.hasSuffix(suffix) {
+			continue
+		}
+		stem := len(s.b) - len(suffix)
+		if suffix == "ion" && (stem == 0 || (s.b[stem-1] != 's' && s.b[stem-1] != 't')) {
+			return
+		}
+		if s.measure(stem) > 1 {
+			s.b = s.b[:stem]
+		}
+		return
+	}
+}
+
+func (s *stemmer) step5() {
+	if s.hasSuffix("e") {
+		stem := len(s.b) - 1
+		m := s.measure(stem)
+		if m > 1 || (m == 1 && !s.endsCVC(stem)) {
+			s.b = s.b[:stem]
+		}
+	}
+	if s.hasSuffix("ll") && s.measure(len(s.b)) > 1 {
+		s.b = s.b[:len(s.b)-1]
+	}
+}
@@ -0,0 +1,43 @@
+package search_test
+
+import (
+	"github.com/MiladJlz/blog_app/search"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	// Examples from Porter's paper, one or more per step.
+	tests := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"ties":           "ti",
+		"caress":         "caress",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"hopping":        "hop",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"generalization": "gener",
+		"hopeful":        "hope",
+		"goodness":       "good",
+		"revival":        "reviv",
+		"adjustable":     "adjust",
+		"controll":       "control",
+		"roll":           "roll",
+		// Short words and words that are not lower-case ASCII are left alone.
+		"go":     "go",
+		"Goes":   "Goes",
+		"کتابها": "کتابها",
+	}
+	for word, want := range tests {
+		if got := search.Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
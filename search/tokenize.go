@@ -0,0 +1,49 @@
+package search
+
+import (
+	"github.com/MiladJlz/blog_app/types"
+	"strings"
+	"unicode"
+)
+
+// stopWords are listed as Normalize returns them.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true, "to": true,
+	"was": true, "will": true, "with": true,
+	"و": true, "در": true, "به": true, "از": true, "که": true, "را": true,
+	"با": true, "این": true, "ان": true, "است": true, "برای": true,
+}
+
+// Normalize lower-cases text, folds Arabic script variants to Persian, maps
+// Persian and Arabic-Indic digits to ASCII and strips diacritics, tatweel and
+// zero-width non-joiners, as types.FoldRune does for each rune.
+func Normalize(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if f, ok := types.FoldRune(r); ok {
+			b.WriteRune(f)
+		}
+	}
+	return b.String()
+}
+
+// Tokenize normalizes text and splits it into index terms, dropping stop words
+// and stemming English words.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if stopWords[f] {
+			continue
+		}
+		terms = append(terms, Stem(f))
+	}
+	return terms
+}
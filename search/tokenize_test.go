@@ -0,0 +1,41 @@
+package search_test
+
+import (
+	"github.com/MiladJlz/blog_app/search"
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"Hello GO", "hello go"},
+		{"علي", "علی"},
+		{"كتاب", "کتاب"},
+		{"۱۴۰۳ and ٢٠٢٤", "1403 and 2024"},
+		{"کتاب‌ها", "کتابها"},
+		{"مُحَمَّد", "محمد"},
+		{"آب", "اب"},
+	}
+	for _, tt := range tests {
+		if got := search.Normalize(tt.text); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The Gophers are running to the #GoLang meetup!", []string{"gopher", "run", "golang", "meetup"}},
+		{"snake_case stays whole", []string{"snake_case", "stai", "whole"}},
+		{"علي و آن کتاب‌ها را خواند", []string{"علی", "کتابها", "خواند"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := search.Tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
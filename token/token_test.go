@@ -0,0 +1,67 @@
+package token_test
+
+import (
+	"errors"
+	"github.com/MiladJlz/blog_app/token"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	signer := token.NewSigner([]byte("secret"))
+	tok := signer.Sign("unsubscribe", "user-1", time.Hour)
+	subject, err := signer.Verify("unsubscribe", tok)
+	if err != nil || subject != "user-1" {
+		t.Fatalf("Verify: got %q, %v, want user-1", subject, err)
+	}
+	claims, err := signer.Parse("unsubscribe", tok)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if until := time.Until(claims.Expires); until <= 0 || until > time.Hour {
+		t.Errorf("expiry: got %v from now, want within the hour", until)
+	}
+	other, err := signer.Parse("unsubscribe", signer.Sign("unsubscribe", "user-1", time.Hour))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(claims.ID) == 0 || claims.ID == other.ID {
+		t.Errorf("token IDs: got %q and %q, want two different IDs", claims.ID, other.ID)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	signer := token.NewSigner([]byte("secret"))
+	tok := signer.Sign("unsubscribe", "user-1", time.Hour)
+	payload, sig, _ := strings.Cut(tok, ".")
+	// Swapping the last character of the payload keeps it valid base64.
+	last := payload[len(payload)-1]
+	swapped := byte('A')
+	if last == 'A' {
+		swapped = 'B'
+	}
+	tampered := payload[:len(payload)-1] + string(swapped) + "." + sig
+	for _, tc := range []struct {
+		name    string
+		signer  *token.Signer
+		purpose string
+		token   string
+		want    error
+	}{
+		{"other purpose", signer, "reset_password", tok, token.ErrInvalid},
+		{"other secret", token.NewSigner([]byte("other")), "unsubscribe", tok, token.ErrInvalid},
+		{"tampered payload", signer, "unsubscribe", tampered, token.ErrInvalid},
+		{"no signature", signer, "unsubscribe", payload, token.ErrInvalid},
+		{"bad signature encoding", signer, "unsubscribe", payload + ".!!", token.ErrInvalid},
+		{"empty", signer, "unsubscribe", "", token.ErrInvalid},
+		{"expired", signer, "unsubscribe", signer.Sign("unsubscribe", "user-1", -time.Second), token.ErrExpired},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			subject, err := tc.signer.Verify(tc.purpose, tc.token)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Verify: got %q, %v, want %v", subject, err, tc.want)
+			}
+		})
+	}
+}
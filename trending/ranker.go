@@ -0,0 +1,161 @@
+package trending
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/types"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Weights struct {
+	Reactions float64
+	Comments  float64
+	Views     float64
+	Reposts   float64
+}
+
+type Config struct {
+	// Window is how far back posts are considered.
+	Window time.Duration
+	// HalfLife is the age at which a post's engagement counts half as much.
+	HalfLife time.Duration
+	// Interval is how often Run recomputes the ranking.
+	Interval time.Duration
+	Limit    int
+	Weights  Weights
+	// Now is the clock used for ages and the window; tests can replace it.
+	Now func() time.Time
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Window:   72 * time.Hour,
+		HalfLife: 12 * time.Hour,
+		Interval: 5 * time.Minute,
+		Limit:    50,
+		Weights: Weights{
+			Reactions: 1,
+			Comments:  3,
+			Views:     0.1,
+			Reposts:   5,
+		},
+		Now: time.Now,
+	}
+}
+
+// Ranker ranks recent posts and hashtags by time-decayed engagement and caches
+// the latest ranking for reads.
+type Ranker struct {
+	postStore db.PostStore
+	config    Config
+
+	mu      sync.RWMutex
+	current *types.Trending
+}
+
+func NewRanker(postStore db.PostStore, config Config) *Ranker {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &Ranker{
+		postStore: postStore,
+		config:    config,
+	}
+}
+
+// Trending returns the cached ranking, computing it first if Recompute has
+// never succeeded.
+func (r *Ranker) Trending(ctx context.Context) (*types.Trending, error) {
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+	if current != nil {
+		return current, nil
+	}
+	return r.Recompute(ctx)
+}
+
+func (r *Ranker) Recompute(ctx context.Context) (*types.Trending, error) {
+	now := r.config.Now()
+	since := now.Add(-r.config.Window)
+	posts, err := r.postStore.GetPostsSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		trending = &types.Trending{
+			ComputedAt: now,
+			Since:      since,
+			Posts:      []*types.TrendingPost{},
+			Tags:       []*types.TrendingTag{},
+		}
+		tags = map[string]*types.TrendingTag{}
+	)
+	for _, post := range posts {
+		// Only public posts trend.
+		if !(types.Viewer{}).CanSee(post) {
+			continue
+		}
+		score := r.score(post, now)
+		if score <= 0 {
+			continue
+		}
+		trending.Posts = append(trending.Posts, &types.TrendingPost{Post: post, Score: score})
+		for _, tag := range post.Tags {
+			t, ok := tags[tag]
+			if !ok {
+				t = &types.TrendingTag{Tag: tag}
+				tags[tag] = t
+				trending.Tags = append(trending.Tags, t)
+			}
+			t.Score += score
+			t.Posts++
+		}
+	}
+	sort.SliceStable(trending.Posts, func(i, j int) bool {
+		return trending.Posts[i].Score > trending.Posts[j].Score
+	})
+	sort.SliceStable(trending.Tags, func(i, j int) bool {
+		return trending.Tags[i].Score > trending.Tags[j].Score
+	})
+	if r.config.Limit > 0 {
+		trending.Posts = trending.Posts[:min(len(trending.Posts), r.config.Limit)]
+		trending.Tags = trending.Tags[:min(len(trending.Tags), r.config.Limit)]
+	}
+
+	r.mu.Lock()
+	r.current = trending
+	r.mu.Unlock()
+	return trending, nil
+}
+
+// Run recomputes the ranking every Interval until ctx is done.
+func (r *Ranker) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Recompute(ctx); err != nil {
+			log.Printf("trending: recompute: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Ranker) score(post *types.Post, now time.Time) float64 {
+	w := r.config.Weights
+	engagement := w.Reactions*float64(post.Stats.Reactions) +
+		w.Comments*float64(post.Stats.Comments) +
+		w.Views*float64(post.Stats.Views) +
+		w.Reposts*float64(post.Stats.Reposts)
+	age := max(now.Sub(post.CreatedAt), 0)
+	return engagement * math.Pow(0.5, age.Hours()/r.config.HalfLife.Hours())
+}
@@ -0,0 +1,185 @@
+package trending_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/trending"
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 9, 7, 12, 0, 0, 0, time.UTC)
+
+// post is a post as old as age, with its hashtags taken from content.
+type post struct {
+	content    string
+	age        time.Duration
+	stats      types.PostStats
+	visibility string
+}
+
+type scored struct {
+	content string
+	score   float64
+}
+
+func insertPosts(t *testing.T, store db.PostStore, posts []post) {
+	t.Helper()
+	author := primitive.NewObjectID()
+	for _, p := range posts {
+		visibility := p.visibility
+		if len(visibility) == 0 {
+			visibility = types.PostVisibilityPublic
+		}
+		_, err := store.InsertPost(context.Background(), &types.Post{
+			Content:    p.content,
+			Author:     author,
+			Kind:       types.PostKindPost,
+			Tags:       types.ExtractTags(p.content),
+			Stats:      p.stats,
+			Visibility: visibility,
+			CreatedAt:  now.Add(-p.age),
+		})
+		if err != nil {
+			t.Fatalf("InsertPost: %v", err)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRecompute(t *testing.T) {
+	reactions := func(n int64) types.PostStats { return types.PostStats{Reactions: n} }
+	for _, tc := range []struct {
+		name      string
+		posts     []post
+		limit     int
+		wantPosts []scored
+		wantTags  []types.TrendingTag
+	}{
+		{
+			name: "engagement halves every half-life",
+			posts: []post{
+				{content: "A day old", age: 24 * time.Hour, stats: reactions(8)},
+				{content: "Fresh", stats: reactions(8)},
+				{content: "Half a day old", age: 12 * time.Hour, stats: reactions(8)},
+			},
+			wantPosts: []scored{{"Fresh", 8}, {"Half a day old", 4}, {"A day old", 2}},
+		},
+		{
+			name: "engagement is weighted",
+			posts: []post{
+				{content: "Busy", stats: types.PostStats{Reactions: 1, Comments: 1, Views: 10, Reposts: 1}},
+			},
+			wantPosts: []scored{{"Busy", 1 + 3 + 1 + 5}},
+		},
+		{
+			name: "posts before the window are left out",
+			posts: []post{
+				{content: "Just in", age: 72 * time.Hour, stats: reactions(64)},
+				{content: "Too old", age: 73 * time.Hour, stats: reactions(1000)},
+			},
+			wantPosts: []scored{{"Just in", 1}},
+		},
+		{
+			name: "posts without engagement are left out",
+			posts: []post{
+				{content: "Ignored #quiet"},
+				{content: "Noticed", stats: reactions(1)},
+			},
+			wantPosts: []scored{{"Noticed", 1}},
+		},
+		{
+			name: "hashtags add up the scores of their posts",
+			posts: []post{
+				{content: "About #Go", stats: reactions(8)},
+				{content: "About #go and #fiber", stats: reactions(4)},
+				{content: "About #fiber, later", age: 12 * time.Hour, stats: reactions(4)},
+			},
+			wantPosts: []scored{{"About #Go", 8}, {"About #go and #fiber", 4}, {"About #fiber, later", 2}},
+			wantTags:  []types.TrendingTag{{Tag: "go", Score: 12, Posts: 2}, {Tag: "fiber", Score: 6, Posts: 2}},
+		},
+		{
+			name: "only public posts trend",
+			posts: []post{
+				{content: "For everyone #open", stats: reactions(1)},
+				{content: "For friends #close", stats: reactions(100), visibility: types.PostVisibilityFriends},
+				{content: "For me #secret", stats: reactions(100), visibility: types.PostVisibilityPrivate},
+			},
+			wantPosts: []scored{{"For everyone #open", 1}},
+			wantTags:  []types.TrendingTag{{Tag: "open", Score: 1, Posts: 1}},
+		},
+		{
+			name: "the limit applies to posts and hashtags",
+			posts: []post{
+				{content: "Third #c", stats: reactions(1)},
+				{content: "First #a", stats: reactions(3)},
+				{content: "Second #b", stats: reactions(2)},
+			},
+			limit:     2,
+			wantPosts: []scored{{"First #a", 3}, {"Second #b", 2}},
+			wantTags:  []types.TrendingTag{{Tag: "a", Score: 3, Posts: 1}, {Tag: "b", Score: 2, Posts: 1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := db.NewMemoryPostStore()
+			insertPosts(t, store, tc.posts)
+			config := trending.DefaultConfig()
+			config.Now = func() time.Time { return now }
+			if tc.limit > 0 {
+				config.Limit = tc.limit
+			}
+			got, err := trending.NewRanker(store, config).Recompute(context.Background())
+			if err != nil {
+				t.Fatalf("Recompute: %v", err)
+			}
+			if !got.ComputedAt.Equal(now) || !got.Since.Equal(now.Add(-config.Window)) {
+				t.Errorf("computed at %v since %v, want %v since %v", got.ComputedAt, got.Since, now, now.Add(-config.Window))
+			}
+			if len(got.Posts) != len(tc.wantPosts) {
+				t.Fatalf("posts: got %d, want %d", len(got.Posts), len(tc.wantPosts))
+			}
+			for i, want := range tc.wantPosts {
+				if p := got.Posts[i]; p.Post.Content != want.content || !near(p.Score, want.score) {
+					t.Errorf("post %d: got %q scoring %v, want %q scoring %v", i, p.Post.Content, p.Score, want.content, want.score)
+				}
+			}
+			if len(got.Tags) != len(tc.wantTags) {
+				t.Fatalf("tags: got %d, want %d", len(got.Tags), len(tc.wantTags))
+			}
+			for i, want := range tc.wantTags {
+				if tag := got.Tags[i]; tag.Tag != want.Tag || !near(tag.Score, want.Score) || tag.Posts != want.Posts {
+					t.Errorf("tag %d: got %+v, want %+v", i, *tag, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrendingIsCached(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryPostStore()
+	config := trending.DefaultConfig()
+	config.Now = func() time.Time { return now }
+	ranker := trending.NewRanker(store, config)
+	insertPosts(t, store, []post{{content: "Early", stats: types.PostStats{Reactions: 1}}})
+
+	if got, err := ranker.Trending(ctx); err != nil || len(got.Posts) != 1 {
+		t.Fatalf("Trending: got %+v, %v, want the ranking computed", got, err)
+	}
+	insertPosts(t, store, []post{{content: "Late", stats: types.PostStats{Reactions: 1}}})
+	if got, err := ranker.Trending(ctx); err != nil || len(got.Posts) != 1 {
+		t.Errorf("Trending: got %+v, %v, want the cached ranking", got, err)
+	}
+	if _, err := ranker.Recompute(ctx); err != nil {
+		t.Fatalf("Recompute: %v", err)
+	}
+	if got, err := ranker.Trending(ctx); err != nil || len(got.Posts) != 2 {
+		t.Errorf("Trending after Recompute: got %+v, %v, want both posts", got, err)
+	}
+}
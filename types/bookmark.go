@@ -0,0 +1,109 @@
+package types
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	maxReadingListNameLen = 100
+)
+
+type Bookmark struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	User      primitive.ObjectID `bson:"user" json:"user" example:"66db21cdb5d96466fa5f3c3c"`
+	Post      primitive.ObjectID `bson:"post" json:"post" example:"66db2c856699531daa9abc16"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+type UserParam struct {
+	UserID string `json:"userID" example:"66db21cdb5d96466fa5f3c3c"`
+}
+
+type ReadingList struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	Owner     primitive.ObjectID   `bson:"owner" json:"owner" example:"66db21cdb5d96466fa5f3c3c"`
+	Name      string               `bson:"name" json:"name" example:"Weekend reads"`
+	Private   bool                 `bson:"private" json:"private" example:"true"`
+	Posts     []primitive.ObjectID `bson:"posts" json:"posts" example:"[66db2c856699531daa9abc16,9bdb2c85156699531daa9abc7]"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+// ReadingListView is a reading list with its posts rendered in list order.
+type ReadingListView struct {
+	*ReadingList
+	Items []*PostView `json:"items"`
+}
+
+type CreateReadingListParams struct {
+	Name    string `json:"name" example:"Weekend reads"`
+	Private bool   `json:"private" example:"true"`
+}
+
+type UpdateReadingListParams struct {
+	UserID  string `json:"userID" example:"66db21cdb5d96466fa5f3c3c"`
+	Name    string `json:"name" example:"Weekend reads"`
+	Private *bool  `json:"private" example:"false"`
+}
+
+type ReadingListPostParams struct {
+	UserID string `json:"userID" example:"66db21cdb5d96466fa5f3c3c"`
+	PostID string `json:"postID" example:"66db2c856699531daa9abc16"`
+}
+
+func (params CreateReadingListParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if err := validateReadingListName(params.Name); len(err) > 0 {
+		errors["name"] = err
+	}
+	return errors
+}
+
+func (p UpdateReadingListParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(p.Name) > 0 {
+		if err := validateReadingListName(p.Name); len(err) > 0 {
+			errors["name"] = err
+		}
+	}
+	return errors
+}
+
+func (p UpdateReadingListParams) ToBSON() bson.M {
+	m := bson.M{}
+	if len(p.Name) > 0 {
+		m["name"] = p.Name
+	}
+	if p.Private != nil {
+		m["private"] = *p.Private
+	}
+	m["updated_at"] = time.Now()
+	return m
+}
+
+func validateReadingListName(name string) string {
+	if len(name) == 0 || len(name) > maxReadingListNameLen {
+		return fmt.Sprintf("name length should be between 1 and %d characters", maxReadingListNameLen)
+	}
+	return ""
+}
+
+func NewReadingListFromParams(params CreateReadingListParams, owner primitive.ObjectID) *ReadingList {
+	now := time.Now()
+	return &ReadingList{
+		Owner:     owner,
+		Name:      params.Name,
+		Private:   params.Private,
+		Posts:     []primitive.ObjectID{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// VisibleTo reports whether viewer may see the list.
+func (l *ReadingList) VisibleTo(viewer string) bool {
+	return !l.Private || l.Owner.Hex() == viewer
+}
@@ -0,0 +1,11 @@
+package types
+
+const (
+	EventNewPost       = "new_post"
+	EventRepost        = "repost"
+	EventComment       = "comment"
+	EventFriendRequest = "friend_request"
+	EventMention       = "mention"
+)
+
+const DefaultLanguage = "en"
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusDead    = "dead"
+)
+
+type Job struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	Type        string             `bson:"type" json:"type" example:"notify.new_post"`
+	Payload     map[string]string  `bson:"payload" json:"payload"`
+	Status      string             `bson:"status" json:"status" example:"pending"`
+	Attempts    int                `bson:"attempts" json:"attempts" example:"1"`
+	MaxAttempts int                `bson:"max_attempts" json:"max_attempts" example:"8"`
+	LastError   string             `bson:"last_error,omitempty" json:"last_error,omitempty" example:"connection refused"`
+	RunAt       time.Time          `bson:"run_at" json:"run_at" example:"2024-09-06T16:23:33.648Z"`
+	LockedUntil time.Time          `bson:"locked_until,omitempty" json:"locked_until,omitempty" example:"2024-09-06T16:24:33.648Z"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+func NewJob(jobType string, payload map[string]string, maxAttempts int, now time.Time) *Job {
+	return &Job{
+		Type:        jobType,
+		Payload:     payload,
+		Status:      JobStatusPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
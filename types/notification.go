@@ -0,0 +1,52 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Notification is an entry in a user's in-app inbox. Similar unread events are
+// grouped into one notification that keeps the most recent actors.
+type Notification struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	Recipient primitive.ObjectID  `bson:"recipient" json:"recipient" example:"66db21cdb5d96466fa5f3c3c"`
+	Type      string              `bson:"type" json:"type" example:"repost"`
+	GroupKey  string              `bson:"group_key" json:"-"`
+	PostID    *primitive.ObjectID `bson:"post_id,omitempty" json:"post_id,omitempty" example:"66db2c856699531daa9abc16"`
+	Excerpt   string              `bson:"excerpt" json:"excerpt" example:"a golang post"`
+	// Actors holds the most recent actors, newest first; ActorCount counts
+	// every distinct actor in the group.
+	Actors     []UserSummary        `bson:"actors" json:"actors"`
+	ActorIDs   []primitive.ObjectID `bson:"actor_ids" json:"-"`
+	ActorCount int                  `bson:"actor_count" json:"actor_count" example:"5"`
+	Read       bool                 `bson:"read" json:"read" example:"false"`
+	CreatedAt  time.Time            `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt  time.Time            `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+// NotificationView is a notification rendered in the recipient's language.
+type NotificationView struct {
+	*Notification
+	Title string `json:"title" example:"foo bar and 4 others shared your post"`
+	Body  string `json:"body" example:"a golang post"`
+	Link  string `json:"link" example:"blogapp://post/66db2c856699531daa9abc16"`
+}
+
+type NotificationPage struct {
+	Page          int64               `json:"page" example:"1"`
+	Limit         int64               `json:"limit" example:"20"`
+	Unread        int64               `json:"unread" example:"3"`
+	Notifications []*NotificationView `json:"notifications"`
+}
+
+type UnreadCount struct {
+	Unread int64 `json:"unread" example:"3"`
+}
+
+func NewUserSummary(user *User) UserSummary {
+	return UserSummary{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+}
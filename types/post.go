@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -11,30 +13,115 @@ const (
 	minContentLen = 10
 )
 
+const (
+	PostKindPost   = "post"
+	PostKindRepost = "repost"
+	PostKindQuote  = "quote"
+)
+
+const (
+	PostVisibilityPublic  = "public"
+	PostVisibilityFriends = "friends"
+	PostVisibilityPrivate = "private"
+)
+
+const (
+	StatReactions = "reactions"
+	StatComments  = "comments"
+	StatViews     = "views"
+	StatReposts   = "reposts"
+)
+
+var tagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]+)`)
+
 type PathParameter struct {
 	ID primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
 }
 type Post struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
-	Content   string             `bson:"content" json:"content" example:"This is example."`
-	Author    primitive.ObjectID `bson:"author" json:"author" example:"66db21cdb5d96466fa5f3c3c"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	Content   string              `bson:"content" json:"content" example:"This is example."`
+	Author    primitive.ObjectID  `bson:"author" json:"author" example:"66db21cdb5d96466fa5f3c3c"`
+	Kind      string              `bson:"kind" json:"kind" example:"post"`
+	RepostOf  *primitive.ObjectID `bson:"repost_of,omitempty" json:"repost_of,omitempty" example:"66db2c856699531daa9abc16"`
+	Tags      []string            `bson:"tags" json:"tags" example:"golang,mongo"`
+	Stats     PostStats           `bson:"stats" json:"stats"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+	// Version starts at 1 and goes up with every edit, but not with the
+	// stats. It is served as the post's ETag.
+	Version int64 `bson:"version" json:"version" example:"1"`
+	// Visibility is public, friends, for the users the author lists as
+	// friends, or private, for the author alone. Posts stored before it
+	// existed have none and are public.
+	Visibility string `bson:"visibility" json:"visibility" example:"public"`
+}
+
+type PostStats struct {
+	Reactions int64 `bson:"reactions" json:"reactions" example:"12"`
+	Comments  int64 `bson:"comments" json:"comments" example:"3"`
+	Views     int64 `bson:"views" json:"views" example:"140"`
+	Reposts   int64 `bson:"reposts" json:"reposts" example:"2"`
+}
+
+// Add adds delta to the counter named stat. Unknown stats are ignored.
+func (s *PostStats) Add(stat string, delta int64) {
+	switch stat {
+	case StatReactions:
+		s.Reactions += delta
+	case StatComments:
+		s.Comments += delta
+	case StatViews:
+		s.Views += delta
+	case StatReposts:
+		s.Reposts += delta
+	}
 }
 
 type CreatePostParams struct {
-	Content   string    `json:"content" example:"This is example."`
-	CreatedAt time.Time `json:"created_at"`
-	Author    string    `json:"author" example:"66db2c856699531daa9abc16"`
+	Content    string    `json:"content" example:"This is example."`
+	CreatedAt  time.Time `json:"created_at"`
+	Author     string    `json:"author" example:"66db2c856699531daa9abc16"`
+	Visibility string    `json:"visibility" example:"public"`
 }
+type CreateRepostParams struct {
+	Content string `json:"content" example:"Quoting this."`
+	Author  string `json:"author" example:"66db2c856699531daa9abc16"`
+}
+
+// PostView is a post as rendered to clients, with the post it reposts or
+// quotes embedded. OriginalUnavailable is set when that post has been deleted
+// or the viewer may not read it.
+// The author summaries are only set when the client asks for them to be
+// expanded.
+type PostView struct {
+	*Post
+	Original              *Post        `json:"original,omitempty"`
+	OriginalUnavailable   bool         `json:"original_unavailable,omitempty"`
+	AuthorSummary         *UserSummary `json:"author_summary,omitempty"`
+	OriginalAuthorSummary *UserSummary `json:"original_author_summary,omitempty"`
+}
+
 type UpdatePostParams struct {
-	Content string `json:"content" example:"This is example."`
+	Content    string `json:"content" example:"This is example."`
+	Visibility string `json:"visibility" example:"friends"`
+}
+
+func (p UpdatePostParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if err := validateVisibility(p.Visibility); len(err) > 0 {
+		errors["visibility"] = err
+	}
+	return errors
 }
 
 func (p UpdatePostParams) ToBSON() bson.M {
 	m := bson.M{}
 	if len(p.Content) > 0 {
 		m["content"] = p.Content
+		m["tags"] = ExtractTags(p.Content)
+	}
+	if len(p.Visibility) > 0 {
+		m["visibility"] = p.Visibility
 	}
 	m["updated_at"] = time.Now()
 	return m
@@ -45,15 +132,88 @@ func (params CreatePostParams) Validate() map[string]string {
 	if len(params.Content) < minContentLen {
 		errors["content"] = fmt.Sprintf("content length should be at least %d characters", minContentLen)
 	}
+	if err := validateVisibility(params.Visibility); len(err) > 0 {
+		errors["visibility"] = err
+	}
 
 	return errors
 }
+
+// validateVisibility returns why visibility is invalid, or "" if it is valid
+// or unset.
+func validateVisibility(visibility string) string {
+	switch visibility {
+	case "", PostVisibilityPublic, PostVisibilityFriends, PostVisibilityPrivate:
+		return ""
+	}
+	return fmt.Sprintf("visibility should be one of %s, %s or %s", PostVisibilityPublic, PostVisibilityFriends, PostVisibilityPrivate)
+}
+
 func NewPostFromParams(params CreatePostParams) *Post {
 	oid, _ := primitive.ObjectIDFromHex(params.Author)
+	if len(params.Visibility) == 0 {
+		params.Visibility = PostVisibilityPublic
+	}
 
 	return &Post{
-		Content:   params.Content,
-		Author:    oid,
-		CreatedAt: time.Now(),
+		Content:    params.Content,
+		Author:     oid,
+		Kind:       PostKindPost,
+		Tags:       ExtractTags(params.Content),
+		Visibility: params.Visibility,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func (params CreateRepostParams) Validate() map[string]string {
+	errors := map[string]string{}
+
+	if _, err := primitive.ObjectIDFromHex(params.Author); err != nil {
+		errors["author"] = fmt.Sprintf("author %s is invalid", params.Author)
+	}
+	if len(params.Content) > 0 && len(params.Content) < minContentLen {
+		errors["content"] = fmt.Sprintf("content length should be at least %d characters", minContentLen)
+	}
+
+	return errors
+}
+
+// NewRepostFromParams creates a repost of original, or a quote post when
+// params carries content. Reposting a plain repost references the post it
+// reposted instead.
+func NewRepostFromParams(params CreateRepostParams, original *Post) *Post {
+	oid, _ := primitive.ObjectIDFromHex(params.Author)
+	ref := original.ID
+	if original.Kind == PostKindRepost && original.RepostOf != nil {
+		ref = *original.RepostOf
+	}
+	kind := PostKindRepost
+	if len(params.Content) > 0 {
+		kind = PostKindQuote
+	}
+
+	return &Post{
+		Content:    params.Content,
+		Author:     oid,
+		Kind:       kind,
+		RepostOf:   &ref,
+		Tags:       ExtractTags(params.Content),
+		Visibility: PostVisibilityPublic,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// ExtractTags returns the lower-cased, de-duplicated hashtags found in content.
+func ExtractTags(content string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range tagRegex.FindAllStringSubmatch(content, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
 	}
+	return tags
 }
@@ -0,0 +1,186 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	QuietHoursDefer = "defer"
+	QuietHoursDrop  = "drop"
+
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+
+	DefaultTimeZone = "UTC"
+	clockLayout     = "15:04"
+)
+
+// NotifiableEvents are the event types users can set preferences for.
+var NotifiableEvents = []string{EventNewPost, EventRepost, EventComment, EventFriendRequest, EventMention}
+
+// ChannelPreference says where notifications of one event type go. Turning
+// every channel off silences the event.
+type ChannelPreference struct {
+	Push  bool `bson:"push" json:"push" example:"true"`
+	InApp bool `bson:"in_app" json:"in_app" example:"true"`
+	Email bool `bson:"email" json:"email" example:"false"`
+}
+
+// DefaultChannelPreference applies to event types the user has not set.
+var DefaultChannelPreference = ChannelPreference{Push: true, InApp: true}
+
+// QuietHours is a daily window, in the user's time zone, during which pushes
+// are deferred until the window ends or dropped. Start after End wraps past
+// midnight.
+type QuietHours struct {
+	Enabled bool   `bson:"enabled" json:"enabled" example:"true"`
+	Start   string `bson:"start" json:"start" example:"22:00"`
+	End     string `bson:"end" json:"end" example:"07:00"`
+	Action  string `bson:"action" json:"action" example:"defer"`
+}
+
+type NotificationSettings struct {
+	Events     map[string]ChannelPreference `bson:"events" json:"events"`
+	QuietHours QuietHours                   `bson:"quiet_hours" json:"quiet_hours"`
+	// Digest is how often to email a digest of friends' posts to a user who
+	// has not opened the app: daily, weekly or off.
+	Digest string `bson:"digest" json:"digest" example:"daily"`
+}
+
+// DisableEmail turns off every email, as an unsubscribe link does.
+func (s *NotificationSettings) DisableEmail() {
+	if s.Events == nil {
+		s.Events = map[string]ChannelPreference{}
+	}
+	for _, event := range NotifiableEvents {
+		pref, ok := s.Events[event]
+		if !ok {
+			pref = DefaultChannelPreference
+		}
+		pref.Email = false
+		s.Events[event] = pref
+	}
+	s.Digest = DigestOff
+}
+
+func (params NotificationSettings) Validate() map[string]string {
+	errors := map[string]string{}
+	for event := range params.Events {
+		if !isNotifiableEvent(event) {
+			errors["events."+event] = fmt.Sprintf("unknown event type %s", event)
+		}
+	}
+	switch params.Digest {
+	case "", DigestDaily, DigestWeekly, DigestOff:
+	default:
+		errors["digest"] = fmt.Sprintf("digest should be one of %s, %s or %s", DigestDaily, DigestWeekly, DigestOff)
+	}
+	q := params.QuietHours
+	if !q.Enabled {
+		return errors
+	}
+	if _, err := parseClock(q.Start); err != nil {
+		errors["quiet_hours.start"] = "start should be a time like 22:00"
+	}
+	if _, err := parseClock(q.End); err != nil {
+		errors["quiet_hours.end"] = "end should be a time like 07:00"
+	}
+	switch q.Action {
+	case QuietHoursDefer, QuietHoursDrop:
+	default:
+		errors["quiet_hours.action"] = fmt.Sprintf("action should be %s or %s", QuietHoursDefer, QuietHoursDrop)
+	}
+	return errors
+}
+
+// Preference returns the user's channels for events of eventType.
+func (u *User) Preference(eventType string) ChannelPreference {
+	if pref, ok := u.Notifications.Events[eventType]; ok {
+		return pref
+	}
+	return DefaultChannelPreference
+}
+
+// LastSeen returns when the user last opened the app on any device.
+func (u *User) LastSeen() time.Time {
+	var last time.Time
+	for _, device := range u.Devices {
+		if device.LastSeen.After(last) {
+			last = device.LastSeen
+		}
+	}
+	return last
+}
+
+// Location returns the user's time zone, or UTC when it is unset or unknown.
+func (u *User) Location() *time.Location {
+	if len(u.TimeZone) == 0 {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// QuietUntil reports whether now falls in the user's quiet hours and, if so,
+// when they end.
+func (u *User) QuietUntil(now time.Time) (time.Time, bool) {
+	q := u.Notifications.QuietHours
+	if !q.Enabled {
+		return time.Time{}, false
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(q.End)
+	if err != nil || start == end {
+		return time.Time{}, false
+	}
+	local := now.In(u.Location())
+	minute := local.Hour()*60 + local.Minute()
+	quiet := minute >= start && minute < end
+	if start > end {
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, local.Location())
+	if !until.After(local) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, local.Location())
+	}
+	return until, true
+}
+
+// parseClock returns the minutes since midnight of a HH:MM time.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse(clockLayout, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func isNotifiableEvent(eventType string) bool {
+	for _, event := range NotifiableEvents {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTimeZone(tz string) string {
+	if len(tz) == 0 {
+		return ""
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Sprintf("time zone %s is unknown", tz)
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package types_test
+
+import (
+	"github.com/MiladJlz/blog_app/types"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestQuietUntil(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 9, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		timeZone string
+		quiet    types.QuietHours
+		now      time.Time
+		want     time.Time
+	}{
+		{"disabled", "", types.QuietHours{Start: "00:00", End: "23:59", Action: types.QuietHoursDefer}, at(7, 12, 0), time.Time{}},
+		{"within the day, inside", "", types.QuietHours{Enabled: true, Start: "13:00", End: "15:00", Action: types.QuietHoursDefer}, at(7, 14, 30), at(7, 15, 0)},
+		{"within the day, at the start", "", types.QuietHours{Enabled: true, Start: "13:00", End: "15:00", Action: types.QuietHoursDefer}, at(7, 13, 0), at(7, 15, 0)},
+		{"within the day, at the end", "", types.QuietHours{Enabled: true, Start: "13:00", End: "15:00", Action: types.QuietHoursDefer}, at(7, 15, 0), time.Time{}},
+		{"past midnight, in the evening", "", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 23, 30), at(8, 7, 0)},
+		{"past midnight, in the morning", "", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(8, 6, 59), at(8, 7, 0)},
+		{"past midnight, in the afternoon", "", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 12, 0), time.Time{}},
+		{"dropping pushes, same window", "", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDrop}, at(7, 23, 30), at(8, 7, 0)},
+		// 23:00 in Tokyo, nine hours ahead.
+		{"ahead of UTC", "Asia/Tokyo", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 14, 0), at(7, 22, 0)},
+		// 19:30 in New York, four hours behind in September.
+		{"behind UTC, quiet there but not here", "America/New_York", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 23, 30), time.Time{}},
+		// 23:00 in New York the evening before.
+		{"behind UTC, a day earlier there", "America/New_York", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 3, 0), at(7, 11, 0)},
+		{"unknown time zone, as UTC", "Mars/Olympus_Mons", types.QuietHours{Enabled: true, Start: "22:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 23, 0), at(8, 7, 0)},
+		{"empty window", "", types.QuietHours{Enabled: true, Start: "22:00", End: "22:00", Action: types.QuietHoursDefer}, at(7, 22, 0), time.Time{}},
+		{"invalid start", "", types.QuietHours{Enabled: true, Start: "25:00", End: "07:00", Action: types.QuietHoursDefer}, at(7, 3, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &types.User{TimeZone: tt.timeZone}
+			user.Notifications.QuietHours = tt.quiet
+			until, quiet := user.QuietUntil(tt.now)
+			if quiet != !tt.want.IsZero() || !until.Equal(tt.want) {
+				t.Errorf("QuietUntil(%v) = %v, %v, want %v", tt.now, until, quiet, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	SearchTypeAll   = "all"
+	SearchTypePosts = "posts"
+	SearchTypeUsers = "users"
+
+	snippetRadius = 40
+	maxSnippets   = 3
+)
+
+type SearchParams struct {
+	Query  string
+	Type   string
+	Author primitive.ObjectID
+	From   time.Time
+	To     time.Time
+	Page   int64
+	Limit  int64
+	// Viewer decides which posts and users the search may return.
+	Viewer Viewer
+}
+
+func (p SearchParams) Skip() int64 {
+	return (p.Page - 1) * p.Limit
+}
+
+type UserSummary struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	FirstName string             `bson:"firstName" json:"firstName" example:"foo"`
+	LastName  string             `bson:"lastName" json:"lastName" example:"bar"`
+}
+
+type PostHit struct {
+	Post       *Post    `json:"post"`
+	Score      float64  `json:"score" example:"1.5"`
+	Highlights []string `json:"highlights" example:"a <em>golang</em> post"`
+}
+
+type UserHit struct {
+	User       *UserSummary `json:"user"`
+	Score      float64      `json:"score" example:"1.5"`
+	Highlights []string     `json:"highlights" example:"<em>foo</em> bar"`
+}
+
+type SearchResult struct {
+	Query      string     `json:"query" example:"golang"`
+	Page       int64      `json:"page" example:"1"`
+	Limit      int64      `json:"limit" example:"20"`
+	TotalPosts int64      `json:"totalPosts" example:"42"`
+	TotalUsers int64      `json:"totalUsers" example:"3"`
+	Posts      []*PostHit `json:"posts"`
+	Users      []*UserHit `json:"users"`
+}
+
+// arabicToPersian folds Arabic letter forms onto the Persian letters users type,
+// so that "علي" and "علی" match the same term.
+var arabicToPersian = map[rune]rune{
+	'ي': 'ی',
+	'ى': 'ی',
+	'ئ': 'ی',
+	'ك': 'ک',
+	'ة': 'ه',
+	'ۀ': 'ه',
+	'ؤ': 'و',
+	'أ': 'ا',
+	'إ': 'ا',
+	'آ': 'ا',
+	'ٱ': 'ا',
+}
+
+// FoldRune lower-cases r, folds Arabic script variants to Persian and maps
+// Persian and Arabic-Indic digits to ASCII. It reports false for the runes
+// search ignores: diacritics, tatweel and zero-width (non-)joiners.
+func FoldRune(r rune) (rune, bool) {
+	switch {
+	case r >= '۰' && r <= '۹':
+		r = '0' + (r - '۰')
+	case r >= '٠' && r <= '٩':
+		r = '0' + (r - '٠')
+	case r >= '\u064B' && r <= '\u065F', r == '\u0670', r == '\u0640', r == '\u200C', r == '\u200D':
+		return 0, false
+	}
+	if p, ok := arabicToPersian[r]; ok {
+		r = p
+	}
+	return unicode.ToLower(r), true
+}
+
+// SearchTerms splits a query into the folded words used for highlighting.
+func SearchTerms(query string) []string {
+	var folded []rune
+	for _, r := range query {
+		if f, ok := FoldRune(r); ok {
+			folded = append(folded, f)
+		}
+	}
+	fields := strings.FieldsFunc(string(folded), func(r rune) bool {
+		return !isWordRune(r)
+	})
+	terms := []string{}
+	for _, f := range fields {
+		if len(f) > 0 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// Highlight returns up to maxSnippets fragments of text around the given terms,
+// with every matched term wrapped in <em> tags. Text is matched as folded by
+// FoldRune, the way search indexes it, but the fragments show it as written.
+// The fragments are HTML: the text in them is escaped.
+func Highlight(text string, terms []string) []string {
+	runes := []rune(text)
+	// folded holds the runes of text that search sees; at[i] is the index in
+	// runes of folded[i], and at[len(folded)] is len(runes).
+	folded := make([]rune, 0, len(runes))
+	at := make([]int, 0, len(runes)+1)
+	for i, r := range runes {
+		if f, ok := FoldRune(r); ok {
+			folded = append(folded, f)
+			at = append(at, i)
+		}
+	}
+	at = append(at, len(runes))
+	snippets := []string{}
+	covered := -1
+	for i := 0; i < len(folded) && len(snippets) < maxSnippets; i++ {
+		if i <= covered {
+			continue
+		}
+		if matchTerm(folded, i, terms) == 0 {
+			continue
+		}
+		start := max(0, i-snippetRadius)
+		end := min(len(folded), i+snippetRadius)
+		if start <= covered {
+			start = covered + 1
+		}
+		snippets = append(snippets, markTerms(runes, folded, at, start, end, terms))
+		covered = end - 1
+	}
+	return snippets
+}
+
+// markTerms renders folded[start:end] as the runes of text it came from.
+func markTerms(runes, folded []rune, at []int, start, end int, terms []string) string {
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	} else {
+		b.WriteString(html.EscapeString(string(runes[:at[0]])))
+	}
+	for i := start; i < end; {
+		if n := matchTerm(folded, i, terms); n > 0 {
+			b.WriteString("<em>")
+			b.WriteString(html.EscapeString(string(runes[at[i]:at[i+n]])))
+			b.WriteString("</em>")
+			i += n
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[at[i]:at[i+1]])))
+		i++
+	}
+	if end < len(folded) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// matchTerm reports the length of the term starting at a word boundary at i,
+// or 0 when no term matches there.
+func matchTerm(lower []rune, i int, terms []string) int {
+	if i > 0 && isWordRune(lower[i-1]) {
+		return 0
+	}
+	for _, term := range terms {
+		t := []rune(term)
+		if i+len(t) > len(lower) || string(lower[i:i+len(t)]) != term {
+			continue
+		}
+		n := len(t)
+		for i+n < len(lower) && isWordRune(lower[i+n]) {
+			n++
+		}
+		return n
+	}
+	return 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
@@ -0,0 +1,28 @@
+package types_test
+
+import (
+	"github.com/MiladJlz/blog_app/types"
+	"slices"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name, text, query string
+		want              []string
+	}{
+		{"whole words", "Go is fun, ergo", "go", []string{"<em>Go</em> is fun, ergo"}},
+		{"word prefixes", "Learning golang", "go", []string{"Learning <em>golang</em>"}},
+		{"no match", "Nothing here", "go", []string{}},
+		{"escaped text", `<script>alert("go")</script> & go`, "go",
+			[]string{`&lt;script&gt;alert(&#34;<em>go</em>&#34;)&lt;/script&gt; &amp; <em>go</em>`}},
+		{"escaped terms", "Ask about <b>", "b", []string{"Ask about &lt;<em>b</em>&gt;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := types.Highlight(tt.text, types.SearchTerms(tt.query)); !slices.Equal(got, tt.want) {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", tt.text, tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// StreamTokenParams prove who is asking for a stream token.
+type StreamTokenParams struct {
+	Password string `json:"password" example:"verysecurepassword"`
+}
+
+type StreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at" example:"2024-09-07T16:23:33.648Z"`
+}
+
+// StreamNotification is the data of a real-time event, rendered in the
+// recipient's language.
+type StreamNotification struct {
+	Title  string              `json:"title" example:"foo bar published a new post"`
+	Body   string              `json:"body" example:"a golang post"`
+	Link   string              `json:"link" example:"blogapp://post/66db2c856699531daa9abc16"`
+	PostID *primitive.ObjectID `json:"post_id,omitempty" example:"66db2c856699531daa9abc16"`
+	Actor  *UserSummary        `json:"actor,omitempty"`
+}
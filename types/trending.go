@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+type TrendingPost struct {
+	Post  *Post   `json:"post"`
+	Score float64 `json:"score" example:"12.5"`
+}
+
+type TrendingTag struct {
+	Tag   string  `json:"tag" example:"golang"`
+	Score float64 `json:"score" example:"30.2"`
+	Posts int     `json:"posts" example:"4"`
+}
+
+type Trending struct {
+	ComputedAt time.Time       `json:"computed_at" example:"2024-09-06T16:23:33.648Z"`
+	Since      time.Time       `json:"since" example:"2024-09-03T16:23:33.648Z"`
+	Posts      []*TrendingPost `json:"posts"`
+	Tags       []*TrendingTag  `json:"tags"`
+}
@@ -6,6 +6,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 	"regexp"
+	"time"
 )
 
 const (
@@ -15,11 +16,31 @@ const (
 	minPasswordLen  = 7
 )
 
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+	PlatformWeb     = "web"
+)
+
 type UpdateUserParams struct {
 	FirstName string `json:"firstName" example:"foo"`
 	LastName  string `json:"lastName" example:"baz"`
+	Email     string `json:"email" example:"foobaz@gmail.com"`
 	FcmToken  string `json:"fcmToken"`
 	Password  string `json:"password" example:"verysecurepassword"`
+	Language  string `json:"language" example:"fa"`
+	TimeZone  string `json:"timeZone" example:"Asia/Tehran"`
+}
+
+func (p UpdateUserParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(p.Email) > 0 && !isEmailValid(p.Email) {
+		errors["email"] = fmt.Sprintf("email %s is invalid", p.Email)
+	}
+	if err := validateTimeZone(p.TimeZone); len(err) > 0 {
+		errors["timeZone"] = err
+	}
+	return errors
 }
 
 func (p UpdateUserParams) ToBSON() bson.M {
@@ -30,11 +51,22 @@ func (p UpdateUserParams) ToBSON() bson.M {
 	if len(p.LastName) > 0 {
 		m["lastName"] = p.LastName
 	}
+	if len(p.Email) > 0 {
+		// a new address has to be verified again
+		m["email"] = p.Email
+		m["emailVerified"] = false
+	}
 	if len(p.Password) > 0 {
 		encpw, _ := bcrypt.GenerateFromPassword([]byte(p.Password), bcryptCost)
 
 		m["password"] = encpw
 	}
+	if len(p.Language) > 0 {
+		m["language"] = p.Language
+	}
+	if len(p.TimeZone) > 0 {
+		m["timeZone"] = p.TimeZone
+	}
 	return m
 }
 
@@ -44,6 +76,8 @@ type CreateUserParams struct {
 	Email     string `json:"email"`
 	FCMToken  string `json:"fcmToken"`
 	Password  string `json:"password"`
+	Language  string `json:"language"`
+	TimeZone  string `json:"timeZone"`
 }
 
 func (params CreateUserParams) Validate() map[string]string {
@@ -60,6 +94,9 @@ func (params CreateUserParams) Validate() map[string]string {
 	if !isEmailValid(params.Email) {
 		errors["email"] = fmt.Sprintf("email %s is invalid", params.Email)
 	}
+	if err := validateTimeZone(params.TimeZone); len(err) > 0 {
+		errors["timeZone"] = err
+	}
 	return errors
 }
 
@@ -69,16 +106,92 @@ func isEmailValid(e string) bool {
 }
 
 type User struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
-	FirstName string               `bson:"firstName" json:"firstName" example:"foo"`
-	LastName  string               `bson:"lastName" json:"lastName" example:"bar"`
-	Email     string               `bson:"email" json:"email" example:"foobar@gmail.com"`
-	Password  string               `bson:"password" json:"password" example:"verysecurepassword"`
-	FCMToken  string               `bson:"fcmToken" json:"fcMToken"`
-	Friends   []primitive.ObjectID `bson:"friends" json:"friends" example:"[66db2c856699531daa9abc16,9bdb2c85156699531daa9abc7]"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	FirstName string             `bson:"firstName" json:"firstName" example:"foo"`
+	LastName  string             `bson:"lastName" json:"lastName" example:"bar"`
+	Email     string             `bson:"email" json:"email" example:"foobar@gmail.com"`
+	// EmailVerified is set once the user follows the link sent to Email.
+	EmailVerified bool                 `bson:"emailVerified" json:"emailVerified" example:"true"`
+	Password      string               `bson:"password" json:"password" example:"verysecurepassword"`
+	FCMToken      string               `bson:"fcmToken" json:"fcMToken"`
+	Language      string               `bson:"language" json:"language" example:"en"`
+	TimeZone      string               `bson:"timeZone" json:"timeZone" example:"Asia/Tehran"`
+	Devices       []Device             `bson:"devices" json:"devices"`
+	Friends       []primitive.ObjectID `bson:"friends" json:"friends" example:"[66db2c856699531daa9abc16,9bdb2c85156699531daa9abc7]"`
+	// Blocked holds the users this user blocks. Blocking goes both ways:
+	// neither sees the other's posts or finds the other in search.
+	Blocked []primitive.ObjectID `bson:"blocked" json:"blocked" example:"[66db2c856699531daa9abc16]"`
+
+	Notifications NotificationSettings `bson:"notifications" json:"notifications"`
+	LastDigestAt  time.Time            `bson:"last_digest_at" json:"-"`
+	// Version starts at 1 and goes up with every change clients can see. It
+	// is served as the user's ETag.
+	Version int64 `bson:"version" json:"version" example:"1"`
+}
+
+// DeviceTokens returns the push tokens of all of the user's devices,
+// including the token set on the user before devices were tracked.
+func (u *User) DeviceTokens() []string {
+	tokens := make([]string, 0, len(u.Devices)+1)
+	legacy := len(u.FCMToken) > 0
+	for _, device := range u.Devices {
+		tokens = append(tokens, device.Token)
+		if device.Token == u.FCMToken {
+			legacy = false
+		}
+	}
+	if legacy {
+		tokens = append(tokens, u.FCMToken)
+	}
+	return tokens
+}
+
+type Device struct {
+	Token      string    `bson:"token" json:"token" example:"fcm-registration-token"`
+	Platform   string    `bson:"platform" json:"platform" example:"android"`
+	AppVersion string    `bson:"app_version" json:"app_version" example:"1.4.2"`
+	LastSeen   time.Time `bson:"last_seen" json:"last_seen" example:"2024-09-06T16:23:33.648Z"`
+}
+
+type RegisterDeviceParams struct {
+	Token      string `json:"token" example:"fcm-registration-token"`
+	Platform   string `json:"platform" example:"android"`
+	AppVersion string `json:"app_version" example:"1.4.2"`
+}
+
+type RemoveDeviceParams struct {
+	Token string `json:"token" example:"fcm-registration-token"`
+}
+
+func (params RegisterDeviceParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.Token) == 0 {
+		errors["token"] = "token is required"
+	}
+	switch params.Platform {
+	case PlatformAndroid, PlatformIOS, PlatformWeb:
+	default:
+		errors["platform"] = fmt.Sprintf("platform should be one of %s, %s or %s", PlatformAndroid, PlatformIOS, PlatformWeb)
+	}
+	return errors
+}
+
+func NewDeviceFromParams(params RegisterDeviceParams) Device {
+	return Device{
+		Token:      params.Token,
+		Platform:   params.Platform,
+		AppVersion: params.AppVersion,
+		LastSeen:   time.Now(),
+	}
 }
 
 func NewUserFromParams(params CreateUserParams) (*User, error) {
+	if len(params.Language) == 0 {
+		params.Language = DefaultLanguage
+	}
+	if len(params.TimeZone) == 0 {
+		params.TimeZone = DefaultTimeZone
+	}
 	encpw, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcryptCost)
 	if err != nil {
 		return nil, err
@@ -89,10 +202,80 @@ func NewUserFromParams(params CreateUserParams) (*User, error) {
 		Email:     params.Email,
 		Password:  string(encpw),
 		FCMToken:  params.FCMToken,
+		Language:  params.Language,
+		TimeZone:  params.TimeZone,
+		Devices:   []Device{},
 		Friends:   []primitive.ObjectID{},
+		Blocked:   []primitive.ObjectID{},
+		Notifications: NotificationSettings{
+			Events: map[string]ChannelPreference{},
+			Digest: DigestDaily,
+		},
+		LastDigestAt: time.Now(),
 	}, nil
 }
 
+// ImportUserParams describe an author brought over from another platform.
+type ImportUserParams struct {
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+func (params ImportUserParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if !isEmailValid(params.Email) {
+		errors["email"] = fmt.Sprintf("email %s is invalid", params.Email)
+	}
+	return errors
+}
+
+// NewUserFromImport creates an imported user with the defaults of a new
+// account. They have no password until they set one with a password reset.
+func NewUserFromImport(params ImportUserParams) *User {
+	return &User{
+		FirstName: params.FirstName,
+		LastName:  params.LastName,
+		Email:     params.Email,
+		Language:  DefaultLanguage,
+		TimeZone:  DefaultTimeZone,
+		Devices:   []Device{},
+		Friends:   []primitive.ObjectID{},
+		Blocked:   []primitive.ObjectID{},
+		Notifications: NotificationSettings{
+			Events: map[string]ChannelPreference{},
+			Digest: DigestDaily,
+		},
+		LastDigestAt: time.Now(),
+	}
+}
+
+// IsValidPassword reports whether password is the user's. Users without a
+// password, such as imported ones, match none.
+func (u *User) IsValidPassword(password string) bool {
+	return len(u.Password) > 0 && bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+type PasswordResetRequestParams struct {
+	Email string `json:"email" example:"foobar@gmail.com"`
+}
+
+type PasswordResetParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password" example:"verysecurepassword"`
+}
+
+func (params PasswordResetParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.Token) == 0 {
+		errors["token"] = "token is required"
+	}
+	if len(params.Password) < minPasswordLen {
+		errors["password"] = fmt.Sprintf("password length should be at least %d characters", minPasswordLen)
+	}
+	return errors
+}
+
 type AddFriendParam struct {
 	UserID string `json:"userID"`
 }
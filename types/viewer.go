@@ -0,0 +1,39 @@
+package types
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+)
+
+// Viewer is the user posts and search results are shown to. The zero Viewer
+// is an anonymous reader, who sees public posts only.
+type Viewer struct {
+	ID primitive.ObjectID
+	// FriendOf holds the users who list the viewer as a friend, whose
+	// friends-only posts the viewer sees.
+	FriendOf []primitive.ObjectID
+	// Hidden holds the users the viewer blocks or is blocked by.
+	Hidden []primitive.ObjectID
+}
+
+// CanSee reports whether the viewer may read post.
+func (v Viewer) CanSee(post *Post) bool {
+	if slices.Contains(v.Hidden, post.Author) {
+		return false
+	}
+	if !v.ID.IsZero() && post.Author == v.ID {
+		return true
+	}
+	switch post.Visibility {
+	case PostVisibilityFriends:
+		return slices.Contains(v.FriendOf, post.Author)
+	case PostVisibilityPrivate:
+		return false
+	}
+	return true
+}
+
+// CanSeeUser reports whether the user shows in the viewer's search results.
+func (v Viewer) CanSeeUser(id primitive.ObjectID) bool {
+	return !slices.Contains(v.Hidden, id)
+}
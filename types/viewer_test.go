@@ -0,0 +1,39 @@
+package types_test
+
+import (
+	"github.com/MiladJlz/blog_app/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestViewerCanSee(t *testing.T) {
+	var (
+		author   = primitive.NewObjectID()
+		reader   = primitive.NewObjectID()
+		friendOf = []primitive.ObjectID{author}
+		hidden   = []primitive.ObjectID{author}
+	)
+	tests := []struct {
+		name       string
+		viewer     types.Viewer
+		visibility string
+		want       bool
+	}{
+		{"anonymous, public", types.Viewer{}, types.PostVisibilityPublic, true},
+		{"anonymous, unset", types.Viewer{}, "", true},
+		{"anonymous, friends", types.Viewer{}, types.PostVisibilityFriends, false},
+		{"stranger, friends", types.Viewer{ID: reader}, types.PostVisibilityFriends, false},
+		{"friend, friends", types.Viewer{ID: reader, FriendOf: friendOf}, types.PostVisibilityFriends, true},
+		{"friend, private", types.Viewer{ID: reader, FriendOf: friendOf}, types.PostVisibilityPrivate, false},
+		{"author, private", types.Viewer{ID: author}, types.PostVisibilityPrivate, true},
+		{"blocked, public", types.Viewer{ID: reader, FriendOf: friendOf, Hidden: hidden}, types.PostVisibilityPublic, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &types.Post{Author: author, Visibility: tt.visibility}
+			if got := tt.viewer.CanSee(post); got != tt.want {
+				t.Errorf("CanSee(%q post) = %v, want %v", tt.visibility, got, tt.want)
+			}
+		})
+	}
+}
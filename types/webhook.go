@@ -0,0 +1,165 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
+	"time"
+)
+
+const (
+	WebhookPostCreated = "post.created"
+	WebhookPostUpdated = "post.updated"
+	WebhookPostDeleted = "post.deleted"
+	WebhookUserCreated = "user.created"
+	WebhookUserUpdated = "user.updated"
+	WebhookUserDeleted = "user.deleted"
+	// WebhookAllEvents subscribes a webhook to every event.
+	WebhookAllEvents = "*"
+
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+var WebhookEvents = []string{
+	WebhookPostCreated, WebhookPostUpdated, WebhookPostDeleted,
+	WebhookUserCreated, WebhookUserUpdated, WebhookUserDeleted,
+}
+
+type Webhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	URL    string             `bson:"url" json:"url" example:"https://example.com/hooks/blog"`
+	Secret string             `bson:"secret" json:"-"`
+	Events []string           `bson:"events" json:"events" example:"post.created,post.deleted"`
+	Active bool               `bson:"active" json:"active" example:"true"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+// WebhookWithSecret is returned once, when a webhook is created, so the
+// receiver can check signatures.
+type WebhookWithSecret struct {
+	*Webhook
+	Secret string `json:"secret" example:"5f0c8e2a..."`
+}
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	ID        string          `json:"id" example:"66db2c856699531daa9abc16"`
+	Event     string          `json:"event" example:"post.created"`
+	CreatedAt time.Time       `json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at" example:"2024-09-06T16:23:33.648Z"`
+	StatusCode int       `bson:"status_code" json:"status_code" example:"500"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty" example:"unexpected status 500"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms" example:"120"`
+}
+
+// WebhookDelivery is one payload sent to one webhook, with every attempt to
+// deliver it.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"66db2c856699531daa9abc16"`
+	Webhook   primitive.ObjectID `bson:"webhook" json:"webhook" example:"66db2c856699531daa9abc16"`
+	Event     string             `bson:"event" json:"event" example:"post.created"`
+	Payload   string             `bson:"payload" json:"payload" example:"{\"id\":\"...\",\"event\":\"post.created\"}"`
+	Status    string             `bson:"status" json:"status" example:"succeeded"`
+	Attempts  []DeliveryAttempt  `bson:"attempts" json:"attempts"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at" example:"2024-09-06T16:23:33.648Z"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at" example:"2024-09-06T16:23:33.648Z"`
+}
+
+type CreateWebhookParams struct {
+	URL    string   `json:"url" example:"https://example.com/hooks/blog"`
+	Events []string `json:"events" example:"post.created,post.deleted"`
+	// Secret signs payloads; one is generated when it is empty.
+	Secret string `json:"secret"`
+}
+
+type UpdateWebhookParams struct {
+	URL    string   `json:"url" example:"https://example.com/hooks/blog"`
+	Events []string `json:"events" example:"post.created"`
+	Active *bool    `json:"active" example:"false"`
+}
+
+func (params CreateWebhookParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if err := validateWebhookURL(params.URL); len(err) > 0 {
+		errors["url"] = err
+	}
+	if len(params.Events) == 0 {
+		errors["events"] = "at least one event is required"
+	} else if err := validateWebhookEvents(params.Events); len(err) > 0 {
+		errors["events"] = err
+	}
+	return errors
+}
+
+func (params UpdateWebhookParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.URL) > 0 {
+		if err := validateWebhookURL(params.URL); len(err) > 0 {
+			errors["url"] = err
+		}
+	}
+	if err := validateWebhookEvents(params.Events); len(err) > 0 {
+		errors["events"] = err
+	}
+	return errors
+}
+
+func (params UpdateWebhookParams) ToBSON() bson.M {
+	m := bson.M{"updated_at": time.Now()}
+	if len(params.URL) > 0 {
+		m["url"] = params.URL
+	}
+	if len(params.Events) > 0 {
+		m["events"] = params.Events
+	}
+	if params.Active != nil {
+		m["active"] = *params.Active
+	}
+	return m
+}
+
+func NewWebhookFromParams(params CreateWebhookParams, secret string) *Webhook {
+	now := time.Now()
+	return &Webhook{
+		URL:       params.URL,
+		Secret:    secret,
+		Events:    params.Events,
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func validateWebhookURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Sprintf("url %s should be an absolute http or https URL", value)
+	}
+	return ""
+}
+
+func validateWebhookEvents(events []string) string {
+	for _, event := range events {
+		if event == WebhookAllEvents {
+			continue
+		}
+		known := false
+		for _, e := range WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return fmt.Sprintf("unknown event %s", event)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/types"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// JobFanOut creates a delivery for every webhook subscribed to an event.
+	JobFanOut = "webhook.fan_out"
+	// JobDeliver posts one delivery; the queue retries it with backoff.
+	JobDeliver = "webhook.deliver"
+
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256, keyed by the
+	// webhook's secret, of the timestamp header, a dot and the body.
+	SignatureHeader = "X-Webhook-Signature"
+
+	deliveryTimeout = 10 * time.Second
+	// maxErrorBody is how much of a failed response is kept in the log.
+	maxErrorBody = 512
+)
+
+// Publish queues event for every webhook subscribed to it. data is captured
+// now, so a deleted resource can still be described.
+func Publish(ctx context.Context, jobs queue.Enqueuer, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload := map[string]string{
+		"event": event,
+		"data":  string(b),
+		"at":    time.Now().Format(time.RFC3339Nano),
+	}
+	_, err = jobs.Enqueue(ctx, JobFanOut, payload)
+	return err
+}
+
+// Sign returns the signature header value for body sent at timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher runs the webhook jobs queued by Publish.
+type Dispatcher struct {
+	webhookStore db.WebhookStore
+	jobs         queue.Scheduler
+	client       *http.Client
+}
+
+func NewDispatcher(webhookStore db.WebhookStore, jobs queue.Scheduler) *Dispatcher {
+	return &Dispatcher{
+		webhookStore: webhookStore,
+		jobs:         jobs,
+		client:       &http.Client{Timeout: deliveryTimeout},
+	}
+}
+
+// HandleFanOut records a delivery of the payload's event for every subscribed
+// webhook and queues each one, so a slow endpoint only delays its own. Each
+// delivery is keyed by the job and webhook, so a retried fan-out neither
+// records nor sends one twice.
+func (d *Dispatcher) HandleFanOut(ctx context.Context, job *types.Job) error {
+	event := job.Payload["event"]
+	webhooks, err := d.webhookStore.GetWebhooksForEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, job.Payload["at"])
+	if err != nil {
+		return fmt.Errorf("webhook event time: %w", err)
+	}
+	body, err := json.Marshal(types.WebhookPayload{
+		ID:        job.ID.Hex(),
+		Event:     event,
+		CreatedAt: at,
+		Data:      json.RawMessage(job.Payload["data"]),
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, webhook := range webhooks {
+		key := job.ID.Hex() + "/" + webhook.ID.Hex()
+		delivery := &types.WebhookDelivery{
+			ID:        queue.KeyID(key),
+			Webhook:   webhook.ID,
+			Event:     event,
+			Payload:   string(body),
+			Status:    types.DeliveryPending,
+			Attempts:  []types.DeliveryAttempt{},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if _, err := d.webhookStore.InsertDelivery(ctx, delivery); err != nil && !errors.Is(err, db.ErrConflict) {
+			return err
+		}
+		if _, err := d.jobs.EnqueueOnce(ctx, key, JobDeliver, map[string]string{"delivery": delivery.ID.Hex()}, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleDeliver sends the payload's delivery and logs the attempt. A failed
+// attempt fails the job, which the queue then retries with backoff.
+func (d *Dispatcher) HandleDeliver(ctx context.Context, job *types.Job) error {
+	delivery, err := d.webhookStore.GetDelivery(ctx, job.Payload["delivery"])
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delivery.Status == types.DeliverySucceeded {
+		return nil
+	}
+	webhook, err := d.webhookStore.GetWebhook(ctx, delivery.Webhook.Hex())
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	attempt := d.post(ctx, webhook, delivery)
+	status := types.DeliverySucceeded
+	if len(attempt.Error) > 0 {
+		status = types.DeliveryFailed
+	}
+	if err := d.webhookStore.RecordAttempt(ctx, delivery.ID, status, attempt); err != nil {
+		return err
+	}
+	if status == types.DeliveryFailed {
+		return errors.New(attempt.Error)
+	}
+	return nil
+}
+
+// post sends the delivery's payload to the webhook and describes how it went.
+// Any status other than 2xx is a failure.
+func (d *Dispatcher) post(ctx context.Context, webhook *types.Webhook, delivery *types.WebhookDelivery) (attempt types.DeliveryAttempt) {
+	start := time.Now()
+	attempt.At = start
+	defer func() {
+		attempt.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blog_app-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		attempt.Error = fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	return attempt
+}
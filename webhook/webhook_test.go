@@ -0,0 +1,207 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/MiladJlz/blog_app/db"
+	"github.com/MiladJlz/blog_app/queue"
+	"github.com/MiladJlz/blog_app/types"
+	"github.com/MiladJlz/blog_app/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	got := webhook.Sign("secret", "1725726213", []byte(`{"event":"post.created"}`))
+	want := "sha256=442223dfd6ea4da034ced54d17c02c6173b588e5a9b907e7b8410ebe226ef392"
+	if got != want {
+		t.Errorf("Sign: got %s, want %s", got, want)
+	}
+}
+
+// receiver is a webhook endpoint that answers with status and records what
+// it was sent.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		w.WriteHeader(r.status)
+		io.WriteString(w, "  receiver says no  ")
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+type fixture struct {
+	webhooks   db.WebhookStore
+	jobs       db.JobStore
+	queue      *queue.Queue
+	dispatcher *webhook.Dispatcher
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	sqlDB, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	f := &fixture{
+		webhooks: db.NewSQLiteWebhookStore(sqlDB),
+		jobs:     db.NewSQLiteJobStore(sqlDB),
+	}
+	f.queue = queue.NewQueue(f.jobs, queue.DefaultConfig())
+	f.dispatcher = webhook.NewDispatcher(f.webhooks, f.queue)
+	f.queue.Register(webhook.JobFanOut, f.dispatcher.HandleFanOut)
+	f.queue.Register(webhook.JobDeliver, f.dispatcher.HandleDeliver)
+	return f
+}
+
+func (f *fixture) insertWebhook(t *testing.T, url string, events ...string) *types.Webhook {
+	t.Helper()
+	hook, err := f.webhooks.InsertWebhook(context.Background(), types.NewWebhookFromParams(types.CreateWebhookParams{URL: url, Events: events}, "secret"))
+	if err != nil {
+		t.Fatalf("InsertWebhook: %v", err)
+	}
+	return hook
+}
+
+func (f *fixture) deliveries(t *testing.T, hook *types.Webhook) []*types.WebhookDelivery {
+	t.Helper()
+	deliveries, err := f.webhooks.GetDeliveries(context.Background(), hook.ID.Hex(), 1, 10)
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+func TestFanOut(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	created, all, deleted := newReceiver(t), newReceiver(t), newReceiver(t)
+	createdHook := f.insertWebhook(t, created.URL, types.WebhookPostCreated)
+	allHook := f.insertWebhook(t, all.URL, types.WebhookAllEvents)
+	f.insertWebhook(t, deleted.URL, types.WebhookPostDeleted)
+
+	if err := webhook.Publish(ctx, f.queue, types.WebhookPostCreated, map[string]string{"content": "Fresh post"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	jobs, err := f.jobs.GetJobs(ctx, types.JobStatusPending, 1, 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("GetJobs: got %d jobs and error %v, want the fan-out", len(jobs), err)
+	}
+	// A retried fan-out must not deliver twice.
+	for range 2 {
+		if err := f.dispatcher.HandleFanOut(ctx, jobs[0]); err != nil {
+			t.Fatalf("HandleFanOut: %v", err)
+		}
+	}
+	for {
+		found, err := f.queue.RunOnce(ctx)
+		if err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+		if !found {
+			break
+		}
+	}
+
+	if got := deleted.received(); got != 0 {
+		t.Errorf("webhook for another event: got %d requests, want none", got)
+	}
+	for _, tc := range []struct {
+		name     string
+		receiver *receiver
+		hook     *types.Webhook
+	}{
+		{"subscribed", created, createdHook},
+		{"catch-all", all, allHook},
+	} {
+		if got := tc.receiver.received(); got != 1 {
+			t.Errorf("%s webhook: got %d requests, want 1", tc.name, got)
+			continue
+		}
+		req, body := tc.receiver.requests[0], tc.receiver.bodies[0]
+		if want := webhook.Sign("secret", req.Header.Get(webhook.TimestampHeader), []byte(body)); req.Header.Get(webhook.SignatureHeader) != want {
+			t.Errorf("%s webhook: signature %s, want %s", tc.name, req.Header.Get(webhook.SignatureHeader), want)
+		}
+		if req.Header.Get(webhook.EventHeader) != types.WebhookPostCreated || !strings.Contains(body, `"content":"Fresh post"`) {
+			t.Errorf("%s webhook: got event %s with body %s", tc.name, req.Header.Get(webhook.EventHeader), body)
+		}
+		deliveries := f.deliveries(t, tc.hook)
+		if len(deliveries) != 1 || deliveries[0].Status != types.DeliverySucceeded || req.Header.Get(webhook.DeliveryHeader) != deliveries[0].ID.Hex() {
+			t.Errorf("%s webhook: got deliveries %+v, want the one sent", tc.name, deliveries)
+		}
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	r := newReceiver(t)
+	r.setStatus(http.StatusInternalServerError)
+	hook := f.insertWebhook(t, r.URL, types.WebhookAllEvents)
+	delivery, err := f.webhooks.InsertDelivery(ctx, &types.WebhookDelivery{
+		Webhook:   hook.ID,
+		Event:     types.WebhookPostDeleted,
+		Payload:   `{"event":"post.deleted"}`,
+		Status:    types.DeliveryPending,
+		Attempts:  []types.DeliveryAttempt{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("InsertDelivery: %v", err)
+	}
+	job := &types.Job{Type: webhook.JobDeliver, Payload: map[string]string{"delivery": delivery.ID.Hex()}}
+
+	if err := f.dispatcher.HandleDeliver(ctx, job); err == nil || !strings.Contains(err.Error(), "unexpected status 500: receiver says no") {
+		t.Errorf("HandleDeliver to a failing webhook: got error %v, want the status and body", err)
+	}
+	got := f.deliveries(t, hook)[0]
+	if got.Status != types.DeliveryFailed || len(got.Attempts) != 1 || got.Attempts[0].StatusCode != http.StatusInternalServerError {
+		t.Errorf("after a failed attempt: got status %s with attempts %+v", got.Status, got.Attempts)
+	}
+
+	r.setStatus(http.StatusNoContent)
+	if err := f.dispatcher.HandleDeliver(ctx, job); err != nil {
+		t.Errorf("HandleDeliver on retry: %v", err)
+	}
+	got = f.deliveries(t, hook)[0]
+	if got.Status != types.DeliverySucceeded || len(got.Attempts) != 2 || len(got.Attempts[1].Error) != 0 {
+		t.Errorf("after a retry: got status %s with attempts %+v", got.Status, got.Attempts)
+	}
+	// A delivered payload is not sent again.
+	if err := f.dispatcher.HandleDeliver(ctx, job); err != nil || r.received() != 2 {
+		t.Errorf("HandleDeliver of a sent delivery: got error %v after %d requests, want 2", err, r.received())
+	}
+}